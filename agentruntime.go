@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/habiliai/agentruntime/config"
@@ -15,6 +16,7 @@ import (
 	"github.com/habiliai/agentruntime/knowledge"
 	"github.com/habiliai/agentruntime/memory"
 	"github.com/habiliai/agentruntime/tool"
+	"github.com/samber/lo"
 )
 
 type (
@@ -30,6 +32,9 @@ type (
 		knowledgeConfig *config.KnowledgeConfig
 		logConfig       *config.LogConfig
 		memoryConfig    *config.MemoryConfig
+
+		// closers close the services created by the runtime
+		closers []func() error
 	}
 	Option func(*AgentRuntime)
 )
@@ -52,6 +57,12 @@ func (r *AgentRuntime) Run(ctx context.Context, req engine.RunRequest, streamCal
 
 func (r *AgentRuntime) Close() {
 	r.toolManager.Close()
+	r.engine.Close()
+	for _, closer := range r.closers {
+		if err := closer(); err != nil {
+			r.logger.Warn("failed to close runtime service", "error", err)
+		}
+	}
 }
 
 func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime, error) {
@@ -83,16 +94,26 @@ func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime,
 	}
 
 	if e.knowledgeService == nil {
-		e.knowledgeService, err = knowledge.NewServiceWithStore(ctx, e.knowledgeConfig, e.modelConfig, e.logger, knowledge.NewInMemoryStore())
+		e.knowledgeService, err = knowledge.NewService(ctx, e.modelConfig, e.knowledgeConfig, e.logger)
 		if err != nil {
 			return nil, err
 		}
+		e.closers = append(e.closers, e.knowledgeService.Close)
 	}
 
 	if e.memoryService == nil {
-		e.memoryService, err = memory.NewService(ctx, e.modelConfig, e.memoryConfig, e.logger)
+		memoryService, err := memory.NewService(ctx, e.modelConfig, e.memoryConfig, e.logger)
 		if err != nil {
-			return nil, err
+			usesMemory := lo.ContainsBy(e.agent.Skills, func(skill entity.AgentSkillUnion) bool {
+				return skill.Type == "nativeTool" && skill.OfNative != nil && skill.OfNative.Name == "memory"
+			})
+			if usesMemory {
+				return nil, err
+			}
+			e.logger.Warn("memory service is unavailable - agent will work without memory", "error", err)
+		} else {
+			e.memoryService = memoryService
+			e.closers = append(e.closers, memoryService.Close)
 		}
 	}
 
@@ -111,6 +132,14 @@ func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime,
 			// Continue without failing agent creation
 		}
 	}
+	for i, source := range e.agent.KnowledgeSources {
+		if err := e.indexKnowledgeSource(ctx, i, source); err != nil {
+			e.logger.Warn("failed to index knowledge source for agent - agent will work without it",
+				"agent", e.agent.Name,
+				"source", knowledgeSourceID(e.agent.Name, i, source),
+				"error", err)
+		}
+	}
 
 	// Create engine with conversation summarizer if configured
 	if e.modelConfig.ConversationSummary.MaxTokens > 0 {
@@ -136,10 +165,82 @@ func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime,
 			g,
 		)
 	}
+	if e.memoryService != nil {
+		e.engine.SetMemoryService(e.memoryService, e.memoryConfig)
+	}
 
 	return e, nil
 }
 
+// indexKnowledgeSource indexes the files and inline maps of a knowledge source
+// under its stable knowledge ID, or imports its snapshot
+func (r *AgentRuntime) indexKnowledgeSource(ctx context.Context, i int, source entity.KnowledgeSource) error {
+	knowledgeId := knowledgeSourceID(r.agent.Name, i, source)
+
+	switch {
+	case source.Path != "" && len(source.Items) > 0:
+		return fmt.Errorf("knowledge source %s has both path and items", knowledgeId)
+	case source.Snapshot != "" && (source.Path != "" || len(source.Items) > 0):
+		return fmt.Errorf("knowledge source %s has a snapshot and a path or items", knowledgeId)
+	case source.Snapshot != "":
+		return r.importKnowledgeSnapshot(ctx, source)
+	case len(source.Items) > 0:
+		_, err := r.knowledgeService.IndexKnowledgeFromMap(ctx, knowledgeId, source.Items)
+		return err
+	case source.Path != "":
+		paths, err := knowledge.ResolvePaths(source.Path)
+		if err != nil {
+			return err
+		}
+		_, err = r.knowledgeService.IndexKnowledgeFromFiles(ctx, knowledgeId, paths, knowledge.LoaderOptions{
+			Type: source.Type,
+			RecordOptions: knowledge.RecordOptions{
+				TextFields:     source.TextFields,
+				MetadataFields: source.MetadataFields,
+			},
+		})
+		return err
+	default:
+		return fmt.Errorf("knowledge source %s has neither path, items nor snapshot", knowledgeId)
+	}
+}
+
+// importKnowledgeSnapshot imports the snapshot of a knowledge source, replacing
+// the stored knowledge. Documents embedded as configured keep their embeddings.
+func (r *AgentRuntime) importKnowledgeSnapshot(ctx context.Context, source entity.KnowledgeSource) error {
+	f, err := os.Open(source.Snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to open knowledge snapshot: %w", err)
+	}
+	defer f.Close()
+
+	opts := knowledge.SnapshotImportOptions{Overwrite: true}
+	if source.ID != "" {
+		opts.KnowledgeIds = []string{source.ID}
+	}
+	result, err := r.knowledgeService.ImportSnapshot(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+	if len(result.Imported) == 0 {
+		return fmt.Errorf("knowledge snapshot %s has no knowledge to import", source.Snapshot)
+	}
+
+	r.logger.Info("imported knowledge snapshot",
+		"snapshot", source.Snapshot,
+		"knowledge_ids", result.Imported,
+		"embedded", result.Embedded)
+	return nil
+}
+
+// knowledgeSourceID returns the knowledge ID of the i-th knowledge source of an agent
+func knowledgeSourceID(agentName string, i int, source entity.KnowledgeSource) string {
+	if source.ID != "" {
+		return source.ID
+	}
+	return fmt.Sprintf("%s-knowledge-%d", agentName, i+1)
+}
+
 func (r *AgentRuntime) GetToolManager() tool.Manager {
 	return r.toolManager
 }
@@ -200,12 +301,27 @@ func WithKnowledgeService(knowledgeService knowledge.Service) func(e *AgentRunti
 	}
 }
 
+// WithKnowledgeConfig sets the knowledge configuration used when the runtime
+// creates its knowledge service, including the store knowledge is kept in
+func WithKnowledgeConfig(knowledgeConfig *config.KnowledgeConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.knowledgeConfig = knowledgeConfig
+	}
+}
+
 func WithMemoryService(memoryService memory.Service) func(e *AgentRuntime) {
 	return func(e *AgentRuntime) {
 		e.memoryService = memoryService
 	}
 }
 
+// WithMemoryConfig sets the memory configuration used when the runtime creates its memory service
+func WithMemoryConfig(memoryConfig *config.MemoryConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.memoryConfig = memoryConfig
+	}
+}
+
 // WithConversationSummary sets the conversation summarization configuration
 func WithConversationSummary(summaryConfig config.ConversationSummaryConfig) func(e *AgentRuntime) {
 	return func(e *AgentRuntime) {
@@ -444,3 +444,153 @@ func TestAgentWithRAGAndPDFKnowledge(t *testing.T) {
 
 	require.True(t, strings.Contains(out, "Solana"), "Output should contain `Solana`")
 }
+
+func TestAgentRuntimeWithKnowledgeSources(t *testing.T) {
+	ctx := t.Context()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/guide.md", []byte("# Guide\n\nInstall the runtime with brew."), 0o644))
+	require.NoError(t, os.Mkdir(dir+"/faq", 0o755))
+	require.NoError(t, os.WriteFile(dir+"/faq/faq.csv", []byte("question,answer\nIs it free?,\"Yes, it is open source.\"\n"), 0o644))
+
+	var agent entity.Agent
+	require.NoError(t, yaml.Unmarshal([]byte(`
+name: helper
+knowledgeSources:
+  - id: docs
+    path: `+dir+`/*.md
+  - path: `+dir+`/faq
+    type: csv
+    textFields: [question, answer]
+  - items:
+      - title: Office hours
+        content: The team answers questions on weekdays.
+`), &agent))
+	require.Len(t, agent.KnowledgeSources, 3)
+
+	knowledgeConfig := config.NewKnowledgeConfig()
+	knowledgeConfig.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	knowledgeConfig.SqlitePath = ":memory:"
+	knowledgeConfig.RerankEnabled = false
+	knowledgeService, err := knowledge.NewService(ctx, &config.ModelConfig{}, knowledgeConfig, logger)
+	require.NoError(t, err)
+	defer knowledgeService.Close()
+
+	runtime, err := agentruntime.NewAgentRuntime(ctx,
+		agentruntime.WithAgent(agent),
+		agentruntime.WithKnowledgeService(knowledgeService),
+		agentruntime.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	docs, err := knowledgeService.GetKnowledge(ctx, "docs")
+	require.NoError(t, err)
+	require.NotNil(t, docs)
+	require.Len(t, docs.Documents, 1)
+	require.Equal(t, "guide.md", docs.Documents[0].Metadata[knowledge.MetadataKeySourceFilename])
+
+	faq, err := knowledgeService.GetKnowledge(ctx, "helper-knowledge-2")
+	require.NoError(t, err)
+	require.NotNil(t, faq)
+	require.Len(t, faq.Documents, 1)
+	require.Equal(t, "Is it free? Yes, it is open source.", faq.Documents[0].EmbeddingText)
+
+	items, err := knowledgeService.GetKnowledge(ctx, "helper-knowledge-3")
+	require.NoError(t, err)
+	require.NotNil(t, items)
+	require.Len(t, items.Documents, 1)
+}
+
+func TestAgentRuntimeWithKnowledgeConfig(t *testing.T) {
+	ctx := t.Context()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/guide.md", []byte("# Guide\n\nInstall the runtime with brew."), 0o644))
+
+	var agent entity.Agent
+	require.NoError(t, yaml.Unmarshal([]byte(`
+name: helper
+knowledgeSources:
+  - id: docs
+    path: `+dir+`/guide.md
+`), &agent))
+
+	knowledgeConfig := config.NewKnowledgeConfig()
+	knowledgeConfig.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	knowledgeConfig.SqlitePath = ":memory:"
+	knowledgeConfig.RerankEnabled = false
+	knowledgeConfig.SqlitePath = dir + "/knowledge.db"
+
+	runtime, err := agentruntime.NewAgentRuntime(ctx,
+		agentruntime.WithAgent(agent),
+		agentruntime.WithKnowledgeConfig(knowledgeConfig),
+		agentruntime.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	runtime.Close()
+
+	// The knowledge indexed by the runtime is kept in the configured database
+	knowledgeService, err := knowledge.NewService(ctx, &config.ModelConfig{}, knowledgeConfig, logger)
+	require.NoError(t, err)
+	defer knowledgeService.Close()
+
+	docs, err := knowledgeService.GetKnowledge(ctx, "docs")
+	require.NoError(t, err)
+	require.Len(t, docs.Documents, 1)
+}
+
+func TestAgentRuntimeWithKnowledgeSnapshot(t *testing.T) {
+	ctx := t.Context()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+
+	knowledgeConfig := config.NewKnowledgeConfig()
+	knowledgeConfig.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	knowledgeConfig.SqlitePath = ":memory:"
+	knowledgeConfig.RerankEnabled = false
+
+	// Index once and export the snapshot, as a CI job would
+	indexer, err := knowledge.NewService(ctx, &config.ModelConfig{}, knowledgeConfig, logger)
+	require.NoError(t, err)
+	_, err = indexer.IndexKnowledgeFromText(ctx, "manual", []string{"Reset the device by holding the power button for ten seconds."})
+	require.NoError(t, err)
+	_, err = indexer.IndexKnowledgeFromText(ctx, "changelog", []string{"Version 2 adds dark mode."})
+	require.NoError(t, err)
+	f, err := os.Create(dir + "/knowledge.snapshot.gz")
+	require.NoError(t, err)
+	require.NoError(t, indexer.ExportSnapshot(ctx, f))
+	require.NoError(t, f.Close())
+	require.NoError(t, indexer.Close())
+
+	var agent entity.Agent
+	require.NoError(t, yaml.Unmarshal([]byte(`
+name: helper
+knowledgeSources:
+  - id: manual
+    snapshot: `+dir+`/knowledge.snapshot.gz
+`), &agent))
+
+	knowledgeService, err := knowledge.NewService(ctx, &config.ModelConfig{}, knowledgeConfig, logger)
+	require.NoError(t, err)
+	defer knowledgeService.Close()
+
+	runtime, err := agentruntime.NewAgentRuntime(ctx,
+		agentruntime.WithAgent(agent),
+		agentruntime.WithKnowledgeService(knowledgeService),
+		agentruntime.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	results, err := knowledgeService.RetrieveRelevantKnowledge(ctx, "how to reset the device", 1, []string{"manual"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Contains(t, results[0].EmbeddingText, "power button")
+
+	// Only the knowledge of the source ID is imported
+	_, err = knowledgeService.GetKnowledge(ctx, "changelog")
+	require.Error(t, err)
+}
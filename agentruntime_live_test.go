@@ -10,6 +10,7 @@ import (
 
 	"github.com/habiliai/agentruntime/engine"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/memory"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/stretchr/testify/require"
 )
@@ -66,6 +67,9 @@ Be clear about what memory operations you're performing.`,
 	require.NoError(t, err)
 	defer runtime.Close()
 
+	// Memories stored by the agent are scoped to the agent's namespace
+	memoryCtx := memory.WithScope(ctx, memory.Scope{AgentName: agent.Name})
+
 	t.Run("Store and retrieve user information", func(t *testing.T) {
 		// Test storing personal information
 		response, err := runtime.Run(ctx, engine.RunRequest{
@@ -127,8 +131,9 @@ Be clear about what memory operations you're performing.`,
 
 		// Verify that coffee preference exists in memory via direct service check
 		memoryService := runtime.GetMemoryService()
-		memories, err := memoryService.ListMemories(ctx)
+		list, err := memoryService.ListMemories(memoryCtx, memory.ListOptions{})
 		require.NoError(t, err)
+		memories := list.Memories
 
 		coffeeMemoryExists := false
 		for _, memory := range memories {
@@ -167,8 +172,9 @@ Be clear about what memory operations you're performing.`,
 
 		// Verify essential information exists via direct service check
 		memoryService := runtime.GetMemoryService()
-		memories, err := memoryService.ListMemories(ctx)
+		list, err := memoryService.ListMemories(memoryCtx, memory.ListOptions{})
 		require.NoError(t, err)
+		memories := list.Memories
 		require.GreaterOrEqual(t, len(memories), 3, "Should have at least 3 memories stored")
 
 		t.Logf("List memories response: %s", response.Text())
@@ -262,8 +268,9 @@ Be clear about what memory operations you're performing.`,
 
 		// Check memory service directly - coffee preference should be gone
 		memoryService := runtime.GetMemoryService()
-		memories, err := memoryService.ListMemories(ctx)
+		list, err := memoryService.ListMemories(memoryCtx, memory.ListOptions{})
 		require.NoError(t, err)
+		memories := list.Memories
 
 		coffeeMemoryExists := false
 		for _, memory := range memories {
@@ -310,8 +317,9 @@ Be clear about what memory operations you're performing.`,
 		require.NotNil(t, memoryService, "Memory service should be available")
 
 		// List all memories directly from the service
-		memories, err := memoryService.ListMemories(ctx)
+		list, err := memoryService.ListMemories(memoryCtx, memory.ListOptions{})
 		require.NoError(t, err)
+		memories := list.Memories
 
 		// Create a map of actual memory keys for verification
 		memoryKeys := make(map[string]bool)
@@ -363,7 +371,7 @@ Be clear about what memory operations you're performing.`,
 
 		// Verify specific memory content for name
 		if memoryKeys["user_name_full"] {
-			nameMemory, err := memoryService.GetMemory(ctx, "user_name_full")
+			nameMemory, err := memoryService.GetMemory(memoryCtx, "user_name_full")
 			require.NoError(t, err)
 			require.Equal(t, "Dennis", nameMemory.Value)
 			require.Contains(t, nameMemory.Tags, "personal")
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/internal/mylog"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/knowledge/eval"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newKnowledgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "knowledge",
+		Short: "Evaluate knowledge bases and move them between stores as snapshots",
+	}
+
+	cmd.AddCommand(newKnowledgeEvalCmd(), newKnowledgeExportCmd(), newKnowledgeImportCmd())
+
+	return cmd
+}
+
+func newKnowledgeEvalCmd() *cobra.Command {
+	params := &struct {
+		Variants string
+		Config   string
+		K        int
+		Format   string
+		Verbose  bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "eval <dataset>",
+		Short: "Measure recall@k, MRR and nDCG of a labeled dataset under several knowledge configurations",
+		Long: `Indexes the knowledge of a YAML or JSON dataset and runs its labeled queries once
+per configuration variant. The first variant is the baseline of the per-query changes.
+
+Without --variants, retrieval without reranking and query rewriting is compared to
+reranking, the hyde, expansion and multi query rewrite strategies, and sentence
+chunks of 500 and 2000 characters.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			dataset, err := eval.LoadDatasetFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			variants := eval.DefaultVariants()
+			if params.Variants != "" {
+				f, err := os.Open(params.Variants)
+				if err != nil {
+					return errors.Wrapf(err, "failed to open variants file")
+				}
+				defer f.Close()
+				if variants, err = eval.LoadVariants(f); err != nil {
+					return err
+				}
+			}
+
+			baseConfig, err := loadKnowledgeConfig(params.Config)
+			if err != nil {
+				return err
+			}
+
+			logLevel := "warn"
+			if params.Verbose {
+				logLevel = "info"
+			}
+			report, err := eval.Run(ctx, dataset, variants, eval.Options{
+				K:           params.K,
+				ModelConfig: modelConfigFromEnv(),
+				BaseConfig:  baseConfig,
+				Logger:      mylog.NewLogger(logLevel, "text"),
+			})
+			if err != nil {
+				return err
+			}
+
+			switch params.Format {
+			case "text":
+				return report.WriteText(cmd.OutOrStdout())
+			case "json":
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			default:
+				return errors.Errorf("unsupported format: %s", params.Format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&params.Variants, "variants", "", "YAML or JSON file of variants, each a name and knowledge config overrides")
+	cmd.Flags().StringVar(&params.Config, "config", "", "YAML or JSON knowledge config the variants override (default: the built-in defaults)")
+	cmd.Flags().IntVarP(&params.K, "k", "k", eval.DefaultK, "Number of results retrieved and evaluated per query")
+	cmd.Flags().StringVar(&params.Format, "format", "text", "Report format: text or json (json includes every query)")
+	cmd.Flags().BoolVarP(&params.Verbose, "verbose", "v", false, "Log the progress of the evaluation")
+
+	return cmd
+}
+
+type knowledgeStoreParams struct {
+	Config string
+	DBPath string
+}
+
+func (p *knowledgeStoreParams) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&p.Config, "config", "", "YAML or JSON knowledge config selecting the store and the embedder")
+	cmd.Flags().StringVar(&p.DBPath, "db", "", "Path of the SQLite knowledge database (overrides sqlitePath of --config)")
+}
+
+// newService creates a knowledge service on the store selected by the flags
+func (p *knowledgeStoreParams) newService(ctx context.Context) (knowledge.Service, error) {
+	knowledgeConfig, err := loadKnowledgeConfig(p.Config)
+	if err != nil {
+		return nil, err
+	}
+	if p.DBPath != "" {
+		knowledgeConfig.PgvectorEnabled = false
+		knowledgeConfig.SqliteEnabled = true
+		knowledgeConfig.SqlitePath = p.DBPath
+	}
+
+	return knowledge.NewService(ctx, modelConfigFromEnv(), knowledgeConfig, mylog.NewLogger("warn", "text"))
+}
+
+func newKnowledgeExportCmd() *cobra.Command {
+	params := &struct {
+		knowledgeStoreParams
+		Output string
+	}{}
+	cmd := &cobra.Command{
+		Use:   "export [knowledge-id...]",
+		Short: "Export knowledge with its embeddings to a snapshot (all knowledge when no ID is given)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			service, err := params.newService(ctx)
+			if err != nil {
+				return err
+			}
+			defer service.Close()
+
+			var w io.Writer = cmd.OutOrStdout()
+			if params.Output != "" && params.Output != "-" {
+				f, err := os.Create(params.Output)
+				if err != nil {
+					return errors.Wrapf(err, "failed to create output file")
+				}
+				defer f.Close()
+				w = f
+			}
+
+			return service.ExportSnapshot(ctx, w, args...)
+		},
+	}
+
+	params.addFlags(cmd)
+	cmd.Flags().StringVarP(&params.Output, "output", "o", "-", "Output file, e.g. knowledge.snapshot.gz (- for stdout)")
+
+	return cmd
+}
+
+func newKnowledgeImportCmd() *cobra.Command {
+	params := &struct {
+		knowledgeStoreParams
+		KnowledgeIds []string
+		Overwrite    bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "import <snapshot>",
+		Short: "Import the knowledge of a snapshot, embedding only documents embedded with another embedder",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			service, err := params.newService(ctx)
+			if err != nil {
+				return err
+			}
+			defer service.Close()
+
+			var r io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return errors.Wrapf(err, "failed to open snapshot")
+				}
+				defer f.Close()
+				r = f
+			}
+
+			result, err := service.ImportSnapshot(ctx, r, knowledge.SnapshotImportOptions{
+				KnowledgeIds: params.KnowledgeIds,
+				Overwrite:    params.Overwrite,
+			})
+			if err != nil {
+				return err
+			}
+
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(result)
+		},
+	}
+
+	params.addFlags(cmd)
+	cmd.Flags().StringSliceVar(&params.KnowledgeIds, "knowledge", nil, "Import only these knowledge IDs")
+	cmd.Flags().BoolVar(&params.Overwrite, "overwrite", false, "Replace stored knowledge with the same ID instead of skipping it")
+
+	return cmd
+}
+
+// loadKnowledgeConfig reads a YAML or JSON knowledge config over the defaults.
+// An empty path returns the defaults.
+func loadKnowledgeConfig(path string) (*config.KnowledgeConfig, error) {
+	knowledgeConfig := config.NewKnowledgeConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read knowledge config")
+		}
+		if err := yaml.Unmarshal(data, knowledgeConfig); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse knowledge config")
+		}
+	}
+	if knowledgeConfig.EmbeddingAPIKey == "" {
+		knowledgeConfig.EmbeddingAPIKey = os.Getenv("EMBEDDING_API_KEY")
+	}
+	return knowledgeConfig, nil
+}
+
+// modelConfigFromEnv returns the model API keys of the environment
+func modelConfigFromEnv() *config.ModelConfig {
+	return &config.ModelConfig{
+		OpenAIAPIKey:    os.Getenv("OPENAI_API_KEY"),
+		AnthropicAPIKey: os.Getenv("ANTHROPIC_API_KEY"),
+		XAIAPIKey:       os.Getenv("XAI_API_KEY"),
+	}
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/internal/mylog"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type memoryParams struct {
+	DBPath            string
+	UserID            string
+	AgentName         string
+	ThreadID          string
+	Format            string
+	EmbeddingProvider string
+	EmbeddingModel    string
+	EmbeddingBaseURL  string
+	VectorDimension   int
+}
+
+func newMemoryCmd() *cobra.Command {
+	params := &memoryParams{}
+	cmd := &cobra.Command{
+		Use:   "memory",
+		Short: "Manage the memories stored in the SQLite memory database",
+	}
+
+	cmd.PersistentFlags().StringVar(&params.DBPath, "db", config.NewMemoryConfig().SqlitePath, "Path of the SQLite memory database")
+	cmd.PersistentFlags().StringVar(&params.UserID, "user", "", "User ID of the memory namespace")
+	cmd.PersistentFlags().StringVar(&params.AgentName, "agent", "", "Agent name of the memory namespace")
+	cmd.PersistentFlags().StringVar(&params.ThreadID, "thread", "", "Thread ID of the memory namespace (thread-scoped memories)")
+	cmd.PersistentFlags().StringVar(&params.Format, "format", "", "json or jsonl (default: from the file extension, otherwise json)")
+	cmd.PersistentFlags().StringVar(&params.EmbeddingProvider, "embedding-provider", "", "Embedding provider: openai, nomic or openai-compatible")
+	cmd.PersistentFlags().StringVar(&params.EmbeddingModel, "embedding-model", "", "Embedding model name")
+	cmd.PersistentFlags().StringVar(&params.EmbeddingBaseURL, "embedding-base-url", "", "Base URL of an OpenAI-compatible embeddings API")
+	cmd.PersistentFlags().IntVar(&params.VectorDimension, "vector-dimension", 0, "Embedding dimension (required for openai-compatible)")
+
+	cmd.AddCommand(newMemoryExportCmd(params), newMemoryImportCmd(params))
+
+	return cmd
+}
+
+func newMemoryExportCmd(params *memoryParams) *cobra.Command {
+	exportParams := &struct {
+		Output     string
+		Embeddings bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all memories of a namespace to a JSON or JSONL file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			// Exporting only reads the database, so it needs no embedder
+			store, err := memory.OpenReadOnlyStore(params.DBPath)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			var w io.Writer = cmd.OutOrStdout()
+			if exportParams.Output != "" && exportParams.Output != "-" {
+				f, err := os.Create(exportParams.Output)
+				if err != nil {
+					return errors.Wrapf(err, "failed to create output file")
+				}
+				defer f.Close()
+				w = f
+			}
+
+			return memory.ExportMemories(ctx, store, params.scope().Namespace(params.ThreadID != ""), w, memory.ExportOptions{
+				Format:            params.format(exportParams.Output),
+				IncludeEmbeddings: exportParams.Embeddings,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&exportParams.Output, "output", "o", "-", "Output file (- for stdout)")
+	cmd.Flags().BoolVar(&exportParams.Embeddings, "embeddings", false, "Include the embeddings")
+
+	return cmd
+}
+
+func newMemoryImportCmd(params *memoryParams) *cobra.Command {
+	importParams := &struct {
+		Overwrite bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import memories from a JSON or JSONL file into a namespace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			service, err := newMemoryServiceForCmd(ctx, params)
+			if err != nil {
+				return err
+			}
+			defer service.Close()
+
+			var r io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return errors.Wrapf(err, "failed to open input file")
+				}
+				defer f.Close()
+				r = f
+			}
+
+			result, err := service.ImportMemories(params.scopedContext(ctx), r, memory.ImportOptions{
+				Format:    params.format(args[0]),
+				Overwrite: importParams.Overwrite,
+			})
+			if err != nil {
+				return err
+			}
+
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(result)
+		},
+	}
+
+	cmd.Flags().BoolVar(&importParams.Overwrite, "overwrite", false, "Replace memories with the same key instead of skipping them")
+
+	return cmd
+}
+
+func newMemoryServiceForCmd(ctx context.Context, params *memoryParams) (memory.Service, error) {
+	memoryConfig := config.NewMemoryConfig()
+	memoryConfig.SqliteEnabled = true
+	memoryConfig.SqlitePath = params.DBPath
+	memoryConfig.ThreadScoped = params.ThreadID != ""
+	if params.EmbeddingProvider != "" {
+		memoryConfig.EmbeddingProvider = params.EmbeddingProvider
+	}
+	if params.EmbeddingModel != "" {
+		memoryConfig.EmbeddingModel = params.EmbeddingModel
+	}
+	if params.EmbeddingBaseURL != "" {
+		memoryConfig.EmbeddingBaseURL = params.EmbeddingBaseURL
+	}
+	memoryConfig.VectorDimension = params.VectorDimension
+	memoryConfig.EmbeddingAPIKey = os.Getenv("EMBEDDING_API_KEY")
+
+	return memory.NewService(ctx, &config.ModelConfig{
+		OpenAIAPIKey:    os.Getenv("OPENAI_API_KEY"),
+		AnthropicAPIKey: os.Getenv("ANTHROPIC_API_KEY"),
+		XAIAPIKey:       os.Getenv("XAI_API_KEY"),
+	}, memoryConfig, mylog.NewLogger("warn", "text"))
+}
+
+// scope returns the memory scope selected by the flags
+func (p *memoryParams) scope() memory.Scope {
+	return memory.Scope{
+		UserID:    p.UserID,
+		AgentName: p.AgentName,
+		ThreadID:  p.ThreadID,
+	}
+}
+
+// scopedContext carries the namespace selected by the flags
+func (p *memoryParams) scopedContext(ctx context.Context) context.Context {
+	ctx = memory.WithScope(ctx, p.scope())
+	return memory.WithActor(ctx, memory.Actor{Type: memory.ActorUser, Name: "cli"})
+}
+
+// format returns the --format flag, or the format implied by the file extension
+func (p *memoryParams) format(path string) memory.ExportFormat {
+	if p.Format != "" {
+		return p.Format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		return memory.ExportFormatJSONL
+	}
+	return memory.ExportFormatJSON
+}
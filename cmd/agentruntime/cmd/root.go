@@ -122,6 +122,8 @@ func newRootCmd() *cobra.Command {
 
 	cmd.Flags().IntVarP(&params.Port, "port", "p", 3001, "Port to listen on")
 
+	cmd.AddCommand(newMemoryCmd(), newKnowledgeCmd())
+
 	return cmd
 }
 
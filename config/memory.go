@@ -1,11 +1,118 @@
 package config
 
+import (
+	"os"
+	"time"
+)
+
 type MemoryConfig struct {
 	GenerationModel string `json:"generationModel"`
+
+	// ThreadScoped controls whether memories are isolated per thread in addition
+	// to per user and per agent
+	// Default: false
+	ThreadScoped bool `json:"threadScoped,omitempty"`
+
+	// SqliteEnabled controls whether memories are persisted in SQLite instead of in memory
+	// Default: false
+	SqliteEnabled bool `json:"sqliteEnabled,omitempty"`
+
+	// SqlitePath specifies the file path for the SQLite database
+	// A leading "~" is expanded to the user's home directory
+	// Default: ~/.agentruntime/memory.db
+	SqlitePath string `json:"sqlitePath,omitempty"`
+
+	// VectorDimension is the dimension of the stored memory embeddings
+	// It must match the output size of the embedding model. When 0, the size
+	// is derived from the embedder (required for "openai-compatible")
+	// Default: 0
+	VectorDimension int `json:"vectorDimension,omitempty"`
+
+	// EmbeddingProvider selects the embedder for memories
+	// Options: "openai" (genkit OpenAI plugin), "nomic" (Nomic Atlas API),
+	// "openai-compatible" (any /v1/embeddings endpoint such as Ollama or llama.cpp)
+	// Default: "openai"
+	EmbeddingProvider string `json:"embeddingProvider,omitempty"`
+
+	// EmbeddingModel specifies the embedding model name
+	// Default: "text-embedding-3-small" for "openai"
+	EmbeddingModel string `json:"embeddingModel,omitempty"`
+
+	// EmbeddingBaseURL is the base URL of an OpenAI-compatible API (e.g. http://localhost:11434/v1)
+	EmbeddingBaseURL string `json:"embeddingBaseUrl,omitempty"`
+
+	// EmbeddingAPIKey is the optional bearer token for an OpenAI-compatible API
+	EmbeddingAPIKey string `json:"embeddingApiKey,omitempty"`
+
+	// NomicAPIKey is the API key for the "nomic" embedding provider
+	NomicAPIKey string `json:"nomicApiKey,omitempty"`
+
+	// RecencyWeight is the share of the search score given to how recently a
+	// memory was updated (0.0~1.0)
+	// Default: 0.1
+	RecencyWeight float64 `json:"recencyWeight,omitempty"`
+
+	// RecencyHalfLife is the time since the last update after which a memory's recency halves
+	// Default: 720h (30 days)
+	RecencyHalfLife time.Duration `json:"recencyHalfLife,omitempty"`
+
+	// ImportanceWeight is the share of the search score given to a memory's importance (0.0~1.0)
+	// Default: 0.1
+	ImportanceWeight float64 `json:"importanceWeight,omitempty"`
+
+	// DefaultTTL is the lifetime of memories stored without an explicit TTL
+	// Default: 0 (memories never expire)
+	DefaultTTL time.Duration `json:"defaultTtl,omitempty"`
+
+	// PruneInterval runs the pruning job in the background at the given interval
+	// Default: 0 (pruning only runs on demand)
+	PruneInterval time.Duration `json:"pruneInterval,omitempty"`
+
+	// PruneMinImportance and PruneMaxIdle define low-value memories: memories
+	// below PruneMinImportance that were not used for PruneMaxIdle are pruned.
+	// Expired memories are always pruned.
+	// Default: 0 (low-value memories are kept)
+	PruneMinImportance float64       `json:"pruneMinImportance,omitempty"`
+	PruneMaxIdle       time.Duration `json:"pruneMaxIdle,omitempty"`
+
+	// ConsolidationThreshold is the minimum cosine similarity for memories to be
+	// considered near-duplicates during consolidation
+	// Default: 0.9
+	ConsolidationThreshold float64 `json:"consolidationThreshold,omitempty"`
+
+	// ConsolidationInterval runs consolidation with GenerationModel over every
+	// namespace in the background at the given interval
+	// Default: 0 (consolidation only runs on demand)
+	ConsolidationInterval time.Duration `json:"consolidationInterval,omitempty"`
+
+	// RecordEpisodes summarizes each thread with GenerationModel in the background
+	// after a run and keeps the summary as the thread's episode, which can be
+	// recalled from other threads. Later runs of the thread update the episode.
+	// Only runs with a thread ID are recorded.
+	// Default: false
+	RecordEpisodes bool `json:"recordEpisodes,omitempty"`
+
+	// EpisodeMinConversations is the minimum number of conversations in a thread,
+	// including the agent's reply, before it is recorded as an episode
+	// Default: 4
+	EpisodeMinConversations int `json:"episodeMinConversations,omitempty"`
 }
 
 func NewMemoryConfig() *MemoryConfig {
 	return &MemoryConfig{
 		GenerationModel: "openai/o4-mini",
+		SqlitePath:      "~/.agentruntime/memory.db",
+
+		EmbeddingProvider: "openai",
+		EmbeddingModel:    "text-embedding-3-small",
+		NomicAPIKey:       os.Getenv("NOMIC_API_KEY"),
+
+		RecencyWeight:    0.1,
+		RecencyHalfLife:  30 * 24 * time.Hour,
+		ImportanceWeight: 0.1,
+
+		ConsolidationThreshold: 0.9,
+
+		EpisodeMinConversations: 4,
 	}
 }
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/habiliai/agentruntime/tool"
+)
+
+type (
+	// Citation links a claim of the answer to the sources it came from
+	Citation struct {
+		// Text is the claim without its citation markers
+		Text string `json:"text"`
+		// Start and End are the byte offsets of the claim in the answer text
+		Start int `json:"start"`
+		End   int `json:"end"`
+		// Refs are the refs of the cited sources
+		Refs []string `json:"refs"`
+	}
+)
+
+var citationMarkerRegex = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// ExtractCitations finds the citation markers the model put after claims in
+// text, e.g. "The shop opens at 9am [1][2].", and returns the claims with the
+// refs they cite and the cited sources in the order of their refs. Markers of
+// unknown refs are left as they are.
+func ExtractCitations(text string, sources []tool.Source) ([]Citation, []tool.Source) {
+	known := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		known[source.Ref] = true
+	}
+
+	var (
+		citations  []Citation
+		cited      = make(map[string]bool)
+		claimStart = 0
+		matches    = citationMarkerRegex.FindAllStringSubmatchIndex(text, -1)
+	)
+	for i := 0; i < len(matches); {
+		// Adjacent markers, e.g. [1][3] or [1], [3], cite the same claim
+		markerStart, markerEnd := matches[i][0], matches[i][1]
+		var refs []string
+		for ; i < len(matches); i++ {
+			if matches[i][0] != markerStart && strings.Trim(text[markerEnd:matches[i][0]], " ,") != "" {
+				break
+			}
+			markerEnd = matches[i][1]
+			for _, ref := range strings.Split(text[matches[i][2]:matches[i][3]], ",") {
+				ref = strings.TrimSpace(ref)
+				if known[ref] && !slices.Contains(refs, ref) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+		if len(refs) == 0 {
+			continue
+		}
+
+		start, end := claimBounds(text, claimStart, markerStart)
+		claimStart = markerEnd
+		if start == end {
+			continue
+		}
+
+		citations = append(citations, Citation{
+			Text:  text[start:end],
+			Start: start,
+			End:   end,
+			Refs:  refs,
+		})
+		for _, ref := range refs {
+			cited[ref] = true
+		}
+	}
+
+	var citedSources []tool.Source
+	for _, source := range sources {
+		if cited[source.Ref] {
+			citedSources = append(citedSources, source)
+		}
+	}
+
+	return citations, citedSources
+}
+
+// claimBounds returns the bounds of the claim ending at a marker at end. The
+// claim starts after the previous marker or at the start of its sentence.
+func claimBounds(text string, start, end int) (int, int) {
+	claim := text[start:end]
+
+	// Markers put after the end of the sentence cite the whole sentence
+	trimmed := strings.TrimRight(claim, " \t.!?")
+	if boundary := max(
+		strings.LastIndex(trimmed, "\n"),
+		strings.LastIndex(trimmed, ". "),
+		strings.LastIndex(trimmed, "! "),
+		strings.LastIndex(trimmed, "? "),
+	); boundary >= 0 {
+		start += boundary + 1
+		claim = text[start:end]
+	}
+
+	withoutLeading := strings.TrimLeft(claim, " \t\n-*")
+	start += len(claim) - len(withoutLeading)
+	end = start + len(strings.TrimRight(withoutLeading, " \t\n"))
+	return start, end
+}
@@ -0,0 +1,49 @@
+package engine_test
+
+import (
+	"testing"
+
+	"github.com/habiliai/agentruntime/engine"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCitations(t *testing.T) {
+	sources := []tool.Source{
+		{Ref: "1", DocumentID: "shop-0", Title: "Opening hours"},
+		{Ref: "2", DocumentID: "shop-1", Title: "Repairs"},
+		{Ref: "3", DocumentID: "shop-2", Title: "Helmets"},
+	}
+	text := "The shop opens at 9am [1]. Repairs take two days [2][1], and helmets are sold [9].\n- Prices are listed online.[2]"
+
+	citations, cited := engine.ExtractCitations(text, sources)
+	require.Len(t, citations, 3)
+
+	assert.Equal(t, "The shop opens at 9am", citations[0].Text)
+	assert.Equal(t, []string{"1"}, citations[0].Refs)
+	assert.Equal(t, "Repairs take two days", citations[1].Text)
+	assert.Equal(t, []string{"2", "1"}, citations[1].Refs)
+	assert.Equal(t, "Prices are listed online.", citations[2].Text)
+	assert.Equal(t, []string{"2"}, citations[2].Refs)
+	for _, citation := range citations {
+		assert.Equal(t, citation.Text, text[citation.Start:citation.End])
+	}
+
+	// Unknown refs are not cited, so the helmets source is left out
+	assert.Equal(t, sources[:2], cited)
+}
+
+func TestExtractCitations_ClaimsInOneSentence(t *testing.T) {
+	sources := []tool.Source{{Ref: "1"}, {Ref: "2"}}
+
+	citations, _ := engine.ExtractCitations("Bikes are red [1, 2] and helmets are blue [2].", sources)
+	require.Len(t, citations, 2)
+	assert.Equal(t, "Bikes are red", citations[0].Text)
+	assert.Equal(t, []string{"1", "2"}, citations[0].Refs)
+	assert.Equal(t, "and helmets are blue", citations[1].Text)
+
+	citations, cited := engine.ExtractCitations("No markers here.", sources)
+	assert.Empty(t, citations)
+	assert.Empty(t, cited)
+}
@@ -18,6 +18,15 @@ var (
 	conversationSummaryTemplate = template.Must(template.New("conversation_summary").Funcs(funcMap()).Parse(conversationSummaryTmpl))
 )
 
+// conversationSummaryValues are the values of the conversation summary template
+type conversationSummaryValues struct {
+	ChatPromptValues
+	MaxTokens int
+	// PreviousSummary summarizes the conversations before RecentConversations,
+	// to be updated with them
+	PreviousSummary *EpisodeSummary
+}
+
 // ConversationSummarizer handles conversation history summarization
 type ConversationSummarizer struct {
 	genkit *genkit.Genkit
@@ -183,10 +192,7 @@ func (cs *ConversationSummarizer) generateSummary(ctx context.Context, promptVal
 	}
 
 	var buf strings.Builder
-	if err := conversationSummaryTemplate.Execute(&buf, struct {
-		ChatPromptValues
-		MaxTokens int
-	}{
+	if err := conversationSummaryTemplate.Execute(&buf, conversationSummaryValues{
 		ChatPromptValues: *promptValues,
 		MaxTokens:        cs.config.SummaryTokens,
 	}); err != nil {
@@ -2,9 +2,11 @@ package engine
 
 import (
 	"log/slog"
+	"sync"
 
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
 	"github.com/habiliai/agentruntime/tool"
 )
 
@@ -14,6 +16,15 @@ type (
 		toolManager            tool.Manager
 		genkit                 *genkit.Genkit
 		conversationSummarizer *ConversationSummarizer
+
+		// memoryService and memoryConfig record threads as episodes; see SetMemoryService
+		memoryService memory.Service
+		memoryConfig  *config.MemoryConfig
+
+		// episodes tracks the episodes being recorded in the background
+		episodes       sync.WaitGroup
+		episodeMu      sync.Mutex
+		episodeThreads map[string]*episodeThread
 	}
 )
 
@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/pkg/errors"
+)
+
+const (
+	// episodeSummaryTokens is the target token count of an episode summary
+	episodeSummaryTokens = 500
+	// episodeTimeout bounds the recording of an episode in the background
+	episodeTimeout = 2 * time.Minute
+)
+
+type (
+	// episodeThread is the episode recording state of a thread
+	episodeThread struct {
+		// running is whether an episode of the thread is being recorded, and
+		// pending the latest run to record after it
+		running bool
+		pending *episodeRun
+		// covered is the number of conversations the thread's episode summarizes
+		covered int
+	}
+
+	// episodeRun is a finished run whose thread is to be recorded as an episode
+	episodeRun struct {
+		ctx   context.Context
+		agent entity.Agent
+		req   RunRequest
+	}
+)
+
+// EpisodeSummary is the summary of a thread kept as an episode in memory
+type EpisodeSummary struct {
+	Summary  string   `json:"summary" jsonschema:"description=The summary of the conversation history"`
+	Outcomes []string `json:"outcomes,omitempty" jsonschema:"description=Decisions made, agreements reached and action items assigned in the conversation, one per item"`
+}
+
+// SetMemoryService lets Run record threads as episodes in memoryService when
+// memoryConfig.RecordEpisodes is enabled
+func (s *Engine) SetMemoryService(memoryService memory.Service, memoryConfig *config.MemoryConfig) {
+	s.memoryService = memoryService
+	s.memoryConfig = memoryConfig
+}
+
+// SummarizeEpisode summarizes the conversations of a thread with the conversation
+// summary instructions, extracting its outcomes as well
+func (s *Engine) SummarizeEpisode(ctx context.Context, agent entity.Agent, req RunRequest, modelName string) (*EpisodeSummary, error) {
+	return s.summarizeEpisode(ctx, agent, req, modelName, nil)
+}
+
+// summarizeEpisode summarizes the conversations of a thread. With a previous
+// summary of the earlier conversations, it updates the previous summary with
+// the conversations of req.
+func (s *Engine) summarizeEpisode(ctx context.Context, agent entity.Agent, req RunRequest, modelName string, previous *EpisodeSummary) (*EpisodeSummary, error) {
+	if len(req.History) == 0 {
+		return nil, errors.New("no conversations to summarize")
+	}
+
+	promptValues, err := s.BuildPromptValues(ctx, agent, req, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build prompt values")
+	}
+
+	var buf strings.Builder
+	if err := conversationSummaryTemplate.Execute(&buf, conversationSummaryValues{
+		ChatPromptValues: *promptValues,
+		MaxTokens:        episodeSummaryTokens,
+		PreviousSummary:  previous,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to execute conversation summary template")
+	}
+
+	summary, _, err := genkit.GenerateData[EpisodeSummary](ctx, s.genkit,
+		ai.WithModelName(modelName),
+		ai.WithPrompt(buf.String()),
+		ai.WithCustomConstrainedOutput(),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate episode summary")
+	}
+	summary.Summary = strings.TrimSpace(summary.Summary)
+
+	return summary, nil
+}
+
+// Close waits for the episodes being recorded in the background
+func (s *Engine) Close() {
+	s.episodes.Wait()
+}
+
+// recordEpisode records the thread of a finished run, including the agent's
+// reply, as an episode in the background so that the reply is not delayed.
+// Runs of a thread finishing while its episode is recorded are recorded after
+// it, only the latest one.
+func (s *Engine) recordEpisode(ctx context.Context, agent entity.Agent, req RunRequest, reply string) {
+	if s.memoryService == nil || s.memoryConfig == nil || !s.memoryConfig.RecordEpisodes || req.ThreadID == "" {
+		return
+	}
+
+	req.History = append(req.History[:len(req.History):len(req.History)], Conversation{User: agent.Name, Text: reply})
+	if len(req.History) < s.memoryConfig.EpisodeMinConversations {
+		return
+	}
+
+	// The episode outlives the run, but keeps its memory scope and actor
+	run := &episodeRun{ctx: context.WithoutCancel(ctx), agent: agent, req: req}
+
+	s.episodeMu.Lock()
+	defer s.episodeMu.Unlock()
+	if s.episodeThreads == nil {
+		s.episodeThreads = make(map[string]*episodeThread)
+	}
+	thread, ok := s.episodeThreads[req.ThreadID]
+	if !ok {
+		thread = &episodeThread{}
+		s.episodeThreads[req.ThreadID] = thread
+	}
+	if thread.running {
+		thread.pending = run
+		return
+	}
+	thread.running = true
+
+	s.episodes.Add(1)
+	go func() {
+		defer s.episodes.Done()
+		for run != nil {
+			s.recordThreadEpisode(run, thread)
+
+			s.episodeMu.Lock()
+			run, thread.pending = thread.pending, nil
+			thread.running = run != nil
+			s.episodeMu.Unlock()
+		}
+	}()
+}
+
+// recordThreadEpisode summarizes the thread of run and stores it as the
+// thread's episode. The conversations already summarized by the episode are
+// not summarized again; the episode is updated with the new ones.
+// Failures are logged since the run itself succeeded.
+func (s *Engine) recordThreadEpisode(run *episodeRun, thread *episodeThread) {
+	ctx, cancel := context.WithTimeout(run.ctx, episodeTimeout)
+	defer cancel()
+
+	req := run.req
+	conversations := len(req.History)
+	s.episodeMu.Lock()
+	covered := thread.covered
+	s.episodeMu.Unlock()
+	if covered >= conversations {
+		return
+	}
+
+	var previous *EpisodeSummary
+	if covered > 0 {
+		episode, err := s.threadEpisode(ctx, req.ThreadID)
+		if err != nil {
+			s.logger.Warn("failed to get episode", "thread_id", req.ThreadID, "error", err)
+			return
+		}
+		if episode != nil {
+			previous = &EpisodeSummary{Summary: episode.Summary, Outcomes: episode.Outcomes}
+			req.History = req.History[covered:]
+		}
+	}
+
+	summary, err := s.summarizeEpisode(ctx, run.agent, req, s.memoryConfig.GenerationModel, previous)
+	if err != nil {
+		s.logger.Warn("failed to summarize episode", "thread_id", req.ThreadID, "error", err)
+		return
+	}
+
+	// Recording the thread again replaces its episode
+	if _, err := s.memoryService.RecordEpisode(ctx, memory.RecordEpisodeInput{
+		ThreadID:     req.ThreadID,
+		Summary:      summary.Summary,
+		Participants: episodeParticipants(run.agent, run.req),
+		Outcomes:     summary.Outcomes,
+	}); err != nil {
+		s.logger.Warn("failed to record episode", "thread_id", req.ThreadID, "error", err)
+		return
+	}
+
+	s.episodeMu.Lock()
+	thread.covered = conversations
+	s.episodeMu.Unlock()
+}
+
+// threadEpisode returns the episode of a thread, or nil if it has none
+func (s *Engine) threadEpisode(ctx context.Context, threadID string) (*memory.Episode, error) {
+	episodes, err := s.memoryService.ListEpisodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, episode := range episodes {
+		if episode.ThreadID == threadID {
+			return episode, nil
+		}
+	}
+	return nil, nil
+}
+
+// episodeParticipants returns the agent, the user and every other participant of a thread
+func episodeParticipants(agent entity.Agent, req RunRequest) []string {
+	var participants []string
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		for _, p := range participants {
+			if strings.EqualFold(p, name) {
+				return
+			}
+		}
+		participants = append(participants, name)
+	}
+
+	add(agent.Name)
+	if req.UserInfo != nil {
+		add(req.UserInfo.FullName)
+		if req.UserInfo.FullName == "" {
+			add(req.UserInfo.Username)
+		}
+	}
+	for _, participant := range req.Participant {
+		add(participant.Name)
+	}
+	for _, conversation := range req.History {
+		add(conversation.User)
+	}
+	return participants
+}
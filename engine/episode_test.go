@@ -0,0 +1,124 @@
+package engine_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/engine"
+	"github.com/habiliai/agentruntime/entity"
+	genkitinternal "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// episodeModel is a fake model that replies to chats and blocks summaries
+// until released
+type episodeModel struct {
+	mu       sync.Mutex
+	prompts  []string
+	summary  chan struct{}
+	released chan struct{}
+}
+
+func (m *episodeModel) generate(ctx context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	var prompt strings.Builder
+	for _, msg := range req.Messages {
+		prompt.WriteString(msg.Text())
+	}
+	if !strings.Contains(prompt.String(), "comprehensive summary") {
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage("Sure, I will remember that.")}, nil
+	}
+
+	m.mu.Lock()
+	m.prompts = append(m.prompts, prompt.String())
+	m.mu.Unlock()
+	m.summary <- struct{}{}
+	<-m.released
+
+	return &ai.ModelResponse{
+		Message: ai.NewModelTextMessage(`{"summary": "The user planned a trip to Busan.", "outcomes": ["Trip planned"]}`),
+	}, nil
+}
+
+func TestEngine_RecordEpisodeInBackground(t *testing.T) {
+	ctx := t.Context()
+	logger := slog.Default()
+
+	g, err := genkitinternal.NewGenkit(ctx, &config.ModelConfig{}, logger, false)
+	require.NoError(t, err)
+
+	model := &episodeModel{
+		summary:  make(chan struct{}, 1),
+		released: make(chan struct{}),
+	}
+	genkit.DefineModel(g, "test", "episode", &ai.ModelInfo{
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+	}, model.generate)
+
+	memoryConfig := config.NewMemoryConfig()
+	memoryConfig.RecordEpisodes = true
+	memoryConfig.EpisodeMinConversations = 2
+	memoryConfig.GenerationModel = "test/episode"
+	memoryService, err := memory.NewServiceWithEmbedder(ctx, memory.NewInMemoryStore(), memory.NewKnowledgeEmbedder(knowledge.NewFakeEmbedder(16)), &config.ModelConfig{}, memoryConfig, logger)
+	require.NoError(t, err)
+
+	e := engine.NewEngine(logger, nil, g)
+	e.SetMemoryService(memoryService, memoryConfig)
+
+	agent := entity.Agent{Name: "Planner", ModelName: "test/episode"}
+	history := []engine.Conversation{
+		{User: "alice", Text: "I want to visit Busan next month."},
+	}
+	run := func() {
+		_, err := e.Run(ctx, agent, engine.RunRequest{
+			History:  history,
+			UserInfo: &engine.UserInfo{ID: "alice"},
+			ThreadID: "thread-1",
+		}, nil)
+		require.NoError(t, err)
+	}
+	scopeCtx := memory.WithScope(ctx, memory.Scope{UserID: "alice", AgentName: agent.Name})
+
+	// The run returns while its episode is still being summarized
+	run()
+	select {
+	case <-model.summary:
+	case <-time.After(10 * time.Second):
+		t.Fatal("episode was not summarized")
+	}
+	close(model.released)
+	e.Close()
+
+	episodes, err := memoryService.ListEpisodes(scopeCtx)
+	require.NoError(t, err)
+	require.Len(t, episodes, 1)
+	assert.Equal(t, "thread-1", episodes[0].ThreadID)
+	assert.Equal(t, "The user planned a trip to Busan.", episodes[0].Summary)
+
+	// The next run updates the episode with the new conversations only
+	history = append(history,
+		engine.Conversation{User: agent.Name, Text: "Sure, I will remember that."},
+		engine.Conversation{User: "alice", Text: "Please book a hotel near Haeundae."},
+	)
+	run()
+	<-model.summary
+	e.Close()
+
+	require.Len(t, model.prompts, 2)
+	assert.Contains(t, model.prompts[1], "previous_summary")
+	assert.Contains(t, model.prompts[1], "Haeundae")
+	assert.NotContains(t, model.prompts[1], "visit Busan next month")
+
+	episodes, err = memoryService.ListEpisodes(scopeCtx)
+	require.NoError(t, err)
+	require.Len(t, episodes, 1)
+}
@@ -9,8 +9,10 @@ import (
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
+	"github.com/google/uuid"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/internal/sliceutils"
+	"github.com/habiliai/agentruntime/memory"
 	"github.com/habiliai/agentruntime/tool"
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
@@ -79,9 +81,14 @@ type (
 		Participant       []Participant  `json:"participants,omitempty"`
 		Files             []File         `json:"files"`
 		UserInfo          *UserInfo      `json:"user_info"`
+		// ThreadID identifies the conversation thread; it scopes thread-level memories
+		ThreadID string `json:"thread_id,omitempty"`
 	}
 
 	UserInfo struct {
+		// ID is a stable identifier of the user; it scopes the user's memories.
+		// Username is used when empty.
+		ID       string `json:"id,omitempty"`
 		FullName string `json:"full_name"`
 		Username string `json:"username,omitempty"`
 		Location string `json:"location,omitempty"`
@@ -91,7 +98,13 @@ type (
 
 	RunResponse struct {
 		*ai.ModelResponse
+		// RunID identifies this run in the memory history
+		RunID     string     `json:"run_id,omitempty"`
 		ToolCalls []ToolCall `json:"tool_calls"`
+		// Citations link the claims of the answer to the knowledge they came from
+		Citations []Citation `json:"citations,omitempty"`
+		// Sources are the cited knowledge documents, in the order of their refs
+		Sources []tool.Source `json:"sources,omitempty"`
 	}
 
 	ToolCall struct {
@@ -107,6 +120,8 @@ func (s *Engine) Run(
 	req RunRequest,
 	streamCallback ai.ModelStreamCallback,
 ) (*RunResponse, error) {
+	// The episode covers the whole thread, not only the recent conversations
+	episodeReq := req
 
 	promptValues, err := s.BuildPromptValues(ctx, agent, req, nil)
 	if err != nil {
@@ -132,7 +147,11 @@ func (s *Engine) Run(
 	}
 
 	ctx = tool.WithEmptyCallDataStore(ctx)
+	ctx = memory.WithScope(ctx, memoryScope(ctx, agent, req))
+
 	var res RunResponse
+	res.RunID = uuid.NewString()
+	ctx = memory.WithActor(ctx, memory.Actor{Type: memory.ActorAgent, Name: agent.Name, RunID: res.RunID})
 	res.ModelResponse, err = genkit.Generate(
 		ctx,
 		s.genkit,
@@ -173,5 +192,30 @@ func (s *Engine) Run(
 		res.ToolCalls = append(res.ToolCalls, tc)
 	}
 
+	if sources := tool.GetSources(ctx); len(sources) > 0 {
+		res.Citations, res.Sources = ExtractCitations(res.Text(), sources)
+	}
+
+	s.recordEpisode(ctx, agent, episodeReq, res.Text())
+
 	return &res, nil
 }
+
+// memoryScope builds the memory scope for a run. Fields already present in the
+// context scope take precedence over the ones derived from the request.
+func memoryScope(ctx context.Context, agent entity.Agent, req RunRequest) memory.Scope {
+	scope := memory.ScopeFromContext(ctx)
+	if scope.UserID == "" && req.UserInfo != nil {
+		scope.UserID = req.UserInfo.ID
+		if scope.UserID == "" {
+			scope.UserID = req.UserInfo.Username
+		}
+	}
+	if scope.AgentName == "" {
+		scope.AgentName = agent.Name
+	}
+	if scope.ThreadID == "" {
+		scope.ThreadID = req.ThreadID
+	}
+	return scope
+}
@@ -14,6 +14,9 @@ type Agent struct {
 	Knowledge       []map[string]any   `json:"knowledge,omitempty"`
 	Evaluator       AgentEvaluator     `json:"evaluator,omitempty"`
 
+	// KnowledgeSources are files and inline maps indexed as knowledge of the agent at startup
+	KnowledgeSources []KnowledgeSource `json:"knowledgeSources,omitempty"`
+
 	// Skills are a unit of capability that an agent can perform.
 	Skills []AgentSkillUnion `json:"skills"`
 
@@ -23,6 +26,29 @@ type Agent struct {
 	Metadata map[string]any `json:"metadata"`
 }
 
+// KnowledgeSource declares knowledge loaded from files, inline maps or a snapshot
+type KnowledgeSource struct {
+	// ID is the knowledge ID of the source. Defaults to "<agent name>-knowledge-<position>"
+	// counting from 1, so set it to keep the ID stable when sources are reordered.
+	ID string `json:"id,omitempty"`
+	// Path is a file, a directory or a glob pattern such as "docs/**/*.md",
+	// relative to the working directory
+	Path string `json:"path,omitempty"`
+	// Type is the loader type of the files: pdf, markdown, html, text, csv, tsv,
+	// json, jsonl or docx. Detected for each file when empty.
+	Type string `json:"type,omitempty"`
+	// TextFields and MetadataFields select the fields of csv, tsv, json and jsonl
+	// records that are embedded and kept as metadata
+	TextFields     []string `json:"textFields,omitempty"`
+	MetadataFields []string `json:"metadataFields,omitempty"`
+	// Items are inline knowledge maps, indexed like Agent.Knowledge
+	Items []map[string]any `json:"items,omitempty"`
+	// Snapshot is a knowledge snapshot file written by "agentruntime knowledge export",
+	// imported with the knowledge IDs it was exported with instead of indexing
+	// files. When ID is set, only that knowledge of the snapshot is imported.
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
 type MessageExample struct {
 	User    string   `json:"user,omitempty"`
 	Text    string   `json:"text,omitempty"`
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"strings"
 
@@ -664,6 +665,12 @@ func convertToolResultBlockContents(output any) (contents []anthropic.BetaToolRe
 						URL: url,
 					}
 				} else {
+					// Data URLs carry the base64 data after the comma
+					if strings.HasPrefix(url, "data:") {
+						if _, data, ok := strings.Cut(url, ";base64,"); ok {
+							url = data
+						}
+					}
 					source.OfBase64 = &anthropic.BetaBase64ImageSourceParam{
 						Data:      url,
 						MediaType: getAnthropicMediaType(contentType),
@@ -675,6 +682,22 @@ func convertToolResultBlockContents(output any) (contents []anthropic.BetaToolRe
 						Source: source,
 					},
 				})
+
+				// Keep the other fields of the result, e.g. its context, next to the image
+				rest := maps.Clone(v)
+				delete(rest, "contentType")
+				delete(rest, "url")
+				if len(rest) > 0 {
+					jsonBytes, err := json.Marshal(rest)
+					if err != nil {
+						return nil, err
+					}
+					contents = append(contents, anthropic.BetaToolResultBlockParamContentUnion{
+						OfText: &anthropic.BetaTextBlockParam{
+							Text: string(jsonBytes),
+						},
+					})
+				}
 				break
 			}
 		}
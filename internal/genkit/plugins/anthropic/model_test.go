@@ -244,3 +244,21 @@ func TestStreamingLogic_WebSearchCombined(t *testing.T) {
 
 	t.Logf("✅ Complete web search flow works: Request=%+v -> Response=%+v", toolUsePart, webSearchToolResultPart)
 }
+
+func TestConvertToolResultBlockContents_Media(t *testing.T) {
+	contents, err := convertToolResultBlockContents(map[string]any{
+		"output": []any{
+			map[string]any{"context": "Bikes are red"},
+			map[string]any{"contentType": "image/png", "url": "data:image/png;base64,iVBORw0KGgo="},
+			map[string]any{"contentType": "image/png", "url": "data:image/png;base64,iVBORw0KGgo=", "ref": "3"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, contents, 4)
+
+	assert.Contains(t, contents[0].OfText.Text, "Bikes are red")
+	require.NotNil(t, contents[1].OfImage)
+	assert.Equal(t, "iVBORw0KGgo=", contents[1].OfImage.Source.OfBase64.Data)
+	require.NotNil(t, contents[2].OfImage)
+	assert.JSONEq(t, `{"ref":"3"}`, contents[3].OfText.Text)
+}
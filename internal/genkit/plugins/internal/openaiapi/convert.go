@@ -1,8 +1,12 @@
 package openaiapi
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/habiliai/agentruntime/internal/genkit/plugins/internal/config"
@@ -141,6 +145,7 @@ func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessagePa
 			}
 			msgs = append(msgs, am)
 		case ai.RoleTool: // tool
+			var media []*ai.Part
 			for _, p := range m.Content {
 				if !p.IsToolResponse() {
 					continue
@@ -149,12 +154,31 @@ func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessagePa
 				if err != nil {
 					return nil, err
 				}
+				if output, media, err = extractToolMedia(output, media); err != nil {
+					return nil, err
+				}
 				tm := goopenai.ToolMessage(
 					p.ToolResponse.Ref,
 					string(output),
 				)
 				msgs = append(msgs, tm)
 			}
+
+			// Tool messages hold only text, so images of the tool results follow
+			// in a user message
+			if len(media) > 0 {
+				multiContent := []goopenai.ChatCompletionContentPartUnionParam{
+					goopenai.TextPart("Images of the tool results:"),
+				}
+				for _, p := range media {
+					part, err := convertPart(p)
+					if err != nil {
+						return nil, err
+					}
+					multiContent = append(multiContent, part)
+				}
+				msgs = append(msgs, goopenai.UserMessageParts(multiContent...))
+			}
 		default:
 			return nil, fmt.Errorf("Unknown OpenAI Role %s", m.Role)
 		}
@@ -163,6 +187,51 @@ func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessagePa
 	return msgs, nil
 }
 
+// extractToolMedia moves the images of a JSON tool output, i.e. objects with an
+// image contentType and a url such as ai.Media, to media parts appended to
+// media. The url of each image is replaced by a reference to its media part.
+// Base64 image data without a data URL prefix is turned into a data URL.
+func extractToolMedia(output []byte, media []*ai.Part) ([]byte, []*ai.Part, error) {
+	if !bytes.Contains(output, []byte(`"contentType":"image/`)) {
+		return output, media, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(output, &value); err != nil {
+		return nil, nil, err
+	}
+
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			contentType, _ := v["contentType"].(string)
+			url, _ := v["url"].(string)
+			if strings.HasPrefix(contentType, "image/") && url != "" {
+				if !strings.HasPrefix(url, "data:") && !strings.Contains(url, "://") {
+					url = "data:" + contentType + ";base64," + url
+				}
+				media = append(media, ai.NewMediaPart(contentType, url))
+				v["url"] = fmt.Sprintf("image %d of the tool results", len(media))
+			}
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				walk(v[key])
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(value)
+
+	output, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, media, nil
+}
+
 func convertPart(part *ai.Part) (res goopenai.ChatCompletionContentPartUnionParam, err error) {
 	switch {
 	case part.IsText():
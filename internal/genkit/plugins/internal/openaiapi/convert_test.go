@@ -117,6 +117,54 @@ func TestConvertMessages(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "tool response with image",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleTool,
+					Content: []*ai.Part{ai.NewToolResponsePart(
+						&ai.ToolResponse{
+							Ref:  "call_1234",
+							Name: "knowledge_search",
+							Output: map[string]any{
+								"output": []any{
+									map[string]any{"context": "Bikes are red"},
+									map[string]any{"contentType": "image/png", "url": "iVBORw0KGgo="},
+								},
+							},
+						},
+					)},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionToolMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionToolMessageParamRoleTool),
+					Content: goopenai.F([]goopenai.ChatCompletionContentPartTextParam{
+						{
+							Text: goopenai.F(`{"output":[{"context":"Bikes are red"},{"contentType":"image/png","url":"image 1 of the tool results"}]}`),
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+						},
+					}),
+					ToolCallID: goopenai.String("call_1234"),
+				},
+				goopenai.ChatCompletionUserMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionUserMessageParamRoleUser),
+					Content: goopenai.F([]goopenai.ChatCompletionContentPartUnionParam{
+						goopenai.ChatCompletionContentPartTextParam{
+							Text: goopenai.F("Images of the tool results:"),
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+						},
+						goopenai.ChatCompletionContentPartImageParam{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+							ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+								URL:    goopenai.F("data:image/png;base64,iVBORw0KGgo="),
+								Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailAuto),
+							}),
+						},
+					}),
+				},
+			},
+		},
 		{
 			name: "text",
 			input: []*ai.Message{
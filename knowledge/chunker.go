@@ -0,0 +1,480 @@
+package knowledge
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChunkStrategyNone keeps each document as it is, without chunking
+	ChunkStrategyNone = "none"
+	// ChunkStrategyFixed packs words into chunks of the configured size
+	ChunkStrategyFixed = "fixed"
+	// ChunkStrategySentence packs whole sentences into chunks, splitting only sentences larger than a chunk
+	ChunkStrategySentence = "sentence"
+	// ChunkStrategyMarkdown chunks each markdown section separately, sentence by sentence
+	ChunkStrategyMarkdown = "markdown"
+
+	// ChunkUnitCharacter measures chunks in characters
+	ChunkUnitCharacter = "character"
+	// ChunkUnitToken measures chunks in tokens, approximated by words and punctuation marks
+	ChunkUnitToken = "token"
+
+	DefaultChunkSize    = 1000
+	DefaultChunkOverlap = 100
+
+	// Metadata keys for the position of a chunk in its source document
+	MetadataKeyChunkIndex = "chunk_index"
+	MetadataKeyChunkCount = "chunk_count"
+	MetadataKeyCharStart  = "char_start"
+	MetadataKeyCharEnd    = "char_end"
+	MetadataKeyHeading    = "heading"
+)
+
+type (
+	// Chunk is a piece of a text to be embedded on its own
+	Chunk struct {
+		Text  string `json:"text"`
+		Index int    `json:"index"`
+		// Start and End are the character offsets of the chunk in the chunked text
+		Start int `json:"start"`
+		End   int `json:"end"`
+		// Heading is the markdown heading path of the chunk, e.g. "Install > Linux"
+		Heading string `json:"heading,omitempty"`
+	}
+
+	// Chunker splits texts into chunks
+	Chunker interface {
+		Chunk(text string) []Chunk
+	}
+
+	textChunker struct {
+		strategy string
+		// headings splits texts into markdown sections before the strategy
+		// chunks each section
+		headings bool
+		unit     string
+		size     int
+		overlap  int
+	}
+
+	// span is a byte range of a text
+	span struct {
+		start, end int
+	}
+
+	// section is a markdown section with its heading path
+	section struct {
+		span
+		heading string
+	}
+)
+
+var (
+	_ Chunker = (*textChunker)(nil)
+
+	markdownHeadingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	markdownFencePattern   = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// NewChunker creates a chunker from the chunking settings of the knowledge config
+func NewChunker(conf *config.KnowledgeConfig) (Chunker, error) {
+	c := &textChunker{
+		strategy: conf.ChunkStrategy,
+		unit:     conf.ChunkUnit,
+		size:     conf.ChunkSize,
+		overlap:  conf.ChunkOverlap,
+	}
+	if c.strategy == "" {
+		c.strategy = ChunkStrategyNone
+	}
+	if c.unit == "" {
+		c.unit = ChunkUnitCharacter
+	}
+	if c.size <= 0 {
+		c.size = DefaultChunkSize
+	}
+
+	switch c.strategy {
+	case ChunkStrategyNone, ChunkStrategyFixed, ChunkStrategySentence, ChunkStrategyMarkdown:
+	default:
+		return nil, errors.Errorf("invalid chunk strategy: %s", c.strategy)
+	}
+	switch c.unit {
+	case ChunkUnitCharacter, ChunkUnitToken:
+	default:
+		return nil, errors.Errorf("invalid chunk unit: %s", c.unit)
+	}
+	if c.overlap < 0 || c.overlap >= c.size {
+		return nil, errors.Errorf("chunk overlap must be between 0 and the chunk size %d, got %d", c.size, c.overlap)
+	}
+
+	return c, nil
+}
+
+// newSectionChunker creates a chunker that splits texts into markdown heading
+// sections, chunking each section further only as the chunk strategy of conf
+// configures, e.g. one chunk per section with the "none" strategy
+func newSectionChunker(conf *config.KnowledgeConfig) (Chunker, error) {
+	chunker, err := NewChunker(conf)
+	if err != nil {
+		return nil, err
+	}
+	chunker.(*textChunker).headings = true
+	return chunker, nil
+}
+
+// Chunk splits text into chunks of at most the configured size, consecutive
+// chunks sharing up to the configured overlap
+func (c *textChunker) Chunk(text string) []Chunk {
+	sections := []section{{span: span{0, len(text)}}}
+	if c.headings || c.strategy == ChunkStrategyMarkdown {
+		sections = markdownSections(text)
+	}
+
+	var (
+		chunks []Chunk
+		// starts and ends only move forward, so character offsets are counted
+		// from the previous chunk instead of the start of text
+		starts, ends runeOffsets
+	)
+	for _, sec := range sections {
+		var spans []span
+		switch c.strategy {
+		case ChunkStrategyNone:
+			spans = []span{sec.span}
+		case ChunkStrategyFixed:
+			spans = c.pack(text, c.refine(text, wordSpans(text, sec.span)))
+		default:
+			spans = c.pack(text, c.refine(text, sentenceSpans(text, sec.span)))
+		}
+
+		for _, s := range spans {
+			s = trimSpan(text, s)
+			if s.start >= s.end {
+				continue
+			}
+			chunks = append(chunks, Chunk{
+				Text:    text[s.start:s.end],
+				Index:   len(chunks),
+				Start:   starts.at(text, s.start),
+				End:     ends.at(text, s.end),
+				Heading: sec.heading,
+			})
+		}
+	}
+
+	return chunks
+}
+
+// runeOffsets converts byte offsets of a text into character offsets, counting
+// from the previously converted offset
+type runeOffsets struct {
+	bytes, runes int
+}
+
+// at returns the character offset of the byte offset i of text
+func (o *runeOffsets) at(text string, i int) int {
+	if i < o.bytes {
+		o.bytes, o.runes = 0, 0
+	}
+	o.runes += utf8.RuneCountInString(text[o.bytes:i])
+	o.bytes = i
+	return o.runes
+}
+
+// measure returns the length of text in the chunk unit
+func (c *textChunker) measure(text string) int {
+	if c.unit == ChunkUnitToken {
+		return len(tokenSpans(text, span{0, len(text)}))
+	}
+	return utf8.RuneCountInString(text)
+}
+
+// refine splits segments larger than a chunk into words, and words larger than
+// a chunk into tokens or characters
+func (c *textChunker) refine(text string, segments []span) []span {
+	refined := make([]span, 0, len(segments))
+	for _, s := range segments {
+		if c.measure(text[s.start:s.end]) <= c.size {
+			refined = append(refined, s)
+			continue
+		}
+
+		for _, word := range wordSpans(text, s) {
+			if c.measure(text[word.start:word.end]) <= c.size {
+				refined = append(refined, word)
+			} else if c.unit == ChunkUnitToken {
+				refined = append(refined, tokenSpans(text, word)...)
+			} else {
+				refined = append(refined, runeSpans(text, word, c.size)...)
+			}
+		}
+	}
+	return refined
+}
+
+// pack greedily merges consecutive segments into chunks of at most the chunk
+// size, starting each chunk with the trailing segments of the previous chunk
+// that fit in the overlap
+func (c *textChunker) pack(text string, segments []span) []span {
+	lengths := make([]int, len(segments))
+	for i, s := range segments {
+		lengths[i] = c.measure(text[s.start:s.end])
+	}
+
+	var chunks []span
+	for i := 0; i < len(segments); {
+		j, total := i, 0
+		for j < len(segments) && (j == i || total+lengths[j] <= c.size) {
+			total += lengths[j]
+			j++
+		}
+		chunks = append(chunks, span{segments[i].start, segments[j-1].end})
+		if j == len(segments) {
+			break
+		}
+
+		next, overlap := j, 0
+		for next-1 > i && overlap+lengths[next-1] <= c.overlap {
+			overlap += lengths[next-1]
+			next--
+		}
+		i = next
+	}
+	return chunks
+}
+
+// markdownSections splits text at markdown headings outside of fenced code
+// blocks. Each section starts with its heading line.
+func markdownSections(text string) []section {
+	var (
+		sections []section
+		headings []string
+		levels   []int
+		fence    string
+		current  = section{span: span{0, 0}}
+	)
+
+	for offset := 0; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset + 1
+		}
+		line := strings.TrimRight(text[offset:end], "\r\n")
+
+		if m := markdownFencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if fence == m[1] {
+				fence = ""
+			}
+		} else if m := markdownHeadingPattern.FindStringSubmatch(line); m != nil && fence == "" {
+			current.end = offset
+			if current.start < current.end {
+				sections = append(sections, current)
+			}
+
+			level := len(m[1])
+			for len(levels) > 0 && levels[len(levels)-1] >= level {
+				levels = levels[:len(levels)-1]
+				headings = headings[:len(headings)-1]
+			}
+			levels = append(levels, level)
+			headings = append(headings, strings.TrimSpace(m[2]))
+			current = section{span: span{offset, offset}, heading: strings.Join(headings, " > ")}
+		}
+
+		offset = end
+	}
+
+	current.end = len(text)
+	if current.start < current.end {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// sentenceSpans splits s into sentences and paragraphs, each with its trailing whitespace
+func sentenceSpans(text string, s span) []span {
+	var spans []span
+	start := s.start
+	for i := s.start; i < s.end; {
+		r, size := utf8.DecodeRuneInString(text[i:s.end])
+		next := i + size
+
+		boundary := false
+		switch r {
+		case '。', '！', '？':
+			boundary = true
+		case '.', '!', '?':
+			nr, _ := utf8.DecodeRuneInString(text[next:s.end])
+			boundary = next == s.end || unicode.IsSpace(nr)
+		case '\n':
+			boundary = next < s.end && strings.HasPrefix(strings.TrimLeft(text[next:s.end], " \t\r"), "\n")
+		}
+
+		if boundary {
+			next = skipSpaces(text, next, s.end)
+			spans = append(spans, span{start, next})
+			start = next
+		}
+		i = next
+	}
+	if start < s.end {
+		spans = append(spans, span{start, s.end})
+	}
+	return spans
+}
+
+// wordSpans splits s into words, each with its trailing whitespace
+func wordSpans(text string, s span) []span {
+	var spans []span
+	start := s.start
+	for i := skipSpaces(text, s.start, s.end); i < s.end; {
+		r, size := utf8.DecodeRuneInString(text[i:s.end])
+		if unicode.IsSpace(r) {
+			next := skipSpaces(text, i, s.end)
+			spans = append(spans, span{start, next})
+			start, i = next, next
+			continue
+		}
+		i += size
+	}
+	if start < s.end {
+		spans = append(spans, span{start, s.end})
+	}
+	return spans
+}
+
+// tokenSpans splits s into approximate tokens: runs of letters and digits, CJK
+// characters and punctuation marks, each with its trailing whitespace
+func tokenSpans(text string, s span) []span {
+	var spans []span
+	i := skipSpaces(text, s.start, s.end)
+	start := s.start
+	for i < s.end {
+		r, size := utf8.DecodeRuneInString(text[i:s.end])
+		next := i + size
+		if isWordRune(r) && !isCJK(r) {
+			for next < s.end {
+				nr, nsize := utf8.DecodeRuneInString(text[next:s.end])
+				if !isWordRune(nr) || isCJK(nr) {
+					break
+				}
+				next += nsize
+			}
+		}
+		next = skipSpaces(text, next, s.end)
+		spans = append(spans, span{start, next})
+		start, i = next, next
+	}
+	return spans
+}
+
+// runeSpans splits s into pieces of size characters
+func runeSpans(text string, s span, size int) []span {
+	var spans []span
+	start, count := s.start, 0
+	for i := s.start; i < s.end; {
+		_, n := utf8.DecodeRuneInString(text[i:s.end])
+		i += n
+		count++
+		if count == size {
+			spans = append(spans, span{start, i})
+			start, count = i, 0
+		}
+	}
+	if start < s.end {
+		spans = append(spans, span{start, s.end})
+	}
+	return spans
+}
+
+// trimSpan shrinks s to exclude leading and trailing whitespace
+func trimSpan(text string, s span) span {
+	segment := text[s.start:s.end]
+	trimmed := strings.TrimLeftFunc(segment, unicode.IsSpace)
+	s.start += len(segment) - len(trimmed)
+	s.end = s.start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return s
+}
+
+func skipSpaces(text string, i, end int) int {
+	for i < end {
+		r, size := utf8.DecodeRuneInString(text[i:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// ChunkDocuments splits the embedding text of each document with chunker,
+// returning one document per chunk annotated with the position of the chunk.
+// Text content is replaced by the chunk while other content, such as the image
+// of a PDF page, is shared by the chunks of the document. The documents are
+// returned as they are with the "none" strategy, so that their IDs and content
+// hashes stay the same as without a chunker, and so is a document without any
+// text to chunk.
+func ChunkDocuments(documents []*Document, chunker Chunker) []*Document {
+	if c, ok := chunker.(*textChunker); ok && c.strategy == ChunkStrategyNone && !c.headings {
+		return documents
+	}
+
+	chunked := make([]*Document, 0, len(documents))
+	for _, doc := range documents {
+		chunks := chunker.Chunk(doc.EmbeddingText)
+		if len(chunks) == 0 {
+			// Documents without text, such as images, are kept as they are
+			chunked = append(chunked, doc)
+			continue
+		}
+		for _, chunk := range chunks {
+			metadata := maps.Clone(doc.Metadata)
+			if metadata == nil {
+				metadata = make(map[string]any)
+			}
+			metadata[MetadataKeyChunkIndex] = chunk.Index
+			metadata[MetadataKeyChunkCount] = len(chunks)
+			metadata[MetadataKeyCharStart] = chunk.Start
+			metadata[MetadataKeyCharEnd] = chunk.End
+			if chunk.Heading != "" {
+				metadata[MetadataKeyHeading] = chunk.Heading
+			}
+
+			chunkDoc := &Document{
+				ID:            doc.ID,
+				Content:       doc.Content,
+				EmbeddingText: chunk.Text,
+				Metadata:      metadata,
+			}
+			if doc.Content.Type() == ContentTypeText {
+				chunkDoc.Content.Text = chunk.Text
+			}
+			if doc.ID != "" && len(chunks) > 1 {
+				chunkDoc.ID = fmt.Sprintf("%s_chunk_%d", doc.ID, chunk.Index)
+			}
+			chunked = append(chunked, chunkDoc)
+		}
+	}
+	return chunked
+}
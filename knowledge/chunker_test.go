@@ -0,0 +1,178 @@
+package knowledge_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChunker(t *testing.T, strategy, unit string, size, overlap int) knowledge.Chunker {
+	chunker, err := knowledge.NewChunker(&config.KnowledgeConfig{
+		ChunkStrategy: strategy,
+		ChunkUnit:     unit,
+		ChunkSize:     size,
+		ChunkOverlap:  overlap,
+	})
+	require.NoError(t, err)
+	return chunker
+}
+
+func TestNewChunker(t *testing.T) {
+	_, err := knowledge.NewChunker(config.NewKnowledgeConfig())
+	require.NoError(t, err)
+
+	_, err = knowledge.NewChunker(&config.KnowledgeConfig{})
+	require.NoError(t, err)
+
+	_, err = knowledge.NewChunker(&config.KnowledgeConfig{ChunkStrategy: "paragraph"})
+	require.Error(t, err)
+
+	_, err = knowledge.NewChunker(&config.KnowledgeConfig{ChunkUnit: "byte"})
+	require.Error(t, err)
+
+	_, err = knowledge.NewChunker(&config.KnowledgeConfig{ChunkSize: 100, ChunkOverlap: 100})
+	require.Error(t, err)
+}
+
+func TestChunker_Sentence(t *testing.T) {
+	text := "Seoul is the capital of Korea. It is known for K-pop. Tokyo is the capital of Japan! Is Paris the capital of France? Yes."
+	chunks := newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 60, 0).Chunk(text)
+
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "Seoul is the capital of Korea. It is known for K-pop.", chunks[0].Text)
+	assert.Equal(t, "Tokyo is the capital of Japan!", chunks[1].Text)
+	assert.Equal(t, "Is Paris the capital of France? Yes.", chunks[2].Text)
+
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk.Text), 60)
+		assert.Equal(t, chunk.Text, text[chunk.Start:chunk.End])
+	}
+}
+
+func TestChunker_Overlap(t *testing.T) {
+	text := "One. Two. Three. Four. Five. Six."
+	chunks := newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 12, 6).Chunk(text)
+
+	require.Len(t, chunks, 4)
+	assert.Equal(t, "One. Two.", chunks[0].Text)
+	assert.Equal(t, "Two. Three.", chunks[1].Text)
+	assert.Equal(t, "Four. Five.", chunks[2].Text)
+	assert.Equal(t, "Five. Six.", chunks[3].Text)
+}
+
+func TestChunker_SplitsLongSentences(t *testing.T) {
+	text := strings.Repeat("word ", 50) + strings.Repeat("x", 25)
+	chunks := newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 20, 0).Chunk(text)
+
+	require.NotEmpty(t, chunks)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk.Text), 20)
+		assert.Equal(t, chunk.Text, text[chunk.Start:chunk.End])
+	}
+	assert.Equal(t, strings.Repeat("x", 20), chunks[len(chunks)-2].Text)
+	assert.Equal(t, "xxxxx", chunks[len(chunks)-1].Text)
+}
+
+func TestChunker_Token(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog, and then it sleeps."
+	chunks := newChunker(t, knowledge.ChunkStrategyFixed, knowledge.ChunkUnitToken, 5, 0).Chunk(text)
+
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "The quick brown fox jumps", chunks[0].Text)
+	assert.Equal(t, "over the lazy dog,", chunks[1].Text)
+	assert.Equal(t, "and then it sleeps.", chunks[2].Text)
+}
+
+func TestChunker_Markdown(t *testing.T) {
+	text := `Intro text.
+
+# Install
+
+Download the binary.
+
+## Linux
+
+Run the installer.
+
+` + "```sh\n# not a heading\n```" + `
+
+# Usage
+
+Run it.`
+	chunks := newChunker(t, knowledge.ChunkStrategyMarkdown, knowledge.ChunkUnitCharacter, 1000, 0).Chunk(text)
+
+	require.Len(t, chunks, 4)
+	assert.Equal(t, "Intro text.", chunks[0].Text)
+	assert.Empty(t, chunks[0].Heading)
+	assert.Equal(t, "# Install\n\nDownload the binary.", chunks[1].Text)
+	assert.Equal(t, "Install", chunks[1].Heading)
+	assert.Contains(t, chunks[2].Text, "# not a heading")
+	assert.Equal(t, "Install > Linux", chunks[2].Heading)
+	assert.Equal(t, "Usage", chunks[3].Heading)
+}
+
+func TestChunker_CharacterOffsets(t *testing.T) {
+	text := "안녕하세요. 반갑습니다. 좋은 하루 되세요."
+	chunks := newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 10, 0).Chunk(text)
+
+	runes := []rune(text)
+	require.Len(t, chunks, 3)
+	for _, chunk := range chunks {
+		assert.Equal(t, chunk.Text, string(runes[chunk.Start:chunk.End]))
+	}
+}
+
+func TestChunker_CharacterOffsetsWithOverlap(t *testing.T) {
+	text := "서울은 한국의 수도입니다. 도쿄는 일본의 수도입니다. 베이징은 중국의 수도입니다."
+	chunks := newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 32, 16).Chunk(text)
+
+	runes := []rune(text)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.Equal(t, chunk.Text, string(runes[chunk.Start:chunk.End]))
+	}
+}
+
+func TestChunkDocuments_NoneByDefault(t *testing.T) {
+	documents := knowledge.ProcessKnowledgeFromMap([]map[string]any{
+		{"id": "capitals", "content": strings.Repeat("Seoul is the capital of Korea. ", 100)},
+	})
+	chunker, err := knowledge.NewChunker(config.NewKnowledgeConfig())
+	require.NoError(t, err)
+
+	// Documents keep their IDs and metadata, so stored knowledge is not embedded again
+	chunked := knowledge.ChunkDocuments(documents, chunker)
+	assert.Equal(t, documents, chunked)
+	assert.NotContains(t, chunked[0].Metadata, knowledge.MetadataKeyChunkIndex)
+}
+
+func TestChunkDocuments(t *testing.T) {
+	documents := knowledge.ProcessKnowledgeFromMap([]map[string]any{
+		{"content": "Seoul is the capital of Korea. Tokyo is the capital of Japan."},
+		{"content": "Short."},
+	})
+	chunked := knowledge.ChunkDocuments(documents, newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 40, 0))
+
+	require.Len(t, chunked, 3)
+	assert.Equal(t, "Seoul is the capital of Korea.", chunked[0].EmbeddingText)
+	assert.Equal(t, chunked[0].EmbeddingText, getDocumentText(chunked[0]))
+	assert.Equal(t, 0, chunked[0].Metadata[knowledge.MetadataKeyChunkIndex])
+	assert.Equal(t, 2, chunked[0].Metadata[knowledge.MetadataKeyChunkCount])
+	assert.Equal(t, 31, chunked[1].Metadata[knowledge.MetadataKeyCharStart])
+	assert.Equal(t, 61, chunked[1].Metadata[knowledge.MetadataKeyCharEnd])
+	assert.Equal(t, 1, chunked[2].Metadata[knowledge.MetadataKeyChunkCount])
+
+	// Documents without text are kept whole
+	blank := &knowledge.Document{ID: "blank", EmbeddingText: " \n", Metadata: map[string]any{"kind": "image"}}
+	assert.Equal(t, []*knowledge.Document{blank}, knowledge.ChunkDocuments([]*knowledge.Document{blank}, newChunker(t, knowledge.ChunkStrategySentence, knowledge.ChunkUnitCharacter, 40, 0)))
+
+	// The source metadata is kept but not modified
+	assert.Equal(t, documents[0].Metadata["content"], chunked[1].Metadata["content"])
+	assert.NotContains(t, documents[0].Metadata, knowledge.MetadataKeyChunkIndex)
+}
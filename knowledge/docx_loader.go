@@ -0,0 +1,206 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ProcessDocumentFromDOCX converts a DOCX file into an unchunked document whose
+// embedding text is markdown, keeping headings, list items and tables. The
+// title and author of the file are captured as metadata. It returns nil if the
+// file has no text.
+func ProcessDocumentFromDOCX(data []byte) (*Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open DOCX")
+	}
+
+	metadata := map[string]any{
+		MetadataKeySourceType: SourceTypeDOCX,
+	}
+
+	var text string
+	for _, file := range archive.File {
+		switch file.Name {
+		case "word/document.xml":
+			r, err := file.Open()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to open DOCX document")
+			}
+			text, err = extractDOCXText(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		case "docProps/core.xml":
+			r, err := file.Open()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to open DOCX properties")
+			}
+			props, err := extractDOCXProperties(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			if props.Title != "" {
+				metadata[MetadataKeySourceTitle] = props.Title
+			}
+			if props.Creator != "" {
+				metadata["author"] = props.Creator
+			}
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	return &Document{
+		Content: Content{
+			MIMEType: "text/plain",
+			Text:     text,
+		},
+		Metadata:      metadata,
+		EmbeddingText: text,
+	}, nil
+}
+
+// docxProperties are the core properties of a DOCX file
+type docxProperties struct {
+	Title   string `xml:"title"`
+	Creator string `xml:"creator"`
+}
+
+func extractDOCXProperties(r io.Reader) (*docxProperties, error) {
+	var props docxProperties
+	if err := xml.NewDecoder(r).Decode(&props); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse DOCX properties")
+	}
+	props.Title = strings.TrimSpace(props.Title)
+	props.Creator = strings.TrimSpace(props.Creator)
+	return &props, nil
+}
+
+// extractDOCXText renders the paragraphs of word/document.xml as markdown
+func extractDOCXText(r io.Reader) (string, error) {
+	var (
+		sb         strings.Builder
+		paragraph  strings.Builder
+		cell       strings.Builder
+		style      string
+		listItem   bool
+		inText     bool
+		tableDepth int
+	)
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to parse DOCX document")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				style, listItem = "", false
+			case "pStyle":
+				style = docxAttr(t, "val")
+			case "numPr":
+				listItem = true
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					sb.WriteString("\n")
+				}
+			case "tc":
+				cell.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if text == "" {
+					continue
+				}
+				if tableDepth > 0 {
+					if cell.Len() > 0 {
+						cell.WriteString(" ")
+					}
+					cell.WriteString(text)
+					continue
+				}
+
+				if level := docxHeadingLevel(style); level > 0 {
+					sb.WriteString("\n" + strings.Repeat("#", level) + " " + text + "\n\n")
+				} else if listItem {
+					sb.WriteString("- " + text + "\n")
+				} else {
+					sb.WriteString(text + "\n\n")
+				}
+			case "tc":
+				if tableDepth == 1 {
+					sb.WriteString(cell.String() + " | ")
+				}
+			case "tr":
+				if tableDepth == 1 {
+					sb.WriteString("\n")
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					sb.WriteString("\n")
+				}
+			}
+		}
+	}
+
+	return blankLinesPattern.ReplaceAllString(sb.String(), "\n\n"), nil
+}
+
+// docxHeadingLevel returns the markdown heading level of a paragraph style, or 0
+// if the style is not a heading
+func docxHeadingLevel(style string) int {
+	style = strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	if style == "title" {
+		return 1
+	}
+	level, err := strconv.Atoi(strings.TrimPrefix(style, "heading"))
+	if err != nil || !strings.HasPrefix(style, "heading") || level < 1 {
+		return 0
+	}
+	return min(level, 6)
+}
+
+func docxAttr(element xml.StartElement, local string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package knowledge_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDOCXDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:body>
+    <w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Employee Handbook</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Leave</w:t></w:r></w:p>
+    <w:p><w:r><w:t xml:space="preserve">Employees get </w:t></w:r><w:r><w:t>25 days of leave.</w:t></w:r></w:p>
+    <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Request leave two weeks ahead</w:t></w:r></w:p>
+    <w:tbl>
+      <w:tr><w:tc><w:p><w:r><w:t>Years</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Days</w:t></w:r></w:p></w:tc></w:tr>
+      <w:tr><w:tc><w:p><w:r><w:t>5+</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>30</w:t></w:r></w:p></w:tc></w:tr>
+    </w:tbl>
+  </w:body>
+</w:document>`
+
+const testDOCXCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:title>Handbook 2025</dc:title>
+  <dc:creator>HR Team</dc:creator>
+</cp:coreProperties>`
+
+func newTestDOCX(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"word/document.xml": testDOCXDocument,
+		"docProps/core.xml": testDOCXCore,
+	} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestProcessDocumentFromDOCX(t *testing.T) {
+	data := newTestDOCX(t)
+	assert.Equal(t, knowledge.SourceTypeDOCX, knowledge.DetectSourceType("", data))
+
+	doc, err := knowledge.ProcessDocumentFromDOCX(data)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+
+	assert.Equal(t, "Handbook 2025", doc.Metadata[knowledge.MetadataKeySourceTitle])
+	assert.Equal(t, "HR Team", doc.Metadata["author"])
+	assert.Equal(t, knowledge.SourceTypeDOCX, doc.Metadata[knowledge.MetadataKeySourceType])
+
+	assert.Contains(t, doc.EmbeddingText, "# Employee Handbook")
+	assert.Contains(t, doc.EmbeddingText, "## Leave\n\nEmployees get 25 days of leave.")
+	assert.Contains(t, doc.EmbeddingText, "- Request leave two weeks ahead")
+	assert.Contains(t, doc.EmbeddingText, "Years | Days |")
+	assert.Contains(t, doc.EmbeddingText, "5+ | 30 |")
+
+	_, err = knowledge.ProcessDocumentFromDOCX([]byte("not a zip"))
+	assert.Error(t, err)
+}
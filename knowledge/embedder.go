@@ -4,22 +4,81 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"hash/fnv"
 	"io"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/config"
 	"github.com/pkg/errors"
 )
 
 type (
 	EmbeddingTaskType string
 
-	Embedder struct {
+	// Embedder generates embeddings for knowledge documents and search queries
+	Embedder interface {
+		// EmbedTexts embeds texts for the given task. Embedders without task
+		// types embed documents and queries the same way.
+		EmbedTexts(ctx context.Context, taskType EmbeddingTaskType, texts ...string) ([][]float32, error)
+		// GetEmbedSize returns the size of the produced embeddings
+		GetEmbedSize() int
+	}
+
+	// ImageEmbedder is an Embedder that also embeds images into a vision space
+	// aligned with the embeddings of its search queries, so that text queries
+	// find images
+	ImageEmbedder interface {
+		Embedder
+		EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][]float32, error)
+		EmbedImageFiles(ctx context.Context, mimeType string, imageFiles ...[]byte) ([][]float32, error)
+	}
+
+	// NomicEmbedder embeds through the Nomic Atlas API. Images embedded with
+	// nomic-embed-vision-v1.5 share the space of search queries embedded with
+	// nomic-embed-text-v1.5.
+	NomicEmbedder struct {
 		client *http.Client
 		apiKey string
 	}
+
+	// GenkitEmbedder embeds through an embedder registered in genkit, e.g. OpenAI text-embedding-3-*
+	GenkitEmbedder struct {
+		embedder  ai.Embedder
+		dimension int
+	}
+
+	// OpenAICompatibleEmbedder embeds through any OpenAI-compatible /embeddings
+	// endpoint, e.g. Ollama, llama.cpp or vLLM
+	OpenAICompatibleEmbedder struct {
+		client    *http.Client
+		baseURL   string
+		apiKey    string
+		model     string
+		dimension int
+	}
+
+	// EmbedderOption customizes the embedders calling an HTTP API
+	EmbedderOption func(*embedderOptions)
+
+	embedderOptions struct {
+		client *http.Client
+	}
+
+	// FakeEmbedder is a deterministic bag-of-words embedder for tests. Texts
+	// sharing words get similar embeddings without calling any API. Images are
+	// embedded from the words in their bytes, so tests can label images with
+	// the words a query matches.
+	FakeEmbedder struct {
+		dimension int
+	}
 )
 
 const (
@@ -31,17 +90,135 @@ const (
 
 	NomicVisionEmbedderModel = "nomic-embed-vision-v1.5"
 	NomicTextEmbedderModel   = "nomic-embed-text-v1.5"
+
+	EmbeddingProviderNomic            = "nomic"
+	EmbeddingProviderOpenAI           = "openai"
+	EmbeddingProviderOpenAICompatible = "openai-compatible"
+	EmbeddingProviderFake             = "fake"
+
+	DefaultOpenAIEmbeddingModel = "text-embedding-3-small"
+
+	// DefaultEmbedderTimeout bounds the embedding requests of the HTTP embedders
+	// created without WithHTTPClient
+	DefaultEmbedderTimeout = 60 * time.Second
+
+	nomicEmbedSize       = 768
+	defaultFakeEmbedSize = 64
+)
+
+var (
+	_ ImageEmbedder = (*NomicEmbedder)(nil)
+	_ Embedder      = (*GenkitEmbedder)(nil)
+	_ Embedder      = (*OpenAICompatibleEmbedder)(nil)
+	_ ImageEmbedder = (*FakeEmbedder)(nil)
+
+	// openAIEmbeddingDimensions holds the output size of the OpenAI embedding models
+	openAIEmbeddingDimensions = map[string]int{
+		"text-embedding-3-small": 1536,
+		"text-embedding-3-large": 3072,
+		"text-embedding-ada-002": 1536,
+	}
 )
 
 func (e *EmbeddingTaskType) String() string {
 	return string(*e)
 }
 
-func NewEmbedder(apiKey string) Embedder {
-	return Embedder{client: http.DefaultClient, apiKey: apiKey}
+// NewEmbedder creates the embedder selected by the knowledge configuration
+func NewEmbedder(g *genkit.Genkit, conf *config.KnowledgeConfig) (Embedder, error) {
+	var embedder Embedder
+	switch provider := conf.EmbeddingProvider; provider {
+	case "", EmbeddingProviderNomic:
+		// The API key is checked by the Nomic API so that agents without
+		// knowledge keep working without one
+		embedder = NewNomicEmbedder(conf.NomicAPIKey)
+	case EmbeddingProviderOpenAI:
+		model := conf.EmbeddingModel
+		if model == "" {
+			model = DefaultOpenAIEmbeddingModel
+		}
+		model = strings.TrimPrefix(model, "openai/")
+
+		// The embeddings are requested at the native size of the model
+		if native := openAIEmbeddingDimensions[model]; native > 0 && conf.VectorDimension > 0 && conf.VectorDimension != native {
+			return nil, errors.Errorf("openai/%s embeddings have %d dimensions, vectorDimension %d is not supported", model, native, conf.VectorDimension)
+		}
+
+		e := genkit.LookupEmbedder(g, "openai", model)
+		if e == nil {
+			return nil, errors.Errorf("no embedder available: openai/%s is not registered - set an OpenAI API key or choose another embedding provider", model)
+		}
+
+		dimension := conf.VectorDimension
+		if dimension == 0 {
+			dimension = openAIEmbeddingDimensions[model]
+		}
+		if dimension == 0 {
+			return nil, errors.Errorf("unknown embedding dimension for openai/%s - set vectorDimension", model)
+		}
+		embedder = NewGenkitEmbedder(e, dimension)
+	case EmbeddingProviderOpenAICompatible:
+		if conf.EmbeddingBaseURL == "" {
+			return nil, errors.New("no embedder available: openai-compatible embedding provider requires embeddingBaseUrl")
+		}
+		if conf.EmbeddingModel == "" {
+			return nil, errors.New("no embedder available: openai-compatible embedding provider requires embeddingModel")
+		}
+		if conf.VectorDimension <= 0 {
+			return nil, errors.New("openai-compatible embedding provider requires vectorDimension")
+		}
+		embedder = NewOpenAICompatibleEmbedder(conf.EmbeddingBaseURL, conf.EmbeddingAPIKey, conf.EmbeddingModel, conf.VectorDimension)
+	case EmbeddingProviderFake:
+		dimension := conf.VectorDimension
+		if dimension == 0 {
+			dimension = defaultFakeEmbedSize
+		}
+		embedder = NewFakeEmbedder(dimension)
+	default:
+		return nil, errors.Errorf("invalid embedding provider: %s", provider)
+	}
+
+	if conf.VectorDimension > 0 && conf.VectorDimension != embedder.GetEmbedSize() {
+		return nil, errors.Errorf("vectorDimension %d does not match the embedder dimension %d", conf.VectorDimension, embedder.GetEmbedSize())
+	}
+
+	return embedder, nil
+}
+
+// embedderID identifies the embedder configured by conf, so that stores can tell
+// embeddings of different models apart
+func embedderID(conf *config.KnowledgeConfig) string {
+	provider := conf.EmbeddingProvider
+	if provider == "" {
+		provider = EmbeddingProviderNomic
+	}
+	model := conf.EmbeddingModel
+	if model == "" && provider == EmbeddingProviderOpenAI {
+		model = DefaultOpenAIEmbeddingModel
+	}
+	return provider + "/" + model
+}
+
+// WithHTTPClient sets the HTTP client embedding requests are sent with
+func WithHTTPClient(client *http.Client) EmbedderOption {
+	return func(o *embedderOptions) {
+		o.client = client
+	}
+}
+
+func newEmbedderOptions(opts []EmbedderOption) *embedderOptions {
+	o := &embedderOptions{client: &http.Client{Timeout: DefaultEmbedderTimeout}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
-func (e *Embedder) EmbedTexts(ctx context.Context, taskType EmbeddingTaskType, texts ...string) ([][]float32, error) {
+func NewNomicEmbedder(apiKey string, opts ...EmbedderOption) *NomicEmbedder {
+	return &NomicEmbedder{client: newEmbedderOptions(opts).client, apiKey: apiKey}
+}
+
+func (e *NomicEmbedder) EmbedTexts(ctx context.Context, taskType EmbeddingTaskType, texts ...string) ([][]float32, error) {
 	var requestBody bytes.Buffer
 	if err := json.NewEncoder(&requestBody).Encode(struct {
 		TaskType string   `json:"task_type"`
@@ -83,7 +260,7 @@ func (e *Embedder) EmbedTexts(ctx context.Context, taskType EmbeddingTaskType, t
 	return response.Embeddings, nil
 }
 
-func (e *Embedder) EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][]float32, error) {
+func (e *NomicEmbedder) EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][]float32, error) {
 	// Create form data
 	formData := url.Values{}
 	formData.Set("model", NomicVisionEmbedderModel)
@@ -120,7 +297,7 @@ func (e *Embedder) EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][
 	return response.Embeddings, nil
 }
 
-func (e *Embedder) EmbedImageFiles(ctx context.Context, mimeType string, imageFiles ...[]byte) ([][]float32, error) {
+func (e *NomicEmbedder) EmbedImageFiles(ctx context.Context, mimeType string, imageFiles ...[]byte) ([][]float32, error) {
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
 
@@ -187,6 +364,166 @@ func (e *Embedder) EmbedImageFiles(ctx context.Context, mimeType string, imageFi
 	return response.Embeddings, nil
 }
 
-func (e *Embedder) GetEmbedSize() int {
-	return 768
+func (e *NomicEmbedder) GetEmbedSize() int {
+	return nomicEmbedSize
+}
+
+func NewGenkitEmbedder(embedder ai.Embedder, dimension int) *GenkitEmbedder {
+	return &GenkitEmbedder{embedder: embedder, dimension: dimension}
+}
+
+func (e *GenkitEmbedder) EmbedTexts(ctx context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	docs := make([]*ai.Document, 0, len(texts))
+	for _, text := range texts {
+		docs = append(docs, &ai.Document{Content: []*ai.Part{ai.NewTextPart(text)}})
+	}
+
+	resp, err := e.embedder.Embed(ctx, &ai.EmbedRequest{Input: docs})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to embed text")
+	}
+
+	embeddings := make([][]float32, 0, len(resp.Embeddings))
+	for _, embedding := range resp.Embeddings {
+		embeddings = append(embeddings, embedding.Embedding)
+	}
+
+	return checkEmbeddings(embeddings, len(texts), e.dimension)
+}
+
+func (e *GenkitEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
+
+// NewOpenAICompatibleEmbedder creates an embedder for the OpenAI-compatible API at
+// baseURL (e.g. http://localhost:11434/v1). apiKey is optional.
+func NewOpenAICompatibleEmbedder(baseURL string, apiKey string, model string, dimension int, opts ...EmbedderOption) *OpenAICompatibleEmbedder {
+	return &OpenAICompatibleEmbedder{
+		client:    newEmbedderOptions(opts).client,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    apiKey,
+		model:     model,
+		dimension: dimension,
+	}
+}
+
+func (e *OpenAICompatibleEmbedder) EmbedTexts(ctx context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	var requestBody bytes.Buffer
+	if err := json.NewEncoder(&requestBody).Encode(struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{
+		Model: e.model,
+		Input: texts,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode request body")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", &requestBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.Errorf("failed to embed text: HTTP %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode response")
+	}
+
+	if len(response.Data) != len(texts) {
+		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(response.Data), len(texts))
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, errors.Errorf("invalid or duplicate embedding index %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return checkEmbeddings(embeddings, len(texts), e.dimension)
+}
+
+func (e *OpenAICompatibleEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
+
+// checkEmbeddings returns embeddings if there is one of dimension for each of
+// count inputs
+func checkEmbeddings(embeddings [][]float32, count int, dimension int) ([][]float32, error) {
+	if len(embeddings) != count {
+		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), count)
+	}
+	for i, embedding := range embeddings {
+		if len(embedding) != dimension {
+			return nil, errors.Errorf("embedding %d dimension mismatch: got %d, expected %d", i, len(embedding), dimension)
+		}
+	}
+	return embeddings, nil
+}
+
+func NewFakeEmbedder(dimension int) *FakeEmbedder {
+	return &FakeEmbedder{dimension: dimension}
+}
+
+func (e *FakeEmbedder) EmbedTexts(_ context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		embedding := make([]float32, e.dimension)
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(word))
+			embedding[h.Sum32()%uint32(e.dimension)] += 1
+		}
+
+		var norm float64
+		for _, v := range embedding {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			for i := range embedding {
+				embedding[i] = float32(float64(embedding[i]) / math.Sqrt(norm))
+			}
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
+
+func (e *FakeEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
+
+func (e *FakeEmbedder) EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][]float32, error) {
+	return e.EmbedTexts(ctx, EmbeddingTaskTypeDocument, imageUrls...)
+}
+
+func (e *FakeEmbedder) EmbedImageFiles(ctx context.Context, _ string, imageFiles ...[]byte) ([][]float32, error) {
+	texts := make([]string, 0, len(imageFiles))
+	for _, imageFile := range imageFiles {
+		texts = append(texts, string(imageFile))
+	}
+	return e.EmbedTexts(ctx, EmbeddingTaskTypeDocument, texts...)
 }
@@ -2,10 +2,18 @@ package knowledge
 
 import (
 	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/habiliai/agentruntime/config"
+	internalgenkit "github.com/habiliai/agentruntime/internal/genkit"
 	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,7 +54,7 @@ func TestEmbeddingTaskType_String(t *testing.T) {
 }
 
 func TestEmbedder_GetEmbedSize(t *testing.T) {
-	embedder := NewEmbedder("test-key")
+	embedder := NewNomicEmbedder("test-key")
 	expected := 768
 	result := embedder.GetEmbedSize()
 
@@ -55,6 +63,171 @@ func TestEmbedder_GetEmbedSize(t *testing.T) {
 	}
 }
 
+func TestNewEmbedder(t *testing.T) {
+	g, err := internalgenkit.NewGenkit(t.Context(), &config.ModelConfig{}, slog.Default(), false)
+	require.NoError(t, err)
+
+	t.Run("nomic by default", func(t *testing.T) {
+		embedder, err := NewEmbedder(g, &config.KnowledgeConfig{})
+		require.NoError(t, err)
+		assert.IsType(t, &NomicEmbedder{}, embedder)
+		assert.Equal(t, 768, embedder.GetEmbedSize())
+	})
+
+	t.Run("fake", func(t *testing.T) {
+		embedder, err := NewEmbedder(g, &config.KnowledgeConfig{EmbeddingProvider: EmbeddingProviderFake, VectorDimension: 8})
+		require.NoError(t, err)
+		assert.Equal(t, 8, embedder.GetEmbedSize())
+	})
+
+	tests := []struct {
+		name     string
+		conf     *config.KnowledgeConfig
+		contains string
+	}{
+		{
+			name:     "openai without API key",
+			conf:     &config.KnowledgeConfig{EmbeddingProvider: EmbeddingProviderOpenAI},
+			contains: "no embedder available",
+		},
+		{
+			name:     "openai-compatible without dimension",
+			conf:     &config.KnowledgeConfig{EmbeddingProvider: EmbeddingProviderOpenAICompatible, EmbeddingBaseURL: "http://localhost:11434/v1", EmbeddingModel: "nomic-embed-text"},
+			contains: "vectorDimension",
+		},
+		{
+			name:     "openai with a dimension the model does not produce",
+			conf:     &config.KnowledgeConfig{EmbeddingProvider: EmbeddingProviderOpenAI, VectorDimension: 512},
+			contains: "vectorDimension 512 is not supported",
+		},
+		{
+			name:     "nomic with mismatching dimension",
+			conf:     &config.KnowledgeConfig{EmbeddingProvider: EmbeddingProviderNomic, VectorDimension: 1536},
+			contains: "does not match",
+		},
+		{
+			name:     "unknown provider",
+			conf:     &config.KnowledgeConfig{EmbeddingProvider: "unknown"},
+			contains: "invalid embedding provider",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEmbedder(g, tt.conf)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.contains)
+		})
+	}
+}
+
+func TestFakeEmbedder(t *testing.T) {
+	embedder := NewFakeEmbedder(32)
+
+	embeddings, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument, "The launch is on June 3", "the LAUNCH is on june 3", "Hiring a backend engineer")
+	require.NoError(t, err)
+	require.Len(t, embeddings, 3)
+	for _, embedding := range embeddings {
+		require.Len(t, embedding, 32)
+	}
+	assert.Equal(t, embeddings[0], embeddings[1], "embeddings should be deterministic and case-insensitive")
+	assert.NotEqual(t, embeddings[0], embeddings[2])
+}
+
+func TestOpenAICompatibleEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+
+		type data struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		resp := struct {
+			Data []data `json:"data"`
+		}{}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, data{Index: i, Embedding: []float32{float32(i), 1}})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	g, err := internalgenkit.NewGenkit(t.Context(), &config.ModelConfig{}, slog.Default(), false)
+	require.NoError(t, err)
+
+	embedder, err := NewEmbedder(g, &config.KnowledgeConfig{
+		EmbeddingProvider: EmbeddingProviderOpenAICompatible,
+		EmbeddingBaseURL:  server.URL + "/v1/",
+		EmbeddingModel:    "nomic-embed-text",
+		VectorDimension:   2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, embedder.GetEmbedSize())
+
+	embeddings, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeQuery, "first", "second")
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0, 1}, {1, 1}}, embeddings)
+}
+
+func TestOpenAICompatibleEmbedder_InvalidResponse(t *testing.T) {
+	type data struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	}
+	tests := []struct {
+		name     string
+		data     []data
+		contains string
+	}{
+		{name: "missing result", data: []data{{Index: 0, Embedding: []float32{0, 1}}}, contains: "count mismatch"},
+		{name: "duplicate index", data: []data{{Index: 1, Embedding: []float32{0, 1}}, {Index: 1, Embedding: []float32{1, 1}}}, contains: "duplicate embedding index 1"},
+		{name: "index out of range", data: []data{{Index: 0, Embedding: []float32{0, 1}}, {Index: 2, Embedding: []float32{1, 1}}}, contains: "embedding index 2"},
+		{name: "wrong dimension", data: []data{{Index: 0, Embedding: []float32{0, 1}}, {Index: 1, Embedding: []float32{1, 1, 1}}}, contains: "embedding 1 dimension mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"data": tt.data}))
+			}))
+			defer server.Close()
+
+			embedder := NewOpenAICompatibleEmbedder(server.URL, "", "nomic-embed-text", 2)
+			_, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument, "first", "second")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.contains)
+		})
+	}
+}
+
+func TestOpenAICompatibleEmbedder_HTTPClient(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// Requests are bounded by a timeout unless another client is given
+	assert.Equal(t, DefaultEmbedderTimeout, NewOpenAICompatibleEmbedder(server.URL, "", "nomic-embed-text", 2).client.Timeout)
+	assert.Equal(t, DefaultEmbedderTimeout, NewNomicEmbedder("test-key").client.Timeout)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	embedder := NewOpenAICompatibleEmbedder(server.URL, "", "nomic-embed-text", 2, WithHTTPClient(client))
+	assert.Same(t, client, embedder.client)
+	assert.Same(t, client, NewNomicEmbedder("test-key", WithHTTPClient(client)).client)
+
+	_, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeQuery, "first")
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
 func TestEmbedder_EmbedTexts(t *testing.T) {
 	// Load .env file if it exists (try both current directory and parent directory)
 	_ = godotenv.Load("../.env")
@@ -64,7 +237,7 @@ func TestEmbedder_EmbedTexts(t *testing.T) {
 		t.Skip("NOMIC_API_KEY environment variable not set, skipping live API test")
 	}
 
-	embedder := NewEmbedder(apiKey)
+	embedder := NewNomicEmbedder(apiKey)
 
 	t.Run("successful embedding", func(t *testing.T) {
 		embeddings, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument, "hello", "world")
@@ -107,7 +280,7 @@ func TestEmbedder_EmbedImageUrls(t *testing.T) {
 		t.Skip("NOMIC_API_KEY environment variable not set, skipping live API test")
 	}
 
-	embedder := NewEmbedder(apiKey)
+	embedder := NewNomicEmbedder(apiKey)
 
 	t.Run("successful embedding with public image", func(t *testing.T) {
 		// Using Nomic's example image URL from their documentation
@@ -158,7 +331,7 @@ func TestEmbedder_EmbedImageFiles(t *testing.T) {
 		t.Skip("NOMIC_API_KEY environment variable not set, skipping live API test")
 	}
 
-	embedder := NewEmbedder(apiKey)
+	embedder := NewNomicEmbedder(apiKey)
 
 	t.Run("successful embedding with small PNG", func(t *testing.T) {
 		// Create a minimal 1x1 PNG image in memory
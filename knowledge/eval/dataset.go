@@ -0,0 +1,152 @@
+// Package eval measures the retrieval quality of knowledge bases. It runs the
+// labeled queries of a dataset against knowledge services built from different
+// KnowledgeConfig variants and reports recall@k, MRR and nDCG for each variant.
+package eval
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Dataset is a corpus to index and the labeled queries to evaluate against it
+	Dataset struct {
+		Knowledge []Corpus `json:"knowledge"`
+		Queries   []Query  `json:"queries"`
+	}
+
+	// Corpus is a knowledge base indexed under ID before the queries are run.
+	// Exactly one of Files, Texts and Records is set.
+	Corpus struct {
+		ID string `json:"id"`
+		// Files are indexed with IndexKnowledgeFromFiles. Relative paths are
+		// resolved against the directory of the dataset file.
+		Files []string `json:"files,omitempty"`
+		// Texts are indexed with IndexKnowledgeFromText
+		Texts []string `json:"texts,omitempty"`
+		// Records are indexed with IndexKnowledgeFromMap
+		Records []map[string]any `json:"records,omitempty"`
+		// Loader configures how Files are loaded
+		Loader knowledge.LoaderOptions `json:"loader,omitempty"`
+	}
+
+	// Query is a query labeled with what a good retrieval returns. A result is
+	// relevant when it is one of ExpectedDocumentIDs, a chunk of one of them, or
+	// contains one of ExpectedAnswers.
+	Query struct {
+		// ID identifies the query in reports. Defaults to its 1-based position.
+		ID    string `json:"id,omitempty"`
+		Query string `json:"query"`
+		// KnowledgeIDs restricts the search to these knowledge bases. When empty,
+		// all knowledge bases of the dataset are searched.
+		KnowledgeIDs []string `json:"knowledgeIds,omitempty"`
+		// ExpectedDocumentIDs are the IDs of the documents that answer the query,
+		// such as "catalog_item_zx-9000". Their chunks count as the document.
+		ExpectedDocumentIDs []string `json:"expectedDocumentIds,omitempty"`
+		// ExpectedAnswers are text snippets that a relevant result contains,
+		// compared case-insensitively
+		ExpectedAnswers []string `json:"expectedAnswers,omitempty"`
+	}
+)
+
+// LoadDataset reads a dataset in YAML or JSON format
+func LoadDataset(r io.Reader) (*Dataset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read dataset")
+	}
+
+	var dataset Dataset
+	if err := yaml.Unmarshal(data, &dataset); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse dataset")
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &dataset, nil
+}
+
+// LoadDatasetFile reads a dataset file and resolves the relative corpus file
+// paths against its directory
+func LoadDatasetFile(path string) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open dataset")
+	}
+	defer f.Close()
+
+	dataset, err := LoadDataset(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid dataset %s", path)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range dataset.Knowledge {
+		for j, file := range dataset.Knowledge[i].Files {
+			if !filepath.IsAbs(file) {
+				dataset.Knowledge[i].Files[j] = filepath.Join(dir, file)
+			}
+		}
+	}
+
+	return dataset, nil
+}
+
+// Validate checks that the corpus and the queries are well formed
+func (d *Dataset) Validate() error {
+	if len(d.Queries) == 0 {
+		return errors.New("dataset has no queries")
+	}
+
+	ids := make(map[string]bool, len(d.Knowledge))
+	for i, corpus := range d.Knowledge {
+		if corpus.ID == "" {
+			return errors.Errorf("knowledge %d has no id", i+1)
+		}
+		if ids[corpus.ID] {
+			return errors.Errorf("duplicate knowledge id %q", corpus.ID)
+		}
+		ids[corpus.ID] = true
+
+		var sources int
+		for _, set := range []bool{len(corpus.Files) > 0, len(corpus.Texts) > 0, len(corpus.Records) > 0} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return errors.Errorf("knowledge %q must have exactly one of files, texts and records", corpus.ID)
+		}
+	}
+
+	for i, query := range d.Queries {
+		if query.Query == "" {
+			return errors.Errorf("query %d is empty", i+1)
+		}
+		if len(query.ExpectedDocumentIDs) == 0 && len(query.ExpectedAnswers) == 0 {
+			return errors.Errorf("query %d has no expectedDocumentIds or expectedAnswers", i+1)
+		}
+		for _, id := range query.KnowledgeIDs {
+			if !ids[id] {
+				return errors.Errorf("query %d searches unknown knowledge %q", i+1, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// knowledgeIDs returns the IDs of all knowledge bases of the dataset
+func (d *Dataset) knowledgeIDs() []string {
+	ids := make([]string, len(d.Knowledge))
+	for i, corpus := range d.Knowledge {
+		ids[i] = corpus.ID
+	}
+	return ids
+}
@@ -0,0 +1,202 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/pkg/errors"
+)
+
+// DefaultK is the default number of results evaluated per query
+const DefaultK = 5
+
+type (
+	// Variant is a named set of KnowledgeConfig overrides, keyed by their JSON
+	// names, such as {"rerankEnabled": false, "chunkSize": 500}
+	Variant struct {
+		Name   string         `json:"name"`
+		Config map[string]any `json:"config,omitempty"`
+	}
+
+	// Options configures Run
+	Options struct {
+		// K is the number of results retrieved and evaluated per query. Default: DefaultK
+		K int
+		// ModelConfig provides the API keys of the embedding, rerank and query
+		// rewrite models
+		ModelConfig *config.ModelConfig
+		// BaseConfig is the configuration the variants override. Default: NewKnowledgeConfig()
+		BaseConfig *config.KnowledgeConfig
+		// NewService creates the knowledge service of a variant. Default: an
+		// in-memory SQLite store per variant, so variants do not share an index.
+		NewService func(ctx context.Context, conf *config.KnowledgeConfig) (knowledge.Service, error)
+		Logger     *slog.Logger
+	}
+)
+
+// DefaultVariants compares retrieval without reranking and query rewriting to
+// enabling each of them, and to sentence chunks of a smaller and a larger size
+func DefaultVariants() []Variant {
+	plain := func(overrides map[string]any) map[string]any {
+		conf := map[string]any{
+			"rerankEnabled":       false,
+			"queryRewriteEnabled": false,
+		}
+		for key, value := range overrides {
+			conf[key] = value
+		}
+		return conf
+	}
+
+	return []Variant{
+		{Name: "baseline", Config: plain(nil)},
+		{Name: "rerank", Config: plain(map[string]any{"rerankEnabled": true})},
+		{Name: "hyde", Config: plain(map[string]any{"queryRewriteEnabled": true, "queryRewriteStrategy": "hyde"})},
+		{Name: "expansion", Config: plain(map[string]any{"queryRewriteEnabled": true, "queryRewriteStrategy": "expansion"})},
+		{Name: "multi", Config: plain(map[string]any{"queryRewriteEnabled": true, "queryRewriteStrategy": "multi"})},
+		{Name: "chunk-500", Config: plain(map[string]any{"chunkStrategy": "sentence", "chunkSize": 500, "chunkOverlap": 50})},
+		{Name: "chunk-2000", Config: plain(map[string]any{"chunkStrategy": "sentence", "chunkSize": 2000, "chunkOverlap": 200})},
+	}
+}
+
+// LoadVariants reads a list of variants in YAML or JSON format
+func LoadVariants(r io.Reader) ([]Variant, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read variants")
+	}
+
+	var variants []Variant
+	if err := yaml.Unmarshal(data, &variants); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse variants")
+	}
+	if len(variants) == 0 {
+		return nil, errors.New("no variants")
+	}
+
+	return variants, nil
+}
+
+// Apply returns a copy of base with the overrides of the variant
+func (v Variant) Apply(base *config.KnowledgeConfig) (*config.KnowledgeConfig, error) {
+	conf := *base
+	if len(v.Config) == 0 {
+		return &conf, nil
+	}
+
+	data, err := json.Marshal(v.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config of variant %q", v.Name)
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, errors.Wrapf(err, "invalid config of variant %q", v.Name)
+	}
+
+	return &conf, nil
+}
+
+// Run indexes the corpus of dataset and evaluates its queries once per variant.
+// The first variant is the baseline of the per-query diffs.
+func Run(ctx context.Context, dataset *Dataset, variants []Variant, opts Options) (*Report, error) {
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return nil, errors.New("no variants")
+	}
+
+	if opts.K <= 0 {
+		opts.K = DefaultK
+	}
+	if opts.ModelConfig == nil {
+		opts.ModelConfig = &config.ModelConfig{}
+	}
+	if opts.BaseConfig == nil {
+		opts.BaseConfig = config.NewKnowledgeConfig()
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if opts.NewService == nil {
+		opts.NewService = func(ctx context.Context, conf *config.KnowledgeConfig) (knowledge.Service, error) {
+			conf.PgvectorEnabled = false
+			conf.SqliteEnabled = true
+			conf.SqlitePath = ":memory:"
+			return knowledge.NewService(ctx, opts.ModelConfig, conf, opts.Logger)
+		}
+	}
+
+	report := &Report{K: opts.K}
+	for _, variant := range variants {
+		opts.Logger.Info("evaluating variant", slog.String("variant", variant.Name))
+
+		vr, err := runVariant(ctx, dataset, variant, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "variant %q", variant.Name)
+		}
+		report.Variants = append(report.Variants, *vr)
+	}
+	report.Diffs = diffQueries(report.Variants)
+
+	return report, nil
+}
+
+func runVariant(ctx context.Context, dataset *Dataset, variant Variant, opts Options) (*VariantReport, error) {
+	conf, err := variant.Apply(opts.BaseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := opts.NewService(ctx, conf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create knowledge service")
+	}
+	defer service.Close()
+
+	for _, corpus := range dataset.Knowledge {
+		switch {
+		case len(corpus.Files) > 0:
+			_, err = service.IndexKnowledgeFromFiles(ctx, corpus.ID, corpus.Files, corpus.Loader)
+		case len(corpus.Texts) > 0:
+			_, err = service.IndexKnowledgeFromText(ctx, corpus.ID, corpus.Texts)
+		default:
+			_, err = service.IndexKnowledgeFromMap(ctx, corpus.ID, corpus.Records)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to index knowledge %q", corpus.ID)
+		}
+	}
+
+	vr := &VariantReport{Name: variant.Name, Config: variant.Config}
+	allKnowledgeIDs := dataset.knowledgeIDs()
+	for i, query := range dataset.Queries {
+		if query.ID == "" {
+			query.ID = strconv.Itoa(i + 1)
+		}
+		knowledgeIDs := query.KnowledgeIDs
+		if len(knowledgeIDs) == 0 {
+			knowledgeIDs = allKnowledgeIDs
+		}
+
+		results, err := service.RetrieveRelevantKnowledge(ctx, query.Query, opts.K, knowledgeIDs)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			qr := EvaluateQuery(query, nil, opts.K)
+			qr.Error = err.Error()
+			vr.Queries = append(vr.Queries, qr)
+			continue
+		}
+		vr.Queries = append(vr.Queries, EvaluateQuery(query, results, opts.K))
+	}
+	vr.summarize()
+
+	return vr, nil
+}
@@ -0,0 +1,201 @@
+package eval_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/knowledge/eval"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchResult(id, text string) *knowledge.KnowledgeSearchResult {
+	return &knowledge.KnowledgeSearchResult{
+		Document: &knowledge.Document{
+			ID:            id,
+			Content:       knowledge.Content{MIMEType: "text/plain", Text: text},
+			EmbeddingText: text,
+		},
+	}
+}
+
+func TestEvaluateQuery(t *testing.T) {
+	results := []*knowledge.KnowledgeSearchResult{
+		searchResult("faq_item_1", "Shipping takes 3 days"),
+		searchResult("faq_item_2_chunk_0", "Returns are accepted within 30 days"),
+		searchResult("faq_item_2_chunk_1", "Returns need a receipt"),
+		searchResult("faq_item_3", "Gift cards never expire"),
+	}
+
+	t.Run("document ids", func(t *testing.T) {
+		qr := eval.EvaluateQuery(eval.Query{
+			ID:                  "returns",
+			Query:               "How do returns work?",
+			ExpectedDocumentIDs: []string{"faq_item_2", "faq_item_9"},
+		}, results, 3)
+
+		assert.Equal(t, []string{"faq_item_1", "faq_item_2_chunk_0", "faq_item_2_chunk_1"}, qr.RetrievedIDs)
+		assert.Equal(t, []string{"faq_item_2"}, qr.Found)
+		assert.Equal(t, []string{"faq_item_9"}, qr.Missed)
+		assert.InDelta(t, 0.5, qr.Recall, 1e-9)
+		assert.InDelta(t, 0.5, qr.ReciprocalRank, 1e-9)
+		// One relevant result at rank 2 out of an ideal of two at ranks 1 and 2
+		assert.InDelta(t, (1/1.5849625)/(1+1/1.5849625), qr.NDCG, 1e-6)
+	})
+
+	t.Run("answers", func(t *testing.T) {
+		qr := eval.EvaluateQuery(eval.Query{
+			Query:           "Do gift cards expire?",
+			ExpectedAnswers: []string{"NEVER EXPIRE"},
+		}, results, 3)
+		assert.Zero(t, qr.Recall)
+		assert.Zero(t, qr.ReciprocalRank)
+		assert.Zero(t, qr.NDCG)
+
+		qr = eval.EvaluateQuery(eval.Query{
+			Query:           "Do gift cards expire?",
+			ExpectedAnswers: []string{"NEVER EXPIRE"},
+		}, results[3:], 3)
+		assert.Equal(t, 1.0, qr.Recall)
+		assert.Equal(t, 1.0, qr.ReciprocalRank)
+		assert.InDelta(t, 1.0, qr.NDCG, 1e-9)
+	})
+}
+
+func TestLoadDatasetFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dataset.yaml"), []byte(`
+knowledge:
+  - id: docs
+    files: [docs/guide.md]
+queries:
+  - query: How do I install it?
+    expectedAnswers: [go install]
+`), 0o644))
+
+	dataset, err := eval.LoadDatasetFile(filepath.Join(dir, "dataset.yaml"))
+	require.NoError(t, err)
+	require.Len(t, dataset.Knowledge, 1)
+	assert.Equal(t, []string{filepath.Join(dir, "docs", "guide.md")}, dataset.Knowledge[0].Files)
+	assert.Equal(t, []string{"go install"}, dataset.Queries[0].ExpectedAnswers)
+
+	_, err = eval.LoadDataset(strings.NewReader(`{"queries": [{"query": "unlabeled"}]}`))
+	assert.ErrorContains(t, err, "no expectedDocumentIds or expectedAnswers")
+
+	_, err = eval.LoadDataset(strings.NewReader(`{"knowledge": [{"id": "a", "texts": ["x"]}], "queries": [{"query": "q", "expectedAnswers": ["x"], "knowledgeIds": ["b"]}]}`))
+	assert.ErrorContains(t, err, "unknown knowledge")
+}
+
+func TestVariant_Apply(t *testing.T) {
+	base := config.NewKnowledgeConfig()
+	variants, err := eval.LoadVariants(strings.NewReader(`
+- name: small-chunks
+  config:
+    rerankEnabled: false
+    chunkSize: 200
+`))
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+
+	conf, err := variants[0].Apply(base)
+	require.NoError(t, err)
+	assert.False(t, conf.RerankEnabled)
+	assert.Equal(t, 200, conf.ChunkSize)
+	assert.Equal(t, base.ChunkOverlap, conf.ChunkOverlap)
+	assert.True(t, base.RerankEnabled, "the base config is not modified")
+
+	_, err = eval.Variant{Name: "bad", Config: map[string]any{"chunkSize": "large"}}.Apply(base)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	ctx := t.Context()
+
+	base := config.NewKnowledgeConfig()
+	base.EmbeddingProvider = knowledge.EmbeddingProviderFake
+
+	dataset := &eval.Dataset{
+		Knowledge: []eval.Corpus{{
+			ID: "catalog",
+			Records: []map[string]any{
+				{"id": "widgets", "content": "Our blue widgets are popular with gardeners"},
+				{"id": "zx-9000", "content": "Model ZX-9000 supports fast charging"},
+				{"id": "returns", "content": "Returns are accepted within 30 days"},
+			},
+		}},
+		Queries: []eval.Query{
+			{ID: "charging", Query: "ZX-9000 fast charging", ExpectedDocumentIDs: []string{"catalog_item_zx-9000"}},
+			{ID: "returns", Query: "returns within 30 days", ExpectedAnswers: []string{"accepted within 30 days"}},
+		},
+	}
+	variants := []eval.Variant{
+		{Name: "baseline", Config: map[string]any{"rerankEnabled": false}},
+		{Name: "keyword-rerank", Config: map[string]any{"rerankStrategy": "keyword"}},
+	}
+
+	report, err := eval.Run(ctx, dataset, variants, eval.Options{K: 1, BaseConfig: base})
+	require.NoError(t, err)
+	require.Len(t, report.Variants, 2)
+	for _, variant := range report.Variants {
+		assert.Equal(t, 1.0, variant.Recall, variant.Name)
+		assert.Equal(t, 1.0, variant.MRR, variant.Name)
+		assert.InDelta(t, 1.0, variant.NDCG, 1e-9, variant.Name)
+		require.Len(t, variant.Queries, 2)
+		assert.Equal(t, []string{"catalog_item_zx-9000"}, variant.Queries[0].RetrievedIDs)
+	}
+	assert.Empty(t, report.Diffs)
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteText(&out))
+	assert.Contains(t, out.String(), "RECALL@1")
+	assert.Contains(t, out.String(), "keyword-rerank")
+
+	_, err = eval.Run(ctx, dataset, []eval.Variant{{Name: "bad", Config: map[string]any{"rerankStrategy": "oracle"}}}, eval.Options{BaseConfig: base})
+	assert.ErrorContains(t, err, "unsupported rerank strategy")
+}
+
+func TestRun_Diffs(t *testing.T) {
+	ctx := t.Context()
+
+	base := config.NewKnowledgeConfig()
+	base.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	base.RerankEnabled = false
+
+	dataset := &eval.Dataset{
+		Knowledge: []eval.Corpus{{
+			ID: "notes",
+			Texts: []string{
+				"The garden gate is painted green. The shed key hangs by the back door.",
+			},
+		}},
+		Queries: []eval.Query{
+			{ID: "key", Query: "where is the shed key", ExpectedAnswers: []string{"garden gate is painted green", "shed key hangs"}},
+		},
+	}
+	variants := []eval.Variant{
+		{Name: "whole", Config: map[string]any{"chunkSize": 1000, "chunkOverlap": 0}},
+		{Name: "sentences", Config: map[string]any{"chunkStrategy": "sentence", "chunkSize": 40, "chunkOverlap": 0}},
+	}
+
+	report, err := eval.Run(ctx, dataset, variants, eval.Options{K: 1, BaseConfig: base})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, report.Variants[0].Recall)
+	assert.Equal(t, 0.5, report.Variants[1].Recall)
+
+	require.Len(t, report.Diffs, 1)
+	diff := report.Diffs[0]
+	assert.Equal(t, "key", diff.QueryID)
+	assert.Equal(t, "whole", diff.Baseline)
+	assert.Equal(t, "sentences", diff.Variant)
+	assert.Equal(t, -0.5, diff.RecallDelta)
+	assert.Equal(t, []string{"garden gate is painted green"}, diff.Lost)
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteText(&out))
+	assert.Contains(t, out.String(), "lost garden gate is painted green")
+}
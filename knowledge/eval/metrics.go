@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"math"
+	"strings"
+
+	"github.com/habiliai/agentruntime/knowledge"
+)
+
+// QueryResult is the evaluation of the results retrieved for one query
+type QueryResult struct {
+	ID    string `json:"id"`
+	Query string `json:"query"`
+	// Recall is the share of the expected documents and answers found in the top k results
+	Recall float64 `json:"recall"`
+	// ReciprocalRank is 1 / the rank of the first relevant result, or 0 when none is relevant
+	ReciprocalRank float64 `json:"reciprocalRank"`
+	// NDCG is the normalized discounted cumulative gain of the top k results
+	NDCG float64 `json:"ndcg"`
+	// RetrievedIDs are the document IDs of the top k results, best first
+	RetrievedIDs []string `json:"retrievedIds"`
+	// Found are the expected document IDs and answers found in the top k results
+	Found []string `json:"found,omitempty"`
+	// Missed are the expected document IDs and answers not found in the top k results
+	Missed []string `json:"missed,omitempty"`
+	// Error is set when the retrieval failed. The metrics are 0.
+	Error string `json:"error,omitempty"`
+}
+
+// EvaluateQuery scores the top k results retrieved for query. Each expected
+// document ID and answer is a target, found by the first result that matches it.
+// A result is relevant when it finds a target that no better result found, so
+// several chunks of the same document add no gain.
+func EvaluateQuery(query Query, results []*knowledge.KnowledgeSearchResult, k int) QueryResult {
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+
+	targets := make([]string, 0, len(query.ExpectedDocumentIDs)+len(query.ExpectedAnswers))
+	targets = append(targets, query.ExpectedDocumentIDs...)
+	targets = append(targets, query.ExpectedAnswers...)
+	matches := func(result *knowledge.KnowledgeSearchResult, target int) bool {
+		if target < len(query.ExpectedDocumentIDs) {
+			id := query.ExpectedDocumentIDs[target]
+			return result.ID == id || strings.HasPrefix(result.ID, id+"_chunk_")
+		}
+		answer := strings.ToLower(targets[target])
+		return strings.Contains(strings.ToLower(result.EmbeddingText), answer) ||
+			strings.Contains(strings.ToLower(result.Content.Text), answer)
+	}
+
+	qr := QueryResult{
+		ID:           query.ID,
+		Query:        query.Query,
+		RetrievedIDs: make([]string, 0, len(results)),
+	}
+
+	found := make([]bool, len(targets))
+	var dcg float64
+	for rank, result := range results {
+		qr.RetrievedIDs = append(qr.RetrievedIDs, result.ID)
+
+		relevant := false
+		for target := range targets {
+			if !found[target] && matches(result, target) {
+				found[target] = true
+				relevant = true
+			}
+		}
+		if !relevant {
+			continue
+		}
+
+		dcg += 1 / math.Log2(float64(rank+2))
+		if qr.ReciprocalRank == 0 {
+			qr.ReciprocalRank = 1 / float64(rank+1)
+		}
+	}
+
+	for target, ok := range found {
+		if ok {
+			qr.Found = append(qr.Found, targets[target])
+		} else {
+			qr.Missed = append(qr.Missed, targets[target])
+		}
+	}
+	if len(targets) > 0 {
+		qr.Recall = float64(len(qr.Found)) / float64(len(targets))
+	}
+
+	// The ideal ranking has a relevant result at each of the first positions
+	var idcg float64
+	ideal := len(targets)
+	if k > 0 && ideal > k {
+		ideal = k
+	}
+	for rank := 0; rank < ideal; rank++ {
+		idcg += 1 / math.Log2(float64(rank+2))
+	}
+	if idcg > 0 {
+		qr.NDCG = dcg / idcg
+	}
+
+	return qr
+}
@@ -0,0 +1,147 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type (
+	// Report is the evaluation of all variants
+	Report struct {
+		K        int             `json:"k"`
+		Variants []VariantReport `json:"variants"`
+		// Diffs are the queries whose results differ from the first variant
+		Diffs []QueryDiff `json:"diffs,omitempty"`
+	}
+
+	// VariantReport is the evaluation of one variant, with metrics averaged over the queries
+	VariantReport struct {
+		Name    string         `json:"name"`
+		Config  map[string]any `json:"config,omitempty"`
+		Recall  float64        `json:"recall"`
+		MRR     float64        `json:"mrr"`
+		NDCG    float64        `json:"ndcg"`
+		Errors  int            `json:"errors,omitempty"`
+		Queries []QueryResult  `json:"queries"`
+	}
+
+	// QueryDiff compares the evaluation of a query by a variant to the baseline
+	QueryDiff struct {
+		QueryID  string `json:"queryId"`
+		Query    string `json:"query"`
+		Baseline string `json:"baseline"`
+		Variant  string `json:"variant"`
+		// RecallDelta, ReciprocalRankDelta and NDCGDelta are the variant metric minus
+		// the baseline metric
+		RecallDelta         float64 `json:"recallDelta"`
+		ReciprocalRankDelta float64 `json:"reciprocalRankDelta"`
+		NDCGDelta           float64 `json:"ndcgDelta"`
+		// Gained are the expected document IDs and answers found only by the variant
+		Gained []string `json:"gained,omitempty"`
+		// Lost are the expected document IDs and answers found only by the baseline
+		Lost []string `json:"lost,omitempty"`
+	}
+)
+
+// summarize averages the metrics of the queries
+func (r *VariantReport) summarize() {
+	r.Recall, r.MRR, r.NDCG, r.Errors = 0, 0, 0, 0
+	for _, query := range r.Queries {
+		r.Recall += query.Recall
+		r.MRR += query.ReciprocalRank
+		r.NDCG += query.NDCG
+		if query.Error != "" {
+			r.Errors++
+		}
+	}
+	if n := float64(len(r.Queries)); n > 0 {
+		r.Recall /= n
+		r.MRR /= n
+		r.NDCG /= n
+	}
+}
+
+// diffQueries compares each query of the other variants to the first variant
+// and returns the queries whose metrics or found targets changed
+func diffQueries(variants []VariantReport) []QueryDiff {
+	if len(variants) < 2 {
+		return nil
+	}
+
+	baseline := variants[0]
+	var diffs []QueryDiff
+	for _, variant := range variants[1:] {
+		for i, query := range variant.Queries {
+			base := baseline.Queries[i]
+			diff := QueryDiff{
+				QueryID:             query.ID,
+				Query:               query.Query,
+				Baseline:            baseline.Name,
+				Variant:             variant.Name,
+				RecallDelta:         query.Recall - base.Recall,
+				ReciprocalRankDelta: query.ReciprocalRank - base.ReciprocalRank,
+				NDCGDelta:           query.NDCG - base.NDCG,
+				Gained:              difference(query.Found, base.Found),
+				Lost:                difference(base.Found, query.Found),
+			}
+			if diff.RecallDelta == 0 && diff.ReciprocalRankDelta == 0 && diff.NDCGDelta == 0 &&
+				len(diff.Gained) == 0 && len(diff.Lost) == 0 {
+				continue
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs
+}
+
+// difference returns the elements of a that are not in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+
+	var diff []string
+	for _, s := range a {
+		if !in[s] {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+// WriteText writes the metrics of the variants as a table, followed by the
+// per-query diffs
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "VARIANT\tRECALL@%d\tMRR\tNDCG@%d\tERRORS\n", r.K, r.K)
+	for _, variant := range r.Variants {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\n", variant.Name, variant.Recall, variant.MRR, variant.NDCG, variant.Errors)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Diffs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nPer-query changes against %s:\n", r.Diffs[0].Baseline)
+	for _, diff := range r.Diffs {
+		fmt.Fprintf(w, "- [%s] %s %q: recall %+.3f, rr %+.3f, ndcg %+.3f", diff.Variant, diff.QueryID, diff.Query, diff.RecallDelta, diff.ReciprocalRankDelta, diff.NDCGDelta)
+		if len(diff.Gained) > 0 {
+			fmt.Fprintf(w, ", gained %s", strings.Join(diff.Gained, ", "))
+		}
+		if len(diff.Lost) > 0 {
+			fmt.Fprintf(w, ", lost %s", strings.Join(diff.Lost, ", "))
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
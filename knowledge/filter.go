@@ -0,0 +1,504 @@
+package knowledge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Filter is an expression over the metadata of documents. The operators set on
+	// a filter must all hold, and so must And, while at least one of Or must hold.
+	// A nil or empty filter matches every document.
+	//
+	// Field is a metadata key; dots address the fields of nested objects, e.g.
+	// "author.name". Values compare as numbers when both sides are numbers and as
+	// strings when both are strings, so a range over "2024-01-01" style dates works.
+	Filter struct {
+		Field string `json:"field,omitempty"`
+
+		// Eq holds when the field equals the value
+		Eq any `json:"eq,omitempty"`
+		// In holds when the field equals one of the values
+		In []any `json:"in,omitempty"`
+		// Gt, Gte, Lt and Lte hold when the field is in range of the number or string
+		Gt  any `json:"gt,omitempty"`
+		Gte any `json:"gte,omitempty"`
+		Lt  any `json:"lt,omitempty"`
+		Lte any `json:"lte,omitempty"`
+		// Exists holds when whether the field is set to a non-null value matches it
+		Exists *bool `json:"exists,omitempty"`
+
+		And []*Filter `json:"and,omitempty"`
+		Or  []*Filter `json:"or,omitempty"`
+	}
+)
+
+// FieldEq returns a filter on a field equal to value
+func FieldEq(field string, value any) *Filter {
+	return &Filter{Field: field, Eq: value}
+}
+
+// FieldIn returns a filter on a field equal to one of values
+func FieldIn(field string, values ...any) *Filter {
+	return &Filter{Field: field, In: values}
+}
+
+// FieldExists returns a filter on a field being set to a non-null value
+func FieldExists(field string) *Filter {
+	exists := true
+	return &Filter{Field: field, Exists: &exists}
+}
+
+// AllOf returns a filter matching the documents matched by every filter
+func AllOf(filters ...*Filter) *Filter {
+	return &Filter{And: filters}
+}
+
+// AnyOf returns a filter matching the documents matched by any filter
+func AnyOf(filters ...*Filter) *Filter {
+	return &Filter{Or: filters}
+}
+
+// IsEmpty reports whether the filter matches every document
+func (f *Filter) IsEmpty() bool {
+	if f == nil {
+		return true
+	}
+	if f.hasOperator() || len(f.Or) > 0 {
+		return false
+	}
+	for _, sub := range f.And {
+		if !sub.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) hasOperator() bool {
+	return f.Eq != nil || len(f.In) > 0 || f.Gt != nil || f.Gte != nil || f.Lt != nil || f.Lte != nil || f.Exists != nil
+}
+
+// Validate reports whether the filter is well-formed: operators need a field,
+// values are scalars and range bounds are numbers or strings
+func (f *Filter) Validate() error {
+	if f == nil {
+		return nil
+	}
+
+	if f.hasOperator() && f.Field == "" {
+		return errors.New("filter operators need a field")
+	}
+	if !f.hasOperator() && f.Field != "" {
+		return errors.Errorf("filter on field %s has no operator", f.Field)
+	}
+	if f.Field != "" && slices.Contains(strings.Split(f.Field, "."), "") {
+		return errors.Errorf("invalid filter field: %s", f.Field)
+	}
+
+	if f.Eq != nil && !isScalar(f.Eq) {
+		return errors.Errorf("filter on field %s: eq must be a string, number or boolean", f.Field)
+	}
+	for _, value := range f.In {
+		if !isScalar(value) {
+			return errors.Errorf("filter on field %s: in must hold strings, numbers or booleans", f.Field)
+		}
+	}
+	for _, bound := range []any{f.Gt, f.Gte, f.Lt, f.Lte} {
+		if bound == nil {
+			continue
+		}
+		if _, ok := toNumber(bound); !ok {
+			if _, ok := bound.(string); !ok {
+				return errors.Errorf("filter on field %s: range bounds must be numbers or strings", f.Field)
+			}
+		}
+	}
+
+	for _, sub := range append(append([]*Filter{}, f.And...), f.Or...) {
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fields returns the metadata fields the filter refers to
+func (f *Filter) Fields() []string {
+	if f == nil {
+		return nil
+	}
+
+	var fields []string
+	if f.Field != "" {
+		fields = append(fields, f.Field)
+	}
+	for _, sub := range append(append([]*Filter{}, f.And...), f.Or...) {
+		fields = append(fields, sub.Fields()...)
+	}
+	return fields
+}
+
+// Matches reports whether the metadata satisfies the filter
+func (f *Filter) Matches(metadata map[string]any) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.Field != "" {
+		value, found := metadataValue(metadata, f.Field)
+		found = found && value != nil
+
+		if f.Exists != nil && found != *f.Exists {
+			return false
+		}
+		if f.Eq != nil && (!found || !valuesEqual(value, f.Eq)) {
+			return false
+		}
+		if len(f.In) > 0 && (!found || !slices.ContainsFunc(f.In, func(v any) bool { return valuesEqual(value, v) })) {
+			return false
+		}
+		for _, r := range []struct {
+			bound any
+			holds func(int) bool
+		}{
+			{f.Gt, func(c int) bool { return c > 0 }},
+			{f.Gte, func(c int) bool { return c >= 0 }},
+			{f.Lt, func(c int) bool { return c < 0 }},
+			{f.Lte, func(c int) bool { return c <= 0 }},
+		} {
+			if r.bound == nil {
+				continue
+			}
+			c, ok := compareValues(value, r.bound)
+			if !found || !ok || !r.holds(c) {
+				return false
+			}
+		}
+	}
+
+	for _, sub := range f.And {
+		if !sub.Matches(metadata) {
+			return false
+		}
+	}
+	if len(f.Or) > 0 && !slices.ContainsFunc(f.Or, func(sub *Filter) bool { return sub.Matches(metadata) }) {
+		return false
+	}
+	return true
+}
+
+// sqliteCondition compiles the filter into a SQLite condition over the JSON column, with
+// its arguments. It returns an empty condition for an empty filter.
+func (f *Filter) sqliteCondition(column string) (string, []any) {
+	return f.sqlCondition(column, sqliteFieldConditions)
+}
+
+// postgresCondition compiles the filter into a Postgres condition over the JSONB
+// column, with its arguments. It returns an empty condition for an empty filter.
+func (f *Filter) postgresCondition(column string) (string, []any) {
+	return f.sqlCondition(column, postgresFieldConditions)
+}
+
+// sqlCondition combines the conditions compiled by fieldConditions for the
+// field of the filter and of its And and Or filters
+func (f *Filter) sqlCondition(column string, fieldConditions func(column string, f *Filter) ([]string, []any)) (string, []any) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+
+	var (
+		conditions []string
+		args       []any
+	)
+	add := func(condition string, conditionArgs ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	if f.Field != "" {
+		conditions, args = fieldConditions(column, f)
+	}
+
+	for _, sub := range f.And {
+		if condition, subArgs := sub.sqlCondition(column, fieldConditions); condition != "" {
+			add(condition, subArgs...)
+		}
+	}
+	if len(f.Or) > 0 {
+		var alternatives []string
+		var alternativeArgs []any
+		for _, sub := range f.Or {
+			condition, subArgs := sub.sqlCondition(column, fieldConditions)
+			if condition == "" {
+				// An empty alternative matches every document
+				alternatives, alternativeArgs = nil, nil
+				break
+			}
+			alternatives = append(alternatives, condition)
+			alternativeArgs = append(alternativeArgs, subArgs...)
+		}
+		if len(alternatives) > 0 {
+			add("("+strings.Join(alternatives, " OR ")+")", alternativeArgs...)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
+
+// sqliteFieldConditions compiles the operators of f with json_extract, guarding
+// comparisons by json_type so that numbers and strings never compare
+func sqliteFieldConditions(column string, f *Filter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	add := func(condition string, conditionArgs ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	path := jsonPath(f.Field)
+	value := fmt.Sprintf("json_extract(%s, ?)", column)
+	valueType := fmt.Sprintf("json_type(%s, ?)", column)
+
+	if f.Exists != nil {
+		if *f.Exists {
+			add(fmt.Sprintf("COALESCE(%s, 'null') != 'null'", valueType), path)
+		} else {
+			add(fmt.Sprintf("COALESCE(%s, 'null') = 'null'", valueType), path)
+		}
+	}
+	if f.Eq != nil {
+		add(scalarCondition(value, valueType, f.Eq), scalarArgs(path, f.Eq)...)
+	}
+	if len(f.In) > 0 {
+		var alternatives []string
+		var alternativeArgs []any
+		for _, v := range f.In {
+			alternatives = append(alternatives, scalarCondition(value, valueType, v))
+			alternativeArgs = append(alternativeArgs, scalarArgs(path, v)...)
+		}
+		add("("+strings.Join(alternatives, " OR ")+")", alternativeArgs...)
+	}
+	for _, r := range []struct {
+		bound any
+		op    string
+	}{{f.Gt, ">"}, {f.Gte, ">="}, {f.Lt, "<"}, {f.Lte, "<="}} {
+		if r.bound == nil {
+			continue
+		}
+		if n, ok := toNumber(r.bound); ok {
+			add(fmt.Sprintf("(%s IN ('integer', 'real') AND %s %s ?)", valueType, value, r.op), path, path, n)
+		} else {
+			add(fmt.Sprintf("(%s = 'text' AND %s %s ?)", valueType, value, r.op), path, path, r.bound)
+		}
+	}
+
+	return conditions, args
+}
+
+// postgresFieldConditions compiles the operators of f with JSONB path operators.
+// Equality compares JSONB values, which never equal across types, and ranges are
+// guarded by jsonb_typeof in CASE so that text is never cast to a number.
+func postgresFieldConditions(column string, f *Filter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	add := func(condition string, conditionArgs ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	path := postgresPath(f.Field)
+	value := fmt.Sprintf("(%s #> ?::text[])", column)
+	text := fmt.Sprintf("(%s #>> ?::text[])", column)
+
+	if f.Exists != nil {
+		if *f.Exists {
+			add(fmt.Sprintf("COALESCE(jsonb_typeof%s, 'null') != 'null'", value), path)
+		} else {
+			add(fmt.Sprintf("COALESCE(jsonb_typeof%s, 'null') = 'null'", value), path)
+		}
+	}
+	if f.Eq != nil {
+		add(fmt.Sprintf("%s = ?::jsonb", value), path, jsonbValue(f.Eq))
+	}
+	if len(f.In) > 0 {
+		alternatives := make([]string, len(f.In))
+		alternativeArgs := make([]any, 0, 2*len(f.In))
+		for i, v := range f.In {
+			alternatives[i] = fmt.Sprintf("%s = ?::jsonb", value)
+			alternativeArgs = append(alternativeArgs, path, jsonbValue(v))
+		}
+		add("("+strings.Join(alternatives, " OR ")+")", alternativeArgs...)
+	}
+	for _, r := range []struct {
+		bound any
+		op    string
+	}{{f.Gt, ">"}, {f.Gte, ">="}, {f.Lt, "<"}, {f.Lte, "<="}} {
+		if r.bound == nil {
+			continue
+		}
+		if n, ok := toNumber(r.bound); ok {
+			add(fmt.Sprintf("(CASE WHEN jsonb_typeof%s = 'number' THEN %s::double precision %s ? ELSE false END)", value, text, r.op), path, path, n)
+		} else {
+			// The C collation compares bytes like strings.Compare
+			add(fmt.Sprintf(`(CASE WHEN jsonb_typeof%s = 'string' THEN %s COLLATE "C" %s ? ELSE false END)`, value, text, r.op), path, path, r.bound)
+		}
+	}
+
+	return conditions, args
+}
+
+// scalarCondition compares a JSON value to a scalar of the same JSON type
+func scalarCondition(value string, valueType string, v any) string {
+	switch v.(type) {
+	case string:
+		return fmt.Sprintf("(%s = 'text' AND %s = ?)", valueType, value)
+	case bool:
+		return fmt.Sprintf("(%s IN ('true', 'false') AND %s = ?)", valueType, value)
+	default:
+		return fmt.Sprintf("(%s IN ('integer', 'real') AND %s = ?)", valueType, value)
+	}
+}
+
+func scalarArgs(path string, v any) []any {
+	switch v := v.(type) {
+	case string:
+		return []any{path, path, v}
+	case bool:
+		// json_extract returns booleans as 1 and 0
+		if v {
+			return []any{path, path, 1}
+		}
+		return []any{path, path, 0}
+	default:
+		n, _ := toNumber(v)
+		return []any{path, path, n}
+	}
+}
+
+// jsonPath converts a dotted field into a SQLite JSON path with quoted keys
+func jsonPath(field string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, key := range strings.Split(field, ".") {
+		sb.WriteString(`."`)
+		sb.WriteString(strings.ReplaceAll(key, `"`, `\"`))
+		sb.WriteString(`"`)
+	}
+	return sb.String()
+}
+
+// postgresPath converts a dotted field into a Postgres text array literal of quoted keys
+func postgresPath(field string) string {
+	keys := strings.Split(field, ".")
+	for i, key := range keys {
+		keys[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+	}
+	return "{" + strings.Join(keys, ",") + "}"
+}
+
+// jsonbValue encodes a scalar filter value as JSON
+func jsonbValue(v any) string {
+	if n, ok := toNumber(v); ok {
+		v = n
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// metadataValue looks up a dotted field in metadata
+func metadataValue(metadata map[string]any, field string) (any, bool) {
+	var value any = metadata
+	for _, key := range strings.Split(field, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func valuesEqual(a any, b any) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	}
+	return false
+}
+
+// compareValues compares two numbers or two strings
+func compareValues(a any, b any) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// toNumber converts integers and floats to float64
+func toNumber(v any) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func isScalar(v any) bool {
+	if _, ok := toNumber(v); ok {
+		return true
+	}
+	switch v.(type) {
+	case string, bool:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	metadata := map[string]any{
+		"page_number": 3,
+		"source_type": "pdf",
+		"published":   "2024-05-01",
+		"draft":       false,
+		"author":      map[string]any{"name": "Kim"},
+		"summary":     nil,
+	}
+	notSet := false
+
+	tests := []struct {
+		name    string
+		filter  *knowledge.Filter
+		matches bool
+	}{
+		{"nil", nil, true},
+		{"eq string", knowledge.FieldEq("source_type", "pdf"), true},
+		{"eq number across types", knowledge.FieldEq("page_number", 3.0), true},
+		{"eq bool", knowledge.FieldEq("draft", false), true},
+		{"eq does not convert strings", knowledge.FieldEq("page_number", "3"), false},
+		{"in", knowledge.FieldIn("source_type", "markdown", "pdf"), true},
+		{"in misses", knowledge.FieldIn("source_type", "markdown", "html"), false},
+		{"range", &knowledge.Filter{Field: "page_number", Gte: 2, Lt: 4}, true},
+		{"range misses", &knowledge.Filter{Field: "page_number", Gt: 3}, false},
+		{"string range", &knowledge.Filter{Field: "published", Gte: "2024-01-01", Lte: "2024-12-31"}, true},
+		{"range over other type", &knowledge.Filter{Field: "source_type", Gt: 1}, false},
+		{"exists", knowledge.FieldExists("author.name"), true},
+		{"null does not exist", knowledge.FieldExists("summary"), false},
+		{"missing does not exist", knowledge.FieldExists("language"), false},
+		{"not exists", &knowledge.Filter{Field: "language", Exists: &notSet}, true},
+		{"missing field", knowledge.FieldEq("language", "en"), false},
+		{"and", knowledge.AllOf(knowledge.FieldEq("source_type", "pdf"), knowledge.FieldEq("page_number", 4)), false},
+		{"or", knowledge.AnyOf(knowledge.FieldEq("source_type", "html"), knowledge.FieldEq("page_number", 3)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.filter.Validate())
+			assert.Equal(t, tt.matches, tt.filter.Matches(metadata))
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	assert.Error(t, (&knowledge.Filter{Eq: "pdf"}).Validate())
+	assert.Error(t, (&knowledge.Filter{Field: "source_type"}).Validate())
+	assert.Error(t, (&knowledge.Filter{Field: "a..b", Eq: 1}).Validate())
+	assert.Error(t, knowledge.FieldEq("tags", []any{"a"}).Validate())
+	assert.Error(t, (&knowledge.Filter{Field: "page_number", Gt: true}).Validate())
+	assert.Error(t, knowledge.AllOf(&knowledge.Filter{Field: "x"}).Validate())
+	assert.NoError(t, knowledge.AllOf().Validate())
+	assert.True(t, knowledge.AllOf().IsEmpty())
+}
+
+func TestService_RetrieveRelevantKnowledgeWithFilter(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	_, err = service.IndexKnowledgeFromMap(ctx, "faq", []map[string]any{
+		{"content": "Shipping takes three days", "language": "en"},
+		{"content": "배송은 3일 걸립니다", "language": "ko"},
+		{"content": "Returns are free", "language": "en"},
+	})
+	require.NoError(t, err)
+
+	results, err := service.RetrieveRelevantKnowledge(ctx, "shipping", 5, nil, knowledge.WithFilter(knowledge.FieldEq("language", "ko")))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "ko", results[0].Metadata["language"])
+
+	_, err = service.RetrieveRelevantKnowledge(ctx, "shipping", 5, nil, knowledge.WithFilter(&knowledge.Filter{Field: "language"}))
+	assert.ErrorContains(t, err, "invalid metadata filter")
+}
@@ -0,0 +1,174 @@
+package knowledge
+
+import (
+	"context"
+	"sort"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SearchModeVector retrieves documents by embedding similarity
+	SearchModeVector = "vector"
+	// SearchModeKeyword retrieves documents by BM25 full-text relevance
+	SearchModeKeyword = "keyword"
+	// SearchModeHybrid retrieves documents by both and fuses the rankings
+	SearchModeHybrid = "hybrid"
+
+	// FusionRRF fuses rankings with reciprocal rank fusion
+	FusionRRF = "rrf"
+	// FusionWeighted fuses rankings with the weighted sum of their min-max normalized scores
+	FusionWeighted = "weighted"
+
+	// DefaultRRFK is the default rank constant of reciprocal rank fusion
+	DefaultRRFK = 60
+)
+
+type (
+	// HybridOptions controls how HybridSearch fuses the vector and keyword rankings
+	HybridOptions struct {
+		// Fusion is FusionRRF or FusionWeighted. Default: FusionRRF
+		Fusion string `json:"fusion,omitempty"`
+		// VectorWeight and KeywordWeight weigh the rankings. When both are 0, the
+		// rankings weigh the same.
+		VectorWeight  float64 `json:"vectorWeight,omitempty"`
+		KeywordWeight float64 `json:"keywordWeight,omitempty"`
+		// RRFK is the rank constant of reciprocal rank fusion. Default: DefaultRRFK
+		RRFK int `json:"rrfK,omitempty"`
+	}
+)
+
+// HybridOptionsFromConfig returns the hybrid search options of conf
+func HybridOptionsFromConfig(conf *config.KnowledgeConfig) HybridOptions {
+	return HybridOptions{
+		Fusion:        conf.HybridFusion,
+		VectorWeight:  conf.HybridVectorWeight,
+		KeywordWeight: conf.HybridKeywordWeight,
+		RRFK:          conf.HybridRRFK,
+	}
+}
+
+// Validate reports whether the fusion method and weights are supported
+func (o HybridOptions) Validate() error {
+	switch o.Fusion {
+	case "", FusionRRF, FusionWeighted:
+	default:
+		return errors.Errorf("unsupported hybrid fusion: %s", o.Fusion)
+	}
+	if o.VectorWeight < 0 || o.KeywordWeight < 0 {
+		return errors.Errorf("hybrid search weights must not be negative")
+	}
+	return nil
+}
+
+// HybridSearch retrieves documents matching filter from store by embedding
+// similarity and by BM25 keyword relevance, and fuses both rankings as configured by opts. Fused scores
+// range from 0 to 1, where 1 is a document ranked first by both.
+func HybridSearch(
+	ctx context.Context,
+	store Store,
+	queryEmbedding []float32,
+	query string,
+	limit int,
+	allowedKnowledgeIds []string,
+	filter *Filter,
+	opts HybridOptions,
+) ([]KnowledgeSearchResult, error) {
+	vectorResults, err := store.Search(ctx, queryEmbedding, limit, allowedKnowledgeIds, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	keywordResults, err := store.KeywordSearch(ctx, query, limit, allowedKnowledgeIds, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := FuseSearchResults(vectorResults, keywordResults, opts)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// FuseSearchResults combines a vector and a keyword ranking of documents into
+// one ranking, identifying documents by ID
+func FuseSearchResults(vectorResults []KnowledgeSearchResult, keywordResults []KnowledgeSearchResult, opts HybridOptions) []KnowledgeSearchResult {
+	vectorWeight, keywordWeight := opts.VectorWeight, opts.KeywordWeight
+	if vectorWeight == 0 && keywordWeight == 0 {
+		vectorWeight, keywordWeight = 0.5, 0.5
+	}
+	k := opts.RRFK
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+
+	type fused struct {
+		result KnowledgeSearchResult
+		score  float64
+	}
+
+	byID := make(map[string]*fused)
+	order := make([]string, 0, len(vectorResults)+len(keywordResults))
+	add := func(results []KnowledgeSearchResult, weight float64) {
+		minScore, maxScore := scoreRange(results)
+		for rank, result := range results {
+			f, exists := byID[result.ID]
+			if !exists {
+				f = &fused{result: result}
+				byID[result.ID] = f
+				order = append(order, result.ID)
+			}
+
+			switch opts.Fusion {
+			case FusionWeighted:
+				normalized := 1.0
+				if maxScore > minScore {
+					normalized = float64(result.Score-minScore) / float64(maxScore-minScore)
+				}
+				f.score += weight * normalized
+			default:
+				f.score += weight / float64(k+rank+1)
+			}
+		}
+	}
+	add(vectorResults, vectorWeight)
+	add(keywordResults, keywordWeight)
+
+	// Scale scores so that a document ranked first by both scores 1
+	maxScore := vectorWeight + keywordWeight
+	if opts.Fusion != FusionWeighted {
+		maxScore /= float64(k + 1)
+	}
+
+	results := make([]KnowledgeSearchResult, 0, len(order))
+	for _, id := range order {
+		f := byID[id]
+		f.result.Score = float32(f.score / maxScore)
+		results = append(results, f.result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
+
+// scoreRange returns the lowest and highest scores of results
+func scoreRange(results []KnowledgeSearchResult) (float32, float32) {
+	if len(results) == 0 {
+		return 0, 0
+	}
+	minScore, maxScore := results[0].Score, results[0].Score
+	for _, result := range results[1:] {
+		if result.Score < minScore {
+			minScore = result.Score
+		}
+		if result.Score > maxScore {
+			maxScore = result.Score
+		}
+	}
+	return minScore, maxScore
+}
@@ -0,0 +1,80 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchResult(id string, score float32) knowledge.KnowledgeSearchResult {
+	return knowledge.KnowledgeSearchResult{
+		Document: &knowledge.Document{ID: id},
+		Score:    score,
+	}
+}
+
+func TestFuseSearchResults_RRF(t *testing.T) {
+	vector := []knowledge.KnowledgeSearchResult{searchResult("a", 0.9), searchResult("b", 0.8)}
+	keyword := []knowledge.KnowledgeSearchResult{searchResult("b", 7.5), searchResult("c", 3.1)}
+
+	results := knowledge.FuseSearchResults(vector, keyword, knowledge.HybridOptions{})
+	require.Len(t, results, 3)
+	assert.Equal(t, "b", results[0].ID)
+	assert.InDelta(t, (1.0/62+1.0/61)/(2.0/61), results[0].Score, 1e-6)
+	assert.Equal(t, "a", results[1].ID)
+	assert.Equal(t, "c", results[2].ID)
+
+	// Weights decide between documents ranked first by one ranking each
+	results = knowledge.FuseSearchResults(vector[:1], keyword[1:], knowledge.HybridOptions{VectorWeight: 0.2, KeywordWeight: 0.8})
+	require.Len(t, results, 2)
+	assert.Equal(t, "c", results[0].ID)
+}
+
+func TestFuseSearchResults_Weighted(t *testing.T) {
+	vector := []knowledge.KnowledgeSearchResult{searchResult("a", 0.9), searchResult("b", 0.5)}
+	keyword := []knowledge.KnowledgeSearchResult{searchResult("b", 10), searchResult("a", 2)}
+
+	results := knowledge.FuseSearchResults(vector, keyword, knowledge.HybridOptions{
+		Fusion:        knowledge.FusionWeighted,
+		VectorWeight:  0.3,
+		KeywordWeight: 0.7,
+	})
+	require.Len(t, results, 2)
+	assert.Equal(t, "b", results[0].ID)
+	assert.InDelta(t, 0.7, results[0].Score, 1e-6)
+	assert.InDelta(t, 0.3, results[1].Score, 1e-6)
+}
+
+func TestService_HybridSearch(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	conf.SearchMode = knowledge.SearchModeHybrid
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	_, err = service.IndexKnowledgeFromMap(ctx, "catalog", []map[string]any{
+		{"content": "Our blue widgets are popular with gardeners"},
+		{"content": "Model ZX-9000 supports fast charging"},
+		{"content": "Returns are accepted within 30 days"},
+	})
+	require.NoError(t, err)
+
+	results, err := service.RetrieveRelevantKnowledge(ctx, "ZX-9000", 1, []string{"catalog"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].EmbeddingText, "ZX-9000")
+
+	conf.SearchMode = "fuzzy"
+	_, err = knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.Default())
+	assert.ErrorContains(t, err, "unsupported search mode")
+}
@@ -0,0 +1,98 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// imageMIMETypes are the image types indexed as knowledge, by the type
+// http.DetectContentType reports for them
+var imageMIMETypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// ProcessDocumentFromImage converts a JPEG, PNG or WebP image into a document
+// embedded in the vision space of an ImageEmbedder. The document has no
+// embedding text, so it is found by text queries embedded into the aligned
+// text space rather than by keywords.
+func ProcessDocumentFromImage(data []byte) (*Document, error) {
+	mimeType := http.DetectContentType(data)
+	if !imageMIMETypes[mimeType] {
+		return nil, errors.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	return &Document{
+		Content: Content{
+			Image:    base64.StdEncoding.EncodeToString(data),
+			MIMEType: mimeType,
+		},
+		Metadata: map[string]any{
+			MetadataKeySourceType:     SourceTypeImage,
+			MetadataKeyEmbeddingSpace: EmbeddingSpaceVision,
+		},
+	}, nil
+}
+
+// inVisionSpace reports whether a document is embedded from its image rather
+// than from its text
+func inVisionSpace(doc *Document) bool {
+	return doc.Metadata[MetadataKeyEmbeddingSpace] == EmbeddingSpaceVision
+}
+
+// embedImageDocuments embeds the images of documents into the vision space of
+// embedder, which must be an ImageEmbedder
+func embedImageDocuments(ctx context.Context, embedder Embedder, documents []*Document, logger *slog.Logger) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	imageEmbedder, ok := embedder.(ImageEmbedder)
+	if !ok {
+		return errors.New("embedding images requires an embedder that supports images - use the nomic embedding provider")
+	}
+
+	now := time.Now()
+
+	// Images are embedded in one request per MIME type
+	var mimeTypes []string
+	byMIMEType := map[string][]*Document{}
+	for _, doc := range documents {
+		if _, ok := byMIMEType[doc.Content.MIMEType]; !ok {
+			mimeTypes = append(mimeTypes, doc.Content.MIMEType)
+		}
+		byMIMEType[doc.Content.MIMEType] = append(byMIMEType[doc.Content.MIMEType], doc)
+	}
+
+	for _, mimeType := range mimeTypes {
+		docs := byMIMEType[mimeType]
+		images := make([][]byte, 0, len(docs))
+		for _, doc := range docs {
+			img, err := base64.StdEncoding.DecodeString(doc.Content.Image)
+			if err != nil {
+				return errors.Wrapf(err, "failed to decode image of document %s", doc.ID)
+			}
+			images = append(images, img)
+		}
+
+		embeddings, err := imageEmbedder.EmbedImageFiles(ctx, mimeType, images...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to generate image embeddings - check your API configuration")
+		}
+		if len(embeddings) != len(docs) {
+			return errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(docs))
+		}
+		for i, doc := range docs {
+			doc.Embeddings = embeddings[i]
+		}
+	}
+	logger.Info("Generated image embeddings", "time", time.Since(now), "images", len(documents))
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPNG returns PNG data the fake embedder embeds as the given words
+func testPNG(words string) []byte {
+	return []byte("\x89PNG\r\n\x1a\n " + words)
+}
+
+func TestProcessDocumentFromImage(t *testing.T) {
+	data := testPNG("red bicycle")
+	assert.Equal(t, knowledge.SourceTypeImage, knowledge.DetectSourceType("", data))
+	assert.Equal(t, knowledge.SourceTypeImage, knowledge.DetectSourceType("photo.JPG", nil))
+
+	doc, err := knowledge.ProcessDocumentFromImage(data)
+	require.NoError(t, err)
+	assert.Equal(t, knowledge.ContentTypeImage, doc.Content.Type())
+	assert.Equal(t, "image/png", doc.Content.MIMEType)
+	assert.True(t, strings.HasPrefix(doc.Content.DataURL(), "data:image/png;base64,"))
+	assert.Equal(t, knowledge.EmbeddingSpaceVision, doc.Metadata[knowledge.MetadataKeyEmbeddingSpace])
+
+	_, err = knowledge.ProcessDocumentFromImage([]byte("GIF89a"))
+	assert.ErrorContains(t, err, "unsupported image type")
+}
+
+func TestService_ImageRetrieval(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shop.md"), []byte("# Shop\n\nOur shop repairs bicycles and sells helmets."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "red.png"), testPNG("red bicycle"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blue.png"), testPNG("blue helmet"), 0o644))
+
+	paths, err := knowledge.ResolvePaths(dir)
+	require.NoError(t, err)
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.RerankEnabled = false
+	conf.SqliteEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	indexed, err := service.IndexKnowledgeFromFiles(ctx, "shop", paths, knowledge.LoaderOptions{})
+	require.NoError(t, err)
+	require.Len(t, indexed.Documents, 3)
+	assert.Equal(t, knowledge.SourceTypeMixed, indexed.Metadata[knowledge.MetadataKeySourceType])
+
+	filenames := func(results []*knowledge.KnowledgeSearchResult) []string {
+		var names []string
+		for _, result := range results {
+			names = append(names, result.Metadata[knowledge.MetadataKeySourceFilename].(string))
+		}
+		return names
+	}
+
+	// Images and texts are ranked separately, so the best image is found next
+	// to the best text
+	results, err := service.RetrieveRelevantKnowledge(ctx, "red bicycle", 2, []string{"shop"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.ElementsMatch(t, []string{"shop.md", "red.png"}, filenames(results))
+	for _, result := range results {
+		if result.Content.Type() == knowledge.ContentTypeImage {
+			assert.True(t, strings.HasPrefix(result.Content.DataURL(), "data:image/png;base64,"))
+		}
+	}
+
+	results, err = service.RetrieveRelevantKnowledge(ctx, "blue helmet", 3, []string{"shop"})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	names := filenames(results)
+	assert.Less(t, slices.Index(names, "blue.png"), slices.Index(names, "red.png"))
+
+	// Filters apply to both rankings
+	results, err = service.RetrieveRelevantKnowledge(ctx, "red bicycle", 3, []string{"shop"},
+		knowledge.WithFilter(knowledge.FieldEq(knowledge.MetadataKeySourceType, knowledge.SourceTypeImage)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"red.png", "blue.png"}, filenames(results))
+}
+
+func TestService_VisionSearchWeight(t *testing.T) {
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.VisionSearchWeight = 2
+
+	_, err := knowledge.NewService(t.Context(), &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.ErrorContains(t, err, "visionSearchWeight must be between 0 and 1")
+}
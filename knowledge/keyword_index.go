@@ -0,0 +1,126 @@
+package knowledge
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// BM25 parameters, the same as the defaults of SQLite FTS5
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type (
+	// keywordIndex is an inverted index of the embedding texts of documents ranked
+	// with BM25. It is not safe for concurrent use.
+	keywordIndex struct {
+		termFreqs   map[*Document]map[string]int
+		docLengths  map[*Document]int
+		docFreqs    map[string]int
+		totalLength int
+	}
+
+	keywordMatch struct {
+		doc   *Document
+		score float64
+	}
+)
+
+func newKeywordIndex() *keywordIndex {
+	return &keywordIndex{
+		termFreqs:  make(map[*Document]map[string]int),
+		docLengths: make(map[*Document]int),
+		docFreqs:   make(map[string]int),
+	}
+}
+
+// keywordTerms splits text into lowercase terms of letters and digits, like the
+// unicode61 tokenizer of FTS5
+func keywordTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// add indexes the embedding text of doc
+func (x *keywordIndex) add(doc *Document) {
+	if _, exists := x.termFreqs[doc]; exists {
+		return
+	}
+
+	terms := keywordTerms(doc.EmbeddingText)
+	freqs := make(map[string]int, len(terms))
+	for _, term := range terms {
+		freqs[term]++
+	}
+	for term := range freqs {
+		x.docFreqs[term]++
+	}
+
+	x.termFreqs[doc] = freqs
+	x.docLengths[doc] = len(terms)
+	x.totalLength += len(terms)
+}
+
+// remove drops doc from the index
+func (x *keywordIndex) remove(doc *Document) {
+	freqs, exists := x.termFreqs[doc]
+	if !exists {
+		return
+	}
+
+	for term := range freqs {
+		if x.docFreqs[term]--; x.docFreqs[term] == 0 {
+			delete(x.docFreqs, term)
+		}
+	}
+	x.totalLength -= x.docLengths[doc]
+	delete(x.termFreqs, doc)
+	delete(x.docLengths, doc)
+}
+
+// search ranks the indexed documents accepted by allow against the query with
+// BM25, best first. Only documents matching at least one query term are returned.
+func (x *keywordIndex) search(query string, allow func(*Document) bool) []keywordMatch {
+	queryTerms := keywordTerms(query)
+	if len(queryTerms) == 0 || len(x.termFreqs) == 0 {
+		return nil
+	}
+
+	numDocs := float64(len(x.termFreqs))
+	avgLength := float64(x.totalLength) / numDocs
+
+	var matches []keywordMatch
+	for doc, freqs := range x.termFreqs {
+		if allow != nil && !allow(doc) {
+			continue
+		}
+
+		var score float64
+		for _, term := range queryTerms {
+			freq := float64(freqs[term])
+			if freq == 0 {
+				continue
+			}
+			df := float64(x.docFreqs[term])
+			idf := math.Log(1 + (numDocs-df+0.5)/(df+0.5))
+			score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*(1-bm25B+bm25B*float64(x.docLengths[doc])/avgLength))
+		}
+
+		if score > 0 {
+			matches = append(matches, keywordMatch{doc: doc, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].doc.ID < matches[j].doc.ID
+	})
+
+	return matches
+}
@@ -0,0 +1,273 @@
+package knowledge
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+const (
+	// RerankStrategyLLM scores candidates with an LLM, in one call per candidate
+	// or in one batch call as configured by UseBatchRerank
+	RerankStrategyLLM = "llm"
+	// RerankStrategyRRF fuses the rankings of the rewrites of a query with
+	// reciprocal rank fusion
+	RerankStrategyRRF = "rrf"
+	// RerankStrategyMMR reorders candidates with Maximal Marginal Relevance
+	RerankStrategyMMR = "mmr"
+	// RerankStrategyKeyword scores candidates by the query terms they contain
+	RerankStrategyKeyword = "keyword"
+
+	// DefaultMMRLambda is the default trade-off between relevance and diversity of MMR
+	DefaultMMRLambda = 0.7
+	// DefaultKeywordRerankWeight is the default weight of the keyword overlap
+	// against the search score
+	DefaultKeywordRerankWeight = 0.5
+)
+
+type (
+	// RankingsReranker is a Reranker that can rerank the rankings of several
+	// queries, such as the rewrites of a query, instead of their merged candidates
+	RankingsReranker interface {
+		Reranker
+		// RerankRankings reranks the results of each query, ranked best first, into
+		// one ranking of at most topK results
+		RerankRankings(ctx context.Context, query string, rankings [][]*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error)
+	}
+
+	// RRFReranker fuses rankings with reciprocal rank fusion. It makes no model calls.
+	RRFReranker struct {
+		k int
+	}
+
+	// MMRReranker reorders candidates with Maximal Marginal Relevance, so that
+	// near-duplicates of better candidates move down. It makes no model calls.
+	MMRReranker struct {
+		lambda float64
+	}
+
+	// KeywordOverlapReranker scores candidates by the share of the query terms
+	// they contain, blended with their search scores. It makes no model calls.
+	KeywordOverlapReranker struct {
+		weight float64
+	}
+)
+
+var (
+	_ RankingsReranker = (*RRFReranker)(nil)
+	_ Reranker         = (*MMRReranker)(nil)
+	_ Reranker         = (*KeywordOverlapReranker)(nil)
+)
+
+// NewRRFReranker creates a reranker fusing rankings with the rank constant k.
+// Values of k below 1 use DefaultRRFK.
+func NewRRFReranker(k int) *RRFReranker {
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+	return &RRFReranker{k: k}
+}
+
+// Rerank implements Reranker.Rerank. A single ranking keeps its order and gets
+// reciprocal rank scores.
+func (r *RRFReranker) Rerank(ctx context.Context, query string, candidates []*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error) {
+	return r.RerankRankings(ctx, query, [][]*KnowledgeSearchResult{candidates}, topK)
+}
+
+// RerankRankings implements RankingsReranker.RerankRankings. Results are
+// identified by document ID, and a result ranked first by every query scores 1.
+func (r *RRFReranker) RerankRankings(_ context.Context, _ string, rankings [][]*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error) {
+	scores := make(map[string]float64)
+	var results []*KnowledgeSearchResult
+	for _, ranking := range rankings {
+		for rank, result := range ranking {
+			if _, exists := scores[result.ID]; !exists {
+				results = append(results, result)
+			}
+			scores[result.ID] += 1 / float64(r.k+rank+1)
+		}
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	maxScore := float64(len(rankings)) / float64(r.k+1)
+	for _, result := range results {
+		result.Score = float32(scores[result.ID] / maxScore)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if topK < len(results) {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+// NewMMRReranker creates a reranker weighing relevance by lambda and diversity by
+// 1 - lambda. lambda is clamped to [0, 1].
+func NewMMRReranker(lambda float64) *MMRReranker {
+	return &MMRReranker{lambda: math.Max(0, math.Min(1, lambda))}
+}
+
+// Rerank implements Reranker.Rerank. Relevance is the min-max normalized search
+// score, and the similarity of two candidates is the cosine similarity of their
+// embeddings, or of their term frequencies when the store returned no embeddings.
+// Candidates keep their search scores.
+func (r *MMRReranker) Rerank(_ context.Context, _ string, candidates []*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	if topK > len(candidates) {
+		topK = len(candidates)
+	}
+
+	relevance := normalizedScores(candidates)
+	terms := make([]map[string]float64, len(candidates))
+	for i, candidate := range candidates {
+		if len(candidate.Embeddings) == 0 {
+			terms[i] = termFrequencies(candidateText(candidate))
+		}
+	}
+	similarity := func(i, j int) float64 {
+		a, b := candidates[i], candidates[j]
+		if len(a.Embeddings) > 0 && len(a.Embeddings) == len(b.Embeddings) {
+			return float64(cosineSimilarity(a.Embeddings, b.Embeddings))
+		}
+		if terms[i] == nil {
+			terms[i] = termFrequencies(candidateText(a))
+		}
+		if terms[j] == nil {
+			terms[j] = termFrequencies(candidateText(b))
+		}
+		return termCosineSimilarity(terms[i], terms[j])
+	}
+
+	// maxSimilarity[i] is the highest similarity of candidate i to a selected one
+	maxSimilarity := make([]float64, len(candidates))
+	selected := make([]bool, len(candidates))
+	results := make([]*KnowledgeSearchResult, 0, topK)
+	for len(results) < topK {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if selected[i] {
+				continue
+			}
+			score := r.lambda*relevance[i] - (1-r.lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		selected[best] = true
+		results = append(results, candidates[best])
+		for i := range candidates {
+			if !selected[i] {
+				maxSimilarity[i] = math.Max(maxSimilarity[i], similarity(i, best))
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// NewKeywordOverlapReranker creates a reranker weighing the keyword overlap by
+// weight and the normalized search score by 1 - weight. weight is clamped to [0, 1].
+func NewKeywordOverlapReranker(weight float64) *KeywordOverlapReranker {
+	return &KeywordOverlapReranker{weight: math.Max(0, math.Min(1, weight))}
+}
+
+// Rerank implements Reranker.Rerank
+func (r *KeywordOverlapReranker) Rerank(_ context.Context, query string, candidates []*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	queryTerms := termFrequencies(query)
+	relevance := normalizedScores(candidates)
+	for i, candidate := range candidates {
+		var overlap float64
+		if len(queryTerms) > 0 {
+			docTerms := termFrequencies(candidateText(candidate))
+			var matched int
+			for term := range queryTerms {
+				if docTerms[term] > 0 {
+					matched++
+				}
+			}
+			overlap = float64(matched) / float64(len(queryTerms))
+		}
+		candidate.Score = float32(r.weight*overlap + (1-r.weight)*relevance[i])
+	}
+
+	results := append([]*KnowledgeSearchResult{}, candidates...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if topK < len(results) {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+// normalizedScores min-max normalizes the scores of the results to [0, 1]. Equal
+// scores normalize to 1.
+func normalizedScores(results []*KnowledgeSearchResult) []float64 {
+	normalized := make([]float64, len(results))
+	if len(results) == 0 {
+		return normalized
+	}
+
+	minScore, maxScore := results[0].Score, results[0].Score
+	for _, result := range results[1:] {
+		if result.Score < minScore {
+			minScore = result.Score
+		}
+		if result.Score > maxScore {
+			maxScore = result.Score
+		}
+	}
+	for i, result := range results {
+		normalized[i] = 1
+		if maxScore > minScore {
+			normalized[i] = float64(result.Score-minScore) / float64(maxScore-minScore)
+		}
+	}
+	return normalized
+}
+
+// candidateText returns the text a candidate was embedded from
+func candidateText(result *KnowledgeSearchResult) string {
+	if result.EmbeddingText != "" {
+		return result.EmbeddingText
+	}
+	return result.Content.Text
+}
+
+// termFrequencies counts the keyword terms of text
+func termFrequencies(text string) map[string]float64 {
+	freqs := make(map[string]float64)
+	for _, term := range keywordTerms(text) {
+		freqs[term]++
+	}
+	return freqs
+}
+
+// termCosineSimilarity returns the cosine similarity of two term frequency vectors
+func termCosineSimilarity(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, freq := range a {
+		dot += freq * b[term]
+		normA += freq * freq
+	}
+	for _, freq := range b {
+		normB += freq * freq
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,227 @@
+package knowledge_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createRankedResult(id, text string, score float32) *knowledge.KnowledgeSearchResult {
+	result := createKnowledgeSearchResult(text)
+	result.ID = id
+	result.EmbeddingText = text
+	result.Score = score
+	return result
+}
+
+func resultIDs(results []*knowledge.KnowledgeSearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestRRFReranker(t *testing.T) {
+	ctx := t.Context()
+	reranker := knowledge.NewRRFReranker(60)
+
+	t.Run("fuses rankings", func(t *testing.T) {
+		rankings := [][]*knowledge.KnowledgeSearchResult{
+			{createRankedResult("a", "a", 0.9), createRankedResult("b", "b", 0.8), createRankedResult("c", "c", 0.7)},
+			{createRankedResult("b", "b", 0.9), createRankedResult("c", "c", 0.8), createRankedResult("d", "d", 0.7)},
+			{createRankedResult("b", "b", 0.9), createRankedResult("a", "a", 0.8)},
+		}
+
+		results, err := reranker.RerankRankings(ctx, "query", rankings, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a", "c"}, resultIDs(results))
+		assert.Greater(t, results[0].Score, results[1].Score)
+		assert.LessOrEqual(t, results[0].Score, float32(1))
+	})
+
+	t.Run("first in every ranking scores 1", func(t *testing.T) {
+		rankings := [][]*knowledge.KnowledgeSearchResult{
+			{createRankedResult("a", "a", 0.5)},
+			{createRankedResult("a", "a", 0.4)},
+		}
+
+		results, err := reranker.RerankRankings(ctx, "query", rankings, 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.InDelta(t, 1.0, results[0].Score, 1e-6)
+	})
+
+	t.Run("single ranking keeps order", func(t *testing.T) {
+		candidates := []*knowledge.KnowledgeSearchResult{
+			createRankedResult("a", "a", 0.9),
+			createRankedResult("b", "b", 0.8),
+			createRankedResult("c", "c", 0.7),
+		}
+
+		results, err := reranker.Rerank(ctx, "query", candidates, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, resultIDs(results))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		results, err := reranker.RerankRankings(ctx, "query", nil, 5)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+}
+
+func TestMMRReranker(t *testing.T) {
+	ctx := t.Context()
+
+	t.Run("demotes near-duplicates by embeddings", func(t *testing.T) {
+		candidates := []*knowledge.KnowledgeSearchResult{
+			createRankedResult("a", "a", 0.95),
+			createRankedResult("a-copy", "a copy", 0.94),
+			createRankedResult("b", "b", 0.8),
+		}
+		candidates[0].Embeddings = []float32{1, 0, 0}
+		candidates[1].Embeddings = []float32{0.99, 0.01, 0}
+		candidates[2].Embeddings = []float32{0, 1, 0}
+
+		results, err := knowledge.NewMMRReranker(0.5).Rerank(ctx, "query", candidates, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, resultIDs(results))
+		assert.Equal(t, float32(0.8), results[1].Score, "MMR keeps the search scores")
+	})
+
+	t.Run("demotes near-duplicates by text", func(t *testing.T) {
+		candidates := []*knowledge.KnowledgeSearchResult{
+			createRankedResult("a", "golden retriever puppies playing fetch", 0.9),
+			createRankedResult("a-copy", "golden retriever puppies playing fetch outside", 0.89),
+			createRankedResult("b", "quarterly revenue report for investors", 0.7),
+			createRankedResult("c", "lighthouse keeper logbook", 0.1),
+		}
+
+		results, err := knowledge.NewMMRReranker(0.5).Rerank(ctx, "query", candidates, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, resultIDs(results))
+	})
+
+	t.Run("lambda 1 ranks by relevance only", func(t *testing.T) {
+		candidates := []*knowledge.KnowledgeSearchResult{
+			createRankedResult("a", "same text", 0.9),
+			createRankedResult("a-copy", "same text", 0.89),
+			createRankedResult("b", "other words", 0.7),
+		}
+
+		results, err := knowledge.NewMMRReranker(1).Rerank(ctx, "query", candidates, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "a-copy", "b"}, resultIDs(results))
+	})
+}
+
+func TestKeywordOverlapReranker(t *testing.T) {
+	ctx := t.Context()
+	candidates := func() []*knowledge.KnowledgeSearchResult {
+		return []*knowledge.KnowledgeSearchResult{
+			createRankedResult("weather", "The weather today is sunny", 0.9),
+			createRankedResult("recipe", "A recipe for apple pie with cinnamon", 0.6),
+			createRankedResult("apple", "Apple trees bloom in spring", 0.5),
+		}
+	}
+
+	results, err := knowledge.NewKeywordOverlapReranker(0.8).Rerank(ctx, "apple pie recipe", candidates(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recipe", "apple"}, resultIDs(results))
+	assert.Greater(t, results[0].Score, results[1].Score)
+
+	results, err = knowledge.NewKeywordOverlapReranker(0).Rerank(ctx, "apple pie recipe", candidates(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"weather", "recipe", "apple"}, resultIDs(results))
+}
+
+func TestGenkitReranker_Concurrency(t *testing.T) {
+	ctx := t.Context()
+	g, err := genkit.Init(ctx)
+	require.NoError(t, err)
+
+	var (
+		mu                 sync.Mutex
+		inFlight, maxCalls int
+		calls              atomic.Int32
+	)
+	genkit.DefineModel(g, "test", "scorer", &ai.ModelInfo{
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true, Context: true},
+	}, func(ctx context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		mu.Lock()
+		inFlight++
+		maxCalls = max(maxCalls, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+
+		// Score a document by the number in its text
+		var score int
+		for _, doc := range req.Docs {
+			for _, part := range doc.Content {
+				_, _ = fmt.Sscanf(strings.TrimPrefix(part.Text, "doc "), "%d", &score)
+			}
+		}
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage(fmt.Sprintf("%d", score))}, nil
+	})
+
+	var candidates []*knowledge.KnowledgeSearchResult
+	for i := 0; i < 8; i++ {
+		candidates = append(candidates, createRankedResult(fmt.Sprintf("%d", i), fmt.Sprintf("doc %d", i), 0.5))
+	}
+
+	reranker := knowledge.NewGenkitReranker(g, "test/scorer", knowledge.WithRerankConcurrency(3))
+	results, err := reranker.Rerank(ctx, "query", candidates, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7", "6", "5"}, resultIDs(results))
+	assert.Equal(t, int32(8), calls.Load())
+	assert.Equal(t, 3, maxCalls)
+}
+
+func TestService_LocalRerankStrategy(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankStrategy = knowledge.RerankStrategyKeyword
+	conf.RerankKeywordWeight = 0.8
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	_, err = service.IndexKnowledgeFromMap(ctx, "catalog", []map[string]any{
+		{"content": "Our blue widgets are popular with gardeners"},
+		{"content": "Model ZX-9000 supports fast charging"},
+		{"content": "Returns are accepted within 30 days"},
+	})
+	require.NoError(t, err)
+
+	results, err := service.RetrieveRelevantKnowledge(ctx, "ZX-9000 charging", 1, []string{"catalog"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].EmbeddingText, "ZX-9000")
+
+	conf.RerankStrategy = "oracle"
+	_, err = knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.Default())
+	assert.ErrorContains(t, err, "unsupported rerank strategy")
+}
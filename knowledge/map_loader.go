@@ -2,6 +2,9 @@ package knowledge
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -12,13 +15,6 @@ import (
 
 // IndexKnowledge indexes knowledge documents for an agent
 func (s *service) IndexKnowledgeFromMap(ctx context.Context, id string, input []map[string]any) (*Knowledge, error) {
-	// First, delete existing knowledge for this agent
-	if id != "" {
-		if err := s.DeleteKnowledge(ctx, id); err != nil {
-			return nil, errors.Wrapf(err, "failed to delete existing knowledge")
-		}
-	}
-
 	knowledge := &Knowledge{
 		ID: id,
 		Metadata: map[string]any{
@@ -26,59 +22,196 @@ func (s *service) IndexKnowledgeFromMap(ctx context.Context, id string, input []
 		},
 	}
 
-	// Process knowledge into text chunks
-	knowledge.Documents = ProcessKnowledgeFromMap(input)
+	// Process knowledge into text chunks, identified by their item so that
+	// inserting or removing items does not change the IDs of the others
+	var documents []*Document
+	itemIds := make(map[string]int, len(input))
+	for _, item := range input {
+		for _, doc := range ProcessKnowledgeFromMap([]map[string]any{item}) {
+			if id != "" {
+				itemId := mapItemID(item)
+				// Items with the same identity are told apart by their occurrence
+				if itemIds[itemId]++; itemIds[itemId] > 1 {
+					itemId = fmt.Sprintf("%s_%d", itemId, itemIds[itemId])
+				}
+				doc.ID = fmt.Sprintf("%s_item_%s", id, itemId)
+			}
+			documents = append(documents, doc)
+		}
+	}
+	knowledge.Documents = ChunkDocuments(documents, s.chunker)
 	if len(knowledge.Documents) == 0 {
 		return nil, errors.Errorf("no documents found for knowledge %s", id)
 	}
 
-	// Extract text content for embedding
-	embeddingTexts := make([]string, len(knowledge.Documents))
-	for i, chunk := range knowledge.Documents {
-		embeddingTexts[i] = chunk.EmbeddingText
+	if err := s.upsertKnowledge(ctx, knowledge); err != nil {
+		return nil, err
+	}
+
+	return knowledge, nil
+}
+
+// mapItemID returns the identity of a knowledge map item: its "id" field, or a
+// hash of its content when it has none
+func mapItemID(item map[string]any) string {
+	if id := fieldText(item["id"]); id != "" {
+		return id
+	}
+
+	// Maps are marshaled with sorted keys, so equal items hash the same
+	data, err := json.Marshal(item)
+	if err != nil {
+		data = []byte(fmt.Sprint(item))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:6])
+}
+
+// upsertKnowledge stores knowledge incrementally. Documents whose content hash
+// matches the stored document with the same ID keep its embeddings, new and
+// changed documents are embedded, and stored documents missing from knowledge
+// are removed. The changes are reported in knowledge.IndexSummary.
+func (s *service) upsertKnowledge(ctx context.Context, knowledge *Knowledge) error {
+	if len(knowledge.Documents) == 0 {
+		return errors.Errorf("no documents found for knowledge %s", knowledge.ID)
+	}
+
+	hashes := map[string]string{}
+	if knowledge.ID != "" {
+		var err error
+		if hashes, err = s.store.GetDocumentHashes(ctx, knowledge.ID); err != nil {
+			return errors.Wrapf(err, "failed to get stored document hashes")
+		}
+	}
+
+	var (
+		summary IndexSummary
+		added   []*Document
+		changed []*Document
+	)
+	documentIds := make(map[string]bool, len(knowledge.Documents))
+	for _, doc := range knowledge.Documents {
+		doc.ContentHash = s.documentHash(doc)
+		storedHash, exists := hashes[doc.ID]
+		switch {
+		case doc.ID == "" || !exists:
+			added = append(added, doc)
+		case storedHash == doc.ContentHash:
+			documentIds[doc.ID] = true
+			summary.Unchanged = append(summary.Unchanged, doc.ID)
+			continue
+		default:
+			summary.Updated = append(summary.Updated, doc.ID)
+		}
+		documentIds[doc.ID] = true
+		changed = append(changed, doc)
+	}
+	for id := range hashes {
+		if !documentIds[id] {
+			summary.Removed = append(summary.Removed, id)
+		}
+	}
+	sort.Strings(summary.Removed)
+
+	if err := s.embedDocuments(ctx, changed); err != nil {
+		return err
+	}
+
+	if err := s.store.Upsert(ctx, knowledge); err != nil {
+		return errors.Wrapf(err, "failed to store knowledge")
+	}
+
+	// IDs of added documents may be assigned by the store
+	for _, doc := range added {
+		summary.Added = append(summary.Added, doc.ID)
+	}
+	knowledge.IndexSummary = &summary
+
+	s.logger.Info("Indexed knowledge",
+		"knowledge_id", knowledge.ID,
+		"added", len(summary.Added),
+		"updated", len(summary.Updated),
+		"removed", len(summary.Removed),
+		"unchanged", len(summary.Unchanged))
+
+	return nil
+}
+
+// embedDocuments generates the embeddings of documents from their embedding
+// texts, or from their images when they belong to the vision space, such as
+// images and PDF pages embedded with PDFEmbeddingMethod "vision"
+func (s *service) embedDocuments(ctx context.Context, documents []*Document) error {
+	var texts, images []*Document
+	for _, doc := range documents {
+		if inVisionSpace(doc) {
+			images = append(images, doc)
+		} else {
+			texts = append(texts, doc)
+		}
+	}
+	if err := embedImageDocuments(ctx, s.embedder, images, s.logger); err != nil {
+		return err
+	}
+	if len(texts) == 0 {
+		return nil
 	}
 
 	// Generate embeddings
-	embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, gog.Map(knowledge.Documents, func(d *Document) string {
+	embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, gog.Map(texts, func(d *Document) string {
 		return d.EmbeddingText
 	})...)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to generate text embeddings - check your API configuration and keys")
+		return errors.Wrapf(err, "failed to generate text embeddings - check your API configuration and keys")
 	}
 
-	if len(embeddings) != len(knowledge.Documents) {
-		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(knowledge.Documents))
+	if len(embeddings) != len(texts) {
+		return errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(texts))
 	}
 
-	// Create knowledge items for storage
-	for i := range knowledge.Documents {
-		knowledge.Documents[i].Embeddings = embeddings[i]
+	for i := range texts {
+		texts[i].Embeddings = embeddings[i]
 	}
 
-	// Store all items
-	if err := s.store.Store(ctx, knowledge); err != nil {
-		return nil, errors.Wrapf(err, "failed to store knowledge")
-	}
-
-	return knowledge, nil
+	return nil
 }
 
 // processKnowledge converts knowledge maps into indexable text chunks
 func ProcessKnowledgeFromMap(data []map[string]any) []*Document {
-	documents := make([]*Document, 0, len(data))
-	for _, item := range data {
+	return ProcessDocumentsFromRecords(data, RecordOptions{})
+}
+
+// ProcessDocumentsFromRecords converts records into documents, one per record
+// with text, embedding the fields selected by opts and keeping the others as metadata
+func ProcessDocumentsFromRecords(records []map[string]any, opts RecordOptions) []*Document {
+	documents := make([]*Document, 0, len(records))
+	for _, item := range records {
 		// Convert the knowledge item to a searchable text representation
-		content := ExtractTextFromMap(item)
+		var content string
+		if len(opts.TextFields) > 0 {
+			content = ExtractTextFromFields(item, opts.TextFields)
+		} else {
+			content = ExtractTextFromMap(item)
+		}
 		if content == "" {
 			continue
 		}
 
+		metadata := item
+		if len(opts.MetadataFields) > 0 {
+			metadata = make(map[string]any, len(opts.MetadataFields))
+			for _, field := range opts.MetadataFields {
+				if value, exists := item[field]; exists {
+					metadata[field] = value
+				}
+			}
+		}
+
 		documents = append(documents, &Document{
 			Content: Content{
 				MIMEType: "text/plain",
 				Text:     content,
 			},
-			Metadata:      item,
+			Metadata:      metadata,
 			EmbeddingText: content,
 		})
 	}
@@ -88,26 +221,31 @@ func ProcessKnowledgeFromMap(data []map[string]any) []*Document {
 
 // extractTextFromKnowledge extracts searchable text from a knowledge map
 func ExtractTextFromMap(item map[string]any) string {
-	var textParts []string
-
 	// Common text fields to extract (in priority order)
-	textFields := []string{"content", "description", "title", "summary", "text", "name"}
+	return ExtractTextFromFields(item, []string{"content", "description", "title", "summary", "text", "name"})
+}
+
+// ExtractTextFromFields extracts searchable text from the given fields of a
+// knowledge map in priority order, falling back to all of its string values
+// when none of the fields has text
+func ExtractTextFromFields(item map[string]any, textFields []string) string {
+	var textParts []string
 
-	// First, look for standard text fields
+	// First, look for the given text fields
 	var foundStandardFields []string
 	for _, field := range textFields {
 		if value, exists := item[field]; exists {
-			if str, ok := value.(string); ok && str != "" {
+			if str := fieldText(value); str != "" {
 				foundStandardFields = append(foundStandardFields, str)
 			}
 		}
 	}
 
-	// If we found standard text fields, use them
+	// If we found the text fields, use them
 	if len(foundStandardFields) > 0 {
 		textParts = foundStandardFields
 	} else {
-		// If no standard text fields found, try to extract from all string values
+		// If no text fields found, try to extract from all string values
 		// Sort keys for deterministic ordering
 		var keys []string
 		for k := range item {
@@ -125,3 +263,15 @@ func ExtractTextFromMap(item map[string]any) string {
 
 	return strings.Join(textParts, " ")
 }
+
+// fieldText returns the text of a string, number or boolean field value
+func fieldText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
@@ -1,9 +1,13 @@
 package knowledge_test
 
 import (
+	"io"
+	"log/slog"
 	"testing"
 
+	"github.com/habiliai/agentruntime/config"
 	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -95,3 +99,81 @@ func TestTextExtraction(t *testing.T) {
 		})
 	}
 }
+
+func TestService_IndexKnowledgeFromMap_Incremental(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	result, err := service.IndexKnowledgeFromMap(ctx, "faq", []map[string]any{
+		{"id": "hours", "content": "The office opens at 9am"},
+		{"id": "parking", "content": "Parking is free for visitors"},
+		{"id": "lunch", "content": "Lunch is served at noon"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"faq_item_hours", "faq_item_parking", "faq_item_lunch"}, result.IndexSummary.Added)
+
+	result, err = service.IndexKnowledgeFromMap(ctx, "faq", []map[string]any{
+		{"id": "hours", "content": "The office opens at 9am"},
+		{"id": "parking", "content": "Parking costs $5 per day"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.IndexSummary.Added)
+	assert.Equal(t, []string{"faq_item_parking"}, result.IndexSummary.Updated)
+	assert.Equal(t, []string{"faq_item_lunch"}, result.IndexSummary.Removed)
+	assert.Equal(t, []string{"faq_item_hours"}, result.IndexSummary.Unchanged)
+
+	// Unchanged documents are not embedded again but stay searchable
+	assert.Empty(t, result.Documents[0].Embeddings)
+	assert.NotEmpty(t, result.Documents[1].Embeddings)
+	results, err := service.RetrieveRelevantKnowledge(ctx, "when does the office open", 1, []string{"faq"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "faq_item_hours", results[0].ID)
+
+	stored, err := service.GetKnowledge(ctx, "faq")
+	require.NoError(t, err)
+	assert.Len(t, stored.Documents, 2)
+}
+
+func TestService_IndexKnowledgeFromMap_InsertItem(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	items := []map[string]any{
+		{"content": "The office opens at 9am"},
+		{"content": "Parking is free for visitors"},
+		{"content": "Parking is free for visitors"},
+	}
+	first, err := service.IndexKnowledgeFromMap(ctx, "faq", items)
+	require.NoError(t, err)
+	require.Len(t, first.IndexSummary.Added, 3)
+	assert.Equal(t, first.IndexSummary.Added[1]+"_2", first.IndexSummary.Added[2])
+
+	// Items without an id are identified by their content, so inserting an item
+	// at the top keeps the others unchanged
+	result, err := service.IndexKnowledgeFromMap(ctx, "faq", append([]map[string]any{
+		{"content": "Lunch is served at noon"},
+	}, items...))
+	require.NoError(t, err)
+	assert.Len(t, result.IndexSummary.Added, 1)
+	assert.Empty(t, result.IndexSummary.Updated)
+	assert.Empty(t, result.IndexSummary.Removed)
+	assert.ElementsMatch(t, first.IndexSummary.Added, result.IndexSummary.Unchanged)
+	for _, doc := range result.Documents[1:] {
+		assert.Empty(t, doc.Embeddings)
+	}
+}
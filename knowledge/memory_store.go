@@ -6,12 +6,15 @@ import (
 	"slices"
 	"sort"
 	"sync"
+
+	"github.com/google/uuid"
 )
 
 type (
 	InMemoryStore struct {
 		mu         sync.RWMutex
 		knowledges map[string]*Knowledge // key: knowledge ID
+		keywords   *keywordIndex
 	}
 )
 
@@ -19,6 +22,7 @@ type (
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
 		knowledges: make(map[string]*Knowledge),
+		keywords:   newKeywordIndex(),
 	}
 }
 
@@ -27,6 +31,56 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
+	i.put(knowledge)
+	return nil
+}
+
+// Upsert implements Store.Upsert
+func (i *InMemoryStore) Upsert(ctx context.Context, knowledge *Knowledge) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	embeddings := make(map[string][]float32)
+	if existing, exists := i.knowledges[knowledge.ID]; exists {
+		for _, doc := range existing.Documents {
+			embeddings[doc.ID] = doc.Embeddings
+		}
+	}
+
+	for _, doc := range knowledge.Documents {
+		if doc.ID == "" {
+			doc.ID = uuid.NewString()
+		}
+	}
+
+	// Documents left out of the knowledge are dropped by replacing it
+	for _, doc := range i.put(knowledge).Documents {
+		if len(doc.Embeddings) == 0 {
+			doc.Embeddings = embeddings[doc.ID]
+		}
+	}
+
+	return nil
+}
+
+// GetDocumentHashes implements Store.GetDocumentHashes
+func (i *InMemoryStore) GetDocumentHashes(ctx context.Context, knowledgeId string) (map[string]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	hashes := make(map[string]string)
+	if knowledge, exists := i.knowledges[knowledgeId]; exists {
+		for _, doc := range knowledge.Documents {
+			hashes[doc.ID] = doc.ContentHash
+		}
+	}
+
+	return hashes, nil
+}
+
+// put stores a deep copy of knowledge, replacing the stored knowledge with the
+// same ID. The caller must hold the write lock.
+func (i *InMemoryStore) put(knowledge *Knowledge) *Knowledge {
 	// Deep copy the knowledge to avoid external modifications
 	storedKnowledge := &Knowledge{
 		ID:        knowledge.ID,
@@ -34,7 +88,12 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 		Documents: make([]*Document, len(knowledge.Documents)),
 	}
 
-	// Store knowledge
+	// Store knowledge, replacing the documents of the stored one in the keyword index
+	if existing, exists := i.knowledges[knowledge.ID]; exists {
+		for _, doc := range existing.Documents {
+			i.keywords.remove(doc)
+		}
+	}
 	i.knowledges[knowledge.ID] = storedKnowledge
 
 	// Store documents
@@ -46,6 +105,7 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 			Embeddings:    copyFloat32Slice(doc.Embeddings),
 			EmbeddingText: doc.EmbeddingText,
 			Metadata:      copyMap(doc.Metadata),
+			ContentHash:   doc.ContentHash,
 		}
 
 		// Add knowledge ID to document metadata for reference
@@ -55,13 +115,14 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 		storedDoc.Metadata["knowledge_id"] = knowledge.ID
 
 		storedKnowledge.Documents[idx] = storedDoc
+		i.keywords.add(storedDoc)
 	}
 
-	return nil
+	return storedKnowledge
 }
 
 // Search implements Store.Search
-func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error) {
+func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
@@ -81,7 +142,7 @@ func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, li
 			continue
 		}
 		for _, doc := range kl.Documents {
-			if len(doc.Embeddings) == 0 {
+			if len(doc.Embeddings) == 0 || !filter.Matches(doc.Metadata) {
 				continue
 			}
 
@@ -125,6 +186,35 @@ func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, li
 	return results, nil
 }
 
+// KeywordSearch implements Store.KeywordSearch
+func (i *InMemoryStore) KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	matches := i.keywords.search(query, func(doc *Document) bool {
+		knowledgeId, _ := doc.Metadata["knowledge_id"].(string)
+		return (len(allowedKnowledgeIds) == 0 || slices.Contains(allowedKnowledgeIds, knowledgeId)) && filter.Matches(doc.Metadata)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	results := make([]KnowledgeSearchResult, len(matches))
+	for idx, match := range matches {
+		results[idx] = KnowledgeSearchResult{
+			Document: &Document{
+				ID:            match.doc.ID,
+				Content:       match.doc.Content,
+				EmbeddingText: match.doc.EmbeddingText,
+				Metadata:      copyMap(match.doc.Metadata),
+			},
+			Score: float32(match.score),
+		}
+	}
+
+	return results, nil
+}
+
 // GetKnowledgeById implements Store.GetKnowledgeById
 func (i *InMemoryStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error) {
 	i.mu.RLock()
@@ -150,20 +240,56 @@ func (i *InMemoryStore) GetKnowledgeById(ctx context.Context, knowledgeId string
 			Embeddings:    nil, // Don't include embeddings in get results
 			EmbeddingText: doc.EmbeddingText,
 			Metadata:      copyMap(doc.Metadata),
+			ContentHash:   doc.ContentHash,
 		}
 	}
 
 	return result, nil
 }
 
+// GetDocumentEmbeddings implements Store.GetDocumentEmbeddings
+func (i *InMemoryStore) GetDocumentEmbeddings(ctx context.Context, knowledgeId string) (map[string][]float32, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	embeddings := make(map[string][]float32)
+	if knowledge, exists := i.knowledges[knowledgeId]; exists {
+		for _, doc := range knowledge.Documents {
+			if len(doc.Embeddings) > 0 {
+				embeddings[doc.ID] = slices.Clone(doc.Embeddings)
+			}
+		}
+	}
+
+	return embeddings, nil
+}
+
+// ListKnowledgeIds implements Store.ListKnowledgeIds
+func (i *InMemoryStore) ListKnowledgeIds(ctx context.Context) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	ids := make([]string, 0, len(i.knowledges))
+	for id := range i.knowledges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
 // DeleteKnowledgeById implements Store.DeleteKnowledgeById
 func (i *InMemoryStore) DeleteKnowledgeById(ctx context.Context, knowledgeId string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if _, exists := i.knowledges[knowledgeId]; !exists {
+	knowledge, exists := i.knowledges[knowledgeId]
+	if !exists {
 		return nil // Not an error if knowledge doesn't exist
 	}
+	for _, doc := range knowledge.Documents {
+		i.keywords.remove(doc)
+	}
 
 	// Delete knowledge
 	delete(i.knowledges, knowledgeId)
@@ -178,6 +304,7 @@ func (i *InMemoryStore) Close() error {
 
 	// Clear all data
 	i.knowledges = make(map[string]*Knowledge)
+	i.keywords = newKeywordIndex()
 
 	return nil
 }
@@ -2,6 +2,8 @@ package knowledge_test
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/habiliai/agentruntime/knowledge"
@@ -116,7 +118,7 @@ func TestInMemoryStore_Search(t *testing.T) {
 
 	// Search with a query embedding similar to doc-1
 	queryEmbedding := generateTestEmbedding(128, 1) // Same as doc-1
-	results, err := store.Search(ctx, queryEmbedding, 2, nil)
+	results, err := store.Search(ctx, queryEmbedding, 2, nil, nil)
 	require.NoError(t, err)
 	require.Len(t, results, 2)
 
@@ -125,7 +127,7 @@ func TestInMemoryStore_Search(t *testing.T) {
 	assert.Greater(t, results[0].Score, float32(0.99)) // Should be very close to 1.0
 
 	// Test with empty query embedding
-	emptyResults, err := store.Search(ctx, []float32{}, 10, nil)
+	emptyResults, err := store.Search(ctx, []float32{}, 10, nil, nil)
 	require.NoError(t, err)
 	assert.Empty(t, emptyResults)
 }
@@ -259,3 +261,203 @@ func generateTestEmbedding(dim int, seed int) []float32 {
 	}
 	return embedding
 }
+
+func TestInMemoryStore_Upsert(t *testing.T) {
+	store := knowledge.NewInMemoryStore()
+	defer store.Close()
+
+	testStoreUpsert(t, store)
+}
+
+// testStoreUpsert checks that Store.Upsert keeps the embeddings of documents
+// stored without them and removes the documents left out
+func testStoreUpsert(t *testing.T, store knowledge.Store) {
+	ctx := t.Context()
+
+	newDocument := func(id string, hash string, embeddings []float32) *knowledge.Document {
+		return &knowledge.Document{
+			ID: id,
+			Content: knowledge.Content{
+				MIMEType: "text/plain",
+				Text:     "Document " + id,
+			},
+			EmbeddingText: "Document " + id,
+			Embeddings:    embeddings,
+			ContentHash:   hash,
+		}
+	}
+
+	require.NoError(t, store.Upsert(ctx, &knowledge.Knowledge{
+		ID: "upsert",
+		Documents: []*knowledge.Document{
+			newDocument("doc-1", "hash-1", generateTestEmbedding(16, 1)),
+			newDocument("doc-2", "hash-2", generateTestEmbedding(16, 2)),
+		},
+	}))
+
+	require.NoError(t, store.Upsert(ctx, &knowledge.Knowledge{
+		ID: "upsert",
+		Documents: []*knowledge.Document{
+			newDocument("doc-1", "hash-1", nil),
+			newDocument("doc-3", "hash-3", generateTestEmbedding(16, 3)),
+		},
+	}))
+
+	hashes, err := store.GetDocumentHashes(ctx, "upsert")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"doc-1": "hash-1", "doc-3": "hash-3"}, hashes)
+
+	stored, err := store.GetKnowledgeById(ctx, "upsert")
+	require.NoError(t, err)
+	require.Len(t, stored.Documents, 2)
+
+	// doc-1 kept its embedding and doc-2 is no longer searchable
+	results, err := store.Search(ctx, generateTestEmbedding(16, 1), 1, []string{"upsert"}, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "doc-1", results[0].ID)
+
+	results, err = store.Search(ctx, generateTestEmbedding(16, 2), 3, []string{"upsert"}, nil)
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.NotEqual(t, "doc-2", result.ID)
+	}
+
+	hashes, err = store.GetDocumentHashes(ctx, "missing")
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+}
+
+func TestInMemoryStore_KeywordSearch(t *testing.T) {
+	store := knowledge.NewInMemoryStore()
+	defer store.Close()
+
+	testStoreKeywordSearch(t, store)
+}
+
+// testStoreKeywordSearch checks that Store.KeywordSearch matches exact terms
+// such as product codes and stays in sync with stored and removed documents
+func testStoreKeywordSearch(t *testing.T, store knowledge.Store) {
+	ctx := t.Context()
+
+	newDocument := func(id string, text string) *knowledge.Document {
+		return &knowledge.Document{
+			ID: id,
+			Content: knowledge.Content{
+				MIMEType: "text/plain",
+				Text:     text,
+			},
+			EmbeddingText: text,
+			Embeddings:    generateTestEmbedding(16, len(text)),
+		}
+	}
+
+	require.NoError(t, store.Store(ctx, &knowledge.Knowledge{
+		ID: "support",
+		Documents: []*knowledge.Document{
+			newDocument("error", "Error E1234 means the disk is full"),
+			newDocument("widget", "The SKU-42X widget ships in blue"),
+			newDocument("general", "General troubleshooting steps for any error"),
+		},
+	}))
+	require.NoError(t, store.Store(ctx, &knowledge.Knowledge{
+		ID: "parts",
+		Documents: []*knowledge.Document{
+			newDocument("spare", "Spare parts for SKU-42X"),
+		},
+	}))
+
+	results, err := store.KeywordSearch(ctx, "what does E1234 mean", 10, nil, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "error", results[0].ID)
+	assert.Greater(t, results[0].Score, float32(0))
+
+	results, err = store.KeywordSearch(ctx, "sku-42x", 10, []string{"support"}, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "widget", results[0].ID)
+
+	results, err = store.KeywordSearch(ctx, "?!", 10, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Removed documents are no longer matched
+	require.NoError(t, store.Upsert(ctx, &knowledge.Knowledge{
+		ID: "support",
+		Documents: []*knowledge.Document{
+			newDocument("error", "Error E1234 means the disk is full"),
+		},
+	}))
+	require.NoError(t, store.DeleteKnowledgeById(ctx, "parts"))
+
+	results, err = store.KeywordSearch(ctx, "42x", 10, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestInMemoryStore_SearchWithFilter(t *testing.T) {
+	store := knowledge.NewInMemoryStore()
+	defer store.Close()
+
+	testStoreSearchWithFilter(t, store)
+}
+
+// testStoreSearchWithFilter checks that Store.Search and Store.KeywordSearch
+// only return documents whose metadata matches the filter
+func testStoreSearchWithFilter(t *testing.T, store knowledge.Store) {
+	ctx := t.Context()
+
+	var documents []*knowledge.Document
+	for i, metadata := range []map[string]any{
+		{"page_number": 1, "source_type": "pdf", "language": "en"},
+		{"page_number": 2, "source_type": "pdf", "language": "ko"},
+		{"page_number": 3, "source_type": "pdf"},
+		{"source_type": "markdown", "language": "en", "published": "2024-03-01"},
+	} {
+		documents = append(documents, &knowledge.Document{
+			ID: fmt.Sprintf("doc-%d", i+1),
+			Content: knowledge.Content{
+				MIMEType: "text/plain",
+				Text:     "Quarterly report",
+			},
+			EmbeddingText: "Quarterly report",
+			Embeddings:    generateTestEmbedding(16, i),
+			Metadata:      metadata,
+		})
+	}
+	require.NoError(t, store.Store(ctx, &knowledge.Knowledge{ID: "reports", Documents: documents}))
+
+	search := func(filter *knowledge.Filter) []string {
+		results, err := store.Search(ctx, generateTestEmbedding(16, 0), 10, []string{"reports"}, filter)
+		require.NoError(t, err)
+		keywordResults, err := store.KeywordSearch(ctx, "quarterly", 10, []string{"reports"}, filter)
+		require.NoError(t, err)
+
+		var ids, keywordIds []string
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		for _, result := range keywordResults {
+			keywordIds = append(keywordIds, result.ID)
+		}
+		assert.ElementsMatch(t, ids, keywordIds)
+		sort.Strings(ids)
+		return ids
+	}
+	notSet := false
+
+	assert.Equal(t, []string{"doc-1", "doc-2", "doc-3", "doc-4"}, search(nil))
+	assert.Equal(t, []string{"doc-1", "doc-2", "doc-3"}, search(knowledge.FieldEq("source_type", "pdf")))
+	assert.Equal(t, []string{"doc-2", "doc-3"}, search(&knowledge.Filter{Field: "page_number", Gte: 2.0}))
+	assert.Equal(t, []string{"doc-1", "doc-4"}, search(knowledge.FieldIn("language", "en", "fr")))
+	assert.Equal(t, []string{"doc-3"}, search(knowledge.AllOf(
+		knowledge.FieldEq("source_type", "pdf"),
+		&knowledge.Filter{Field: "language", Exists: &notSet},
+	)))
+	assert.Equal(t, []string{"doc-1", "doc-4"}, search(knowledge.AnyOf(
+		knowledge.FieldEq("page_number", 1),
+		&knowledge.Filter{Field: "published", Lt: "2025-01-01"},
+	)))
+	assert.Empty(t, search(knowledge.FieldEq("page_number", "1")))
+}
@@ -31,21 +31,14 @@ func min(a, b int) int {
 }
 
 func (s *service) IndexKnowledgeFromPDF(ctx context.Context, id string, inputs []io.Reader) (*Knowledge, error) {
-	// First, delete existing knowledge for this agent
-	if id != "" {
-		if err := s.DeleteKnowledge(ctx, id); err != nil {
-			return nil, errors.Wrapf(err, "failed to delete existing knowledge")
-		}
-	}
-
-	knowledge, err := ProcessKnowledgeFromMultiplePDFs(ctx, s.genkit, id, inputs, s.logger, s.config, s.embedder)
+	knowledge, err := extractKnowledgeFromPDFs(ctx, s.genkit, id, inputs, s.logger, s.config)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to process knowledge from PDFs")
 	}
 
-	// Store all items
-	if err := s.store.Store(ctx, knowledge); err != nil {
-		return nil, errors.Wrapf(err, "failed to store knowledge")
+	// Only pages that changed since the knowledge was last indexed are embedded
+	if err := s.upsertKnowledge(ctx, knowledge); err != nil {
+		return nil, err
 	}
 
 	return knowledge, nil
@@ -60,6 +53,28 @@ func ProcessKnowledgeFromMultiplePDFs(
 	logger *slog.Logger,
 	config *config.KnowledgeConfig,
 	embedder Embedder,
+) (*Knowledge, error) {
+	knowledge, err := extractKnowledgeFromPDFs(ctx, g, id, inputs, logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := embedPDFDocuments(ctx, config, embedder, knowledge.Documents, logger); err != nil {
+		return nil, err
+	}
+
+	return knowledge, nil
+}
+
+// extractKnowledgeFromPDFs extracts the pages of multiple PDFs into a single
+// Knowledge object without embedding them
+func extractKnowledgeFromPDFs(
+	ctx context.Context,
+	g *genkit.Genkit,
+	id string,
+	inputs []io.Reader,
+	logger *slog.Logger,
+	config *config.KnowledgeConfig,
 ) (*Knowledge, error) {
 	// Create knowledge object
 	knowledge := &Knowledge{
@@ -83,28 +98,40 @@ func ProcessKnowledgeFromMultiplePDFs(
 		pdfCount++
 
 		// Process PDF directly to get documents and metadata
-		documents, pdfMetadata, err := ProcessDocumentsFromPDF(ctx, g, input, logger, config, embedder)
+		documents, pdfMetadata, err := extractDocumentsFromPDF(ctx, g, input, logger, config)
 		if err != nil {
 			logger.Warn("Failed to process PDF", "pdf_number", pdfCount, "error", err.Error())
 			continue
 		}
 
 		// Add documents with updated IDs and metadata
+		globalPageNumbers := make(map[any]int)
 		for _, doc := range documents {
-			// Update document ID to include PDF number and global page number
-			doc.ID = fmt.Sprintf("%s_pdf_%d_page_%d", id, pdfCount, globalPageNumber)
-
 			// Update metadata to include PDF source info
 			if doc.Metadata == nil {
 				doc.Metadata = make(map[string]any)
 			}
+
+			// Chunks of the same page share its global page number
+			pageNumber, ok := globalPageNumbers[doc.Metadata["page_number"]]
+			if !ok {
+				pageNumber = globalPageNumber
+				globalPageNumbers[doc.Metadata["page_number"]] = pageNumber
+				globalPageNumber++
+			}
+
+			// Update document ID to include PDF number, global page number and chunk index
+			doc.ID = fmt.Sprintf("%s_pdf_%d_page_%d", id, pdfCount, pageNumber)
+			if chunkCount, _ := doc.Metadata[MetadataKeyChunkCount].(int); chunkCount > 1 {
+				doc.ID = fmt.Sprintf("%s_chunk_%d", doc.ID, doc.Metadata[MetadataKeyChunkIndex])
+			}
+
 			doc.Metadata["pdf_number"] = pdfCount
-			doc.Metadata["global_page_number"] = globalPageNumber
+			doc.Metadata["global_page_number"] = pageNumber
 			doc.Metadata["original_page_number"] = doc.Metadata["page_number"]
-			doc.Metadata["page_number"] = globalPageNumber
+			doc.Metadata["page_number"] = pageNumber
 
 			knowledge.Documents = append(knowledge.Documents, doc)
-			globalPageNumber++
 		}
 
 		// Collect metadata directly
@@ -133,7 +160,8 @@ func ProcessKnowledgeFromMultiplePDFs(
 
 	logger.Info("Processed multiple PDFs",
 		"pdf_count", pdfCount,
-		"total_pages", len(knowledge.Documents),
+		"total_pages", globalPageNumber-1,
+		"documents", len(knowledge.Documents),
 		"knowledge_id", id)
 
 	return knowledge, nil
@@ -147,6 +175,27 @@ func ProcessDocumentsFromPDF(
 	logger *slog.Logger,
 	config *config.KnowledgeConfig,
 	embedder Embedder,
+) ([]*Document, map[string]any, error) {
+	documents, metadata, err := extractDocumentsFromPDF(ctx, g, input, logger, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := embedPDFDocuments(ctx, config, embedder, documents, logger); err != nil {
+		return nil, nil, err
+	}
+
+	return documents, metadata, nil
+}
+
+// extractDocumentsFromPDF extracts the pages of a single PDF into documents
+// without embedding them, chunking them when they are embedded as text
+func extractDocumentsFromPDF(
+	ctx context.Context,
+	g *genkit.Genkit,
+	input io.Reader,
+	logger *slog.Logger,
+	config *config.KnowledgeConfig,
 ) ([]*Document, map[string]any, error) {
 	// Read PDF data
 	pdfData, err := io.ReadAll(input)
@@ -263,6 +312,10 @@ func ProcessDocumentsFromPDF(
 				"extraction_method": config.PDFExtractionMethod,
 			},
 		}
+		// Pages embedded as images are found through the vision space
+		if config.PDFEmbeddingMethod == "vision" {
+			document.Metadata[MetadataKeyEmbeddingSpace] = EmbeddingSpaceVision
+		}
 
 		documents = append(documents, document)
 	}
@@ -273,29 +326,37 @@ func ProcessDocumentsFromPDF(
 		return nil, nil, errors.Errorf("no pages found in PDF")
 	}
 
-	now = time.Now()
+	// Pages embedded as images stay whole, pages embedded as text are chunked
+	if config.PDFEmbeddingMethod == "text" {
+		chunker, err := NewChunker(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = ChunkDocuments(documents, chunker)
+	}
+
+	return documents, metadata, nil
+}
+
+// embedPDFDocuments generates the embeddings of PDF documents from their page
+// images or their text, depending on config.PDFEmbeddingMethod
+func embedPDFDocuments(
+	ctx context.Context,
+	config *config.KnowledgeConfig,
+	embedder Embedder,
+	documents []*Document,
+	logger *slog.Logger,
+) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	now := time.Now()
 
 	switch config.PDFEmbeddingMethod {
 	case "vision":
-		{
-			images := make([][]byte, 0, len(documents))
-			for _, doc := range documents {
-				img, err := base64.StdEncoding.DecodeString(doc.Content.Image)
-				if err != nil {
-					return nil, nil, errors.Wrapf(err, "failed to decode image")
-				}
-				images = append(images, img)
-			}
-			embeddings, err := embedder.EmbedImageFiles(ctx, "image/jpeg", images...)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to generate image embeddings - check your API configuration")
-			}
-			if len(embeddings) != len(documents) {
-				return nil, nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
-			}
-			for i := range documents {
-				documents[i].Embeddings = embeddings[i]
-			}
+		if err := embedImageDocuments(ctx, embedder, documents, logger); err != nil {
+			return err
 		}
 	case "text":
 		{
@@ -304,11 +365,11 @@ func ProcessDocumentsFromPDF(
 				return d.EmbeddingText
 			})...)
 			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to generate text embeddings - check your API configuration and keys")
+				return errors.Wrapf(err, "failed to generate text embeddings - check your API configuration and keys")
 			}
 
 			if len(embeddings) != len(documents) {
-				return nil, nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
+				return errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
 			}
 
 			// Assign embeddings to documents
@@ -323,7 +384,7 @@ func ProcessDocumentsFromPDF(
 	}
 	logger.Info("Generated embeddings", "time", time.Since(now))
 
-	return documents, metadata, nil
+	return nil
 }
 
 // ExtractTextWithVisionLLM uses Vision LLM to extract text from an image
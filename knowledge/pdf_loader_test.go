@@ -60,7 +60,7 @@ func TestProcessDocumentsFromPDF(t *testing.T) {
 	reader := bytes.NewReader(pdfData)
 
 	// Create embedder
-	embedder := knowledge.NewEmbedder(nomicApiKey)
+	embedder := knowledge.NewNomicEmbedder(nomicApiKey)
 
 	// Process PDF documents
 	documents, metadata, err := knowledge.ProcessDocumentsFromPDF(ctx, g, reader, logger, config.NewKnowledgeConfig(), embedder)
@@ -152,7 +152,7 @@ func TestProcessDocumentsFromPDF_InvalidInput(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reader := bytes.NewReader(tt.input)
-			embedder := knowledge.NewEmbedder("")
+			embedder := knowledge.NewNomicEmbedder("")
 			_, _, err := knowledge.ProcessDocumentsFromPDF(ctx, g, reader, logger, config.NewKnowledgeConfig(), embedder)
 			require.Error(t, err)
 			assert.Contains(t, err.Error(), tt.expectedErr)
@@ -248,7 +248,7 @@ func BenchmarkProcessDocumentsFromPDF(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		reader := bytes.NewReader(pdfData)
-		embedder := knowledge.NewEmbedder("test-key")
+		embedder := knowledge.NewNomicEmbedder("test-key")
 		_, _, err := knowledge.ProcessDocumentsFromPDF(ctx, g, reader, logger, config.NewKnowledgeConfig(), embedder)
 		if err != nil {
 			b.Fatal(err)
@@ -285,7 +285,7 @@ func TestProcessDocumentsFromPDF_RealFile(t *testing.T) {
 
 	// Process only first few pages to avoid token limits
 	// We'll create a limited reader that processes only a subset
-	embedder := knowledge.NewEmbedder(nomicApiKey)
+	embedder := knowledge.NewNomicEmbedder(nomicApiKey)
 	documents, metadata, err := knowledge.ProcessDocumentsFromPDF(ctx, g, pdfFile, logger, config.NewKnowledgeConfig(), embedder)
 
 	// Allow partial success - the function might fail on some pages
@@ -400,7 +400,7 @@ func TestProcessDocumentsFromPDF_Simple(t *testing.T) {
 	require.NoError(t, err)
 
 	reader := bytes.NewReader(pdfData)
-	embedder := knowledge.NewEmbedder(nomicApiKey)
+	embedder := knowledge.NewNomicEmbedder(nomicApiKey)
 	documents, metadata, err := knowledge.ProcessDocumentsFromPDF(ctx, g, reader, logger, config.NewKnowledgeConfig(), embedder)
 
 	// If no API key, we expect an error
@@ -462,7 +462,7 @@ func TestProcessDocumentsFromPDF_Vision(t *testing.T) {
 	reader := bytes.NewReader(solanaWhitepaperPDF)
 
 	// Create embedder for vision
-	embedder := knowledge.NewEmbedder(nomicApiKey)
+	embedder := knowledge.NewNomicEmbedder(nomicApiKey)
 
 	// Create config for vision embedding
 	knowledgeConfig := config.NewKnowledgeConfig()
@@ -0,0 +1,572 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/mokiat/gog"
+	"github.com/pkg/errors"
+	"gorm.io/datatypes"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	// PgvectorIndexHNSW indexes embeddings with a hierarchical navigable small world graph
+	PgvectorIndexHNSW = "hnsw"
+	// PgvectorIndexIVFFlat indexes embeddings with inverted lists
+	PgvectorIndexIVFFlat = "ivfflat"
+	// PgvectorIndexNone searches embeddings exactly
+	PgvectorIndexNone = "none"
+
+	// pgvectorDocumentColumns are the columns of PgvectorDocumentRecord, which
+	// leave out the embedding
+	pgvectorDocumentColumns = "id, created_at, updated_at, content, embedding_text, metadata, content_hash, knowledge_record_id"
+)
+
+type (
+	// PgvectorStore implements Store using Postgres with the pgvector extension.
+	// Embeddings are compared by cosine distance.
+	PgvectorStore struct {
+		db      *gorm.DB
+		vecDim  int
+		options PgvectorOptions
+	}
+
+	// PgvectorOptions controls the vector index of a PgvectorStore
+	PgvectorOptions struct {
+		// IndexType is PgvectorIndexHNSW, PgvectorIndexIVFFlat or PgvectorIndexNone. Default: PgvectorIndexHNSW
+		IndexType string `json:"indexType,omitempty"`
+		// HNSWM and HNSWEfConstruction build the HNSW index. Default: the pgvector defaults
+		HNSWM              int `json:"hnswM,omitempty"`
+		HNSWEfConstruction int `json:"hnswEfConstruction,omitempty"`
+		// HNSWEfSearch is the candidate list size of HNSW searches. Default: the pgvector default
+		HNSWEfSearch int `json:"hnswEfSearch,omitempty"`
+		// IVFFlatLists builds the IVFFlat index. Default: 100
+		IVFFlatLists int `json:"ivfflatLists,omitempty"`
+		// IVFFlatProbes is the number of lists IVFFlat searches visit. Default: the pgvector default
+		IVFFlatProbes int `json:"ivfflatProbes,omitempty"`
+	}
+
+	// PgvectorKnowledgeRecord represents the database structure for knowledge items
+	PgvectorKnowledgeRecord struct {
+		ID        string `gorm:"primaryKey"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+
+		Metadata datatypes.JSONType[map[string]any]
+
+		Documents []*PgvectorDocumentRecord `gorm:"foreignKey:KnowledgeRecordID;constraint:OnDelete:CASCADE"`
+	}
+
+	// PgvectorDocumentRecord represents the database structure for documents. The
+	// embedding column is managed by the store, as its type depends on the dimension.
+	PgvectorDocumentRecord struct {
+		ID        string `gorm:"primaryKey"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+
+		Content       datatypes.JSONType[Content]
+		EmbeddingText string
+		Metadata      datatypes.JSONType[map[string]any]
+		ContentHash   string
+
+		KnowledgeRecordID string `gorm:"index"`
+	}
+)
+
+var (
+	_ Store = (*PgvectorStore)(nil)
+)
+
+// TableName specifies the table name for GORM
+func (PgvectorKnowledgeRecord) TableName() string {
+	return "knowledges"
+}
+
+// TableName specifies the table name for GORM
+func (PgvectorDocumentRecord) TableName() string {
+	return "knowledge_documents"
+}
+
+// PgvectorOptionsFromConfig returns the pgvector index options of conf
+func PgvectorOptionsFromConfig(conf *config.KnowledgeConfig) PgvectorOptions {
+	return PgvectorOptions{
+		IndexType:          conf.PgvectorIndexType,
+		HNSWM:              conf.PgvectorHNSWM,
+		HNSWEfConstruction: conf.PgvectorHNSWEfConstruction,
+		HNSWEfSearch:       conf.PgvectorHNSWEfSearch,
+		IVFFlatLists:       conf.PgvectorIVFFlatLists,
+		IVFFlatProbes:      conf.PgvectorIVFFlatProbes,
+	}
+}
+
+// Validate reports whether the index type and parameters are supported
+func (o PgvectorOptions) Validate() error {
+	switch o.IndexType {
+	case "", PgvectorIndexHNSW, PgvectorIndexIVFFlat, PgvectorIndexNone:
+	default:
+		return errors.Errorf("unsupported pgvector index type: %s", o.IndexType)
+	}
+	if o.HNSWM < 0 || o.HNSWEfConstruction < 0 || o.HNSWEfSearch < 0 || o.IVFFlatLists < 0 || o.IVFFlatProbes < 0 {
+		return errors.New("pgvector index parameters must not be negative")
+	}
+	return nil
+}
+
+// NewPgvectorStore creates a Postgres-based knowledge store and migrates its
+// schema. dimension must be the GetEmbedSize of the embedder used with the
+// store, and the database must provide the vector extension.
+func NewPgvectorStore(dsn string, dimension int, options PgvectorOptions) (*PgvectorStore, error) {
+	if dsn == "" {
+		return nil, errors.New("pgvector DSN is required")
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open postgres database")
+	}
+
+	store, err := NewPgvectorStoreWithDB(db, dimension, options)
+	if err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// NewPgvectorStoreWithDB creates a knowledge store on an open Postgres
+// connection and migrates its schema
+func NewPgvectorStoreWithDB(db *gorm.DB, dimension int, options PgvectorOptions) (*PgvectorStore, error) {
+	if dimension <= 0 {
+		return nil, errors.Errorf("invalid embedding dimension: %d", dimension)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	store := &PgvectorStore{
+		db:      db,
+		vecDim:  dimension,
+		options: options,
+	}
+
+	if err := store.migrate(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// migrate creates the tables, the embedding column and the indexes
+func (s *PgvectorStore) migrate() error {
+	if err := s.db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		return errors.Wrapf(err, "failed to create vector extension")
+	}
+
+	if err := s.db.AutoMigrate(&PgvectorKnowledgeRecord{}, &PgvectorDocumentRecord{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate knowledge tables")
+	}
+
+	// A vector column records its dimension as the type modifier
+	var dimension int
+	if err := s.db.Raw(`
+		SELECT COALESCE(MAX(atttypmod), 0)
+		FROM pg_attribute
+		WHERE attrelid = 'knowledge_documents'::regclass AND attname = 'embedding' AND NOT attisdropped
+	`).Row().Scan(&dimension); err != nil {
+		return errors.Wrapf(err, "failed to check embedding column")
+	}
+	if dimension > 0 && dimension != s.vecDim {
+		return errors.Errorf("knowledge_documents embeddings have dimension %d, not %d", dimension, s.vecDim)
+	}
+	if dimension == 0 {
+		if err := s.db.Exec(fmt.Sprintf("ALTER TABLE knowledge_documents ADD COLUMN embedding vector(%d)", s.vecDim)).Error; err != nil {
+			return errors.Wrapf(err, "failed to add embedding column")
+		}
+	}
+
+	if err := s.createVectorIndex(); err != nil {
+		return err
+	}
+
+	// Keyword search matches the simple text search configuration, which lowercases
+	// words without stemming like keywordTerms
+	if err := s.db.Exec(`
+		CREATE INDEX IF NOT EXISTS knowledge_documents_fts_idx
+		ON knowledge_documents USING gin (to_tsvector('simple', embedding_text))
+	`).Error; err != nil {
+		return errors.Wrapf(err, "failed to create keyword index")
+	}
+
+	return nil
+}
+
+// createVectorIndex creates the configured index of the embeddings
+func (s *PgvectorStore) createVectorIndex() error {
+	var createIndexSQL string
+	switch s.options.IndexType {
+	case "", PgvectorIndexHNSW:
+		var params []string
+		if s.options.HNSWM > 0 {
+			params = append(params, "m = "+strconv.Itoa(s.options.HNSWM))
+		}
+		if s.options.HNSWEfConstruction > 0 {
+			params = append(params, "ef_construction = "+strconv.Itoa(s.options.HNSWEfConstruction))
+		}
+		createIndexSQL = "CREATE INDEX IF NOT EXISTS knowledge_documents_embedding_hnsw_idx ON knowledge_documents USING hnsw (embedding vector_cosine_ops)"
+		if len(params) > 0 {
+			createIndexSQL += " WITH (" + strings.Join(params, ", ") + ")"
+		}
+	case PgvectorIndexIVFFlat:
+		lists := s.options.IVFFlatLists
+		if lists == 0 {
+			lists = 100
+		}
+		createIndexSQL = fmt.Sprintf("CREATE INDEX IF NOT EXISTS knowledge_documents_embedding_ivfflat_idx ON knowledge_documents USING ivfflat (embedding vector_cosine_ops) WITH (lists = %d)", lists)
+	default:
+		return nil
+	}
+
+	if err := s.db.Exec(createIndexSQL).Error; err != nil {
+		return errors.Wrapf(err, "failed to create %s index", s.options.IndexType)
+	}
+	return nil
+}
+
+// Store implements Store.Store
+func (s *PgvectorStore) Store(ctx context.Context, knowledge *Knowledge) error {
+	if len(knowledge.Documents) == 0 {
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.save(tx, knowledge)
+	})
+}
+
+// Upsert implements Store.Upsert
+func (s *PgvectorStore) Upsert(ctx context.Context, knowledge *Knowledge) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.save(tx, knowledge); err != nil {
+			return err
+		}
+
+		// Remove the documents left out of the knowledge
+		query := tx.Where("knowledge_record_id = ?", knowledge.ID)
+		if len(knowledge.Documents) > 0 {
+			query = query.Where("id NOT IN ?", gog.Map(knowledge.Documents, func(doc *Document) string { return doc.ID }))
+		}
+		if err := query.Delete(&PgvectorDocumentRecord{}).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete stale document records")
+		}
+
+		return nil
+	})
+}
+
+// GetDocumentHashes implements Store.GetDocumentHashes
+func (s *PgvectorStore) GetDocumentHashes(ctx context.Context, knowledgeId string) (map[string]string, error) {
+	var records []PgvectorDocumentRecord
+	if err := s.db.WithContext(ctx).
+		Select("id", "content_hash").
+		Where("knowledge_record_id = ?", knowledgeId).
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document hashes")
+	}
+
+	hashes := make(map[string]string, len(records))
+	for _, record := range records {
+		hashes[record.ID] = record.ContentHash
+	}
+
+	return hashes, nil
+}
+
+// GetDocumentEmbeddings implements Store.GetDocumentEmbeddings
+func (s *PgvectorStore) GetDocumentEmbeddings(ctx context.Context, knowledgeId string) (map[string][]float32, error) {
+	rows, err := s.db.WithContext(ctx).Raw("SELECT id, embedding::text FROM knowledge_documents WHERE knowledge_record_id = ? AND embedding IS NOT NULL", knowledgeId).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document embeddings")
+	}
+	defer rows.Close()
+
+	embeddings := make(map[string][]float32)
+	for rows.Next() {
+		var (
+			documentId string
+			embedding  string
+		)
+		if err := rows.Scan(&documentId, &embedding); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan document embedding")
+		}
+		var values []float32
+		if err := json.Unmarshal([]byte(embedding), &values); err != nil {
+			return nil, errors.Wrapf(err, "invalid embedding of document %s", documentId)
+		}
+		embeddings[documentId] = values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document embeddings")
+	}
+
+	return embeddings, nil
+}
+
+// ListKnowledgeIds implements Store.ListKnowledgeIds
+func (s *PgvectorStore) ListKnowledgeIds(ctx context.Context) ([]string, error) {
+	var ids []string
+	if err := s.db.WithContext(ctx).Model(&PgvectorKnowledgeRecord{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list knowledge")
+	}
+	return ids, nil
+}
+
+// save saves the knowledge record and its documents within tx. Documents without
+// embeddings keep their stored embeddings.
+func (s *PgvectorStore) save(tx *gorm.DB, knowledge *Knowledge) error {
+	if knowledge.ID == "" {
+		knowledge.ID = uuid.NewString()
+	}
+
+	record := PgvectorKnowledgeRecord{
+		ID:       knowledge.ID,
+		Metadata: datatypes.NewJSONType(knowledge.Metadata),
+	}
+	if err := tx.Save(&record).Error; err != nil {
+		return errors.Wrapf(err, "failed to save knowledge record")
+	}
+
+	for _, item := range knowledge.Documents {
+		if item.ID == "" {
+			item.ID = uuid.NewString()
+		}
+
+		docRecord := PgvectorDocumentRecord{
+			ID:                item.ID,
+			Content:           datatypes.NewJSONType(item.Content),
+			EmbeddingText:     item.EmbeddingText,
+			Metadata:          datatypes.NewJSONType(item.Metadata),
+			ContentHash:       item.ContentHash,
+			KnowledgeRecordID: knowledge.ID,
+		}
+		if err := tx.Save(&docRecord).Error; err != nil {
+			return errors.Wrapf(err, "failed to save document record")
+		}
+
+		if len(item.Embeddings) == 0 {
+			continue
+		}
+		if len(item.Embeddings) != s.vecDim {
+			return errors.Errorf("document %s has an embedding of dimension %d, not %d", item.ID, len(item.Embeddings), s.vecDim)
+		}
+		if err := tx.Exec(
+			"UPDATE knowledge_documents SET embedding = ?::vector WHERE id = ?",
+			vectorLiteral(item.Embeddings), item.ID,
+		).Error; err != nil {
+			return errors.Wrapf(err, "failed to save document embedding")
+		}
+	}
+
+	return nil
+}
+
+// Search implements Store.Search. With an approximate index, filters apply to the
+// candidates of the index, so raise HNSWEfSearch or IVFFlatProbes when selective
+// filters return too few results.
+func (s *PgvectorStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	if len(queryEmbedding) == 0 || limit <= 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+	if len(queryEmbedding) != s.vecDim {
+		return nil, errors.Errorf("query embedding has dimension %d, not %d", len(queryEmbedding), s.vecDim)
+	}
+
+	type searchRow struct {
+		PgvectorDocumentRecord
+		Distance float64
+	}
+
+	var rows []searchRow
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SET LOCAL scopes the search parameters to the transaction
+		switch {
+		case (s.options.IndexType == "" || s.options.IndexType == PgvectorIndexHNSW) && s.options.HNSWEfSearch > 0:
+			if err := tx.Exec(fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", s.options.HNSWEfSearch)).Error; err != nil {
+				return errors.Wrapf(err, "failed to set hnsw.ef_search")
+			}
+		case s.options.IndexType == PgvectorIndexIVFFlat && s.options.IVFFlatProbes > 0:
+			if err := tx.Exec(fmt.Sprintf("SET LOCAL ivfflat.probes = %d", s.options.IVFFlatProbes)).Error; err != nil {
+				return errors.Wrapf(err, "failed to set ivfflat.probes")
+			}
+		}
+
+		query := vectorLiteral(queryEmbedding)
+		tx = tx.Model(&PgvectorDocumentRecord{}).
+			Select(pgvectorDocumentColumns+", embedding <=> ?::vector AS distance", query).
+			Where("embedding IS NOT NULL")
+		if len(allowedKnowledgeIds) > 0 {
+			tx = tx.Where("knowledge_record_id IN ?", allowedKnowledgeIds)
+		}
+		if condition, args := filter.postgresCondition("metadata"); condition != "" {
+			tx = tx.Where(condition, args...)
+		}
+
+		// Ordering by the distance alone lets Postgres use the vector index
+		if err := tx.Order("distance").Limit(limit).Scan(&rows).Error; err != nil {
+			return errors.Wrapf(err, "failed to execute search query")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	results := make([]KnowledgeSearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = KnowledgeSearchResult{
+			Document: row.PgvectorDocumentRecord.toDocument(),
+			Score:    float32(1 - row.Distance), // Convert distance to similarity score
+		}
+	}
+
+	return results, nil
+}
+
+// KeywordSearch implements Store.KeywordSearch. Documents matching any term of
+// the query are ranked by the cover density of ts_rank_cd rather than by BM25,
+// which Postgres does not provide.
+func (s *PgvectorStore) KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	terms := keywordTerms(query)
+	if len(terms) == 0 || limit <= 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
+	// Terms hold only letters and digits, and quoting keeps them from being parsed
+	// as query syntax
+	tsQuery := strings.Join(gog.Map(terms, func(term string) string {
+		return "'" + term + "'"
+	}), " | ")
+
+	type keywordRow struct {
+		PgvectorDocumentRecord
+		Score float64
+	}
+
+	tx := s.db.WithContext(ctx).
+		Model(&PgvectorDocumentRecord{}).
+		Select(pgvectorDocumentColumns+", ts_rank_cd(to_tsvector('simple', embedding_text), to_tsquery('simple', ?)) AS score", tsQuery).
+		Where("to_tsvector('simple', embedding_text) @@ to_tsquery('simple', ?)", tsQuery)
+	if len(allowedKnowledgeIds) > 0 {
+		tx = tx.Where("knowledge_record_id IN ?", allowedKnowledgeIds)
+	}
+	if condition, args := filter.postgresCondition("metadata"); condition != "" {
+		tx = tx.Where(condition, args...)
+	}
+
+	var rows []keywordRow
+	if err := tx.Order("score DESC, id").Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to execute keyword search query")
+	}
+
+	results := make([]KnowledgeSearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = KnowledgeSearchResult{
+			Document: row.PgvectorDocumentRecord.toDocument(),
+			Score:    float32(row.Score),
+		}
+	}
+
+	return results, nil
+}
+
+// GetKnowledgeById implements Store.GetKnowledgeById
+func (s *PgvectorStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error) {
+	var record PgvectorKnowledgeRecord
+	if err := s.db.WithContext(ctx).
+		Preload("Documents").
+		First(&record, "id = ?", knowledgeId).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch knowledge records")
+	}
+
+	knowledge := &Knowledge{
+		ID:        record.ID,
+		Metadata:  record.Metadata.Data(),
+		Documents: make([]*Document, 0, len(record.Documents)),
+	}
+	for _, document := range record.Documents {
+		knowledge.Documents = append(knowledge.Documents, document.toDocument())
+	}
+
+	return knowledge, nil
+}
+
+// DeleteKnowledgeById implements Store.DeleteKnowledgeById
+func (s *PgvectorStore) DeleteKnowledgeById(ctx context.Context, knowledgeId string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PgvectorDocumentRecord{}, "knowledge_record_id = ?", knowledgeId).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete document records")
+		}
+		if err := tx.Delete(&PgvectorKnowledgeRecord{}, "id = ?", knowledgeId).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete knowledge record")
+		}
+		return nil
+	})
+}
+
+// Dimension returns the embedding dimension of the embedding column
+func (s *PgvectorStore) Dimension() int {
+	return s.vecDim
+}
+
+// Close implements Store.Close
+func (s *PgvectorStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// toDocument converts a document record into a document without embeddings
+func (record *PgvectorDocumentRecord) toDocument() *Document {
+	metadata := record.Metadata.Data()
+	if metadata == nil {
+		metadata = map[string]any{
+			"knowledge_id": record.KnowledgeRecordID,
+		}
+	}
+
+	return &Document{
+		ID:            record.ID,
+		Content:       record.Content.Data(),
+		Metadata:      metadata,
+		EmbeddingText: record.EmbeddingText,
+		ContentHash:   record.ContentHash,
+	}
+}
+
+// vectorLiteral formats an embedding in the text representation of pgvector
+func vectorLiteral(embedding []float32) string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, v := range embedding {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
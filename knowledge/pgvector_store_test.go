@@ -0,0 +1,203 @@
+package knowledge_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var (
+	pgvectorContainerOnce sync.Once
+	pgvectorContainerDSN  string
+	pgvectorContainerErr  error
+)
+
+// testPgvectorDSN returns the DSN of PGVECTOR_DSN, or starts a pgvector
+// container shared by the tests of the package. The container is removed by
+// the testcontainers reaper when the tests end. Without PGVECTOR_DSN and
+// Docker, the test is skipped.
+func testPgvectorDSN(t *testing.T) string {
+	if dsn := os.Getenv("PGVECTOR_DSN"); dsn != "" {
+		return dsn
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	pgvectorContainerOnce.Do(func() {
+		container, err := tcpostgres.Run(context.Background(), "pgvector/pgvector:pg17",
+			tcpostgres.WithDatabase("knowledge"),
+			tcpostgres.WithUsername("postgres"),
+			tcpostgres.WithPassword("postgres"),
+			tcpostgres.BasicWaitStrategies(),
+		)
+		if err != nil {
+			pgvectorContainerErr = err
+			return
+		}
+		pgvectorContainerDSN, pgvectorContainerErr = container.ConnectionString(context.Background(), "sslmode=disable")
+	})
+	require.NoError(t, pgvectorContainerErr, "failed to start the pgvector container")
+
+	return pgvectorContainerDSN
+}
+
+// newTestPgvectorStore creates a store on the test database of testPgvectorDSN.
+// The knowledge tables are dropped first, so do not point PGVECTOR_DSN at a
+// database in use.
+func newTestPgvectorStore(t *testing.T, dimension int, options knowledge.PgvectorOptions) *knowledge.PgvectorStore {
+	dsn := testPgvectorDSN(t)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrator().DropTable("knowledge_documents", "knowledges"))
+
+	store, err := knowledge.NewPgvectorStoreWithDB(db, dimension, options)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestPgvectorStore_StoreAndSearch(t *testing.T) {
+	for _, indexType := range []string{knowledge.PgvectorIndexHNSW, knowledge.PgvectorIndexIVFFlat, knowledge.PgvectorIndexNone} {
+		t.Run(indexType, func(t *testing.T) {
+			ctx := t.Context()
+			store := newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{
+				IndexType:     indexType,
+				HNSWEfSearch:  100,
+				IVFFlatLists:  1,
+				IVFFlatProbes: 1,
+			})
+			assert.Equal(t, 16, store.Dimension())
+
+			for _, id := range []string{"a", "b"} {
+				var documents []*knowledge.Document
+				for i := 0; i < 5; i++ {
+					documents = append(documents, &knowledge.Document{
+						ID: id + "-" + string(rune('0'+i)),
+						Content: knowledge.Content{
+							MIMEType: "text/plain",
+							Text:     "Document " + id,
+						},
+						EmbeddingText: "Document " + id,
+						Embeddings:    generateTestEmbedding(16, i),
+						Metadata:      map[string]any{"index": i},
+					})
+				}
+				require.NoError(t, store.Store(ctx, &knowledge.Knowledge{ID: id, Documents: documents}))
+			}
+
+			results, err := store.Search(ctx, generateTestEmbedding(16, 3), 3, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 3)
+			assert.Contains(t, []string{"a-3", "b-3"}, results[0].ID)
+			assert.InDelta(t, 1.0, results[0].Score, 1e-5)
+			assert.GreaterOrEqual(t, results[0].Score, results[2].Score)
+
+			results, err = store.Search(ctx, generateTestEmbedding(16, 3), 10, []string{"b"}, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 5)
+			for _, result := range results {
+				assert.Equal(t, "Document b", result.EmbeddingText)
+			}
+
+			stored, err := store.GetKnowledgeById(ctx, "a")
+			require.NoError(t, err)
+			assert.Len(t, stored.Documents, 5)
+
+			require.NoError(t, store.DeleteKnowledgeById(ctx, "a"))
+			_, err = store.GetKnowledgeById(ctx, "a")
+			require.Error(t, err)
+
+			results, err = store.Search(ctx, generateTestEmbedding(16, 3), 10, []string{"a"}, nil)
+			require.NoError(t, err)
+			assert.Empty(t, results)
+		})
+	}
+}
+
+func TestPgvectorStore_StoreIsAtomic(t *testing.T) {
+	ctx := t.Context()
+	store := newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{})
+
+	// The second document has the wrong dimension, so neither is stored
+	err := store.Store(ctx, &knowledge.Knowledge{
+		ID: "atomic",
+		Documents: []*knowledge.Document{
+			{ID: "ok", EmbeddingText: "ok", Embeddings: generateTestEmbedding(16, 1)},
+			{ID: "bad", EmbeddingText: "bad", Embeddings: generateTestEmbedding(8, 1)},
+		},
+	})
+	require.Error(t, err)
+
+	_, err = store.GetKnowledgeById(ctx, "atomic")
+	require.Error(t, err)
+	hashes, err := store.GetDocumentHashes(ctx, "atomic")
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+}
+
+func TestPgvectorStore_Dimension(t *testing.T) {
+	store := newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{})
+	db, err := gorm.Open(postgres.Open(testPgvectorDSN(t)), &gorm.Config{})
+	require.NoError(t, err)
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	_, err = knowledge.NewPgvectorStoreWithDB(db, 32, knowledge.PgvectorOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dimension 16")
+
+	_, err = store.Search(t.Context(), generateTestEmbedding(32, 1), 1, nil, nil)
+	require.Error(t, err)
+}
+
+func TestPgvectorStore_Upsert(t *testing.T) {
+	testStoreUpsert(t, newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{}))
+}
+
+func TestPgvectorStore_KeywordSearch(t *testing.T) {
+	testStoreKeywordSearch(t, newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{}))
+}
+
+func TestPgvectorStore_SearchWithFilter(t *testing.T) {
+	testStoreSearchWithFilter(t, newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{IndexType: knowledge.PgvectorIndexNone}))
+}
+
+func TestPgvectorStore_Snapshot(t *testing.T) {
+	ctx := t.Context()
+	store := newTestPgvectorStore(t, 16, knowledge.PgvectorOptions{})
+
+	source := knowledge.NewInMemoryStore()
+	require.NoError(t, source.Store(ctx, &knowledge.Knowledge{
+		ID: "vectors",
+		Documents: []*knowledge.Document{
+			{ID: "v1", EmbeddingText: "first", Embeddings: generateTestEmbedding(16, 1)},
+			{ID: "v2", EmbeddingText: "second", Embeddings: generateTestEmbedding(16, 2)},
+		},
+	}))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, knowledge.ExportSnapshot(ctx, source, &snapshot, knowledge.SnapshotExportOptions{}))
+	_, err := knowledge.ImportSnapshot(ctx, store, &snapshot, knowledge.SnapshotImportOptions{})
+	require.NoError(t, err)
+
+	ids, err := store.ListKnowledgeIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vectors"}, ids)
+
+	embeddings, err := store.GetDocumentEmbeddings(ctx, "vectors")
+	require.NoError(t, err)
+	require.Len(t, embeddings, 2)
+	assert.InDeltaSlice(t, generateTestEmbedding(16, 1), embeddings["v1"], 1e-6)
+}
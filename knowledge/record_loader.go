@@ -0,0 +1,170 @@
+package knowledge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"maps"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// RecordOptions selects the fields of CSV, TSV, JSON and JSONL records that
+	// become the embedding text and the metadata of documents
+	RecordOptions struct {
+		// TextFields are the fields embedded in priority order. When empty, the text is
+		// extracted from the standard text fields by ExtractTextFromMap.
+		TextFields []string `json:"textFields,omitempty"`
+		// MetadataFields are the fields kept as metadata. When empty, every field is kept.
+		MetadataFields []string `json:"metadataFields,omitempty"`
+	}
+
+	// LoaderOptions controls how knowledge files are loaded
+	LoaderOptions struct {
+		// Type is the source type of the files, such as SourceTypeCSV. When empty, it is
+		// detected for each file by DetectSourceType.
+		Type string `json:"type,omitempty"`
+
+		RecordOptions `json:",inline"`
+	}
+)
+
+const (
+	// MetadataKeyRecordNumber is the 1-based position of a record in its source file
+	MetadataKeyRecordNumber = "record_number"
+)
+
+// ParseRecordsFromCSV reads the rows of a CSV or TSV file as records keyed by
+// the columns of its header row. Empty cells are omitted.
+func ParseRecordsFromCSV(input io.Reader, delimiter rune) ([]map[string]any, error) {
+	reader := csv.NewReader(input)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read header row")
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	}
+
+	var records []map[string]any
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read row %d", len(records)+2)
+		}
+
+		record := make(map[string]any, len(header))
+		for i, value := range row {
+			if i >= len(header) || header[i] == "" {
+				continue
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				record[header[i]] = value
+			}
+		}
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// ParseRecordsFromJSON reads a JSON array of objects, or a single object, as records
+func ParseRecordsFromJSON(data []byte) ([]map[string]any, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if data[0] == '{' {
+		var record map[string]any
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse JSON object")
+		}
+		return []map[string]any{record}, nil
+	}
+
+	var records []map[string]any
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse JSON array of objects")
+	}
+	return records, nil
+}
+
+// ParseRecordsFromJSONL reads one JSON object per line as records, skipping blank lines
+func ParseRecordsFromJSONL(input io.Reader) ([]map[string]any, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var records []map[string]any
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var record map[string]any
+		if err := json.Unmarshal(text, &record); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse JSON object at line %d", line)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read JSONL")
+	}
+
+	return records, nil
+}
+
+// ParseRecords reads the records of a CSV, TSV, JSON or JSONL source
+func ParseRecords(data []byte, sourceType string) ([]map[string]any, error) {
+	switch sourceType {
+	case SourceTypeCSV:
+		return ParseRecordsFromCSV(bytes.NewReader(data), ',')
+	case SourceTypeTSV:
+		return ParseRecordsFromCSV(bytes.NewReader(data), '\t')
+	case SourceTypeJSON:
+		return ParseRecordsFromJSON(data)
+	case SourceTypeJSONL:
+		return ParseRecordsFromJSONL(bytes.NewReader(data))
+	default:
+		return nil, errors.Errorf("unsupported record source type: %s", sourceType)
+	}
+}
+
+// ProcessDocumentsFromRecordSource converts the records of a CSV, TSV, JSON or
+// JSONL source into unchunked documents annotated with their record number
+func ProcessDocumentsFromRecordSource(data []byte, sourceType string, opts RecordOptions) ([]*Document, error) {
+	records, err := ParseRecords(data, sourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []*Document
+	for i, record := range records {
+		for _, doc := range ProcessDocumentsFromRecords([]map[string]any{record}, opts) {
+			metadata := maps.Clone(doc.Metadata)
+			metadata[MetadataKeySourceType] = sourceType
+			metadata[MetadataKeyRecordNumber] = i + 1
+			doc.Metadata = metadata
+			documents = append(documents, doc)
+		}
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,109 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalogCSV = `sku,name,description,price,category
+A-1,Trail Shoe,"Lightweight shoe for muddy trails, with a grippy sole",120,shoes
+A-2,Rain Jacket,Waterproof jacket that packs into its pocket,90,
+`
+
+func TestParseRecordsFromCSV(t *testing.T) {
+	records, err := knowledge.ParseRecordsFromCSV(strings.NewReader(testCatalogCSV), ',')
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "Lightweight shoe for muddy trails, with a grippy sole", records[0]["description"])
+	assert.Equal(t, "120", records[0]["price"])
+	assert.NotContains(t, records[1], "category")
+
+	records, err = knowledge.ParseRecordsFromCSV(strings.NewReader("question\tanswer\nHow to reset?\tUse the settings page.\n"), '\t')
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"question": "How to reset?", "answer": "Use the settings page."}}, records)
+}
+
+func TestParseRecordsFromJSON(t *testing.T) {
+	records, err := knowledge.ParseRecordsFromJSON([]byte(`[{"name": "Seoul", "population": 9.7}, {"name": "Tokyo"}]`))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, 9.7, records[0]["population"])
+
+	records, err = knowledge.ParseRecordsFromJSON([]byte(`{"name": "Seoul"}`))
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = knowledge.ParseRecordsFromJSON([]byte(`["Seoul"]`))
+	assert.Error(t, err)
+
+	records, err = knowledge.ParseRecordsFromJSONL(strings.NewReader("{\"name\": \"Seoul\"}\n\n{\"name\": \"Tokyo\"}\n"))
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	_, err = knowledge.ParseRecordsFromJSONL(strings.NewReader("{\"name\": \"Seoul\"}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestProcessDocumentsFromRecordSource(t *testing.T) {
+	documents, err := knowledge.ProcessDocumentsFromRecordSource([]byte(testCatalogCSV), knowledge.SourceTypeCSV, knowledge.RecordOptions{
+		TextFields:     []string{"name", "description", "price"},
+		MetadataFields: []string{"sku", "category"},
+	})
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+
+	assert.Equal(t, "Trail Shoe Lightweight shoe for muddy trails, with a grippy sole 120", documents[0].EmbeddingText)
+	assert.Equal(t, map[string]any{
+		"sku":                             "A-1",
+		"category":                        "shoes",
+		knowledge.MetadataKeySourceType:   knowledge.SourceTypeCSV,
+		knowledge.MetadataKeyRecordNumber: 1,
+	}, documents[0].Metadata)
+	assert.Equal(t, 2, documents[1].Metadata[knowledge.MetadataKeyRecordNumber])
+
+	// Without options, the standard text fields are embedded and every field is kept
+	documents, err = knowledge.ProcessDocumentsFromRecordSource([]byte(testCatalogCSV), knowledge.SourceTypeCSV, knowledge.RecordOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Waterproof jacket that packs into its pocket Rain Jacket", documents[1].EmbeddingText)
+	assert.Equal(t, "90", documents[1].Metadata["price"])
+}
+
+func TestService_IndexKnowledgeFromRecordFiles(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "catalog.csv"), []byte(testCatalogCSV), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "faq.jsonl"), []byte(`{"question": "Do you ship abroad?", "answer": "Yes, to 40 countries.", "id": 7}`), 0o644))
+
+	result, err := service.IndexKnowledgeFromFiles(ctx, "catalog", []string{filepath.Join(dir, "catalog.csv")}, knowledge.LoaderOptions{
+		RecordOptions: knowledge.RecordOptions{TextFields: []string{"name", "description"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 2)
+	assert.Equal(t, knowledge.SourceTypeCSV, result.Metadata[knowledge.MetadataKeySourceType])
+	assert.Equal(t, "catalog.csv", result.Documents[0].Metadata[knowledge.MetadataKeySourceFilename])
+
+	result, err = service.IndexKnowledgeFromFiles(ctx, "faq", []string{filepath.Join(dir, "faq.jsonl")}, knowledge.LoaderOptions{
+		Type: knowledge.SourceTypeJSONL,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	assert.Equal(t, "answer: Yes, to 40 countries. question: Do you ship abroad?", result.Documents[0].EmbeddingText)
+}
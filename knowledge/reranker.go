@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
@@ -16,22 +17,43 @@ type Reranker interface {
 	Rerank(ctx context.Context, query string, candidates []*KnowledgeSearchResult, topK int) ([]*KnowledgeSearchResult, error)
 }
 
+// DefaultRerankConcurrency is the default number of candidates GenkitReranker scores at once
+const DefaultRerankConcurrency = 4
+
 // GenkitReranker implements Reranker using genkit LLM for relevance scoring
 type GenkitReranker struct {
-	genkit *genkit.Genkit
-	model  string
+	genkit      *genkit.Genkit
+	model       string
+	concurrency int
+}
+
+// GenkitRerankerOption customizes NewGenkitReranker
+type GenkitRerankerOption func(*GenkitReranker)
+
+// WithRerankConcurrency sets how many candidates are scored at once. Values below
+// 1 score one candidate at a time.
+func WithRerankConcurrency(concurrency int) GenkitRerankerOption {
+	return func(r *GenkitReranker) {
+		r.concurrency = max(concurrency, 1)
+	}
 }
 
-// NewGenkitReranker creates a new reranker using genkit
-func NewGenkitReranker(genkit *genkit.Genkit, model string) Reranker {
+// NewGenkitReranker creates a new reranker using genkit that scores each
+// candidate with its own LLM call, DefaultRerankConcurrency calls at a time
+func NewGenkitReranker(genkit *genkit.Genkit, model string, opts ...GenkitRerankerOption) Reranker {
 	// Add openai prefix if not present
 	if model != "" && !strings.Contains(model, "/") {
 		model = "openai/" + model
 	}
-	return &GenkitReranker{
-		genkit: genkit,
-		model:  model,
+	r := &GenkitReranker{
+		genkit:      genkit,
+		model:       model,
+		concurrency: DefaultRerankConcurrency,
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
 }
 
 // Rerank reranks the candidates based on relevance to the query
@@ -45,16 +67,34 @@ func (r *GenkitReranker) Rerank(ctx context.Context, query string, candidates []
 		topK = len(candidates)
 	}
 
-	results := make([]*KnowledgeSearchResult, 0, len(candidates))
+	// Score the candidates concurrently, with at most r.concurrency calls in flight
+	scores := make([]float64, len(candidates))
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			score, err := r.scoreRelevance(ctx, query, candidate)
+			if err != nil {
+				// If scoring fails for one candidate, use a default low score
+				score = 0.0
+			}
+			scores[i] = score
+		}()
+	}
+	wg.Wait()
 
-	// Score each candidate
-	for _, candidate := range candidates {
-		score, err := r.scoreRelevance(ctx, query, candidate)
-		if err != nil {
-			// If scoring fails for one candidate, use a default low score
-			score = 0.0
-		}
-		candidate.Score = float32(score)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]*KnowledgeSearchResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		candidate.Score = float32(scores[i])
 		results = append(results, candidate)
 	}
 
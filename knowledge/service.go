@@ -9,6 +9,7 @@ import (
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/habiliai/agentruntime/config"
 	xgenkit "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/pkg/errors"
 )
 
 type (
@@ -16,10 +17,27 @@ type (
 		// Knowledge management methods
 		IndexKnowledgeFromMap(ctx context.Context, id string, input []map[string]any) (*Knowledge, error)
 		IndexKnowledgeFromPDF(ctx context.Context, id string, inputs []io.Reader) (*Knowledge, error)
-		RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string) ([]*KnowledgeSearchResult, error)
+		// IndexKnowledgeFromText indexes markdown, HTML, JSON or plain text documents
+		IndexKnowledgeFromText(ctx context.Context, id string, inputs []string) (*Knowledge, error)
+		// IndexKnowledgeFromFiles indexes PDF, markdown, HTML, plain text, CSV, TSV, JSON, JSONL, DOCX or image files
+		IndexKnowledgeFromFiles(ctx context.Context, id string, paths []string, opts LoaderOptions) (*Knowledge, error)
+		RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, opts ...RetrieveOption) ([]*KnowledgeSearchResult, error)
 		DeleteKnowledge(ctx context.Context, knowledgeId string) error
 		Close() error
 		GetKnowledge(ctx context.Context, knowledgeId string) (*Knowledge, error)
+		// ExportSnapshot writes the knowledge with the given IDs, or all stored
+		// knowledge, with its embeddings to w
+		ExportSnapshot(ctx context.Context, w io.Writer, knowledgeIds ...string) error
+		// ImportSnapshot loads the knowledge of a snapshot, embedding only the
+		// documents that were embedded differently than this service embeds them
+		ImportSnapshot(ctx context.Context, r io.Reader, opts SnapshotImportOptions) (*SnapshotImportResult, error)
+	}
+
+	// RetrieveOption customizes RetrieveRelevantKnowledge
+	RetrieveOption func(*retrieveOptions)
+
+	retrieveOptions struct {
+		filter *Filter
 	}
 
 	service struct {
@@ -27,6 +45,7 @@ type (
 
 		store         Store
 		embedder      Embedder
+		chunker       Chunker
 		reranker      Reranker
 		queryRewriter QueryRewriter
 		config        *config.KnowledgeConfig
@@ -38,12 +57,20 @@ var (
 	_ Service = (*service)(nil)
 )
 
-// NewService creates a new knowledge service with default SQLite-based storage
+// WithFilter retrieves only the documents whose metadata matches filter
+func WithFilter(filter *Filter) RetrieveOption {
+	return func(o *retrieveOptions) {
+		o.filter = filter
+	}
+}
+
+// NewService creates a new knowledge service with the store selected by conf
 func NewService(ctx context.Context, modelConfig *config.ModelConfig, conf *config.KnowledgeConfig, logger *slog.Logger) (Service, error) {
-	return NewServiceWithStore(ctx, conf, modelConfig, logger, NewInMemoryStore())
+	return NewServiceWithStore(ctx, conf, modelConfig, logger, nil)
 }
 
-// NewServiceWithStore creates a new knowledge service with a custom knowledge store
+// NewServiceWithStore creates a new knowledge service with a custom knowledge
+// store. When store is nil, the store selected by conf is created with NewStore.
 func NewServiceWithStore(
 	ctx context.Context,
 	conf *config.KnowledgeConfig,
@@ -57,15 +84,61 @@ func NewServiceWithStore(
 	}
 
 	// Create embedder for RAG functionality
-	embedder := NewEmbedder(conf.NomicAPIKey)
+	embedder, err := NewEmbedder(genkit, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stores with a fixed vector size must match the embedder
+	if sized, ok := store.(interface{ Dimension() int }); ok && sized.Dimension() != embedder.GetEmbedSize() {
+		return nil, errors.Errorf("knowledge store dimension %d does not match the embedder dimension %d", sized.Dimension(), embedder.GetEmbedSize())
+	}
+
+	chunker, err := NewChunker(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	switch conf.SearchMode {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+	default:
+		return nil, errors.Errorf("unsupported search mode: %s", conf.SearchMode)
+	}
+	if err := HybridOptionsFromConfig(conf).Validate(); err != nil {
+		return nil, err
+	}
+	if conf.VisionSearchWeight < 0 || conf.VisionSearchWeight > 1 {
+		return nil, errors.Errorf("visionSearchWeight must be between 0 and 1, got %v", conf.VisionSearchWeight)
+	}
+
+	if store == nil {
+		if store, err = NewStore(conf, embedder.GetEmbedSize(), logger); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create reranker if enabled
 	var reranker Reranker
 	if conf.RerankEnabled {
-		if conf.UseBatchRerank {
-			reranker = NewBatchGenkitReranker(genkit, conf.RerankModel)
-		} else {
-			reranker = NewGenkitReranker(genkit, conf.RerankModel)
+		switch conf.RerankStrategy {
+		case "", RerankStrategyLLM:
+			if conf.UseBatchRerank {
+				reranker = NewBatchGenkitReranker(genkit, conf.RerankModel)
+			} else {
+				concurrency := conf.RerankConcurrency
+				if concurrency <= 0 {
+					concurrency = DefaultRerankConcurrency
+				}
+				reranker = NewGenkitReranker(genkit, conf.RerankModel, WithRerankConcurrency(concurrency))
+			}
+		case RerankStrategyRRF:
+			reranker = NewRRFReranker(conf.HybridRRFK)
+		case RerankStrategyMMR:
+			reranker = NewMMRReranker(conf.RerankMMRLambda)
+		case RerankStrategyKeyword:
+			reranker = NewKeywordOverlapReranker(conf.RerankKeywordWeight)
+		default:
+			return nil, errors.Errorf("unsupported rerank strategy: %s", conf.RerankStrategy)
 		}
 	} else {
 		reranker = NewNoOpReranker()
@@ -87,6 +160,7 @@ func NewServiceWithStore(
 		genkit:        genkit,
 		store:         store,
 		embedder:      embedder,
+		chunker:       chunker,
 		reranker:      reranker,
 		queryRewriter: queryRewriter,
 		config:        conf,
@@ -106,7 +180,15 @@ func (s *service) Close() error {
 }
 
 // RetrieveRelevantKnowledge retrieves relevant knowledge chunks based on query
-func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string) ([]*KnowledgeSearchResult, error) {
+func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, opts ...RetrieveOption) ([]*KnowledgeSearchResult, error) {
+	var options retrieveOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := options.filter.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid metadata filter")
+	}
+
 	// Apply query rewriting
 	queries, err := s.queryRewriter.Rewrite(ctx, query)
 	if err != nil {
@@ -124,25 +206,11 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 	// Search with all rewritten queries
 	allSearchResults := make([]KnowledgeSearchResult, 0)
 	uniqueResults := make(map[string]KnowledgeSearchResult) // Use map to track unique results by ID
+	rankings := make([][]*KnowledgeSearchResult, 0, len(queries))
 
 	for i, q := range queries {
-		// Generate embedding for this query
-		embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeQuery, q)
-		if err != nil {
-			s.logger.Warn("failed to generate embedding for rewritten query",
-				slog.String("query", q),
-				slog.String("error", err.Error()))
-			continue // Skip this query rather than using empty embedding
-		}
-
-		if len(embeddings) == 0 {
-			continue // Skip if no embeddings returned
-		}
-
-		queryEmbedding := embeddings[0]
-
 		// Search for relevant knowledge
-		searchResults, err := s.store.Search(ctx, queryEmbedding, retrievalLimit, allowedKnowledgeIds)
+		searchResults, err := s.search(ctx, q, retrievalLimit, allowedKnowledgeIds, options.filter)
 		if err != nil {
 			s.logger.Warn("search failed for rewritten query",
 				slog.String("query", q),
@@ -150,6 +218,13 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 			continue
 		}
 
+		ranking := make([]*KnowledgeSearchResult, len(searchResults))
+		for j := range searchResults {
+			result := searchResults[j]
+			ranking[j] = &result
+		}
+		rankings = append(rankings, ranking)
+
 		// Apply score weighting based on query type
 		scoreWeight := 1.0
 		if i > 0 { // Not the original query
@@ -182,9 +257,19 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 		candidates[i] = &result
 	}
 
-	// Apply reranking if enabled
-	if s.config.RerankEnabled && s.reranker != nil && len(candidates) > limit {
-		rerankResults, err := s.reranker.Rerank(ctx, query, candidates, limit)
+	// Apply reranking if enabled. Rankings rerankers also fuse the rankings of
+	// several queries when there are no more candidates than the limit.
+	rankingsReranker, fusesRankings := s.reranker.(RankingsReranker)
+	if s.config.RerankEnabled && s.reranker != nil && (len(candidates) > limit || fusesRankings && len(rankings) > 1) {
+		var (
+			rerankResults []*KnowledgeSearchResult
+			err           error
+		)
+		if fusesRankings {
+			rerankResults, err = rankingsReranker.RerankRankings(ctx, query, rankings, limit)
+		} else {
+			rerankResults, err = s.reranker.Rerank(ctx, query, candidates, limit)
+		}
 		if err != nil {
 			// If reranking fails, fall back to original results
 			s.logger.Warn("reranking failed, falling back to original results", slog.String("error", err.Error()))
@@ -204,6 +289,72 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 	return candidates, nil
 }
 
+// search retrieves documents matching filter for a query by embedding similarity,
+// BM25 keyword relevance or both, as configured by SearchMode
+func (s *service) search(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	if s.config.SearchMode == SearchModeKeyword {
+		return s.store.KeywordSearch(ctx, query, limit, allowedKnowledgeIds, filter)
+	}
+
+	embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeQuery, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate query embedding")
+	}
+	if len(embeddings) == 0 {
+		return nil, nil
+	}
+
+	// Only image embedders put documents in the vision space
+	if _, ok := s.embedder.(ImageEmbedder); ok && s.config.VisionSearchWeight > 0 {
+		return s.searchModalities(ctx, embeddings[0], query, limit, allowedKnowledgeIds, filter)
+	}
+	return s.searchEmbedding(ctx, embeddings[0], query, limit, allowedKnowledgeIds, filter)
+}
+
+// searchEmbedding retrieves documents by the similarity to the query embedding,
+// fused with their keyword relevance in hybrid search mode
+func (s *service) searchEmbedding(ctx context.Context, queryEmbedding []float32, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	if s.config.SearchMode == SearchModeHybrid {
+		return HybridSearch(ctx, s.store, queryEmbedding, query, limit, allowedKnowledgeIds, filter, HybridOptionsFromConfig(s.config))
+	}
+	return s.store.Search(ctx, queryEmbedding, limit, allowedKnowledgeIds, filter)
+}
+
+// searchModalities ranks text documents and documents in the vision space
+// separately and fuses both rankings weighted by VisionSearchWeight, since a
+// query is less similar to a matching image than to a matching text. Without
+// images the text ranking is returned as is.
+func (s *service) searchModalities(ctx context.Context, queryEmbedding []float32, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	notVision := false
+	textResults, err := s.searchEmbedding(ctx, queryEmbedding, query, limit, allowedKnowledgeIds,
+		AllOf(filter, &Filter{Field: MetadataKeyEmbeddingSpace, Exists: &notVision}))
+	if err != nil {
+		return nil, err
+	}
+
+	// Images have no text to match keywords against
+	imageResults, err := s.store.Search(ctx, queryEmbedding, limit, allowedKnowledgeIds,
+		AllOf(filter, FieldEq(MetadataKeyEmbeddingSpace, EmbeddingSpaceVision)))
+	if err != nil {
+		return nil, err
+	}
+	if len(imageResults) == 0 {
+		return textResults, nil
+	}
+
+	weight := s.config.VisionSearchWeight
+	results := FuseSearchResults(textResults, imageResults, HybridOptions{
+		Fusion:        s.config.HybridFusion,
+		VectorWeight:  1 - weight,
+		KeywordWeight: weight,
+		RRFK:          s.config.HybridRRFK,
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
 // DeleteAgentKnowledge removes all knowledge for an agent
 func (s *service) DeleteKnowledge(ctx context.Context, knowledgeId string) error {
 	return s.store.DeleteKnowledgeById(ctx, knowledgeId)
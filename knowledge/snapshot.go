@@ -0,0 +1,272 @@
+package knowledge
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// SnapshotHeader is the first record of a snapshot. A snapshot is a gzip
+	// compressed stream of JSON records: the header followed by one Knowledge per
+	// line, with its documents, metadata, content hashes and embeddings.
+	SnapshotHeader struct {
+		Version int `json:"version"`
+		// Embedder identifies the embedding provider and model of the embeddings,
+		// e.g. "openai/text-embedding-3-small"
+		Embedder string `json:"embedder,omitempty"`
+		// Dimension is the size of the embeddings
+		Dimension int       `json:"dimension,omitempty"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	// SnapshotExportOptions configures ExportSnapshot
+	SnapshotExportOptions struct {
+		// KnowledgeIds selects the knowledge to export. When empty, all stored
+		// knowledge is exported.
+		KnowledgeIds []string
+		// Embedder is recorded in the header to identify the embeddings
+		Embedder string
+	}
+
+	// SnapshotImportOptions configures ImportSnapshot
+	SnapshotImportOptions struct {
+		// KnowledgeIds selects the knowledge to import. When empty, all knowledge of
+		// the snapshot is imported.
+		KnowledgeIds []string
+		// Overwrite replaces stored knowledge with the same ID; it is skipped otherwise
+		Overwrite bool
+	}
+
+	// SnapshotImportResult lists the knowledge imported from a snapshot
+	SnapshotImportResult struct {
+		Imported []string `json:"imported"`
+		Skipped  []string `json:"skipped,omitempty"`
+		// Embedded counts the imported documents whose embeddings were recomputed
+		Embedded int `json:"embedded"`
+	}
+)
+
+const (
+	// snapshotVersion is the version of the snapshot format
+	snapshotVersion = 1
+)
+
+// ExportSnapshot writes knowledge of store with the embeddings of its documents
+// to w as a snapshot
+func ExportSnapshot(ctx context.Context, store Store, w io.Writer, opts SnapshotExportOptions) error {
+	ids := opts.KnowledgeIds
+	if len(ids) == 0 {
+		var err error
+		if ids, err = store.ListKnowledgeIds(ctx); err != nil {
+			return err
+		}
+	}
+
+	header := SnapshotHeader{
+		Version:   snapshotVersion,
+		Embedder:  opts.Embedder,
+		CreatedAt: time.Now().UTC(),
+	}
+	if sized, ok := store.(interface{ Dimension() int }); ok {
+		header.Dimension = sized.Dimension()
+	}
+
+	knowledges := make([]*Knowledge, 0, len(ids))
+	for _, id := range ids {
+		knowledge, err := store.GetKnowledgeById(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get knowledge %s", id)
+		}
+		if knowledge == nil {
+			return errors.Errorf("knowledge %s not found", id)
+		}
+
+		embeddings, err := store.GetDocumentEmbeddings(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get embeddings of knowledge %s", id)
+		}
+		for _, doc := range knowledge.Documents {
+			doc.Embeddings = embeddings[doc.ID]
+			if header.Dimension == 0 {
+				header.Dimension = len(doc.Embeddings)
+			}
+		}
+		knowledges = append(knowledges, knowledge)
+	}
+
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+	if err := encoder.Encode(&header); err != nil {
+		return errors.Wrapf(err, "failed to write snapshot header")
+	}
+	for _, knowledge := range knowledges {
+		if err := encoder.Encode(knowledge); err != nil {
+			return errors.Wrapf(err, "failed to write knowledge %s", knowledge.ID)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write snapshot")
+	}
+
+	return nil
+}
+
+// ImportSnapshot loads the knowledge of a snapshot into store as it was
+// exported. Every document must have embeddings of the dimension of the store.
+// Use Service.ImportSnapshot to embed documents the snapshot has no usable
+// embeddings for.
+func ImportSnapshot(ctx context.Context, store Store, r io.Reader, opts SnapshotImportOptions) (*SnapshotImportResult, error) {
+	dimension := 0
+	if sized, ok := store.(interface{ Dimension() int }); ok {
+		dimension = sized.Dimension()
+	}
+
+	return importSnapshot(ctx, store, r, opts, func(_ *SnapshotHeader, knowledge *Knowledge) (int, error) {
+		for _, doc := range knowledge.Documents {
+			if len(doc.Embeddings) == 0 {
+				return 0, errors.Errorf("document %s of knowledge %s has no embeddings", doc.ID, knowledge.ID)
+			}
+			if dimension > 0 && len(doc.Embeddings) != dimension {
+				return 0, errors.Errorf("document %s of knowledge %s has embeddings of dimension %d, not %d", doc.ID, knowledge.ID, len(doc.Embeddings), dimension)
+			}
+		}
+		return 0, nil
+	})
+}
+
+// ExportSnapshot implements Service.ExportSnapshot
+func (s *service) ExportSnapshot(ctx context.Context, w io.Writer, knowledgeIds ...string) error {
+	return ExportSnapshot(ctx, s.store, w, SnapshotExportOptions{
+		KnowledgeIds: knowledgeIds,
+		Embedder:     embedderID(s.config),
+	})
+}
+
+// ImportSnapshot implements Service.ImportSnapshot. Documents keep their
+// embeddings when their content hash shows they were embedded as this service
+// embeds them, and are embedded again otherwise, e.g. for another embedding model.
+func (s *service) ImportSnapshot(ctx context.Context, r io.Reader, opts SnapshotImportOptions) (*SnapshotImportResult, error) {
+	return importSnapshot(ctx, s.store, r, opts, func(header *SnapshotHeader, knowledge *Knowledge) (int, error) {
+		var changed []*Document
+		for _, doc := range knowledge.Documents {
+			hash := s.documentHash(doc)
+			if doc.ContentHash == hash && len(doc.Embeddings) == s.embedder.GetEmbedSize() {
+				continue
+			}
+
+			doc.ContentHash = hash
+			doc.Embeddings = nil
+			changed = append(changed, doc)
+		}
+
+		embedded := len(changed)
+		if embedded > 0 {
+			s.logger.Info("embedding snapshot documents",
+				slog.String("knowledge_id", knowledge.ID),
+				slog.String("snapshot_embedder", header.Embedder),
+				slog.Int("documents", embedded))
+		}
+		if err := s.embedDocuments(ctx, changed); err != nil {
+			return 0, err
+		}
+
+		return embedded, nil
+	})
+}
+
+// importSnapshot reads the knowledge of a snapshot, prepares the embeddings of
+// the selected knowledge with prepare and replaces the stored knowledge with it
+func importSnapshot(
+	ctx context.Context,
+	store Store,
+	r io.Reader,
+	opts SnapshotImportOptions,
+	prepare func(header *SnapshotHeader, knowledge *Knowledge) (int, error),
+) (*SnapshotImportResult, error) {
+	selected := make(map[string]bool, len(opts.KnowledgeIds))
+	for _, id := range opts.KnowledgeIds {
+		selected[id] = true
+	}
+
+	result := &SnapshotImportResult{Imported: []string{}}
+	err := readSnapshot(r, func(header *SnapshotHeader, knowledge *Knowledge) error {
+		if knowledge.ID == "" {
+			return errors.New("snapshot contains knowledge without an id")
+		}
+		if len(selected) > 0 && !selected[knowledge.ID] {
+			return nil
+		}
+
+		if !opts.Overwrite {
+			hashes, err := store.GetDocumentHashes(ctx, knowledge.ID)
+			if err != nil {
+				return errors.Wrapf(err, "failed to check knowledge %s", knowledge.ID)
+			}
+			if len(hashes) > 0 {
+				result.Skipped = append(result.Skipped, knowledge.ID)
+				return nil
+			}
+		}
+
+		embedded, err := prepare(header, knowledge)
+		if err != nil {
+			return err
+		}
+		// Every document has embeddings, so Upsert replaces the stored knowledge
+		if err := store.Upsert(ctx, knowledge); err != nil {
+			return errors.Wrapf(err, "failed to store knowledge %s", knowledge.ID)
+		}
+
+		result.Imported = append(result.Imported, knowledge.ID)
+		result.Embedded += embedded
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// readSnapshot calls fn with each knowledge of a snapshot. Snapshots that are
+// not gzip compressed are read as well.
+func readSnapshot(r io.Reader, fn func(header *SnapshotHeader, knowledge *Knowledge) error) error {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read snapshot")
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	decoder := json.NewDecoder(src)
+	var header SnapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return errors.Wrapf(err, "failed to read snapshot header")
+	}
+	if header.Version < 1 || header.Version > snapshotVersion {
+		return errors.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	for i := 1; ; i++ {
+		var knowledge Knowledge
+		if err := decoder.Decode(&knowledge); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read knowledge #%d of snapshot", i)
+		}
+		if err := fn(&header, &knowledge); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,173 @@
+//go:build !without_sqlite
+
+package knowledge_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSnapshotTestService(t *testing.T, configure func(conf *config.KnowledgeConfig)) knowledge.Service {
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	if configure != nil {
+		configure(conf)
+	}
+
+	service, err := knowledge.NewService(t.Context(), &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	t.Cleanup(func() { service.Close() })
+
+	return service
+}
+
+func TestService_Snapshot(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	source := newSnapshotTestService(t, func(conf *config.KnowledgeConfig) {
+		conf.SqlitePath = filepath.Join(dir, "source.db")
+	})
+	_, err := source.IndexKnowledgeFromMap(ctx, "catalog", []map[string]any{
+		{"id": "W-1", "content": "Our blue widgets are popular with gardeners"},
+		{"id": "ZX-9000", "content": "Model ZX-9000 supports fast charging"},
+	})
+	require.NoError(t, err)
+	_, err = source.IndexKnowledgeFromText(ctx, "policies", []string{"Returns are accepted within 30 days"})
+	require.NoError(t, err)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, source.ExportSnapshot(ctx, &snapshot))
+
+	t.Run("same embedder keeps embeddings", func(t *testing.T) {
+		target := newSnapshotTestService(t, nil)
+		result, err := target.ImportSnapshot(ctx, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"catalog", "policies"}, result.Imported)
+		assert.Zero(t, result.Embedded)
+
+		catalog, err := target.GetKnowledge(ctx, "catalog")
+		require.NoError(t, err)
+		require.Len(t, catalog.Documents, 2)
+		assert.Equal(t, "ZX-9000", catalog.Documents[1].Metadata["id"])
+
+		results, err := target.RetrieveRelevantKnowledge(ctx, "ZX-9000 fast charging", 1, []string{"catalog", "policies"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "catalog_item_ZX-9000", results[0].ID)
+
+		// Indexing the same content again finds the imported documents unchanged
+		indexed, err := target.IndexKnowledgeFromMap(ctx, "catalog", []map[string]any{
+			{"id": "W-1", "content": "Our blue widgets are popular with gardeners"},
+			{"id": "ZX-9000", "content": "Model ZX-9000 supports fast charging"},
+		})
+		require.NoError(t, err)
+		assert.Len(t, indexed.IndexSummary.Unchanged, 2)
+
+		// Stored knowledge is skipped unless overwritten
+		result, err = target.ImportSnapshot(ctx, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, result.Imported)
+		assert.Equal(t, []string{"catalog", "policies"}, result.Skipped)
+
+		result, err = target.ImportSnapshot(ctx, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{
+			KnowledgeIds: []string{"policies"},
+			Overwrite:    true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"policies"}, result.Imported)
+	})
+
+	t.Run("other embedder embeds again", func(t *testing.T) {
+		target := newSnapshotTestService(t, func(conf *config.KnowledgeConfig) {
+			conf.VectorDimension = 32
+		})
+		result, err := target.ImportSnapshot(ctx, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Embedded)
+
+		results, err := target.RetrieveRelevantKnowledge(ctx, "returns within 30 days", 1, []string{"policies"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "Returns are accepted within 30 days", results[0].EmbeddingText)
+	})
+
+	t.Run("selected knowledge", func(t *testing.T) {
+		var selected bytes.Buffer
+		require.NoError(t, source.ExportSnapshot(ctx, &selected, "policies"))
+
+		target := newSnapshotTestService(t, nil)
+		result, err := target.ImportSnapshot(ctx, &selected, knowledge.SnapshotImportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"policies"}, result.Imported)
+	})
+}
+
+func TestSnapshot_Stores(t *testing.T) {
+	ctx := t.Context()
+
+	source := knowledge.NewInMemoryStore()
+	require.NoError(t, source.Store(ctx, &knowledge.Knowledge{
+		ID:       "vectors",
+		Metadata: map[string]any{"source_type": "map"},
+		Documents: []*knowledge.Document{
+			{ID: "v1", EmbeddingText: "first", Content: knowledge.Content{Text: "first"}, Embeddings: generateTestEmbedding(16, 1)},
+			{ID: "v2", EmbeddingText: "second", Content: knowledge.Content{Text: "second"}, Embeddings: generateTestEmbedding(16, 2)},
+		},
+	}))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, knowledge.ExportSnapshot(ctx, source, &snapshot, knowledge.SnapshotExportOptions{Embedder: "fake/test"}))
+
+	// Snapshots are gzip compressed and start with the header
+	gz, err := gzip.NewReader(bytes.NewReader(snapshot.Bytes()))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"embedder":"fake/test","dimension":16`)
+
+	target, err := knowledge.NewSqliteStore(":memory:", 16)
+	require.NoError(t, err)
+	defer target.Close()
+
+	result, err := knowledge.ImportSnapshot(ctx, target, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vectors"}, result.Imported)
+
+	ids, err := target.ListKnowledgeIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vectors"}, ids)
+
+	embeddings, err := target.GetDocumentEmbeddings(ctx, "vectors")
+	require.NoError(t, err)
+	require.Len(t, embeddings, 2)
+	assert.InDeltaSlice(t, generateTestEmbedding(16, 2), embeddings["v2"], 1e-6)
+
+	results, err := target.Search(ctx, generateTestEmbedding(16, 2), 1, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "v2", results[0].ID)
+
+	// Uncompressed snapshots are read as well
+	result, err = knowledge.ImportSnapshot(ctx, knowledge.NewInMemoryStore(), bytes.NewReader(raw), knowledge.SnapshotImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vectors"}, result.Imported)
+
+	// A store of another dimension cannot take the embeddings
+	small, err := knowledge.NewSqliteStore(":memory:", 8)
+	require.NoError(t, err)
+	defer small.Close()
+	_, err = knowledge.ImportSnapshot(ctx, small, bytes.NewReader(snapshot.Bytes()), knowledge.SnapshotImportOptions{})
+	assert.ErrorContains(t, err, "dimension 16, not 8")
+}
@@ -0,0 +1,186 @@
+package knowledge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MetadataKeyFingerprint is the knowledge metadata key of the hash of the
+	// indexed files and the settings they were indexed with
+	MetadataKeyFingerprint = "fingerprint"
+)
+
+// filesFingerprint hashes the paths and contents of files together with the
+// loader options and the settings that change how files are chunked and embedded
+func (s *service) filesFingerprint(paths []string, files [][]byte, opts LoaderOptions) string {
+	settings, _ := json.Marshal(struct {
+		Options             LoaderOptions
+		EmbeddingProvider   string
+		EmbeddingModel      string
+		EmbedSize           int
+		ChunkStrategy       string
+		ChunkUnit           string
+		ChunkSize           int
+		ChunkOverlap        int
+		PDFEmbeddingMethod  string
+		PDFExtractionMethod string
+	}{
+		Options:             opts,
+		EmbeddingProvider:   s.config.EmbeddingProvider,
+		EmbeddingModel:      s.config.EmbeddingModel,
+		EmbedSize:           s.embedder.GetEmbedSize(),
+		ChunkStrategy:       s.config.ChunkStrategy,
+		ChunkUnit:           s.config.ChunkUnit,
+		ChunkSize:           s.config.ChunkSize,
+		ChunkOverlap:        s.config.ChunkOverlap,
+		PDFEmbeddingMethod:  s.config.PDFEmbeddingMethod,
+		PDFExtractionMethod: s.config.PDFExtractionMethod,
+	})
+
+	h := sha256.New()
+	h.Write(settings)
+	for i, path := range paths {
+		fileHash := sha256.Sum256(files[i])
+		h.Write([]byte{0})
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write(fileHash[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// documentHash hashes the content of a document together with the settings it is
+// embedded with, so documents are embedded again when either changes
+func (s *service) documentHash(doc *Document) string {
+	parts := []string{
+		s.config.EmbeddingProvider,
+		s.config.EmbeddingModel,
+		strconv.Itoa(s.embedder.GetEmbedSize()),
+		doc.Content.MIMEType,
+		doc.Content.Text,
+		doc.Content.Image,
+		doc.EmbeddingText,
+	}
+	if doc.Content.Type() == ContentTypeImage {
+		parts = append(parts, s.config.PDFEmbeddingMethod)
+	}
+
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ResolvePaths returns the files a knowledge source path refers to, sorted by
+// path. The path is a file, a directory whose files are listed recursively, or
+// a glob pattern where "**" matches any number of directories, e.g.
+// "docs/**/*.md". Hidden files and directories are skipped when listing.
+func ResolvePaths(path string) ([]string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to stat knowledge path %s", path)
+		}
+		if !info.IsDir() {
+			return []string{path}, nil
+		}
+		return walkFiles(path, func(string) bool { return true })
+	}
+
+	pattern := filepath.ToSlash(filepath.Clean(path))
+	if _, err := filepath.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid knowledge path pattern %s", path)
+	}
+
+	// Walk from the longest directory prefix without wildcards
+	segments := strings.Split(pattern, "/")
+	root := ""
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			root = strings.Join(segments[:i], "/")
+			break
+		}
+	}
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+
+	paths, err := walkFiles(filepath.FromSlash(root), func(file string) bool {
+		return matchGlob(pattern, filepath.ToSlash(filepath.Clean(file)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no files match knowledge path pattern %s", path)
+	}
+	return paths, nil
+}
+
+// walkFiles lists the regular files under root accepted by match, skipping hidden
+// files and directories other than root itself
+func walkFiles(root string, match func(string) bool) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && match(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list knowledge files in %s", root)
+	}
+
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// matchGlob reports whether a slash-separated path matches a pattern whose
+// "**" segments match zero or more path segments
+func matchGlob(pattern string, path string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchSegments(pattern []string, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
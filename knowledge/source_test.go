@@ -0,0 +1,107 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"guide.md":             "# Guide",
+		"faq.csv":              "question,answer",
+		"api/auth.md":          "# Auth",
+		"api/v2/errors.md":     "# Errors",
+		"api/v2/spec.json":     "{}",
+		".git/config":          "hidden",
+		"api/.drafts/draft.md": "hidden",
+	})
+	rel := func(paths []string) []string {
+		for i, path := range paths {
+			paths[i] = filepath.ToSlash(path[len(dir)+1:])
+		}
+		return paths
+	}
+
+	paths, err := knowledge.ResolvePaths(filepath.Join(dir, "guide.md"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"guide.md"}, rel(paths))
+
+	paths, err = knowledge.ResolvePaths(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api/auth.md", "api/v2/errors.md", "api/v2/spec.json", "faq.csv", "guide.md"}, rel(paths))
+
+	paths, err = knowledge.ResolvePaths(filepath.Join(dir, "*.md"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"guide.md"}, rel(paths))
+
+	paths, err = knowledge.ResolvePaths(filepath.Join(dir, "**", "*.md"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api/auth.md", "api/v2/errors.md", "guide.md"}, rel(paths))
+
+	paths, err = knowledge.ResolvePaths(filepath.Join(dir, "api", "**", "*.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api/v2/spec.json"}, rel(paths))
+
+	_, err = knowledge.ResolvePaths(filepath.Join(dir, "*.pdf"))
+	assert.Error(t, err)
+
+	_, err = knowledge.ResolvePaths(filepath.Join(dir, "missing.md"))
+	assert.Error(t, err)
+}
+
+func TestService_IndexKnowledgeFromFiles_SkipsUnchangedFiles(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"guide.md": "# Guide\n\nInstall the runtime."})
+	paths := []string{filepath.Join(dir, "guide.md")}
+
+	first, err := service.IndexKnowledgeFromFiles(ctx, "docs", paths, knowledge.LoaderOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.Documents[0].Embeddings)
+	fingerprint := first.Metadata[knowledge.MetadataKeyFingerprint]
+	require.NotEmpty(t, fingerprint)
+
+	// The stored knowledge is returned as is, without embedding the file again
+	second, err := service.IndexKnowledgeFromFiles(ctx, "docs", paths, knowledge.LoaderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, second.Metadata[knowledge.MetadataKeyFingerprint])
+	assert.Equal(t, first.Documents[0].ID, second.Documents[0].ID)
+	assert.Empty(t, second.Documents[0].Embeddings)
+
+	// Changing the loader options or the file indexes it again
+	third, err := service.IndexKnowledgeFromFiles(ctx, "docs", paths, knowledge.LoaderOptions{Type: knowledge.SourceTypeText})
+	require.NoError(t, err)
+	assert.NotEqual(t, fingerprint, third.Metadata[knowledge.MetadataKeyFingerprint])
+
+	writeFiles(t, dir, map[string]string{"guide.md": "# Guide\n\nUpgrade the runtime."})
+	fourth, err := service.IndexKnowledgeFromFiles(ctx, "docs", paths, knowledge.LoaderOptions{Type: knowledge.SourceTypeText})
+	require.NoError(t, err)
+	assert.NotEqual(t, third.Metadata[knowledge.MetadataKeyFingerprint], fourth.Metadata[knowledge.MetadataKeyFingerprint])
+	assert.Contains(t, fourth.Documents[0].EmbeddingText, "Upgrade")
+}
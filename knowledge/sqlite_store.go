@@ -4,21 +4,71 @@ package knowledge
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 	"github.com/google/uuid"
+	"github.com/mokiat/gog"
 	"github.com/pkg/errors"
 	"gorm.io/datatypes"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const (
+	sqliteMetadataKeyEmbeddingDimension = "embedding_dimension"
+	sqliteMetadataKeyEmbedder           = "embedder"
+)
+
 // SqliteStore implements Store using SQLite with sqlite-vec extension
 type SqliteStore struct {
-	db     *gorm.DB
-	vecDim int
+	db         *gorm.DB
+	vecDim     int
+	embedderId string
+	// resetEmbeddings allows migrate to drop embeddings of another dimension or embedder
+	resetEmbeddings bool
+	logger          *slog.Logger
+	// fts is whether the documents_fts table is available. SQLite is built with
+	// FTS5 only with the sqlite_fts5 build tag; without it keyword search ranks
+	// the documents in Go.
+	fts bool
+}
+
+// SqliteStoreOption customizes NewSqliteStore
+type SqliteStoreOption func(*SqliteStore)
+
+// WithEmbedderID records the embedder the stored embeddings are produced by, so
+// that the embeddings are dropped when the store is opened for another embedder
+func WithEmbedderID(embedderId string) SqliteStoreOption {
+	return func(s *SqliteStore) {
+		s.embedderId = embedderId
+	}
+}
+
+// WithEmbeddingReset allows the store to drop the stored embeddings when it is
+// opened with another dimension or embedder, so that the knowledge is embedded
+// again when indexed. Without it, NewSqliteStore fails with
+// ErrEmbeddingSettingsChanged and leaves the database as it is.
+func WithEmbeddingReset(allow bool) SqliteStoreOption {
+	return func(s *SqliteStore) {
+		s.resetEmbeddings = allow
+	}
+}
+
+// WithLogger sets the logger the store reports dropped embeddings to
+func WithLogger(logger *slog.Logger) SqliteStoreOption {
+	return func(s *SqliteStore) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
 }
 
 // KnowledgeRecord represents the database structure for knowledge items
@@ -45,6 +95,7 @@ type SqliteDocumentRecord struct {
 	Content       datatypes.JSONType[Content]
 	EmbeddingText string
 	Metadata      datatypes.JSONType[map[string]any]
+	ContentHash   string
 
 	KnowledgeRecordID string
 	KnowledgeRecord   *SqliteKnowledgeRecord `gorm:"foreignKey:KnowledgeRecordID"`
@@ -54,16 +105,39 @@ func (SqliteDocumentRecord) TableName() string {
 	return "documents"
 }
 
-// NewSqliteStore creates a new SQLite-based knowledge store
-func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
+// SqliteKnowledgeMetadataRecord stores the settings the embeddings of the store were created with
+type SqliteKnowledgeMetadataRecord struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+func (SqliteKnowledgeMetadataRecord) TableName() string {
+	return "knowledge_metadata"
+}
+
+// NewSqliteStore creates a new SQLite-based knowledge store and migrates its schema.
+// dimension must be the GetEmbedSize of the embedder used with the store. When the
+// database holds embeddings of another dimension, or of another embedder given with
+// WithEmbedderID, it fails with ErrEmbeddingSettingsChanged unless WithEmbeddingReset
+// allows it to drop them and clear the content hashes of the documents, so that
+// indexing the knowledge again embeds every document.
+func NewSqliteStore(dbPath string, dimension int, opts ...SqliteStoreOption) (*SqliteStore, error) {
+	if dimension <= 0 {
+		return nil, errors.Errorf("invalid embedding dimension: %d", dimension)
+	}
+
 	// Initialize sqlite-vec extension
 	sqlite_vec.Auto()
 
+	dsn := fmt.Sprintf("file:%s?cache=shared&mode=rwc&_journal_mode=WAL&_foreign_keys=on", dbPath)
+	if dbPath == ":memory:" {
+		// A shared cache would share ":memory:" with every store of the process, so
+		// name a database that only the connections of this store share
+		dsn = fmt.Sprintf("file:knowledge-%s?mode=memory&cache=shared&_foreign_keys=on", uuid.NewString())
+	}
+
 	// Open database connection
-	db, err := gorm.Open(
-		sqlite.Open(fmt.Sprintf("file:%s?cache=shared&mode=rwc&_journal_mode=WAL&_foreign_keys=on", dbPath)),
-		&gorm.Config{},
-	)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to open sqlite database")
 	}
@@ -71,21 +145,125 @@ func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
 	store := &SqliteStore{
 		db:     db,
 		vecDim: dimension,
+		logger: slog.New(slog.DiscardHandler),
 	}
-
-	// Auto-migrate the knowledge table
-	if err := db.AutoMigrate(&SqliteKnowledgeRecord{}, &SqliteDocumentRecord{}); err != nil {
-		return nil, errors.Wrapf(err, "failed to migrate knowledge table")
+	for _, opt := range opts {
+		opt(store)
 	}
 
-	// Create vector table
-	if err := store.createVectorTable(); err != nil {
+	if err := store.migrate(); err != nil {
+		_ = store.Close()
 		return nil, err
 	}
 
 	return store, nil
 }
 
+// migrate creates or updates the tables used by the store
+func (s *SqliteStore) migrate() error {
+	if err := s.db.AutoMigrate(&SqliteKnowledgeRecord{}, &SqliteDocumentRecord{}, &SqliteKnowledgeMetadataRecord{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate knowledge tables")
+	}
+
+	storedDim, storedEmbedderId, err := s.embeddingSettings()
+	if err != nil {
+		return err
+	}
+	reset := (storedDim > 0 && storedDim != s.vecDim) ||
+		(s.embedderId != "" && storedEmbedderId != "" && storedEmbedderId != s.embedderId)
+	if reset && !s.resetEmbeddings {
+		return errors.Wrapf(ErrEmbeddingSettingsChanged, "stored embeddings of embedder '%s' with dimension %d, opened for embedder '%s' with dimension %d",
+			storedEmbedderId, storedDim, s.embedderId, s.vecDim)
+	}
+	if reset {
+		s.logger.Warn("dropping stored knowledge embeddings; index the knowledge again to embed it",
+			slog.String("old_embedder", storedEmbedderId),
+			slog.Int("old_dimension", storedDim),
+			slog.String("new_embedder", s.embedderId),
+			slog.Int("new_dimension", s.vecDim),
+		)
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if reset {
+			// Embeddings of another size or model cannot be compared with new ones
+			if err := tx.Exec("DROP TABLE IF EXISTS document_vectors").Error; err != nil {
+				return errors.Wrapf(err, "failed to drop document_vectors table")
+			}
+			if err := tx.Exec("UPDATE documents SET content_hash = ''").Error; err != nil {
+				return errors.Wrapf(err, "failed to clear document hashes")
+			}
+		}
+
+		settings := []*SqliteKnowledgeMetadataRecord{
+			{Key: sqliteMetadataKeyEmbeddingDimension, Value: strconv.Itoa(s.vecDim)},
+		}
+		if s.embedderId != "" {
+			settings = append(settings, &SqliteKnowledgeMetadataRecord{Key: sqliteMetadataKeyEmbedder, Value: s.embedderId})
+		}
+		for _, setting := range settings {
+			if err := tx.Save(setting).Error; err != nil {
+				return errors.Wrapf(err, "failed to save embedding settings")
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Create vector table
+	if err := s.createVectorTable(); err != nil {
+		return err
+	}
+
+	// Create full-text index
+	return s.createKeywordTable()
+}
+
+// embeddingSettings returns the dimension and the embedder ID the stored
+// embeddings were created with. Databases created before the settings were
+// recorded report the dimension of their vector table.
+func (s *SqliteStore) embeddingSettings() (int, string, error) {
+	var records []SqliteKnowledgeMetadataRecord
+	if err := s.db.Find(&records).Error; err != nil {
+		return 0, "", errors.Wrapf(err, "failed to read embedding settings")
+	}
+
+	var (
+		dimension  int
+		embedderId string
+	)
+	for _, record := range records {
+		switch record.Key {
+		case sqliteMetadataKeyEmbeddingDimension:
+			d, err := strconv.Atoi(record.Value)
+			if err != nil {
+				return 0, "", errors.Wrapf(err, "invalid stored embedding dimension '%s'", record.Value)
+			}
+			dimension = d
+		case sqliteMetadataKeyEmbedder:
+			embedderId = record.Value
+		}
+	}
+
+	if dimension == 0 {
+		var tableSQL []string
+		if err := s.db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'document_vectors'").Scan(&tableSQL).Error; err != nil {
+			return 0, "", errors.Wrapf(err, "failed to check document_vectors table")
+		}
+		if len(tableSQL) > 0 {
+			if match := vectorColumnPattern.FindStringSubmatch(tableSQL[0]); match != nil {
+				dimension, _ = strconv.Atoi(match[1])
+			}
+		}
+	}
+
+	return dimension, embedderId, nil
+}
+
+// vectorColumnPattern matches the embedding column of the document_vectors table
+var vectorColumnPattern = regexp.MustCompile(`embedding\s+float\[(\d+)\]`)
+
 // createVectorTable creates the sqlite-vec virtual table
 func (s *SqliteStore) createVectorTable() error {
 	// Verify sqlite-vec is loaded
@@ -110,6 +288,59 @@ func (s *SqliteStore) createVectorTable() error {
 	return nil
 }
 
+// createKeywordTable creates the FTS5 index of the embedding texts of documents
+// and the triggers keeping it in sync with the documents table
+func (s *SqliteStore) createKeywordTable() error {
+	var fts5, exists int64
+	if err := s.db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&fts5); err != nil {
+		return errors.Wrapf(err, "failed to check FTS5 support")
+	}
+	if fts5 == 0 {
+		return nil
+	}
+
+	if err := s.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'documents_fts'").Row().Scan(&exists); err != nil {
+		return errors.Wrapf(err, "failed to check documents_fts table")
+	}
+
+	if err := s.db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(
+			embedding_text,
+			content='documents',
+			content_rowid='rowid'
+		);
+	`).Error; err != nil {
+		return errors.Wrapf(err, "failed to create documents_fts table")
+	}
+
+	for _, trigger := range []string{
+		`CREATE TRIGGER IF NOT EXISTS documents_fts_insert AFTER INSERT ON documents BEGIN
+			INSERT INTO documents_fts(rowid, embedding_text) VALUES (new.rowid, new.embedding_text);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS documents_fts_delete AFTER DELETE ON documents BEGIN
+			INSERT INTO documents_fts(documents_fts, rowid, embedding_text) VALUES ('delete', old.rowid, old.embedding_text);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS documents_fts_update AFTER UPDATE OF embedding_text ON documents BEGIN
+			INSERT INTO documents_fts(documents_fts, rowid, embedding_text) VALUES ('delete', old.rowid, old.embedding_text);
+			INSERT INTO documents_fts(rowid, embedding_text) VALUES (new.rowid, new.embedding_text);
+		END;`,
+	} {
+		if err := s.db.Exec(trigger).Error; err != nil {
+			return errors.Wrapf(err, "failed to create documents_fts trigger")
+		}
+	}
+
+	// Index the documents stored before the table existed
+	if exists == 0 {
+		if err := s.db.Exec("INSERT INTO documents_fts(documents_fts) VALUES ('rebuild')").Error; err != nil {
+			return errors.Wrapf(err, "failed to build documents_fts index")
+		}
+	}
+
+	s.fts = true
+	return nil
+}
+
 // Store implements Store.Store
 func (s *SqliteStore) Store(ctx context.Context, knowledge *Knowledge) error {
 	if len(knowledge.Documents) == 0 {
@@ -117,83 +348,182 @@ func (s *SqliteStore) Store(ctx context.Context, knowledge *Knowledge) error {
 	}
 
 	// Begin transaction
-	tx := s.db.WithContext(ctx)
-	if err := tx.Transaction(func(tx *gorm.DB) error {
-		if knowledge.ID == "" {
-			knowledge.ID = uuid.NewString()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.save(tx, knowledge)
+	})
+}
+
+// Upsert implements Store.Upsert
+func (s *SqliteStore) Upsert(ctx context.Context, knowledge *Knowledge) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.save(tx, knowledge); err != nil {
+			return err
 		}
-		record := SqliteKnowledgeRecord{
-			ID:        knowledge.ID,
-			Metadata:  datatypes.NewJSONType(knowledge.Metadata),
-			Documents: make([]*SqliteDocumentRecord, 0, len(knowledge.Documents)),
+
+		documentIds := make([]string, 0, len(knowledge.Documents))
+		for _, item := range knowledge.Documents {
+			documentIds = append(documentIds, item.ID)
 		}
 
-		if err := tx.Save(&record).Error; err != nil {
-			return errors.Wrapf(err, "failed to save knowledge record")
+		// Remove the documents left out of the knowledge
+		query := tx.Model(&SqliteDocumentRecord{}).Where("knowledge_record_id = ?", knowledge.ID)
+		if len(documentIds) > 0 {
+			query = query.Where("id NOT IN ?", documentIds)
+		}
+		var staleIds []string
+		if err := query.Pluck("id", &staleIds).Error; err != nil {
+			return errors.Wrapf(err, "failed to get stale document IDs")
+		}
+		if len(staleIds) == 0 {
+			return nil
 		}
 
-		for _, item := range knowledge.Documents {
-			if item.ID == "" {
-				item.ID = uuid.NewString()
-			}
+		if err := tx.Exec("DELETE FROM document_vectors WHERE document_id IN ?", staleIds).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete stale vectors")
+		}
+		if err := tx.Delete(&SqliteDocumentRecord{}, "id IN ?", staleIds).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete stale document records")
+		}
+
+		return nil
+	})
+}
 
-			// Create or update knowledge record
-			docRecord := SqliteDocumentRecord{
-				ID:                item.ID,
-				EmbeddingText:     item.EmbeddingText,
-				Metadata:          datatypes.NewJSONType(item.Metadata),
-				KnowledgeRecordID: knowledge.ID, // Set the foreign key
-				Content:           datatypes.NewJSONType(item.Content),
+// GetDocumentHashes implements Store.GetDocumentHashes
+func (s *SqliteStore) GetDocumentHashes(ctx context.Context, knowledgeId string) (map[string]string, error) {
+	var records []SqliteDocumentRecord
+	if err := s.db.WithContext(ctx).
+		Select("id", "content_hash").
+		Where("knowledge_record_id = ?", knowledgeId).
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document hashes")
+	}
+
+	hashes := make(map[string]string, len(records))
+	for _, record := range records {
+		hashes[record.ID] = record.ContentHash
+	}
+
+	return hashes, nil
+}
+
+// GetDocumentEmbeddings implements Store.GetDocumentEmbeddings
+func (s *SqliteStore) GetDocumentEmbeddings(ctx context.Context, knowledgeId string) (map[string][]float32, error) {
+	rows, err := s.db.WithContext(ctx).Raw("SELECT document_id, vec_to_json(embedding) FROM document_vectors WHERE document_id IN (SELECT id FROM documents WHERE knowledge_record_id = ?)", knowledgeId).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document embeddings")
+	}
+	defer rows.Close()
+
+	embeddings := make(map[string][]float32)
+	for rows.Next() {
+		var (
+			documentId string
+			embedding  string
+		)
+		if err := rows.Scan(&documentId, &embedding); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan document embedding")
+		}
+		var values []float32
+		if err := json.Unmarshal([]byte(embedding), &values); err != nil {
+			return nil, errors.Wrapf(err, "invalid embedding of document %s", documentId)
+		}
+		embeddings[documentId] = values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document embeddings")
+	}
+
+	return embeddings, nil
+}
+
+// ListKnowledgeIds implements Store.ListKnowledgeIds
+func (s *SqliteStore) ListKnowledgeIds(ctx context.Context) ([]string, error) {
+	var ids []string
+	if err := s.db.WithContext(ctx).Model(&SqliteKnowledgeRecord{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list knowledge")
+	}
+	return ids, nil
+}
+
+// save saves the knowledge record and its documents within tx. Documents without
+// embeddings keep their stored vectors.
+func (s *SqliteStore) save(tx *gorm.DB, knowledge *Knowledge) error {
+	if knowledge.ID == "" {
+		knowledge.ID = uuid.NewString()
+	}
+	record := SqliteKnowledgeRecord{
+		ID:        knowledge.ID,
+		Metadata:  datatypes.NewJSONType(knowledge.Metadata),
+		Documents: make([]*SqliteDocumentRecord, 0, len(knowledge.Documents)),
+	}
+
+	if err := tx.Save(&record).Error; err != nil {
+		return errors.Wrapf(err, "failed to save knowledge record")
+	}
+
+	for _, item := range knowledge.Documents {
+		if item.ID == "" {
+			item.ID = uuid.NewString()
+		}
+
+		// Create or update knowledge record
+		docRecord := SqliteDocumentRecord{
+			ID:                item.ID,
+			EmbeddingText:     item.EmbeddingText,
+			Metadata:          datatypes.NewJSONType(item.Metadata),
+			ContentHash:       item.ContentHash,
+			KnowledgeRecordID: knowledge.ID, // Set the foreign key
+			Content:           datatypes.NewJSONType(item.Content),
+		}
+
+		// Use Save to create or update
+		if err := tx.Save(&docRecord).Error; err != nil {
+			return errors.Wrapf(err, "failed to save document record")
+		}
+
+		// Store embedding in vector table
+		if len(item.Embeddings) > 0 {
+			// Delete existing vector (if updating)
+			if err := tx.Exec("DELETE FROM document_vectors WHERE document_id = ?", item.ID).Error; err != nil {
+				return errors.Wrapf(err, "failed to delete existing vector")
 			}
 
-			// Use Save to create or update
-			if err := tx.Save(&docRecord).Error; err != nil {
-				return errors.Wrapf(err, "failed to save document record")
+			// Serialize embedding
+			serializedEmbedding, err := sqlite_vec.SerializeFloat32(item.Embeddings)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize embedding")
 			}
 
-			// Store embedding in vector table
-			if len(item.Embeddings) > 0 {
-				// Delete existing vector (if updating)
-				if err := tx.Exec("DELETE FROM document_vectors WHERE document_id = ?", item.ID).Error; err != nil {
-					return errors.Wrapf(err, "failed to delete existing vector")
-				}
-
-				// Serialize embedding
-				serializedEmbedding, err := sqlite_vec.SerializeFloat32(item.Embeddings)
-				if err != nil {
-					return errors.Wrapf(err, "failed to serialize embedding")
-				}
-
-				// Insert new vector
-				insertSQL := "INSERT INTO document_vectors (document_id, embedding) VALUES (?, ?)"
-				if err := tx.Exec(insertSQL, item.ID, serializedEmbedding).Error; err != nil {
-					return errors.Wrapf(err, "failed to insert knowledge vector")
-				}
+			// Insert new vector
+			insertSQL := "INSERT INTO document_vectors (document_id, embedding) VALUES (?, ?)"
+			if err := tx.Exec(insertSQL, item.ID, serializedEmbedding).Error; err != nil {
+				return errors.Wrapf(err, "failed to insert knowledge vector")
 			}
 		}
-
-		return nil
-	}); err != nil {
-		return err
 	}
 
 	return nil
 }
 
 // Search implements Store.Search
-func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error) {
+func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
 	var allowedDocumentIds []string
 
-	// Get document IDs from allowed knowledge IDs
-	if len(allowedKnowledgeIds) > 0 {
-		if err := s.db.WithContext(ctx).
-			Model(&SqliteDocumentRecord{}).
-			Where("knowledge_record_id IN ?", allowedKnowledgeIds).
-			Pluck("id", &allowedDocumentIds).Error; err != nil {
+	// Get document IDs from allowed knowledge IDs and the metadata filter
+	if len(allowedKnowledgeIds) > 0 || !filter.IsEmpty() {
+		tx := s.db.WithContext(ctx).Model(&SqliteDocumentRecord{})
+		if len(allowedKnowledgeIds) > 0 {
+			tx = tx.Where("knowledge_record_id IN ?", allowedKnowledgeIds)
+		}
+		if condition, args := filter.sqliteCondition("metadata"); condition != "" {
+			tx = tx.Where(condition, args...)
+		}
+		if err := tx.Pluck("id", &allowedDocumentIds).Error; err != nil {
 			return nil, errors.Wrapf(err, "failed to get document IDs from knowledge IDs")
 		}
 
-		// If no documents found for the allowed knowledge IDs, return empty results
+		// If no documents match the allowed knowledge IDs and the filter, return empty results
 		if len(allowedDocumentIds) == 0 {
 			return []KnowledgeSearchResult{}, nil
 		}
@@ -214,14 +544,15 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 	var searchSQL string
 	var args []interface{}
 
+	// The k constraint rather than LIMIT keeps vec0 from treating a single
+	// allowed document ID as a point lookup
 	if len(allowedDocumentIds) > 0 {
 		// Filter by allowed document IDs if specified
 		searchSQL = `
 			SELECT document_id, distance
 			FROM document_vectors
-			WHERE embedding MATCH ? AND document_id IN ?
+			WHERE embedding MATCH ? AND document_id IN ? AND k = ?
 			ORDER BY distance
-			LIMIT ?
 		`
 		args = []interface{}{serializedQuery, allowedDocumentIds, limit * 2}
 	} else {
@@ -229,9 +560,8 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 		searchSQL = `
 			SELECT document_id, distance
 			FROM document_vectors
-			WHERE embedding MATCH ?
+			WHERE embedding MATCH ? AND k = ?
 			ORDER BY distance
-			LIMIT ?
 		`
 		args = []interface{}{serializedQuery, limit * 2}
 	}
@@ -297,6 +627,11 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 		})
 	}
 
+	// Records are fetched in arbitrary order, so restore the ranking
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
 	// Limit results
 	if len(results) > limit {
 		results = results[:limit]
@@ -305,6 +640,124 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 	return results, nil
 }
 
+// KeywordSearch implements Store.KeywordSearch. Documents matching any term of
+// the query are ranked by the BM25 score of FTS5.
+func (s *SqliteStore) KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	terms := keywordTerms(query)
+	if len(terms) == 0 || limit <= 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+	if !s.fts {
+		return s.scanKeywordSearch(ctx, query, limit, allowedKnowledgeIds, filter)
+	}
+
+	// Quote the terms so that FTS5 does not parse them as query syntax
+	matchQuery := strings.Join(gog.Map(terms, func(term string) string {
+		return `"` + term + `"`
+	}), " OR ")
+
+	tx := s.db.WithContext(ctx).
+		Table("documents_fts").
+		Select("documents.id AS id, -bm25(documents_fts) AS score").
+		Joins("JOIN documents ON documents.rowid = documents_fts.rowid").
+		Where("documents_fts MATCH ?", matchQuery)
+	if len(allowedKnowledgeIds) > 0 {
+		tx = tx.Where("documents.knowledge_record_id IN ?", allowedKnowledgeIds)
+	}
+	if condition, args := filter.sqliteCondition("documents.metadata"); condition != "" {
+		tx = tx.Where(condition, args...)
+	}
+
+	type keywordRow struct {
+		ID    string
+		Score float64
+	}
+	var matches []keywordRow
+	if err := tx.Order("score DESC").Limit(limit).Scan(&matches).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to execute keyword search query")
+	}
+	if len(matches) == 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
+	var records []*SqliteDocumentRecord
+	if err := s.db.WithContext(ctx).
+		Where("id IN ?", gog.Map(matches, func(m keywordRow) string { return m.ID })).
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document records")
+	}
+	byID := make(map[string]*SqliteDocumentRecord, len(records))
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+
+	results := make([]KnowledgeSearchResult, 0, len(matches))
+	for _, match := range matches {
+		if record, ok := byID[match.ID]; ok {
+			results = append(results, KnowledgeSearchResult{
+				Document: record.toDocument(),
+				Score:    float32(match.Score),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// scanKeywordSearch ranks the documents with an in-memory keyword index when
+// SQLite is built without FTS5
+func (s *SqliteStore) scanKeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	tx := s.db.WithContext(ctx)
+	if len(allowedKnowledgeIds) > 0 {
+		tx = tx.Where("knowledge_record_id IN ?", allowedKnowledgeIds)
+	}
+	if condition, args := filter.sqliteCondition("metadata"); condition != "" {
+		tx = tx.Where(condition, args...)
+	}
+	var records []*SqliteDocumentRecord
+	if err := tx.Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch document records")
+	}
+
+	index := newKeywordIndex()
+	for _, record := range records {
+		index.add(record.toDocument())
+	}
+
+	matches := index.search(query, nil)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	results := make([]KnowledgeSearchResult, len(matches))
+	for i, match := range matches {
+		results[i] = KnowledgeSearchResult{
+			Document: match.doc,
+			Score:    float32(match.score),
+		}
+	}
+
+	return results, nil
+}
+
+// toDocument converts a document record into a document without embeddings
+func (record *SqliteDocumentRecord) toDocument() *Document {
+	metadata := record.Metadata.Data()
+	if metadata == nil {
+		metadata = map[string]any{
+			"knowledge_id": record.KnowledgeRecordID,
+		}
+	}
+
+	return &Document{
+		ID:            record.ID,
+		Content:       record.Content.Data(),
+		Metadata:      metadata,
+		EmbeddingText: record.EmbeddingText,
+		ContentHash:   record.ContentHash,
+	}
+}
+
 // GetKnowledgeById implements Store.GetKnowledgeById
 func (s *SqliteStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error) {
 	var record SqliteKnowledgeRecord
@@ -319,20 +772,7 @@ func (s *SqliteStore) GetKnowledgeById(ctx context.Context, knowledgeId string)
 	}
 
 	for _, document := range record.Documents {
-		// Parse metadata
-		metadata := document.Metadata.Data()
-		if metadata == nil {
-			metadata = map[string]any{
-				"knowledge_id": record.ID,
-			}
-		}
-
-		knowledge.Documents = append(knowledge.Documents, &Document{
-			ID:            document.ID,
-			Content:       document.Content.Data(),
-			Metadata:      metadata,
-			EmbeddingText: document.EmbeddingText,
-		})
+		knowledge.Documents = append(knowledge.Documents, document.toDocument())
 	}
 
 	return knowledge, nil
@@ -371,6 +811,17 @@ func (s *SqliteStore) DeleteKnowledgeById(ctx context.Context, knowledgeId strin
 	return nil
 }
 
+// NewSqliteStoreForEmbedder creates a SQLite-based knowledge store whose vector
+// table is sized for the embeddings of embedder
+func NewSqliteStoreForEmbedder(dbPath string, embedder Embedder, opts ...SqliteStoreOption) (*SqliteStore, error) {
+	return NewSqliteStore(dbPath, embedder.GetEmbedSize(), opts...)
+}
+
+// Dimension returns the embedding dimension of the vector table
+func (s *SqliteStore) Dimension() int {
+	return s.vecDim
+}
+
 // Close implements Store.Close
 func (s *SqliteStore) Close() error {
 	sqlDB, err := s.db.DB()
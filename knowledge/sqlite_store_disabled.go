@@ -0,0 +1,42 @@
+//go:build without_sqlite
+
+package knowledge
+
+import (
+	"log/slog"
+
+	"github.com/pkg/errors"
+)
+
+// SqliteStore is unavailable when built with the without_sqlite tag
+type SqliteStore struct {
+	*InMemoryStore
+}
+
+// SqliteStoreOption customizes NewSqliteStore
+type SqliteStoreOption func(*SqliteStore)
+
+// WithEmbedderID has no effect when built with the without_sqlite tag
+func WithEmbedderID(embedderId string) SqliteStoreOption {
+	return func(*SqliteStore) {}
+}
+
+// WithEmbeddingReset has no effect when built with the without_sqlite tag
+func WithEmbeddingReset(allow bool) SqliteStoreOption {
+	return func(*SqliteStore) {}
+}
+
+// WithLogger has no effect when built with the without_sqlite tag
+func WithLogger(logger *slog.Logger) SqliteStoreOption {
+	return func(*SqliteStore) {}
+}
+
+// NewSqliteStore always fails when built with the without_sqlite tag
+func NewSqliteStore(dbPath string, dimension int, opts ...SqliteStoreOption) (*SqliteStore, error) {
+	return nil, errors.New("sqlite knowledge store is not available: built with without_sqlite tag")
+}
+
+// NewSqliteStoreForEmbedder always fails when built with the without_sqlite tag
+func NewSqliteStoreForEmbedder(dbPath string, embedder Embedder, opts ...SqliteStoreOption) (*SqliteStore, error) {
+	return nil, errors.New("sqlite knowledge store is not available: built with without_sqlite tag")
+}
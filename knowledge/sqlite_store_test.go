@@ -0,0 +1,212 @@
+//go:build !without_sqlite
+
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqliteStore_EmbedderDimension(t *testing.T) {
+	embedder := knowledge.NewFakeEmbedder(16)
+	store, err := knowledge.NewSqliteStoreForEmbedder(filepath.Join(t.TempDir(), "knowledge.db"), embedder)
+	require.NoError(t, err)
+	defer store.Close()
+	assert.Equal(t, 16, store.Dimension())
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.RerankEnabled = false
+
+	conf.VectorDimension = 16
+	service, err := knowledge.NewServiceWithStore(t.Context(), conf, &config.ModelConfig{}, slog.Default(), store)
+	require.NoError(t, err)
+
+	_, err = service.IndexKnowledgeFromMap(t.Context(), "launch", []map[string]any{
+		{"title": "Launch", "content": "The launch is on June 3"},
+		{"title": "Hiring", "content": "We are hiring a backend engineer"},
+	})
+	require.NoError(t, err)
+
+	results, err := service.RetrieveRelevantKnowledge(t.Context(), "when is the launch", 1, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].Document.EmbeddingText, "June 3")
+
+	conf.VectorDimension = 32
+	_, err = knowledge.NewServiceWithStore(t.Context(), conf, &config.ModelConfig{}, slog.Default(), store)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match")
+}
+
+func TestSqliteStore_Upsert(t *testing.T) {
+	store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), 16)
+	require.NoError(t, err)
+	defer store.Close()
+
+	testStoreUpsert(t, store)
+}
+
+func TestSqliteStore_KeywordSearch(t *testing.T) {
+	store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), 16)
+	require.NoError(t, err)
+	defer store.Close()
+
+	testStoreKeywordSearch(t, store)
+}
+
+func TestSqliteStore_SearchWithFilter(t *testing.T) {
+	store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), 16)
+	require.NoError(t, err)
+	defer store.Close()
+
+	testStoreSearchWithFilter(t, store)
+}
+
+func TestSqliteStore_EmbeddingMigration(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "knowledge.db")
+
+	store, err := knowledge.NewSqliteStore(path, 16, knowledge.WithEmbedderID("fake/"))
+	require.NoError(t, err)
+	require.NoError(t, store.Store(ctx, &knowledge.Knowledge{
+		ID: "docs",
+		Documents: []*knowledge.Document{
+			{ID: "doc-1", EmbeddingText: "Document 1", Embeddings: generateTestEmbedding(16, 1), ContentHash: "hash-1"},
+		},
+	}))
+	require.NoError(t, store.Close())
+
+	// Reopening with the same settings keeps the embeddings
+	store, err = knowledge.NewSqliteStore(path, 16, knowledge.WithEmbedderID("fake/"))
+	require.NoError(t, err)
+	results, err := store.Search(ctx, generateTestEmbedding(16, 1), 1, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, store.Close())
+
+	for _, reopen := range []struct {
+		name       string
+		dimension  int
+		embedderId string
+	}{
+		{"dimension", 32, "fake/"},
+		{"embedder", 32, "openai/text-embedding-3-small"},
+	} {
+		t.Run(reopen.name, func(t *testing.T) {
+			// The embeddings are only dropped when allowed
+			_, err := knowledge.NewSqliteStore(path, reopen.dimension, knowledge.WithEmbedderID(reopen.embedderId))
+			require.ErrorIs(t, err, knowledge.ErrEmbeddingSettingsChanged)
+
+			store, err := knowledge.NewSqliteStore(path, reopen.dimension, knowledge.WithEmbedderID(reopen.embedderId), knowledge.WithEmbeddingReset(true))
+			require.NoError(t, err)
+			defer store.Close()
+			assert.Equal(t, reopen.dimension, store.Dimension())
+
+			// Documents are kept without embeddings, to be embedded again
+			stored, err := store.GetKnowledgeById(ctx, "docs")
+			require.NoError(t, err)
+			require.Len(t, stored.Documents, 1)
+			hashes, err := store.GetDocumentHashes(ctx, "docs")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"doc-1": ""}, hashes)
+
+			results, err := store.Search(ctx, generateTestEmbedding(reopen.dimension, 1), 1, nil, nil)
+			require.NoError(t, err)
+			assert.Empty(t, results)
+
+			require.NoError(t, store.Upsert(ctx, &knowledge.Knowledge{
+				ID: "docs",
+				Documents: []*knowledge.Document{
+					{ID: "doc-1", EmbeddingText: "Document 1", Embeddings: generateTestEmbedding(reopen.dimension, 1), ContentHash: "hash-1"},
+				},
+			}))
+			results, err = store.Search(ctx, generateTestEmbedding(reopen.dimension, 1), 1, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+		})
+	}
+}
+
+func TestService_SqlitePersistence(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.RerankEnabled = false
+	conf.SqlitePath = filepath.Join(t.TempDir(), "data", "knowledge.db")
+	conf.VectorDimension = 16
+
+	items := []map[string]any{
+		{"title": "Launch", "content": "The launch is on June 3"},
+		{"title": "Hiring", "content": "We are hiring a backend engineer"},
+	}
+	index := func() *knowledge.Knowledge {
+		service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		require.NoError(t, err)
+		defer service.Close()
+
+		indexed, err := service.IndexKnowledgeFromMap(ctx, "company", items)
+		require.NoError(t, err)
+
+		results, err := service.RetrieveRelevantKnowledge(ctx, "when is the launch", 1, nil)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Contains(t, results[0].Document.EmbeddingText, "June 3")
+
+		return indexed
+	}
+
+	indexed := index()
+	require.NotNil(t, indexed.IndexSummary)
+	assert.Len(t, indexed.IndexSummary.Added, 2)
+
+	// The knowledge survives a restart
+	indexed = index()
+	assert.Len(t, indexed.IndexSummary.Unchanged, 2)
+	assert.Empty(t, indexed.IndexSummary.Added)
+
+	// A new embedding dimension embeds every document again once allowed
+	conf.VectorDimension = 32
+	_, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.ErrorIs(t, err, knowledge.ErrEmbeddingSettingsChanged)
+	assert.ErrorContains(t, err, "sqliteResetEmbeddings")
+
+	conf.SqliteResetEmbeddings = true
+	indexed = index()
+	assert.Len(t, indexed.IndexSummary.Updated, 2)
+}
+
+func TestNewStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	conf := config.NewKnowledgeConfig()
+
+	// The default database is kept in the home directory
+	store, err := knowledge.NewStore(conf, 16, slog.Default())
+	require.NoError(t, err)
+	assert.IsType(t, &knowledge.SqliteStore{}, store)
+	require.NoError(t, store.Close())
+	assert.FileExists(t, filepath.Join(home, ".agentruntime", "knowledge.db"))
+
+	conf.SqliteEnabled = false
+	store, err = knowledge.NewStore(conf, 16, slog.Default())
+	require.NoError(t, err)
+	assert.IsType(t, &knowledge.InMemoryStore{}, store)
+
+	conf.PgvectorEnabled = true
+	_, err = knowledge.NewStore(conf, 16, slog.Default())
+	require.ErrorContains(t, err, "DSN is required")
+
+	conf.PgvectorDSN = "postgres://localhost/knowledge"
+	conf.PgvectorIndexType = "annoy"
+	_, err = knowledge.NewStore(conf, 16, slog.Default())
+	require.ErrorContains(t, err, "unsupported pgvector index type")
+}
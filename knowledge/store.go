@@ -2,23 +2,104 @@ package knowledge
 
 import (
 	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
 )
 
+// ErrEmbeddingSettingsChanged is returned when a store holds embeddings of another
+// dimension or embedder than the one it is opened for
+var ErrEmbeddingSettingsChanged = errors.New("embedding settings changed")
+
 // Store defines the interface for complete knowledge storage operations
 type Store interface {
 	// Store stores or updates knowledge items with their embeddings
 	// This should be atomic - either all items are stored or none
 	Store(ctx context.Context, knowledge *Knowledge) error
 
-	// Search performs semantic search and returns matching results
-	Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error)
+	// Upsert stores knowledge incrementally. Documents without embeddings keep the
+	// embeddings stored under their ID, and the stored documents of the knowledge
+	// missing from knowledge.Documents are removed.
+	Upsert(ctx context.Context, knowledge *Knowledge) error
+
+	// GetDocumentHashes returns the content hashes of the stored documents of a
+	// knowledge keyed by document ID, or an empty map if it is not stored
+	GetDocumentHashes(ctx context.Context, knowledgeId string) (map[string]string, error)
+
+	// Search performs semantic search and returns matching results. Unless filter
+	// is nil, only documents whose metadata matches it are searched.
+	Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error)
+
+	// KeywordSearch performs full-text search over the embedding texts of
+	// documents and returns the results ranked by relevance, such as BM25, best
+	// first. Unless filter is nil, only documents whose metadata matches it are searched.
+	KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error)
 
 	// GetKnowledgeById retrieves all knowledge items for a specific agent
 	GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error)
 
+	// GetDocumentEmbeddings returns the embeddings of the stored documents of a
+	// knowledge keyed by document ID, or an empty map if it is not stored
+	GetDocumentEmbeddings(ctx context.Context, knowledgeId string) (map[string][]float32, error)
+
+	// ListKnowledgeIds returns the IDs of all stored knowledge, sorted
+	ListKnowledgeIds(ctx context.Context) ([]string, error)
+
 	// DeleteKnowledgeById removes all knowledge for a specific agent
 	DeleteKnowledgeById(ctx context.Context, knowledgeId string) error
 
 	// Close closes the knowledge store and releases resources
 	Close() error
 }
+
+// NewStore creates the knowledge store selected by the knowledge configuration:
+// a PgvectorStore if PgvectorEnabled, else a SqliteStore at SqlitePath if
+// SqliteEnabled, else an InMemoryStore. dimension is the embedding size of the
+// configured embedder.
+func NewStore(conf *config.KnowledgeConfig, dimension int, logger *slog.Logger) (Store, error) {
+	if conf.PgvectorEnabled {
+		store, err := NewPgvectorStore(conf.PgvectorDSN, dimension, PgvectorOptionsFromConfig(conf))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create pgvector knowledge store")
+		}
+		return store, nil
+	}
+
+	if !conf.SqliteEnabled {
+		return NewInMemoryStore(), nil
+	}
+
+	path := conf.SqlitePath
+	if path == "" {
+		path = ":memory:"
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve home directory")
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, errors.Wrapf(err, "failed to create knowledge database directory")
+		}
+	}
+
+	store, err := NewSqliteStore(path, dimension,
+		WithEmbedderID(embedderID(conf)),
+		WithEmbeddingReset(conf.SqliteResetEmbeddings),
+		WithLogger(logger),
+	)
+	if errors.Is(err, ErrEmbeddingSettingsChanged) {
+		return nil, errors.Wrapf(err, "knowledge database %s was indexed with another embedder; enable sqliteResetEmbeddings to drop its embeddings and index the knowledge again", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create sqlite knowledge store")
+	}
+	return store, nil
+}
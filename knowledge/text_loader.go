@@ -0,0 +1,536 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/mokiat/gog"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+var (
+	markdownSyntaxPattern = regexp.MustCompile("(?m)^(#{1,6}[ \t]|```|~~~|[-*+][ \t]|\\d+\\.[ \t])")
+	blankLinesPattern     = regexp.MustCompile(`\n{3,}`)
+	spacesPattern         = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+	// htmlBoilerplateTags are elements that hold navigation, scripts or forms
+	// rather than the content of a page
+	htmlBoilerplateTags = map[string]bool{
+		"script": true, "style": true, "noscript": true, "template": true,
+		"nav": true, "header": true, "footer": true, "aside": true,
+		"form": true, "button": true, "iframe": true, "svg": true,
+	}
+	htmlBlockTags = map[string]bool{
+		"p": true, "div": true, "section": true, "article": true, "main": true,
+		"ul": true, "ol": true, "table": true, "tr": true, "blockquote": true,
+		"dl": true, "dt": true, "dd": true, "figure": true, "figcaption": true,
+	}
+)
+
+// IndexKnowledgeFromText indexes markdown, HTML, JSON or plain text documents, detecting the type of each
+func (s *service) IndexKnowledgeFromText(ctx context.Context, id string, inputs []string) (*Knowledge, error) {
+	knowledge := &Knowledge{
+		ID:       id,
+		Metadata: map[string]any{},
+	}
+
+	var sourceTypes []string
+	for i, input := range inputs {
+		sourceType := DetectSourceType("", []byte(input))
+		documents, err := s.processSource([]byte(input), sourceType, RecordOptions{}, documentIDPrefix(id, fmt.Sprintf("text_%d", i+1)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process text %d", i+1)
+		}
+		knowledge.Documents = append(knowledge.Documents, documents...)
+		sourceTypes = append(sourceTypes, sourceType)
+	}
+	knowledge.Metadata[MetadataKeySourceType] = knowledgeSourceType(sourceTypes)
+
+	if err := s.upsertKnowledge(ctx, knowledge); err != nil {
+		return nil, err
+	}
+
+	return knowledge, nil
+}
+
+// IndexKnowledgeFromFiles indexes PDF, markdown, HTML, plain text, CSV, TSV, JSON,
+// JSONL, DOCX and image files. The type of each file is detected from its extension and
+// content unless opts.Type is set. If the files, opts and the indexing settings
+// are the same as when the knowledge was last indexed, the stored knowledge is
+// returned without processing the files again. Otherwise only the documents
+// that changed are embedded again.
+func (s *service) IndexKnowledgeFromFiles(ctx context.Context, id string, paths []string, opts LoaderOptions) (*Knowledge, error) {
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read knowledge file %s", path)
+		}
+		files[i] = data
+	}
+
+	// Files that did not change since they were indexed are not embedded again
+	fingerprint := s.filesFingerprint(paths, files, opts)
+	if id != "" {
+		if existing, err := s.store.GetKnowledgeById(ctx, id); err == nil && existing != nil && existing.Metadata[MetadataKeyFingerprint] == fingerprint {
+			s.logger.Debug("knowledge files are unchanged, skipping indexing", "knowledge_id", id)
+			existing.IndexSummary = &IndexSummary{
+				Unchanged: gog.Map(existing.Documents, func(d *Document) string { return d.ID }),
+			}
+			return existing, nil
+		}
+	}
+
+	knowledge := &Knowledge{
+		ID: id,
+		Metadata: map[string]any{
+			MetadataKeyFingerprint: fingerprint,
+		},
+	}
+
+	var (
+		sourceTypes []string
+		pdfs        []int
+	)
+	for i, path := range paths {
+		sourceType := opts.Type
+		if sourceType == "" {
+			sourceType = DetectSourceType(path, files[i])
+		}
+		sourceTypes = append(sourceTypes, sourceType)
+		if sourceType == SourceTypePDF {
+			pdfs = append(pdfs, i)
+			continue
+		}
+
+		documents, err := s.processSource(files[i], sourceType, opts.RecordOptions, documentIDPrefix(id, "file_"+filepath.ToSlash(path)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process knowledge file %s", path)
+		}
+		for _, doc := range documents {
+			if _, ok := doc.Metadata[MetadataKeySourceFilename]; !ok {
+				doc.Metadata[MetadataKeySourceFilename] = filepath.Base(path)
+			}
+		}
+		knowledge.Documents = append(knowledge.Documents, documents...)
+	}
+
+	if len(pdfs) > 0 {
+		inputs := make([]io.Reader, 0, len(pdfs))
+		for _, i := range pdfs {
+			inputs = append(inputs, bytes.NewReader(files[i]))
+		}
+
+		pdfKnowledge, err := extractKnowledgeFromPDFs(ctx, s.genkit, id, inputs, s.logger, s.config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process knowledge from PDFs")
+		}
+		for _, doc := range pdfKnowledge.Documents {
+			if pdfNumber, _ := doc.Metadata["pdf_number"].(int); pdfNumber > 0 && pdfNumber <= len(pdfs) {
+				doc.Metadata[MetadataKeySourceFilename] = filepath.Base(paths[pdfs[pdfNumber-1]])
+			}
+		}
+		knowledge.Metadata = gog.Merge(pdfKnowledge.Metadata, knowledge.Metadata)
+		knowledge.Documents = append(knowledge.Documents, pdfKnowledge.Documents...)
+	}
+	knowledge.Metadata[MetadataKeySourceType] = knowledgeSourceType(sourceTypes)
+
+	if err := s.upsertKnowledge(ctx, knowledge); err != nil {
+		return nil, err
+	}
+
+	return knowledge, nil
+}
+
+// processSource parses a source of the given type into chunked documents.
+// Markdown, HTML and DOCX are chunked by headings unless chunking is disabled.
+// Unless idPrefix is empty, documents are identified by it and their record
+// number so they keep their IDs when the source is indexed again.
+func (s *service) processSource(data []byte, sourceType string, opts RecordOptions, idPrefix string) ([]*Document, error) {
+	var (
+		documents []*Document
+		err       error
+	)
+	switch sourceType {
+	case SourceTypeCSV, SourceTypeTSV, SourceTypeJSON, SourceTypeJSONL:
+		documents, err = ProcessDocumentsFromRecordSource(data, sourceType, opts)
+	case SourceTypeImage:
+		// Images are embedded whole
+		document, err := ProcessDocumentFromImage(data)
+		if err != nil {
+			return nil, err
+		}
+		if idPrefix != "" {
+			document.ID = idPrefix
+		}
+		return []*Document{document}, nil
+	default:
+		var document *Document
+		if sourceType == SourceTypeDOCX {
+			document, err = ProcessDocumentFromDOCX(data)
+		} else {
+			document, err = ProcessDocumentFromText(string(data), sourceType)
+		}
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if idPrefix != "" {
+		for _, doc := range documents {
+			doc.ID = idPrefix
+			if recordNumber, ok := doc.Metadata[MetadataKeyRecordNumber]; ok {
+				doc.ID = fmt.Sprintf("%s_record_%d", idPrefix, recordNumber)
+			}
+		}
+	}
+
+	chunker := s.chunker
+	switch sourceType {
+	case SourceTypeMarkdown, SourceTypeHTML, SourceTypeDOCX:
+		// Documents with headings are always split into their sections
+		if chunker, err = newSectionChunker(s.config); err != nil {
+			return nil, err
+		}
+	}
+
+	return ChunkDocuments(documents, chunker), nil
+}
+
+// documentIDPrefix returns the prefix of the IDs of the documents of a source of
+// knowledge, or an empty prefix if the knowledge has no ID yet
+func documentIDPrefix(knowledgeId string, source string) string {
+	if knowledgeId == "" {
+		return ""
+	}
+	return knowledgeId + "_" + source
+}
+
+// knowledgeSourceType returns the source type shared by all sources, or
+// SourceTypeMixed when the sources differ
+func knowledgeSourceType(sourceTypes []string) string {
+	if len(sourceTypes) == 0 {
+		return SourceTypeText
+	}
+	for _, sourceType := range sourceTypes[1:] {
+		if sourceType != sourceTypes[0] {
+			return SourceTypeMixed
+		}
+	}
+	return sourceTypes[0]
+}
+
+// DetectSourceType detects the source type of a knowledge file from its file
+// name, which may be empty, and its content
+func DetectSourceType(filename string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pdf":
+		return SourceTypePDF
+	case ".md", ".markdown", ".mdx":
+		return SourceTypeMarkdown
+	case ".html", ".htm", ".xhtml":
+		return SourceTypeHTML
+	case ".txt", ".text":
+		return SourceTypeText
+	case ".csv":
+		return SourceTypeCSV
+	case ".tsv", ".tab":
+		return SourceTypeTSV
+	case ".json":
+		return SourceTypeJSON
+	case ".jsonl", ".ndjson":
+		return SourceTypeJSONL
+	case ".docx":
+		return SourceTypeDOCX
+	case ".jpg", ".jpeg", ".png", ".webp":
+		return SourceTypeImage
+	}
+
+	switch contentType := http.DetectContentType(content); {
+	case contentType == "application/pdf":
+		return SourceTypePDF
+	case strings.HasPrefix(contentType, "text/html"):
+		return SourceTypeHTML
+	case contentType == "application/zip" && bytes.Contains(content, []byte("word/")):
+		return SourceTypeDOCX
+	case imageMIMETypes[contentType]:
+		return SourceTypeImage
+	}
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		if json.Valid(trimmed) {
+			return SourceTypeJSON
+		}
+		if trimmed[0] == '{' {
+			return SourceTypeJSONL
+		}
+	}
+
+	if _, _, ok := splitFrontMatter(string(content)); ok || markdownSyntaxPattern.Match(content) {
+		return SourceTypeMarkdown
+	}
+	return SourceTypeText
+}
+
+// ProcessDocumentFromText converts a markdown, HTML or plain text into an
+// unchunked document whose embedding text is markdown or plain text. YAML front
+// matter and HTML head information are captured as metadata, with the title and
+// URL under MetadataKeySourceTitle and MetadataKeySourceURL. It returns nil if the
+// text has no content.
+func ProcessDocumentFromText(input string, sourceType string) (*Document, error) {
+	metadata := map[string]any{
+		MetadataKeySourceType: sourceType,
+	}
+
+	var text string
+	switch sourceType {
+	case SourceTypeMarkdown, SourceTypeText:
+		frontMatter, body, ok := splitFrontMatter(input)
+		if ok {
+			var values map[string]any
+			if err := yaml.Unmarshal([]byte(frontMatter), &values); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse front matter")
+			}
+			for k, v := range values {
+				switch strings.ToLower(k) {
+				case "title":
+					metadata[MetadataKeySourceTitle] = v
+				case "url", "link", "source_url":
+					metadata[MetadataKeySourceURL] = v
+				default:
+					metadata[k] = v
+				}
+			}
+		}
+		text = body
+	case SourceTypeHTML:
+		page, err := extractHTML(input)
+		if err != nil {
+			return nil, err
+		}
+		if page.title != "" {
+			metadata[MetadataKeySourceTitle] = page.title
+		}
+		if page.url != "" {
+			metadata[MetadataKeySourceURL] = page.url
+		}
+		if page.description != "" {
+			metadata["description"] = page.description
+		}
+		text = page.text
+	default:
+		return nil, errors.Errorf("unsupported text source type: %s", sourceType)
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	return &Document{
+		Content: Content{
+			MIMEType: "text/plain",
+			Text:     text,
+		},
+		Metadata:      metadata,
+		EmbeddingText: text,
+	}, nil
+}
+
+// splitFrontMatter splits YAML front matter delimited by "---" lines from the body of a text
+func splitFrontMatter(text string) (frontMatter string, body string, ok bool) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	rest, found := strings.CutPrefix(text, "---\n")
+	if !found {
+		if rest, found = strings.CutPrefix(text, "---\r\n"); !found {
+			return "", text, false
+		}
+	}
+
+	for offset := 0; offset < len(rest); {
+		end := strings.IndexByte(rest[offset:], '\n')
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += offset + 1
+		}
+		if line := strings.TrimRight(rest[offset:end], "\r\n"); line == "---" || line == "..." {
+			return rest[:offset], rest[end:], true
+		}
+		offset = end
+	}
+
+	return "", text, false
+}
+
+// htmlPage is the content of an HTML page without its boilerplate
+type htmlPage struct {
+	title       string
+	url         string
+	description string
+	// text is the content of the page as markdown, keeping headings, lists and links
+	text string
+}
+
+// extractHTML strips scripts, navigation and other boilerplate from an HTML
+// page and renders its main content as markdown
+func extractHTML(input string) (*htmlPage, error) {
+	root, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse HTML")
+	}
+
+	page := &htmlPage{}
+	var main, article, body *html.Node
+	for n := range root.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.Data {
+		case "title":
+			if page.title == "" {
+				page.title = strings.TrimSpace(spacesPattern.ReplaceAllString(nodeText(n), " "))
+			}
+		case "meta":
+			if name := strings.ToLower(attr(n, "name")); name == "description" || attr(n, "property") == "og:description" {
+				if page.description == "" {
+					page.description = attr(n, "content")
+				}
+			}
+		case "link":
+			if strings.EqualFold(attr(n, "rel"), "canonical") {
+				page.url = attr(n, "href")
+			}
+		case "main":
+			if main == nil {
+				main = n
+			}
+		case "article":
+			if article == nil {
+				article = n
+			}
+		case "body":
+			body = n
+		}
+	}
+
+	content := root
+	for _, n := range []*html.Node{main, article, body} {
+		if n != nil {
+			content = n
+			break
+		}
+	}
+
+	var sb strings.Builder
+	renderMarkdown(&sb, content)
+	text := blankLinesPattern.ReplaceAllString(sb.String(), "\n\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	page.text = strings.TrimSpace(strings.Join(lines, "\n"))
+
+	return page, nil
+}
+
+// renderMarkdown writes the content of n as markdown, skipping boilerplate elements
+func renderMarkdown(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(spacesPattern.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			renderMarkdown(sb, c)
+		}
+		return
+	default:
+		return
+	}
+
+	if htmlBoilerplateTags[n.Data] || n.Data == "head" {
+		return
+	}
+
+	renderChildren := func() {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			renderMarkdown(sb, c)
+		}
+	}
+
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		sb.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		sb.WriteString(strings.TrimSpace(spacesPattern.ReplaceAllString(nodeText(n), " ")))
+		sb.WriteString("\n\n")
+	case "a":
+		text := strings.TrimSpace(spacesPattern.ReplaceAllString(nodeText(n), " "))
+		href := attr(n, "href")
+		if text == "" {
+			return
+		}
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			sb.WriteString(text)
+			return
+		}
+		sb.WriteString("[" + text + "](" + href + ")")
+	case "li":
+		sb.WriteString("\n- ")
+		renderChildren()
+		sb.WriteString("\n")
+	case "pre":
+		sb.WriteString("\n\n```\n" + strings.Trim(nodeText(n), "\n") + "\n```\n\n")
+	case "br":
+		sb.WriteString("\n")
+	case "td", "th":
+		renderChildren()
+		sb.WriteString(" | ")
+	case "img":
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			sb.WriteString(alt)
+		}
+	default:
+		if htmlBlockTags[n.Data] {
+			sb.WriteString("\n\n")
+			renderChildren()
+			sb.WriteString("\n\n")
+			return
+		}
+		renderChildren()
+	}
+}
+
+// nodeText returns the raw text under n
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			sb.WriteString(d.Data)
+		}
+	}
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
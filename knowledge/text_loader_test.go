@@ -0,0 +1,145 @@
+package knowledge_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMarkdown = `---
+title: Installation Guide
+url: https://example.com/docs/install
+tags: [setup, linux]
+---
+
+# Install
+
+Download the binary from the releases page.
+
+## Linux
+
+Run ` + "`install.sh`" + ` as root.
+`
+
+const testHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Pricing | Example</title>
+  <meta name="description" content="Plans and prices">
+  <link rel="canonical" href="https://example.com/pricing">
+  <script>var tracking = true;</script>
+</head>
+<body>
+  <nav><a href="/">Home</a> <a href="/docs">Docs</a></nav>
+  <main>
+    <h1>Pricing</h1>
+    <p>The <a href="https://example.com/pro">Pro plan</a> costs $10 per month.</p>
+    <ul><li>Unlimited agents</li><li>Priority support</li></ul>
+  </main>
+  <footer>Copyright Example</footer>
+</body>
+</html>`
+
+func TestDetectSourceType(t *testing.T) {
+	assert.Equal(t, knowledge.SourceTypeMarkdown, knowledge.DetectSourceType("guide.md", []byte("plain words")))
+	assert.Equal(t, knowledge.SourceTypeHTML, knowledge.DetectSourceType("index.htm", nil))
+	assert.Equal(t, knowledge.SourceTypePDF, knowledge.DetectSourceType("paper.PDF", nil))
+	assert.Equal(t, knowledge.SourceTypeText, knowledge.DetectSourceType("notes.txt", []byte("# not markdown")))
+
+	assert.Equal(t, knowledge.SourceTypeHTML, knowledge.DetectSourceType("", []byte(testHTML)))
+	assert.Equal(t, knowledge.SourceTypeMarkdown, knowledge.DetectSourceType("", []byte(testMarkdown)))
+	assert.Equal(t, knowledge.SourceTypeMarkdown, knowledge.DetectSourceType("", []byte("Steps:\n\n- one\n- two")))
+	assert.Equal(t, knowledge.SourceTypePDF, knowledge.DetectSourceType("", []byte("%PDF-1.7\n")))
+	assert.Equal(t, knowledge.SourceTypeText, knowledge.DetectSourceType("", []byte("Just a sentence.")))
+}
+
+func TestProcessDocumentFromText_Markdown(t *testing.T) {
+	doc, err := knowledge.ProcessDocumentFromText(testMarkdown, knowledge.SourceTypeMarkdown)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+
+	assert.Equal(t, "Installation Guide", doc.Metadata[knowledge.MetadataKeySourceTitle])
+	assert.Equal(t, "https://example.com/docs/install", doc.Metadata[knowledge.MetadataKeySourceURL])
+	assert.Equal(t, knowledge.SourceTypeMarkdown, doc.Metadata[knowledge.MetadataKeySourceType])
+	assert.Equal(t, []any{"setup", "linux"}, doc.Metadata["tags"])
+	assert.NotContains(t, doc.EmbeddingText, "title:")
+	assert.True(t, len(doc.EmbeddingText) > 0 && doc.EmbeddingText[0] == '#')
+}
+
+func TestProcessDocumentFromText_HTML(t *testing.T) {
+	doc, err := knowledge.ProcessDocumentFromText(testHTML, knowledge.SourceTypeHTML)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+
+	assert.Equal(t, "Pricing | Example", doc.Metadata[knowledge.MetadataKeySourceTitle])
+	assert.Equal(t, "https://example.com/pricing", doc.Metadata[knowledge.MetadataKeySourceURL])
+	assert.Equal(t, "Plans and prices", doc.Metadata["description"])
+
+	assert.Contains(t, doc.EmbeddingText, "# Pricing")
+	assert.Contains(t, doc.EmbeddingText, "[Pro plan](https://example.com/pro) costs $10 per month.")
+	assert.Contains(t, doc.EmbeddingText, "- Unlimited agents")
+	assert.NotContains(t, doc.EmbeddingText, "tracking")
+	assert.NotContains(t, doc.EmbeddingText, "Home")
+	assert.NotContains(t, doc.EmbeddingText, "Copyright")
+}
+
+func TestProcessDocumentFromText_Empty(t *testing.T) {
+	doc, err := knowledge.ProcessDocumentFromText("---\ntitle: Empty\n---\n", knowledge.SourceTypeMarkdown)
+	require.NoError(t, err)
+	assert.Nil(t, doc)
+}
+
+func TestService_IndexKnowledgeFromFiles(t *testing.T) {
+	ctx := t.Context()
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.SqlitePath = ":memory:"
+	conf.RerankEnabled = false
+	service, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer service.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "install.md"), []byte(testMarkdown), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pricing.html"), []byte(testHTML), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Support is available on weekdays."), 0o644))
+
+	result, err := service.IndexKnowledgeFromFiles(ctx, "docs", []string{
+		filepath.Join(dir, "install.md"),
+		filepath.Join(dir, "pricing.html"),
+		filepath.Join(dir, "notes.txt"),
+	}, knowledge.LoaderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, knowledge.SourceTypeMixed, result.Metadata[knowledge.MetadataKeySourceType])
+
+	headings := map[any]bool{}
+	filenames := map[any]bool{}
+	for _, doc := range result.Documents {
+		assert.NotEmpty(t, doc.Embeddings)
+		headings[doc.Metadata[knowledge.MetadataKeyHeading]] = true
+		filenames[doc.Metadata[knowledge.MetadataKeySourceFilename]] = true
+	}
+	assert.True(t, headings["Install"])
+	assert.True(t, headings["Install > Linux"])
+	assert.True(t, headings["Pricing"])
+	assert.Equal(t, map[any]bool{"install.md": true, "pricing.html": true, "notes.txt": true}, filenames)
+
+	results, err := service.RetrieveRelevantKnowledge(ctx, "Pro plan price per month", 1, []string{"docs"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "pricing.html", results[0].Metadata[knowledge.MetadataKeySourceFilename])
+
+	_, err = service.IndexKnowledgeFromText(ctx, "inline", []string{"<html><body><p>Hello</p></body></html>"})
+	require.NoError(t, err)
+	stored, err := service.GetKnowledge(ctx, "inline")
+	require.NoError(t, err)
+	assert.Equal(t, knowledge.SourceTypeHTML, stored.Metadata[knowledge.MetadataKeySourceType])
+}
@@ -2,6 +2,7 @@ package knowledge
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/mokiat/gog"
@@ -12,6 +13,19 @@ type (
 		ID        string         `json:"id"`
 		Metadata  map[string]any `json:"metadata"`
 		Documents []*Document    `json:"documents"`
+
+		// IndexSummary reports how the documents changed when the knowledge was
+		// indexed. It is not stored.
+		IndexSummary *IndexSummary `json:"indexSummary,omitempty"`
+	}
+
+	// IndexSummary lists the IDs of the documents added, updated, removed and
+	// left unchanged by indexing knowledge again
+	IndexSummary struct {
+		Added     []string `json:"added,omitempty"`
+		Updated   []string `json:"updated,omitempty"`
+		Removed   []string `json:"removed,omitempty"`
+		Unchanged []string `json:"unchanged,omitempty"`
 	}
 
 	Document struct {
@@ -20,6 +34,9 @@ type (
 		Embeddings    []float32      `json:"embeddings"`
 		EmbeddingText string         `json:"embeddingText"`
 		Metadata      map[string]any `json:"metadata"`
+		// ContentHash identifies the content of the document and how it was embedded,
+		// so unchanged documents keep their embeddings when indexed again
+		ContentHash string `json:"contentHash,omitempty"`
 	}
 
 	KnowledgeSearchResult struct {
@@ -38,14 +55,33 @@ type (
 
 const (
 	// Source type constants for metadata
-	SourceTypeMap = "map"
-	SourceTypePDF = "pdf"
+	SourceTypeMap      = "map"
+	SourceTypePDF      = "pdf"
+	SourceTypeMarkdown = "markdown"
+	SourceTypeHTML     = "html"
+	SourceTypeText     = "text"
+	SourceTypeCSV      = "csv"
+	SourceTypeTSV      = "tsv"
+	SourceTypeJSON     = "json"
+	SourceTypeJSONL    = "jsonl"
+	SourceTypeDOCX     = "docx"
+	// SourceTypeImage is the source type of JPEG, PNG and WebP images
+	SourceTypeImage = "image"
+	// SourceTypeMixed is the source type of knowledge indexed from sources of different types
+	SourceTypeMixed = "mixed"
 
 	// Metadata keys for source information
 	MetadataKeySourceTitle    = "source_title"
 	MetadataKeySourceURL      = "source_url"
 	MetadataKeySourceFilename = "source_filename"
 	MetadataKeySourceType     = "source_type"
+	MetadataKeyPageNumber     = "page_number"
+
+	// MetadataKeyEmbeddingSpace is the document metadata key of the embedding space
+	// of documents not embedded from their text, e.g. EmbeddingSpaceVision
+	MetadataKeyEmbeddingSpace = "embedding_space"
+	// EmbeddingSpaceVision marks images and PDF pages embedded by an ImageEmbedder
+	EmbeddingSpaceVision = "vision"
 
 	ContentTypeText  ContentType = "text"
 	ContentTypeImage ContentType = "image"
@@ -62,7 +98,7 @@ func (d *Document) ToDoc() (*ai.Document, error) {
 	case "text/plain", "plain/text":
 		doc.Content = append(doc.Content, ai.NewTextPart(d.Content.Text))
 	case "image/jpeg", "image/jpg", "image/png", "image/webp":
-		doc.Content = append(doc.Content, ai.NewMediaPart(d.Content.MIMEType, d.Content.Image))
+		doc.Content = append(doc.Content, ai.NewMediaPart(d.Content.MIMEType, d.Content.DataURL()))
 	default:
 		return nil, fmt.Errorf("unknown content type: %s", d.Content.MIMEType)
 	}
@@ -79,3 +115,12 @@ func (c *Content) Type() ContentType {
 	}
 	return ""
 }
+
+// DataURL returns the image of the content as a base64 data URL, the form of
+// media parts that model plugins accept
+func (c *Content) DataURL() string {
+	if c.Image == "" || strings.HasPrefix(c.Image, "data:") {
+		return c.Image
+	}
+	return "data:" + c.MIMEType + ";base64," + c.Image
+}
@@ -0,0 +1,423 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type (
+	ConsolidationAction = string
+
+	// ConsolidationDecision is how a cluster of near-duplicate memories is resolved
+	ConsolidationDecision struct {
+		Action ConsolidationAction `json:"action" jsonschema:"required,enum=merge,enum=supersede,enum=keep,description=merge: the memories state the same fact and become one memory. supersede: the memories contradict each other and the older ones are outdated. keep: the memories are distinct facts."`
+		Key    string              `json:"key,omitempty" jsonschema:"description=merge: the key of the merged memory (prefer an existing key). supersede: the key of the memory that is still current."`
+		Value  string              `json:"value,omitempty" jsonschema:"description=merge: the value of the merged memory, keeping every detail of the originals"`
+		Tags   []string            `json:"tags,omitempty" jsonschema:"description=merge: the tags of the merged memory"`
+		// Superseded lists the outdated memory keys for the supersede action
+		Superseded []string `json:"superseded,omitempty" jsonschema:"description=supersede: the keys of the outdated memories"`
+		Reason     string   `json:"reason" jsonschema:"required,description=Short explanation of the decision"`
+	}
+
+	// Consolidator decides how to resolve a cluster of near-duplicate memories
+	Consolidator interface {
+		Resolve(ctx context.Context, memories []*Memory) (*ConsolidationDecision, error)
+	}
+
+	// GenkitConsolidator resolves clusters with an LLM
+	GenkitConsolidator struct {
+		genkit *genkit.Genkit
+		model  string
+	}
+
+	// Consolidation is the audit record of a resolved cluster with its before and after views
+	Consolidation struct {
+		ID        string              `json:"id"`
+		Namespace string              `json:"namespace,omitempty"`
+		Action    ConsolidationAction `json:"action"`
+		Reason    string              `json:"reason,omitempty"`
+		Before    []*Memory           `json:"before"`
+		After     []*Memory           `json:"after"`
+		CreatedAt time.Time           `json:"created_at"`
+	}
+
+	ConsolidateOptions struct {
+		// Threshold is the minimum cosine similarity for memories to be clustered.
+		// MemoryConfig.ConsolidationThreshold is used when 0.
+		Threshold float64
+		// Consolidator resolves the clusters; the GenerationModel is used when nil
+		Consolidator Consolidator
+	}
+
+	ConsolidationTemplateData struct {
+		Memories []*Memory
+	}
+)
+
+const (
+	ConsolidationActionMerge     ConsolidationAction = "merge"
+	ConsolidationActionSupersede ConsolidationAction = "supersede"
+	ConsolidationActionKeep      ConsolidationAction = "keep"
+)
+
+const consolidationPromptTemplate = `These memories were stored separately but look alike. Decide how to resolve them:
+
+- merge: they state the same fact (e.g. user_location_city and user_city_current). Write one memory that keeps every detail.
+- supersede: they contradict each other because the fact changed (e.g. an old and a new coffee preference). Keep the most recent one current.
+- keep: they are different facts that only look alike.
+
+Memories:
+{{- range .Memories}}
+- key: {{.Key}}
+  value: {{.Value}}
+  {{- if .Tags}}
+  tags: {{join .Tags ", "}}
+  {{- end}}
+  source: {{.Source}}
+  updated: {{.UpdatedAt.Format "2006-01-02T15:04:05Z07:00"}}
+{{- end}}`
+
+var (
+	_ Consolidator = (*GenkitConsolidator)(nil)
+
+	consolidationTmpl = template.Must(template.New("consolidationPrompt").
+				Funcs(template.FuncMap{"join": strings.Join}).
+				Parse(consolidationPromptTemplate))
+)
+
+// NewGenkitConsolidator creates a consolidator using the given genkit model
+func NewGenkitConsolidator(genkit *genkit.Genkit, model string) Consolidator {
+	return &GenkitConsolidator{
+		genkit: genkit,
+		model:  model,
+	}
+}
+
+func (c *GenkitConsolidator) Resolve(ctx context.Context, memories []*Memory) (*ConsolidationDecision, error) {
+	var promptBuffer bytes.Buffer
+	if err := consolidationTmpl.Execute(&promptBuffer, ConsolidationTemplateData{Memories: memories}); err != nil {
+		return nil, err
+	}
+
+	var output ConsolidationDecision
+	response, err := genkit.Generate(
+		ctx, c.genkit,
+		ai.WithModelName(c.model),
+		ai.WithPrompt(strings.TrimSpace(promptBuffer.String())),
+		ai.WithOutputType(&output),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := response.Output(&output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// Consolidate clusters near-duplicate memories of the current namespace by
+// embedding and merges them or marks the outdated ones superseded. Every change
+// is recorded as a Consolidation with its before and after views.
+func (s *service) Consolidate(ctx context.Context, opts ConsolidateOptions) ([]*Consolidation, error) {
+	return s.consolidateNamespace(ctx, s.namespace(ctx), opts)
+}
+
+// ListConsolidations returns the consolidation audit records of the current namespace
+func (s *service) ListConsolidations(ctx context.Context) ([]*Consolidation, error) {
+	consolidations, err := s.store.ListConsolidations(ctx, s.namespace(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list consolidations")
+	}
+
+	return consolidations, nil
+}
+
+// consolidateAll consolidates every namespace, used by the scheduled job. A
+// namespace that fails to consolidate is logged and skipped so that it does
+// not hold back the others.
+func (s *service) consolidateAll(ctx context.Context) error {
+	namespaces, err := s.store.ListNamespaces(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list namespaces")
+	}
+
+	for _, namespace := range namespaces {
+		consolidations, err := s.consolidateNamespace(ctx, namespace, ConsolidateOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Warn("failed to consolidate memories", "namespace", namespace, "error", err)
+		}
+		if len(consolidations) > 0 {
+			s.logger.Info("consolidated memories", "namespace", namespace, "count", len(consolidations))
+		}
+	}
+
+	return nil
+}
+
+func (s *service) consolidateNamespace(ctx context.Context, namespace string, opts ConsolidateOptions) ([]*Consolidation, error) {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = s.memoryConfig.ConsolidationThreshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		return nil, errors.Errorf("consolidation threshold must be in (0, 1], got %v", threshold)
+	}
+
+	consolidator := opts.Consolidator
+	if consolidator == nil {
+		consolidator = NewGenkitConsolidator(s.genkit, s.memoryConfig.GenerationModel)
+	}
+
+	list, err := s.store.List(ctx, namespace, ListOptions{ActiveOnly: true})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list memories")
+	}
+
+	memories := slices.DeleteFunc(list.Memories, func(memory *Memory) bool {
+		return len(memory.Embedding) == 0
+	})
+
+	var consolidations []*Consolidation
+	for _, cluster := range clusterMemories(memories, threshold) {
+		decision, err := consolidator.Resolve(ctx, cluster)
+		if err != nil {
+			return consolidations, errors.Wrapf(err, "failed to resolve memories %s", strings.Join(memoryKeys(cluster), ", "))
+		}
+
+		consolidation, err := s.applyConsolidation(ctx, namespace, cluster, decision)
+		if err != nil {
+			return consolidations, err
+		}
+		if consolidation != nil {
+			consolidations = append(consolidations, consolidation)
+		}
+	}
+
+	return consolidations, nil
+}
+
+// applyConsolidation stores the outcome of a decision and its audit record.
+// It returns nil when the memories are kept as they are.
+func (s *service) applyConsolidation(ctx context.Context, namespace string, cluster []*Memory, decision *ConsolidationDecision) (*Consolidation, error) {
+	byKey := make(map[string]*Memory, len(cluster))
+	before := make([]*Memory, 0, len(cluster))
+	for _, memory := range cluster {
+		byKey[memory.Key] = memory
+		before = append(before, snapshot(memory))
+	}
+
+	now := time.Now()
+	consolidation := &Consolidation{
+		ID:        uuid.NewString(),
+		Namespace: namespace,
+		Action:    decision.Action,
+		Reason:    decision.Reason,
+		Before:    before,
+		CreatedAt: now,
+	}
+
+	switch decision.Action {
+	case ConsolidationActionKeep:
+		return nil, nil
+	case ConsolidationActionMerge:
+		if decision.Key == "" || decision.Value == "" {
+			return nil, errors.New("merge decision requires a key and a value")
+		}
+		if _, ok := byKey[decision.Key]; !ok {
+			if _, err := s.store.Get(ctx, namespace, decision.Key); err == nil {
+				return nil, errors.Errorf("merge decision key '%s' belongs to another memory", decision.Key)
+			} else if !errors.Is(err, ErrMemoryNotFound) {
+				return nil, errors.Wrapf(err, "failed to get memory '%s'", decision.Key)
+			}
+		}
+
+		merged, err := s.mergeMemories(ctx, namespace, cluster, decision, now)
+		if err != nil {
+			return nil, err
+		}
+
+		// The merged memory is stored before the others are deleted, so that a
+		// failure leaves the original memories in place
+		if err := s.store.Replace(ctx, merged); err != nil {
+			return nil, errors.Wrapf(err, "failed to store merged memory")
+		}
+		s.recordMutation(ctx, namespace, MutationConsolidate, byKey[merged.Key], merged)
+		for _, memory := range cluster {
+			if memory.Key == merged.Key {
+				continue
+			}
+			if err := s.store.Delete(ctx, namespace, memory.Key); err != nil {
+				return nil, errors.Wrapf(err, "failed to delete merged memory '%s'", memory.Key)
+			}
+			s.recordMutation(ctx, namespace, MutationConsolidate, memory, nil)
+		}
+		consolidation.After = []*Memory{merged}
+	case ConsolidationActionSupersede:
+		current, ok := byKey[decision.Key]
+		if !ok {
+			return nil, errors.Errorf("supersede decision names unknown current memory '%s'", decision.Key)
+		}
+
+		consolidation.After = []*Memory{current}
+		for _, key := range decision.Superseded {
+			memory, ok := byKey[key]
+			if !ok || key == current.Key {
+				return nil, errors.Errorf("supersede decision names invalid outdated memory '%s'", key)
+			}
+
+			previous := snapshot(memory)
+			memory.SupersededBy = current.Key
+			memory.UpdatedAt = now
+			if err := s.store.Replace(ctx, memory); err != nil {
+				return nil, errors.Wrapf(err, "failed to mark memory '%s' superseded", key)
+			}
+			s.recordMutation(ctx, namespace, MutationConsolidate, previous, memory)
+			consolidation.After = append(consolidation.After, memory)
+		}
+	default:
+		return nil, errors.Errorf("invalid consolidation action: %s", decision.Action)
+	}
+
+	if err := s.store.SaveConsolidation(ctx, consolidation); err != nil {
+		return nil, errors.Wrapf(err, "failed to save consolidation")
+	}
+
+	return consolidation, nil
+}
+
+// mergeMemories builds the merged memory. It keeps the earliest creation time,
+// the highest importance and the latest expiry, and drops the expiry if any
+// of the originals was permanent.
+func (s *service) mergeMemories(ctx context.Context, namespace string, cluster []*Memory, decision *ConsolidationDecision, now time.Time) (*Memory, error) {
+	embeddings, err := s.embedder.EmbedDocuments(ctx, decision.Value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate embedding for merged memory")
+	}
+
+	merged := &Memory{
+		Key:            decision.Key,
+		Value:          decision.Value,
+		Source:         cluster[0].Source,
+		Tags:           decision.Tags,
+		Namespace:      namespace,
+		CreatedAt:      cluster[0].CreatedAt,
+		UpdatedAt:      now,
+		LastAccessedAt: now,
+		Embedding:      embeddings[0],
+	}
+
+	permanent := false
+	for _, memory := range cluster {
+		merged.Importance = max(merged.Importance, memory.Importance)
+		if !memory.CreatedAt.IsZero() && (merged.CreatedAt.IsZero() || memory.CreatedAt.Before(merged.CreatedAt)) {
+			merged.CreatedAt = memory.CreatedAt
+		}
+		if len(decision.Tags) == 0 {
+			for _, tag := range memory.Tags {
+				if !slices.Contains(merged.Tags, tag) {
+					merged.Tags = append(merged.Tags, tag)
+				}
+			}
+		}
+
+		if memory.ExpiresAt == nil {
+			permanent = true
+		} else if merged.ExpiresAt == nil || memory.ExpiresAt.After(*merged.ExpiresAt) {
+			merged.ExpiresAt = memory.ExpiresAt
+		}
+	}
+	if permanent {
+		merged.ExpiresAt = nil
+	}
+
+	return merged, nil
+}
+
+// clusterMemories groups memories whose embeddings are at least threshold
+// similar, directly or through other members. Singletons are dropped.
+func clusterMemories(memories []*Memory, threshold float64) [][]*Memory {
+	sort.Slice(memories, func(i, j int) bool {
+		return memories[i].Key < memories[j].Key
+	})
+
+	parent := make([]int, len(memories))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range memories {
+		for j := i + 1; j < len(memories); j++ {
+			if cosineSimilarity(memories[i].Embedding, memories[j].Embedding) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]*Memory)
+	var roots []int
+	for i, memory := range memories {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], memory)
+	}
+
+	var clusters [][]*Memory
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+
+	return clusters
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func memoryKeys(memories []*Memory) []string {
+	keys := make([]string, 0, len(memories))
+	for _, memory := range memories {
+		keys = append(keys, memory.Key)
+	}
+	return keys
+}
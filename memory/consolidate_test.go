@@ -0,0 +1,171 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsolidator returns decisions by the first key of each cluster
+type fakeConsolidator struct {
+	decisions map[string]*memory.ConsolidationDecision
+	clusters  [][]string
+}
+
+func (c *fakeConsolidator) Resolve(ctx context.Context, memories []*memory.Memory) (*memory.ConsolidationDecision, error) {
+	keys := make([]string, 0, len(memories))
+	for _, mem := range memories {
+		keys = append(keys, mem.Key)
+	}
+	c.clusters = append(c.clusters, keys)
+
+	if decision, ok := c.decisions[keys[0]]; ok {
+		return decision, nil
+	}
+	return &memory.ConsolidationDecision{Action: memory.ConsolidationActionKeep}, nil
+}
+
+func TestService_Consolidate(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewInMemoryStore()
+	service := newTestService(t, store, config.NewMemoryConfig())
+
+	for _, input := range []memory.RememberInput{
+		{Key: "user_city_current", Value: "lives in Seoul Korea", Tags: []string{"personal"}},
+		{Key: "user_location_city", Value: "lives in Seoul Korea", Tags: []string{"location"}},
+		{Key: "user_preference_coffee", Value: "likes dark roast coffee"},
+		{Key: "user_preference_coffee_new", Value: "likes light roast coffee"},
+		{Key: "user_name_full", Value: "Dennis Park"},
+	} {
+		_, err := service.RememberMemory(ctx, input)
+		require.NoError(t, err)
+	}
+
+	consolidator := &fakeConsolidator{decisions: map[string]*memory.ConsolidationDecision{
+		"user_city_current": {
+			Action: memory.ConsolidationActionMerge,
+			Key:    "user_location_city",
+			Value:  "Lives in Seoul, Korea",
+			Reason: "same fact",
+		},
+		"user_preference_coffee": {
+			Action:     memory.ConsolidationActionSupersede,
+			Key:        "user_preference_coffee_new",
+			Superseded: []string{"user_preference_coffee"},
+			Reason:     "preference changed",
+		},
+	}}
+
+	consolidations, err := service.Consolidate(ctx, memory.ConsolidateOptions{Threshold: 0.8, Consolidator: consolidator})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{
+		{"user_city_current", "user_location_city"},
+		{"user_preference_coffee", "user_preference_coffee_new"},
+	}, consolidator.clusters)
+	require.Len(t, consolidations, 2)
+
+	// Merged into one memory keeping the tags of both
+	_, err = service.GetMemory(ctx, "user_city_current")
+	require.Error(t, err)
+	merged, err := service.GetMemory(ctx, "user_location_city")
+	require.NoError(t, err)
+	assert.Equal(t, "Lives in Seoul, Korea", merged.Value)
+	assert.ElementsMatch(t, []string{"personal", "location"}, merged.Tags)
+
+	// Superseded memories are kept but hidden from listing and search
+	outdated, err := store.Get(ctx, memory.DefaultNamespace, "user_preference_coffee")
+	require.NoError(t, err)
+	assert.Equal(t, "user_preference_coffee_new", outdated.SupersededBy)
+
+	list, err := service.ListMemories(ctx, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	assert.Len(t, memories, 3)
+
+	results, err := service.SearchMemory(ctx, "coffee", 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.NotEqual(t, "user_preference_coffee", result.Memory.Key)
+	}
+
+	// Before and after views are kept for audit
+	audit, err := service.ListConsolidations(ctx)
+	require.NoError(t, err)
+	require.Len(t, audit, 2)
+	for _, consolidation := range audit {
+		assert.Len(t, consolidation.Before, 2)
+		switch consolidation.Action {
+		case memory.ConsolidationActionMerge:
+			assert.Equal(t, "lives in Seoul Korea", consolidation.Before[0].Value)
+			require.Len(t, consolidation.After, 1)
+			assert.Equal(t, "Lives in Seoul, Korea", consolidation.After[0].Value)
+		case memory.ConsolidationActionSupersede:
+			require.Len(t, consolidation.After, 2)
+			assert.Empty(t, consolidation.Before[0].SupersededBy)
+		default:
+			t.Fatalf("unexpected action %s", consolidation.Action)
+		}
+	}
+
+	// Resolved memories are not clustered again
+	consolidator.clusters = nil
+	consolidations, err = service.Consolidate(ctx, memory.ConsolidateOptions{Threshold: 0.8, Consolidator: consolidator})
+	require.NoError(t, err)
+	assert.Empty(t, consolidations)
+	assert.Empty(t, consolidator.clusters)
+}
+
+func TestService_ConsolidateInvalidDecision(t *testing.T) {
+	ctx := t.Context()
+	service := newTestService(t, memory.NewInMemoryStore(), config.NewMemoryConfig())
+
+	for _, key := range []string{"a_fact", "b_fact"} {
+		_, err := service.RememberMemory(ctx, memory.RememberInput{Key: key, Value: "the same fact"})
+		require.NoError(t, err)
+	}
+
+	_, err := service.Consolidate(ctx, memory.ConsolidateOptions{Consolidator: &fakeConsolidator{decisions: map[string]*memory.ConsolidationDecision{
+		"a_fact": {Action: memory.ConsolidationActionSupersede, Key: "unknown", Superseded: []string{"a_fact"}},
+	}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown current memory")
+
+	list, err := service.ListMemories(ctx, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	assert.Len(t, memories, 2)
+}
+
+// failingReplaceStore fails every Replace
+type failingReplaceStore struct {
+	memory.Store
+}
+
+func (s *failingReplaceStore) Replace(ctx context.Context, memory *memory.Memory) error {
+	return errors.New("disk I/O error")
+}
+
+func TestService_ConsolidateMergeFailureKeepsMemories(t *testing.T) {
+	ctx := t.Context()
+	service := newTestService(t, &failingReplaceStore{Store: memory.NewInMemoryStore()}, config.NewMemoryConfig())
+
+	for _, key := range []string{"a_fact", "b_fact"} {
+		_, err := service.RememberMemory(ctx, memory.RememberInput{Key: key, Value: "the same fact"})
+		require.NoError(t, err)
+	}
+
+	_, err := service.Consolidate(ctx, memory.ConsolidateOptions{Consolidator: &fakeConsolidator{decisions: map[string]*memory.ConsolidationDecision{
+		"a_fact": {Action: memory.ConsolidationActionMerge, Key: "b_fact", Value: "The same fact"},
+	}}})
+	require.ErrorContains(t, err, "disk I/O error")
+
+	// The merged memory was not stored, so neither original is deleted
+	list, err := service.ListMemories(ctx, memory.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.Memories, 2)
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Embedder generates embeddings for memory values and search queries
+	Embedder interface {
+		// EmbedDocuments embeds memory values for storage
+		EmbedDocuments(ctx context.Context, texts ...string) ([][]float32, error)
+		// EmbedQuery embeds a search query
+		EmbedQuery(ctx context.Context, query string) ([]float32, error)
+		// Dimension returns the size of the produced embeddings
+		Dimension() int
+	}
+
+	// KnowledgeEmbedder adapts an embedder of the knowledge package, embedding
+	// memory values as documents and search queries as queries
+	KnowledgeEmbedder struct {
+		embedder knowledge.Embedder
+	}
+)
+
+const (
+	EmbeddingProviderOpenAI           = knowledge.EmbeddingProviderOpenAI
+	EmbeddingProviderNomic            = knowledge.EmbeddingProviderNomic
+	EmbeddingProviderOpenAICompatible = knowledge.EmbeddingProviderOpenAICompatible
+
+	DefaultOpenAIEmbeddingModel = knowledge.DefaultOpenAIEmbeddingModel
+)
+
+var (
+	_ Embedder = (*KnowledgeEmbedder)(nil)
+)
+
+// NewKnowledgeEmbedder wraps a knowledge embedder for memories
+func NewKnowledgeEmbedder(embedder knowledge.Embedder) *KnowledgeEmbedder {
+	return &KnowledgeEmbedder{embedder: embedder}
+}
+
+// NewEmbedder creates the embedder selected by the memory configuration.
+// It fails when the selected embedder is not available.
+func NewEmbedder(g *genkit.Genkit, memoryConfig *config.MemoryConfig) (Embedder, error) {
+	if memoryConfig == nil {
+		memoryConfig = config.NewMemoryConfig()
+	}
+
+	var embedder knowledge.Embedder
+	switch provider := memoryConfig.EmbeddingProvider; provider {
+	case "", EmbeddingProviderOpenAI:
+		// Nomic is the default of the knowledge package, so the provider is set explicitly
+		var err error
+		embedder, err = knowledge.NewEmbedder(g, &config.KnowledgeConfig{
+			EmbeddingProvider: EmbeddingProviderOpenAI,
+			EmbeddingModel:    memoryConfig.EmbeddingModel,
+			VectorDimension:   memoryConfig.VectorDimension,
+		})
+		if err != nil {
+			return nil, err
+		}
+	case EmbeddingProviderNomic:
+		if memoryConfig.NomicAPIKey == "" {
+			return nil, errors.New("no embedder available: nomic embedding provider requires a Nomic API key")
+		}
+		embedder = knowledge.NewNomicEmbedder(memoryConfig.NomicAPIKey)
+	case EmbeddingProviderOpenAICompatible:
+		if memoryConfig.EmbeddingBaseURL == "" {
+			return nil, errors.New("no embedder available: openai-compatible embedding provider requires embeddingBaseUrl")
+		}
+		if memoryConfig.EmbeddingModel == "" {
+			return nil, errors.New("no embedder available: openai-compatible embedding provider requires embeddingModel")
+		}
+		if memoryConfig.VectorDimension <= 0 {
+			return nil, errors.New("openai-compatible embedding provider requires vectorDimension")
+		}
+		embedder = knowledge.NewOpenAICompatibleEmbedder(memoryConfig.EmbeddingBaseURL, memoryConfig.EmbeddingAPIKey, memoryConfig.EmbeddingModel, memoryConfig.VectorDimension)
+	default:
+		return nil, errors.Errorf("invalid embedding provider: %s", provider)
+	}
+
+	if memoryConfig.VectorDimension > 0 && memoryConfig.VectorDimension != embedder.GetEmbedSize() {
+		return nil, errors.Errorf("vectorDimension %d does not match the embedder dimension %d", memoryConfig.VectorDimension, embedder.GetEmbedSize())
+	}
+
+	return NewKnowledgeEmbedder(embedder), nil
+}
+
+func (e *KnowledgeEmbedder) EmbedDocuments(ctx context.Context, texts ...string) ([][]float32, error) {
+	embeddings, err := e.embedder.EmbedTexts(ctx, knowledge.EmbeddingTaskTypeDocument, texts...)
+	if err != nil {
+		return nil, err
+	}
+	return checkEmbeddings(embeddings, len(texts), e.Dimension())
+}
+
+func (e *KnowledgeEmbedder) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	embeddings, err := e.embedder.EmbedTexts(ctx, knowledge.EmbeddingTaskTypeQuery, query)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err = checkEmbeddings(embeddings, 1, e.Dimension())
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (e *KnowledgeEmbedder) Dimension() int {
+	return e.embedder.GetEmbedSize()
+}
+
+// checkEmbeddings verifies the embedder returned one embedding of the expected size per input
+func checkEmbeddings(embeddings [][]float32, count int, dimension int) ([][]float32, error) {
+	if len(embeddings) != count {
+		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), count)
+	}
+	for _, embedding := range embeddings {
+		if len(embedding) != dimension {
+			return nil, errors.Errorf("embedding dimension mismatch: got %d, expected %d", len(embedding), dimension)
+		}
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,127 @@
+package memory_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	internalgenkit "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEmbedder_Unavailable(t *testing.T) {
+	g, err := internalgenkit.NewGenkit(t.Context(), &config.ModelConfig{}, slog.Default(), false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		conf     *config.MemoryConfig
+		contains string
+	}{
+		{
+			name:     "openai without API key",
+			conf:     &config.MemoryConfig{EmbeddingProvider: memory.EmbeddingProviderOpenAI},
+			contains: "no embedder available",
+		},
+		{
+			name:     "nomic without API key",
+			conf:     &config.MemoryConfig{EmbeddingProvider: memory.EmbeddingProviderNomic},
+			contains: "Nomic API key",
+		},
+		{
+			name:     "openai-compatible without base URL",
+			conf:     &config.MemoryConfig{EmbeddingProvider: memory.EmbeddingProviderOpenAICompatible, EmbeddingModel: "nomic-embed-text", VectorDimension: 768},
+			contains: "embeddingBaseUrl",
+		},
+		{
+			name:     "openai-compatible without dimension",
+			conf:     &config.MemoryConfig{EmbeddingProvider: memory.EmbeddingProviderOpenAICompatible, EmbeddingBaseURL: "http://localhost:11434/v1", EmbeddingModel: "nomic-embed-text"},
+			contains: "vectorDimension",
+		},
+		{
+			name:     "nomic with mismatching dimension",
+			conf:     &config.MemoryConfig{EmbeddingProvider: memory.EmbeddingProviderNomic, NomicAPIKey: "test-key", VectorDimension: 1536},
+			contains: "does not match",
+		},
+		{
+			name:     "unknown provider",
+			conf:     &config.MemoryConfig{EmbeddingProvider: "unknown"},
+			contains: "invalid embedding provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := memory.NewEmbedder(g, tt.conf)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.contains)
+		})
+	}
+}
+
+func TestOpenAICompatibleEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer local-key", r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+
+		type data struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		resp := struct {
+			Data []data `json:"data"`
+		}{}
+		// Return the embeddings in reverse order to check that index is honored
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, data{Index: i, Embedding: []float32{float32(i), 1, 0}})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	g, err := internalgenkit.NewGenkit(t.Context(), &config.ModelConfig{}, slog.Default(), false)
+	require.NoError(t, err)
+
+	embedder, err := memory.NewEmbedder(g, &config.MemoryConfig{
+		EmbeddingProvider: memory.EmbeddingProviderOpenAICompatible,
+		EmbeddingBaseURL:  server.URL + "/v1/",
+		EmbeddingModel:    "nomic-embed-text",
+		EmbeddingAPIKey:   "local-key",
+		VectorDimension:   3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, embedder.Dimension())
+
+	embeddings, err := embedder.EmbedDocuments(t.Context(), "first", "second")
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0, 1, 0}, {1, 1, 0}}, embeddings)
+
+	query, err := embedder.EmbedQuery(t.Context(), "query")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 1, 0}, query)
+
+	// Embeddings of an unexpected size are rejected
+	embedder, err = memory.NewEmbedder(g, &config.MemoryConfig{
+		EmbeddingProvider: memory.EmbeddingProviderOpenAICompatible,
+		EmbeddingBaseURL:  server.URL + "/v1",
+		EmbeddingModel:    "nomic-embed-text",
+		EmbeddingAPIKey:   "local-key",
+		VectorDimension:   4,
+	})
+	require.NoError(t, err)
+	_, err = embedder.EmbedQuery(t.Context(), "query")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dimension mismatch")
+}
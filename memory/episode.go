@@ -0,0 +1,215 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Episode is the summary of a past conversation thread. Episodes are kept per
+	// user and agent regardless of MemoryConfig.ThreadScoped so that they can be
+	// recalled across threads.
+	Episode struct {
+		ID        string `json:"id"`
+		Namespace string `json:"namespace,omitempty"`
+		ThreadID  string `json:"thread_id,omitempty"`
+
+		Summary      string   `json:"summary"`
+		Participants []string `json:"participants,omitempty"`
+		Outcomes     []string `json:"outcomes,omitempty"`
+
+		// StartedAt and EndedAt bound the conversation the episode summarizes
+		StartedAt time.Time `json:"started_at,omitzero"`
+		EndedAt   time.Time `json:"ended_at,omitzero"`
+		CreatedAt time.Time `json:"created_at,omitzero"`
+		UpdatedAt time.Time `json:"updated_at,omitzero"`
+
+		Embedding []float32 `json:"-"`
+	}
+
+	ScoredEpisode struct {
+		*Episode
+		Score float64 `json:"score"`
+	}
+
+	RecordEpisodeInput struct {
+		// ThreadID identifies the summarized thread. Recording the same thread again
+		// updates its episode instead of creating another one.
+		ThreadID     string   `json:"thread_id,omitempty"`
+		Summary      string   `json:"summary"`
+		Participants []string `json:"participants,omitempty"`
+		Outcomes     []string `json:"outcomes,omitempty"`
+
+		// StartedAt defaults to the start of the existing episode of the thread, or now
+		StartedAt time.Time `json:"started_at,omitzero"`
+		// EndedAt defaults to now
+		EndedAt time.Time `json:"ended_at,omitzero"`
+	}
+
+	// EpisodeSearchOptions narrows and cuts off episode search results
+	EpisodeSearchOptions struct {
+		// Participant keeps only episodes with the given participant
+		Participant string `json:"participant,omitempty"`
+		// Since and Until keep only episodes overlapping the time range
+		Since *time.Time `json:"since,omitempty"`
+		Until *time.Time `json:"until,omitempty"`
+		// MinScore drops results whose score is below the threshold (0.0~1.0)
+		MinScore float64 `json:"min_score,omitempty"`
+	}
+)
+
+// Matches reports whether the episode passes the participant and time filters
+func (o EpisodeSearchOptions) Matches(episode *Episode) bool {
+	if o.Participant != "" && !slices.ContainsFunc(episode.Participants, func(p string) bool {
+		return strings.EqualFold(p, o.Participant)
+	}) {
+		return false
+	}
+	if o.Since != nil && episode.EndedAt.Before(*o.Since) {
+		return false
+	}
+	if o.Until != nil && episode.StartedAt.After(*o.Until) {
+		return false
+	}
+	return true
+}
+
+// episodeText is the text of an episode that is embedded and matched by keywords
+func episodeText(episode *Episode) string {
+	var sb strings.Builder
+	sb.WriteString(episode.Summary)
+	for _, outcome := range episode.Outcomes {
+		sb.WriteString("\n- ")
+		sb.WriteString(outcome)
+	}
+	return sb.String()
+}
+
+// searchEpisodes ranks the episodes passing opts like memories are ranked:
+// vector similarity fused with BM25 over the summary, outcomes and participants
+func searchEpisodes(query string, queryEmbedding []float32, episodes []*Episode, limit uint, opts EpisodeSearchOptions) []ScoredEpisode {
+	byID := make(map[string]*Episode, len(episodes))
+	var candidates, validCandidates []*Memory
+	for _, episode := range episodes {
+		if !opts.Matches(episode) {
+			continue
+		}
+		byID[episode.ID] = episode
+		candidate := &Memory{
+			Key:       episode.ID,
+			Value:     episodeText(episode),
+			Tags:      episode.Participants,
+			Embedding: episode.Embedding,
+		}
+		candidates = append(candidates, candidate)
+		if len(queryEmbedding) > 0 && len(candidate.Embedding) == len(queryEmbedding) {
+			validCandidates = append(validCandidates, candidate)
+		}
+	}
+
+	results := fuseResults(query, vectorSearch(queryEmbedding, validCandidates), keywordSearch(query, candidates))
+	results = finalizeResults(results, SearchOptions{MinScore: opts.MinScore}, limit)
+
+	scored := make([]ScoredEpisode, 0, len(results))
+	for _, result := range results {
+		scored = append(scored, ScoredEpisode{Episode: byID[result.Memory.Key], Score: result.Score})
+	}
+	return scored
+}
+
+// sortEpisodes orders episodes by their start, oldest first
+func sortEpisodes(episodes []*Episode) {
+	slices.SortFunc(episodes, func(a, b *Episode) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// episodeID returns the ID of the episode of a thread, or a new ID for episodes without a thread
+func episodeID(namespace string, threadID string) string {
+	if threadID == "" {
+		return uuid.NewString()
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(namespace+"\x00"+threadID)).String()
+}
+
+// episodeNamespace is the namespace of the episodes of the current user and agent
+func episodeNamespace(ctx context.Context) string {
+	return ScopeFromContext(ctx).Namespace(false)
+}
+
+// RecordEpisode stores the summary of a conversation as an episode of the current
+// user and agent, replacing the previous episode of the same thread
+func (s *service) RecordEpisode(ctx context.Context, input RecordEpisodeInput) (*Episode, error) {
+	if strings.TrimSpace(input.Summary) == "" {
+		return nil, errors.New("episode summary cannot be empty")
+	}
+
+	now := time.Now()
+	episode := &Episode{
+		ID:           episodeID(episodeNamespace(ctx), input.ThreadID),
+		Namespace:    episodeNamespace(ctx),
+		ThreadID:     input.ThreadID,
+		Summary:      input.Summary,
+		Participants: input.Participants,
+		Outcomes:     input.Outcomes,
+		StartedAt:    input.StartedAt,
+		EndedAt:      input.EndedAt,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if episode.EndedAt.IsZero() {
+		episode.EndedAt = now
+	}
+
+	embeddings, err := s.embedder.EmbedDocuments(ctx, episodeText(episode))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate embedding for episode")
+	}
+	episode.Embedding = embeddings[0]
+
+	if err := s.store.SaveEpisode(ctx, episode); err != nil {
+		return nil, errors.Wrapf(err, "failed to store episode")
+	}
+
+	return episode, nil
+}
+
+// RecallEpisodes searches the episodes of the current user and agent by meaning and keywords
+func (s *service) RecallEpisodes(ctx context.Context, query string, limit int, opts EpisodeSearchOptions) ([]ScoredEpisode, error) {
+	if query == "" {
+		return nil, errors.Errorf("query cannot be empty")
+	}
+	if limit < 0 {
+		return nil, errors.Errorf("invalid limit: %d", limit)
+	}
+
+	queryEmbedding, err := s.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate embedding for query")
+	}
+
+	episodes, err := s.store.SearchEpisodes(ctx, episodeNamespace(ctx), query, queryEmbedding, uint(limit), opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to search episodes")
+	}
+
+	return episodes, nil
+}
+
+// ListEpisodes returns the episodes of the current user and agent, oldest first
+func (s *service) ListEpisodes(ctx context.Context) ([]*Episode, error) {
+	episodes, err := s.store.ListEpisodes(ctx, episodeNamespace(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list episodes")
+	}
+
+	return episodes, nil
+}
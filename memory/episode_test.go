@@ -0,0 +1,88 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/mokiat/gog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Episodes(t *testing.T) {
+	memoryConfig := config.NewMemoryConfig()
+	memoryConfig.ThreadScoped = true
+	service := newTestService(t, memory.NewInMemoryStore(), memoryConfig)
+
+	scope := memory.Scope{UserID: "alice", AgentName: "assistant"}
+	launchCtx := memory.WithScope(t.Context(), memory.Scope{UserID: scope.UserID, AgentName: scope.AgentName, ThreadID: "launch"})
+	hiringCtx := memory.WithScope(t.Context(), memory.Scope{UserID: scope.UserID, AgentName: scope.AgentName, ThreadID: "hiring"})
+
+	_, err := service.RecordEpisode(launchCtx, memory.RecordEpisodeInput{ThreadID: "launch"})
+	require.Error(t, err)
+
+	first, err := service.RecordEpisode(launchCtx, memory.RecordEpisodeInput{
+		ThreadID:     "launch",
+		Summary:      "Discussed the product launch timeline",
+		Participants: []string{"assistant", "Alice"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user:alice/agent:assistant", first.Namespace)
+	assert.False(t, first.StartedAt.IsZero())
+
+	// Recording the thread again updates its episode and keeps its start
+	time.Sleep(10 * time.Millisecond)
+	launch, err := service.RecordEpisode(launchCtx, memory.RecordEpisodeInput{
+		ThreadID:     "launch",
+		Summary:      "Discussed the product launch timeline and decided the launch date",
+		Participants: []string{"assistant", "Alice", "Bob"},
+		Outcomes:     []string{"Launch moved to June 3", "Bob prepares the press release"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, launch.ID)
+	assert.Equal(t, first.StartedAt, launch.StartedAt)
+	assert.True(t, launch.EndedAt.After(first.EndedAt))
+
+	_, err = service.RecordEpisode(hiringCtx, memory.RecordEpisodeInput{
+		ThreadID:     "hiring",
+		Summary:      "Reviewed candidates for the backend engineer role",
+		Participants: []string{"assistant", "Alice"},
+		Outcomes:     []string{"Schedule a second interview with Kim"},
+	})
+	require.NoError(t, err)
+
+	// Episodes are shared across the threads of the user and agent
+	episodes, err := service.ListEpisodes(hiringCtx)
+	require.NoError(t, err)
+	require.Len(t, episodes, 2)
+	assert.Equal(t, "launch", episodes[0].ThreadID)
+	assert.Equal(t, "hiring", episodes[1].ThreadID)
+
+	results, err := service.RecallEpisodes(hiringCtx, "what did we decide about the launch date", 1, memory.EpisodeSearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "launch", results[0].ThreadID)
+	assert.Contains(t, results[0].Outcomes, "Launch moved to June 3")
+
+	results, err = service.RecallEpisodes(hiringCtx, "launch", 10, memory.EpisodeSearchOptions{Participant: "bob"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "launch", results[0].ThreadID)
+
+	results, err = service.RecallEpisodes(hiringCtx, "launch", 10, memory.EpisodeSearchOptions{Since: gog.PtrOf(time.Now().Add(time.Hour))})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Other users do not see the episodes
+	bobCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "bob", AgentName: scope.AgentName})
+	episodes, err = service.ListEpisodes(bobCtx)
+	require.NoError(t, err)
+	assert.Empty(t, episodes)
+
+	require.NoError(t, service.DeleteNamespace(t.Context(), scope.Namespace(false)))
+	episodes, err = service.ListEpisodes(launchCtx)
+	require.NoError(t, err)
+	assert.Empty(t, episodes)
+}
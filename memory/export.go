@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	ExportFormat = string
+
+	ExportOptions struct {
+		// Format is ExportFormatJSON (default) or ExportFormatJSONL
+		Format ExportFormat
+		// IncludeEmbeddings writes the embeddings so that an import can skip recomputing them
+		IncludeEmbeddings bool
+	}
+
+	ImportOptions struct {
+		// Format is ExportFormatJSON (default) or ExportFormatJSONL
+		Format ExportFormat
+		// Overwrite replaces memories with the same key; they are skipped otherwise
+		Overwrite bool
+	}
+
+	ImportResult struct {
+		Imported int `json:"imported"`
+		Skipped  int `json:"skipped"`
+		// Embedded counts the imported memories whose embedding was recomputed
+		Embedded int `json:"embedded"`
+	}
+
+	// ExportedMemory is a memory in the portable format, with its embedding when exported
+	ExportedMemory struct {
+		*Memory
+		Embedding []float32 `json:"embedding,omitempty"`
+	}
+
+	// MemoryExport is the document written in the JSON format
+	MemoryExport struct {
+		Version    int               `json:"version"`
+		Namespace  string            `json:"namespace,omitempty"`
+		ExportedAt time.Time         `json:"exported_at"`
+		Memories   []*ExportedMemory `json:"memories"`
+	}
+)
+
+const (
+	ExportFormatJSON  ExportFormat = "json"
+	ExportFormatJSONL ExportFormat = "jsonl"
+
+	// exportVersion is the version of the MemoryExport document
+	exportVersion = 1
+)
+
+// ExportMemories writes every memory of the current namespace, including
+// expired and superseded ones, to w
+func (s *service) ExportMemories(ctx context.Context, w io.Writer, opts ExportOptions) error {
+	return ExportMemories(ctx, s.store, s.namespace(ctx), w, opts)
+}
+
+// ExportMemories writes every memory of a namespace of store, including
+// expired and superseded ones, to w. Unlike Service.ExportMemories, it needs no
+// embedder, so that a store opened with OpenReadOnlyStore can be exported.
+func ExportMemories(ctx context.Context, store Store, namespace string, w io.Writer, opts ExportOptions) error {
+	list, err := store.List(ctx, namespace, ListOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list memories")
+	}
+
+	exported := make([]*ExportedMemory, 0, len(list.Memories))
+	for _, memory := range list.Memories {
+		record := &ExportedMemory{Memory: memory}
+		if opts.IncludeEmbeddings {
+			record.Embedding = memory.Embedding
+		}
+		exported = append(exported, record)
+	}
+
+	switch opts.Format {
+	case "", ExportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(&MemoryExport{
+			Version:    exportVersion,
+			Namespace:  namespace,
+			ExportedAt: time.Now(),
+			Memories:   exported,
+		}); err != nil {
+			return errors.Wrapf(err, "failed to write memories")
+		}
+	case ExportFormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range exported {
+			if err := encoder.Encode(record); err != nil {
+				return errors.Wrapf(err, "failed to write memory '%s'", record.Key)
+			}
+		}
+	default:
+		return errors.Errorf("invalid export format: %s", opts.Format)
+	}
+
+	return nil
+}
+
+// ImportMemories loads memories from r into the current namespace. Missing
+// embeddings, or ones of another dimension, are recomputed.
+func (s *service) ImportMemories(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	var records []*ExportedMemory
+	switch opts.Format {
+	case "", ExportFormatJSON:
+		var document MemoryExport
+		if err := json.NewDecoder(r).Decode(&document); err != nil {
+			return nil, errors.Wrapf(err, "failed to read memories")
+		}
+		if document.Version > exportVersion {
+			return nil, errors.Errorf("unsupported export version %d", document.Version)
+		}
+		records = document.Memories
+	case ExportFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var record ExportedMemory
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return nil, errors.Wrapf(err, "failed to read memory at line %d", line)
+			}
+			records = append(records, &record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "failed to read memories")
+		}
+	default:
+		return nil, errors.Errorf("invalid import format: %s", opts.Format)
+	}
+
+	namespace := s.namespace(ctx)
+	now := time.Now()
+	result := &ImportResult{}
+
+	// Validate the records and collect the values to embed
+	memories := make([]*Memory, 0, len(records))
+	var (
+		toEmbed []*Memory
+		values  []string
+	)
+	for i, record := range records {
+		if record.Memory == nil || record.Key == "" {
+			return nil, errors.Errorf("memory #%d has no key", i+1)
+		}
+
+		memory := record.Memory
+		memory.Namespace = namespace
+		memory.Embedding = record.Embedding
+		if memory.Source == "" {
+			memory.Source = MemorySourceUser
+		}
+		if memory.CreatedAt.IsZero() {
+			memory.CreatedAt = now
+		}
+		if memory.UpdatedAt.IsZero() {
+			memory.UpdatedAt = memory.CreatedAt
+		}
+
+		if len(memory.Embedding) != s.embedder.Dimension() {
+			toEmbed = append(toEmbed, memory)
+			values = append(values, memory.Value)
+		}
+		memories = append(memories, memory)
+	}
+
+	if len(values) > 0 {
+		embeddings, err := s.embedder.EmbedDocuments(ctx, values...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate embeddings")
+		}
+		for i, memory := range toEmbed {
+			memory.Embedding = embeddings[i]
+		}
+	}
+	embedded := make(map[*Memory]bool, len(toEmbed))
+	for _, memory := range toEmbed {
+		embedded[memory] = true
+	}
+
+	for _, memory := range memories {
+		existing, err := s.store.Get(ctx, namespace, memory.Key)
+		if errors.Is(err, ErrMemoryNotFound) {
+			existing = nil
+		} else if err != nil {
+			return result, errors.Wrapf(err, "failed to get memory '%s'", memory.Key)
+		}
+		if existing != nil && !opts.Overwrite {
+			result.Skipped++
+			continue
+		}
+		existing = snapshot(existing)
+
+		if err := s.store.Replace(ctx, memory); err != nil {
+			return result, errors.Wrapf(err, "failed to store memory '%s'", memory.Key)
+		}
+		s.recordMutation(ctx, namespace, MutationImport, existing, memory)
+
+		result.Imported++
+		if embedded[memory] {
+			result.Embedded++
+		}
+	}
+
+	return result, nil
+}
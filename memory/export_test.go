@@ -0,0 +1,123 @@
+package memory_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ExportImport(t *testing.T) {
+	source := newTestService(t, memory.NewInMemoryStore(), config.NewMemoryConfig())
+	aliceCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice"})
+
+	for _, input := range []memory.RememberInput{
+		{Key: "user_name_full", Value: "Alice Kim", Tags: []string{"personal"}},
+		{Key: "user_preference_coffee", Value: "dark roast"},
+	} {
+		_, err := source.RememberMemory(aliceCtx, input)
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		format     memory.ExportFormat
+		embeddings bool
+	}{
+		{name: "json without embeddings", format: memory.ExportFormatJSON},
+		{name: "json with embeddings", format: memory.ExportFormatJSON, embeddings: true},
+		{name: "jsonl without embeddings", format: memory.ExportFormatJSONL},
+		{name: "jsonl with embeddings", format: memory.ExportFormatJSONL, embeddings: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, source.ExportMemories(aliceCtx, &buf, memory.ExportOptions{Format: tc.format, IncludeEmbeddings: tc.embeddings}))
+			assert.Equal(t, tc.embeddings, strings.Contains(buf.String(), `"embedding"`))
+			if tc.format == memory.ExportFormatJSONL {
+				assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+			}
+
+			// Load into another user's namespace of a fresh service
+			target := newTestService(t, memory.NewInMemoryStore(), config.NewMemoryConfig())
+			bobCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "bob"})
+
+			result, err := target.ImportMemories(bobCtx, bytes.NewReader(buf.Bytes()), memory.ImportOptions{Format: tc.format})
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.Imported)
+			if tc.embeddings {
+				assert.Zero(t, result.Embedded)
+			} else {
+				assert.Equal(t, 2, result.Embedded)
+			}
+
+			imported, err := target.GetMemory(bobCtx, "user_name_full")
+			require.NoError(t, err)
+			assert.Equal(t, "Alice Kim", imported.Value)
+			assert.Equal(t, []string{"personal"}, imported.Tags)
+			assert.Equal(t, "user:bob", imported.Namespace)
+			assert.Len(t, imported.Embedding, 16)
+			assert.False(t, imported.CreatedAt.IsZero())
+
+			results, err := target.SearchMemory(bobCtx, "coffee", 1, memory.SearchOptions{})
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.Equal(t, "user_preference_coffee", results[0].Memory.Key)
+		})
+	}
+}
+
+func TestService_ImportOverwrite(t *testing.T) {
+	ctx := t.Context()
+	service := newTestService(t, memory.NewInMemoryStore(), config.NewMemoryConfig())
+
+	_, err := service.RememberMemory(ctx, memory.RememberInput{Key: "user_preference_coffee", Value: "dark roast"})
+	require.NoError(t, err)
+
+	input := `{"key":"user_preference_coffee","value":"light roast"}
+{"key":"user_preference_tea","value":"green tea"}
+`
+
+	result, err := service.ImportMemories(ctx, strings.NewReader(input), memory.ImportOptions{Format: memory.ExportFormatJSONL})
+	require.NoError(t, err)
+	assert.Equal(t, &memory.ImportResult{Imported: 1, Skipped: 1, Embedded: 1}, result)
+
+	coffee, err := service.GetMemory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	assert.Equal(t, "dark roast", coffee.Value)
+
+	result, err = service.ImportMemories(ctx, strings.NewReader(input), memory.ImportOptions{Format: memory.ExportFormatJSONL, Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Imported)
+
+	coffee, err = service.GetMemory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	assert.Equal(t, "light roast", coffee.Value)
+
+	history, err := service.ListHistory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, memory.MutationImport, history[1].Operation)
+	assert.Equal(t, "dark roast", history[1].OldValue.Value)
+
+	_, err = service.ImportMemories(ctx, strings.NewReader(`{"value":"no key"}`), memory.ImportOptions{Format: memory.ExportFormatJSONL})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no key")
+
+	_, err = service.ImportMemories(ctx, strings.NewReader(`{}`), memory.ImportOptions{Format: "xml"})
+	require.Error(t, err)
+}
+
+func TestExportedMemory_JSON(t *testing.T) {
+	data, err := json.Marshal(&memory.ExportedMemory{
+		Memory:    &memory.Memory{Key: "k", Value: "v", Embedding: []float32{1}},
+		Embedding: []float32{0.5},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"embedding":[0.5]`)
+	assert.Contains(t, string(data), `"key":"k"`)
+}
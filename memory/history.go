@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type (
+	ActorType = string
+
+	// Actor identifies who changes memories. It is carried through the context
+	// and recorded in the memory history.
+	Actor struct {
+		Type  ActorType `json:"type"`
+		Name  string    `json:"name,omitempty"`
+		RunID string    `json:"run_id,omitempty"`
+	}
+
+	MutationOperation = string
+
+	// MemoryMutation is one recorded change of a memory. OldValue is nil for a
+	// creation and NewValue is nil for a deletion.
+	MemoryMutation struct {
+		ID        string            `json:"id"`
+		Namespace string            `json:"namespace,omitempty"`
+		Key       string            `json:"key"`
+		Version   int               `json:"version"`
+		Operation MutationOperation `json:"operation"`
+		Actor     Actor             `json:"actor"`
+		ThreadID  string            `json:"thread_id,omitempty"`
+		OldValue  *Memory           `json:"old_value,omitempty"`
+		NewValue  *Memory           `json:"new_value,omitempty"`
+		CreatedAt time.Time         `json:"created_at"`
+	}
+
+	actorContextKeyType string
+)
+
+const (
+	ActorUser   ActorType = "user"
+	ActorAgent  ActorType = "agent"
+	ActorTool   ActorType = "tool"
+	ActorSystem ActorType = "system"
+
+	MutationCreate      MutationOperation = "create"
+	MutationUpdate      MutationOperation = "update"
+	MutationDelete      MutationOperation = "delete"
+	MutationPrune       MutationOperation = "prune"
+	MutationConsolidate MutationOperation = "consolidate"
+	MutationRollback    MutationOperation = "rollback"
+	MutationImport      MutationOperation = "import"
+)
+
+var (
+	actorContextKey = actorContextKeyType("ctx.memoryActor")
+)
+
+// WithActor returns a copy of ctx that carries the given actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx, or the system actor
+func ActorFromContext(ctx context.Context) Actor {
+	actor, ok := ctx.Value(actorContextKey).(Actor)
+	if !ok {
+		return Actor{Type: ActorSystem}
+	}
+	return actor
+}
+
+// ListHistory returns the recorded changes of the memory with the given key, oldest first
+func (s *service) ListHistory(ctx context.Context, key string) ([]*MemoryMutation, error) {
+	if key == "" {
+		return nil, errors.Errorf("memory key cannot be empty")
+	}
+
+	mutations, err := s.store.ListMutations(ctx, s.namespace(ctx), key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list memory history")
+	}
+
+	return mutations, nil
+}
+
+// Rollback restores the memory with the given key to the value it had after
+// the given version. Rolling back to a deletion deletes the memory.
+func (s *service) Rollback(ctx context.Context, key string, version int) (*Memory, error) {
+	mutations, err := s.ListHistory(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *MemoryMutation
+	for _, mutation := range mutations {
+		if mutation.Version == version {
+			target = mutation
+			break
+		}
+	}
+	if target == nil {
+		return nil, errors.Errorf("version %d of memory '%s' not found", version, key)
+	}
+
+	namespace := s.namespace(ctx)
+	current, err := s.store.Get(ctx, namespace, key)
+	if errors.Is(err, ErrMemoryNotFound) {
+		current = nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to get memory")
+	}
+
+	if target.NewValue == nil {
+		if current == nil {
+			return nil, nil
+		}
+		if err := s.store.Delete(ctx, namespace, key); err != nil {
+			return nil, errors.Wrapf(err, "failed to delete memory")
+		}
+		s.recordMutation(ctx, namespace, MutationRollback, current, nil)
+		return nil, nil
+	}
+
+	restored := *target.NewValue
+	restored.Namespace = namespace
+	restored.UpdatedAt = time.Now()
+
+	embeddings, err := s.embedder.EmbedDocuments(ctx, restored.Value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate embedding for input '%s'", restored.Value)
+	}
+	restored.Embedding = embeddings[0]
+
+	if err := s.store.Replace(ctx, &restored); err != nil {
+		return nil, errors.Wrapf(err, "failed to restore memory")
+	}
+	s.recordMutation(ctx, namespace, MutationRollback, current, &restored)
+
+	return &restored, nil
+}
+
+// recordMutation appends a change to the memory history. The history is an
+// audit trail, so a failure is logged rather than undoing the change.
+func (s *service) recordMutation(ctx context.Context, namespace string, operation MutationOperation, oldValue, newValue *Memory) {
+	mutation := &MemoryMutation{
+		ID:        uuid.NewString(),
+		Namespace: namespace,
+		Operation: operation,
+		Actor:     ActorFromContext(ctx),
+		ThreadID:  ScopeFromContext(ctx).ThreadID,
+		OldValue:  snapshot(oldValue),
+		NewValue:  snapshot(newValue),
+		CreatedAt: time.Now(),
+	}
+	if newValue != nil {
+		mutation.Key = newValue.Key
+	} else if oldValue != nil {
+		mutation.Key = oldValue.Key
+	}
+
+	if err := s.store.AppendMutation(ctx, mutation); err != nil {
+		s.logger.Warn("failed to record memory history", "key", mutation.Key, "operation", operation, "error", err)
+	}
+}
+
+// snapshot copies a memory without its embedding for the history
+func snapshot(memory *Memory) *Memory {
+	if memory == nil {
+		return nil
+	}
+	copied := *memory
+	copied.Tags = append([]string(nil), memory.Tags...)
+	copied.Embedding = nil
+	return &copied
+}
@@ -0,0 +1,122 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/mokiat/gog"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActorFromContext(t *testing.T) {
+	assert.Equal(t, memory.Actor{Type: memory.ActorSystem}, memory.ActorFromContext(t.Context()))
+
+	actor := memory.Actor{Type: memory.ActorAgent, Name: "assistant", RunID: "run-1"}
+	assert.Equal(t, actor, memory.ActorFromContext(memory.WithActor(t.Context(), actor)))
+}
+
+func TestService_HistoryAndRollback(t *testing.T) {
+	store := memory.NewInMemoryStore()
+	service := newTestService(t, store, config.NewMemoryConfig())
+
+	ctx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice", ThreadID: "thread-1"})
+	ctx = memory.WithActor(ctx, memory.Actor{Type: memory.ActorAgent, Name: "assistant", RunID: "run-1"})
+
+	_, err := service.RememberMemory(ctx, memory.RememberInput{Key: "user_preference_coffee", Value: "dark roast"})
+	require.NoError(t, err)
+
+	userCtx := memory.WithActor(ctx, memory.Actor{Type: memory.ActorUser, Name: "alice"})
+	_, err = service.UpdateMemory(userCtx, "user_preference_coffee", memory.UpdateMemoryInput{Value: gog.PtrOf("light roast")})
+	require.NoError(t, err)
+
+	require.NoError(t, service.DeleteMemory(ctx, "user_preference_coffee"))
+
+	history, err := service.ListHistory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+
+	assert.Equal(t, 1, history[0].Version)
+	assert.Equal(t, memory.MutationCreate, history[0].Operation)
+	assert.Equal(t, memory.Actor{Type: memory.ActorAgent, Name: "assistant", RunID: "run-1"}, history[0].Actor)
+	assert.Equal(t, "thread-1", history[0].ThreadID)
+	assert.Nil(t, history[0].OldValue)
+	assert.Equal(t, "dark roast", history[0].NewValue.Value)
+	assert.Empty(t, history[0].NewValue.Embedding)
+
+	assert.Equal(t, 2, history[1].Version)
+	assert.Equal(t, memory.MutationUpdate, history[1].Operation)
+	assert.Equal(t, memory.ActorUser, history[1].Actor.Type)
+	assert.Equal(t, "dark roast", history[1].OldValue.Value)
+	assert.Equal(t, "light roast", history[1].NewValue.Value)
+
+	assert.Equal(t, memory.MutationDelete, history[2].Operation)
+	assert.Equal(t, "light roast", history[2].OldValue.Value)
+	assert.Nil(t, history[2].NewValue)
+
+	// Roll back to the first version restores the deleted memory
+	restored, err := service.Rollback(ctx, "user_preference_coffee", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "dark roast", restored.Value)
+
+	stored, err := service.GetMemory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	assert.Equal(t, "dark roast", stored.Value)
+	assert.NotEmpty(t, stored.Embedding)
+
+	history, err = service.ListHistory(ctx, "user_preference_coffee")
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	assert.Equal(t, memory.MutationRollback, history[3].Operation)
+	assert.Nil(t, history[3].OldValue)
+
+	// Rolling back to a deletion deletes the memory again
+	restored, err = service.Rollback(ctx, "user_preference_coffee", 3)
+	require.NoError(t, err)
+	assert.Nil(t, restored)
+	_, err = service.GetMemory(ctx, "user_preference_coffee")
+	require.Error(t, err)
+
+	_, err = service.Rollback(ctx, "user_preference_coffee", 42)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "version 42")
+
+	// History is per namespace
+	history, err = service.ListHistory(t.Context(), "user_preference_coffee")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+// failingGetStore fails every Get with err
+type failingGetStore struct {
+	memory.Store
+	err error
+}
+
+func (s *failingGetStore) Get(ctx context.Context, namespace string, key string) (*memory.Memory, error) {
+	return nil, s.err
+}
+
+func TestService_DeleteAndRollbackStoreErrors(t *testing.T) {
+	store := &failingGetStore{Store: memory.NewInMemoryStore(), err: errors.New("disk I/O error")}
+	service := newTestService(t, store, config.NewMemoryConfig())
+	ctx := t.Context()
+
+	_, err := service.RememberMemory(ctx, memory.RememberInput{Key: "user_preference_coffee", Value: "dark roast"})
+	require.NoError(t, err)
+
+	err = service.DeleteMemory(ctx, "user_preference_coffee")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk I/O error")
+
+	_, err = service.Rollback(ctx, "user_preference_coffee", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk I/O error")
+
+	// Missing memories are still not an error
+	store.err = errors.Wrap(memory.ErrMemoryNotFound, "key 'user_preference_tea'")
+	require.NoError(t, service.DeleteMemory(ctx, "user_preference_tea"))
+}
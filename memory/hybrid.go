@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type (
+	// SearchOptions narrows and cuts off memory search results
+	SearchOptions struct {
+		// Tags keeps only memories having at least one of the tags
+		Tags []string `json:"tags,omitempty"`
+		// Source keeps only memories from the given source (user, agent)
+		Source MemorySource `json:"source,omitempty"`
+		// MinScore drops results whose score is below the threshold (0.0~1.0). Scores
+		// are fused ranks: 1.0 for a memory ranked first by both meaning and
+		// keywords, at most 0.5 for one found by only one of them.
+		MinScore float64 `json:"min_score,omitempty"`
+	}
+)
+
+const (
+	// rrfK is the rank constant of reciprocal rank fusion
+	rrfK = 60
+
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Matches reports whether the memory passes the tag and source filters.
+// Expired and superseded memories never match.
+func (o SearchOptions) Matches(memory *Memory) bool {
+	if memory.Expired(time.Now()) || memory.SupersededBy != "" {
+		return false
+	}
+	if o.Source != "" && memory.Source != o.Source {
+		return false
+	}
+	if len(o.Tags) > 0 && !slices.ContainsFunc(o.Tags, func(tag string) bool {
+		return slices.ContainsFunc(memory.Tags, func(t string) bool {
+			return strings.EqualFold(t, tag)
+		})
+	}) {
+		return false
+	}
+	return true
+}
+
+// tokenize splits text into lowercase terms. Underscores separate terms so that
+// keys like user_location_city match their words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// memoryTerms returns the searchable terms of a memory: its key, value and tags
+func memoryTerms(memory *Memory) []string {
+	terms := tokenize(memory.Key)
+	terms = append(terms, tokenize(memory.Value)...)
+	for _, tag := range memory.Tags {
+		terms = append(terms, tokenize(tag)...)
+	}
+	return terms
+}
+
+// keywordSearch ranks the memories against the query with BM25.
+// Only memories matching at least one query term are returned.
+func keywordSearch(query string, memories []*Memory) []ScoredMemory {
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 || len(memories) == 0 {
+		return nil
+	}
+
+	// Build term frequencies and document lengths
+	termFreqs := make([]map[string]int, len(memories))
+	docFreqs := make(map[string]int)
+	totalLength := 0
+	for i, memory := range memories {
+		terms := memoryTerms(memory)
+		totalLength += len(terms)
+
+		freqs := make(map[string]int, len(terms))
+		for _, term := range terms {
+			freqs[term]++
+		}
+		for term := range freqs {
+			docFreqs[term]++
+		}
+		termFreqs[i] = freqs
+	}
+
+	numDocs := float64(len(memories))
+	avgLength := float64(totalLength) / numDocs
+
+	var results []ScoredMemory
+	for i, memory := range memories {
+		docLength := 0
+		for _, freq := range termFreqs[i] {
+			docLength += freq
+		}
+
+		var score float64
+		for _, term := range queryTerms {
+			freq := float64(termFreqs[i][term])
+			if freq == 0 {
+				continue
+			}
+			df := float64(docFreqs[term])
+			idf := math.Log(1 + (numDocs-df+0.5)/(df+0.5))
+			score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*(1-bm25B+bm25B*float64(docLength)/avgLength))
+		}
+
+		if score > 0 {
+			results = append(results, ScoredMemory{Memory: memory, Score: score, KeywordScore: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
+
+// fuseResults combines the vector and keyword rankings with reciprocal rank fusion.
+// Every result is scored on the same scale: the sum of its reciprocal ranks,
+// normalized so that a memory ranked first by both rankings scores 1.0. A memory
+// found by only one ranking scores at most 0.5. A memory whose key is exactly
+// the query counts as the first of both rankings, so it is pinned to the top.
+func fuseResults(query string, vectorResults []ScoredMemory, keywordResults []ScoredMemory) []ScoredMemory {
+	isExactKey := func(result ScoredMemory) bool {
+		return strings.EqualFold(result.Memory.Key, strings.TrimSpace(query))
+	}
+	var exact *Memory
+	if i := slices.IndexFunc(vectorResults, isExactKey); i >= 0 {
+		exact = vectorResults[i].Memory
+	} else if i := slices.IndexFunc(keywordResults, isExactKey); i >= 0 {
+		exact = keywordResults[i].Memory
+	}
+	if exact != nil {
+		vectorResults = pinFirst(vectorResults, exact)
+		keywordResults = pinFirst(keywordResults, exact)
+	}
+
+	type fused struct {
+		result ScoredMemory
+		rrf    float64
+	}
+
+	byKey := make(map[string]*fused)
+	order := make([]string, 0, len(vectorResults)+len(keywordResults))
+	add := func(result ScoredMemory, rank int, keyword bool) {
+		f, ok := byKey[result.Memory.Key]
+		if !ok {
+			f = &fused{result: ScoredMemory{Memory: result.Memory}}
+			byKey[result.Memory.Key] = f
+			order = append(order, result.Memory.Key)
+		}
+		f.rrf += 1.0 / float64(rrfK+rank+1)
+		if keyword {
+			f.result.KeywordScore = result.KeywordScore
+		} else {
+			f.result.VectorScore = result.VectorScore
+		}
+	}
+
+	for rank, result := range vectorResults {
+		add(result, rank, false)
+	}
+	for rank, result := range keywordResults {
+		add(result, rank, true)
+	}
+
+	maxRRF := 2.0 / float64(rrfK+1)
+	results := make([]ScoredMemory, 0, len(order))
+	for _, key := range order {
+		f := byKey[key]
+		f.result.Score = f.rrf / maxRRF
+		results = append(results, f.result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
+
+// pinFirst moves the result of the memory to the front of results, adding it
+// when results do not have it
+func pinFirst(results []ScoredMemory, memory *Memory) []ScoredMemory {
+	pinned := make([]ScoredMemory, 1, len(results)+1)
+	pinned[0] = ScoredMemory{Memory: memory}
+	for _, result := range results {
+		if result.Memory.Key == memory.Key {
+			pinned[0] = result
+			continue
+		}
+		pinned = append(pinned, result)
+	}
+	return pinned
+}
+
+// finalizeResults applies the minimum score and the limit to ranked results
+func finalizeResults(results []ScoredMemory, opts SearchOptions, limit uint) []ScoredMemory {
+	if opts.MinScore > 0 {
+		results = slices.DeleteFunc(results, func(result ScoredMemory) bool {
+			return result.Score < opts.MinScore
+		})
+	}
+
+	if limit > 0 && uint(len(results)) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
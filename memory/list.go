@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	ListSortField = string
+
+	// ListOptions filters, sorts and paginates memory listings
+	ListOptions struct {
+		// Tags keeps only memories having at least one of the tags
+		Tags []string `json:"tags,omitempty"`
+		// Source keeps only memories from the given source (user, agent)
+		Source MemorySource `json:"source,omitempty"`
+		// KeyPrefix keeps only memories whose key starts with the prefix
+		KeyPrefix string `json:"key_prefix,omitempty"`
+		// ActiveOnly drops expired and superseded memories
+		ActiveOnly bool `json:"active_only,omitempty"`
+
+		// SortBy is the sort field; ListSortByKey when empty
+		SortBy ListSortField `json:"sort_by,omitempty"`
+		// Descending reverses the sort order
+		Descending bool `json:"descending,omitempty"`
+
+		// Cursor continues a previous listing from its NextCursor
+		Cursor string `json:"cursor,omitempty"`
+		// Limit is the page size; 0 lists every memory
+		Limit int `json:"limit,omitempty"`
+	}
+
+	// MemoryList is a page of memories
+	MemoryList struct {
+		Memories []*Memory `json:"memories"`
+		// NextCursor continues the listing, empty on the last page
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+
+	// listCursor holds the sort values of the last memory of a page
+	listCursor struct {
+		Key        string    `json:"k"`
+		CreatedAt  time.Time `json:"c,omitzero"`
+		UpdatedAt  time.Time `json:"u,omitzero"`
+		Importance float64   `json:"i,omitempty"`
+	}
+)
+
+const (
+	ListSortByKey        ListSortField = "key"
+	ListSortByCreatedAt  ListSortField = "created_at"
+	ListSortByUpdatedAt  ListSortField = "updated_at"
+	ListSortByImportance ListSortField = "importance"
+)
+
+// Matches reports whether the memory passes the filters of the options
+func (o ListOptions) Matches(memory *Memory, now time.Time) bool {
+	if o.ActiveOnly && (memory.Expired(now) || memory.SupersededBy != "") {
+		return false
+	}
+	if !strings.HasPrefix(memory.Key, o.KeyPrefix) {
+		return false
+	}
+	if o.Source != "" && memory.Source != o.Source {
+		return false
+	}
+	if len(o.Tags) > 0 && !slices.ContainsFunc(o.Tags, func(tag string) bool {
+		return slices.ContainsFunc(memory.Tags, func(t string) bool {
+			return strings.EqualFold(t, tag)
+		})
+	}) {
+		return false
+	}
+	return true
+}
+
+// paginate filters, sorts and pages the memories per the options
+func paginate(memories []*Memory, opts ListOptions) (*MemoryList, error) {
+	compare, err := memoryComparator(opts.SortBy, opts.Descending)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Limit < 0 {
+		return nil, errors.Errorf("invalid limit: %d", opts.Limit)
+	}
+
+	now := time.Now()
+	filtered := make([]*Memory, 0, len(memories))
+	for _, memory := range memories {
+		if opts.Matches(memory, now) {
+			filtered = append(filtered, memory)
+		}
+	}
+	slices.SortFunc(filtered, compare)
+
+	if opts.Cursor != "" {
+		after, err := decodeListCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start, _ := slices.BinarySearchFunc(filtered, after, compare)
+		for start < len(filtered) && compare(filtered[start], after) <= 0 {
+			start++
+		}
+		filtered = filtered[start:]
+	}
+
+	list := &MemoryList{Memories: filtered}
+	if opts.Limit > 0 && len(filtered) > opts.Limit {
+		list.Memories = filtered[:opts.Limit]
+		list.NextCursor = encodeListCursor(list.Memories[opts.Limit-1])
+	}
+
+	return list, nil
+}
+
+// memoryComparator orders memories by the sort field, then by key
+func memoryComparator(sortBy ListSortField, descending bool) (func(a, b *Memory) int, error) {
+	var compareField func(a, b *Memory) int
+	switch sortBy {
+	case "", ListSortByKey:
+		compareField = func(a, b *Memory) int { return 0 }
+	case ListSortByCreatedAt:
+		compareField = func(a, b *Memory) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case ListSortByUpdatedAt:
+		compareField = func(a, b *Memory) int { return a.UpdatedAt.Compare(b.UpdatedAt) }
+	case ListSortByImportance:
+		compareField = func(a, b *Memory) int { return cmp.Compare(a.Importance, b.Importance) }
+	default:
+		return nil, errors.Errorf("invalid sort field: %s", sortBy)
+	}
+
+	return func(a, b *Memory) int {
+		c := compareField(a, b)
+		if c == 0 {
+			c = strings.Compare(a.Key, b.Key)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}, nil
+}
+
+// encodeListCursor stores every sort value of the memory so that a cursor is
+// independent of the sort field
+func encodeListCursor(memory *Memory) string {
+	data, _ := json.Marshal(listCursor{
+		Key:        memory.Key,
+		CreatedAt:  memory.CreatedAt,
+		UpdatedAt:  memory.UpdatedAt,
+		Importance: memory.Importance,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor returns the position of a cursor as a memory to compare against
+func decodeListCursor(cursor string) (*Memory, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrapf(err, "invalid cursor")
+	}
+	return &Memory{
+		Key:        c.Key,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		Importance: c.Importance,
+	}, nil
+}
@@ -1,5 +1,7 @@
 package memory
 
+import "time"
+
 type (
 	Memory struct {
 		Key    string       `json:"key" jsonschema:"description=The key of the memory. This is the key of the memory."`
@@ -7,19 +9,60 @@ type (
 		Source MemorySource `json:"source" jsonschema:"description=The source of the memory. This is the origin of the memory."`
 		Tags   []string     `json:"tags,omitempty" jsonschema:"description=The tags of the memory. This is the metadata of the memory."`
 
+		Namespace string `json:"namespace,omitempty" jsonschema:"description=The namespace the memory belongs to (user, agent and thread scope)."`
+
+		Importance     float64    `json:"importance" jsonschema:"description=How important the memory is (0.0~1.0). Important memories rank higher and are kept longer."`
+		CreatedAt      time.Time  `json:"created_at,omitzero" jsonschema:"description=When the memory was first stored."`
+		UpdatedAt      time.Time  `json:"updated_at,omitzero" jsonschema:"description=When the memory was last changed."`
+		LastAccessedAt time.Time  `json:"last_accessed_at,omitzero" jsonschema:"description=When the memory was last recalled or found by a search."`
+		ExpiresAt      *time.Time `json:"expires_at,omitempty" jsonschema:"description=When the memory expires. Expired memories are no longer returned and get pruned."`
+
+		// SupersededBy is the key of the memory that replaced this outdated one
+		SupersededBy string `json:"superseded_by,omitempty" jsonschema:"description=The key of the memory that replaced this outdated memory."`
+
 		Embedding []float32 `json:"-"`
 	}
 
 	MemorySource = string
 
-	// ScoredMemory holds a memory with its similarity score
+	// ScoredMemory holds a memory with its relevance score.
+	// Score is the reciprocal rank fusion of the vector and keyword rankings,
+	// normalized so that a memory ranked first by both scores 1.0.
 	ScoredMemory struct {
 		Memory *Memory `json:"memory" jsonschema:"description=The memory that was found"`
-		Score  float64 `json:"score" jsonschema:"description=The similarity score of the memory to the query (0.0~1.0)"`
+		Score  float64 `json:"score" jsonschema:"description=The relevance score of the memory to the query (0.0~1.0)"`
+
+		// VectorScore is the embedding similarity (0.0~1.0), zero when not ranked by vector
+		VectorScore float64 `json:"vector_score,omitempty" jsonschema:"description=The embedding similarity of the memory to the query (0.0~1.0)"`
+		// KeywordScore is the BM25 keyword relevance, zero when no query term matched
+		KeywordScore float64 `json:"keyword_score,omitempty" jsonschema:"description=The BM25 keyword relevance of the memory to the query"`
 	}
 )
 
 const (
 	MemorySourceUser  MemorySource = "user"
 	MemorySourceAgent MemorySource = "agent"
+
+	// DefaultImportance is used when a memory is stored without an importance
+	DefaultImportance = 0.5
 )
+
+// Expired reports whether the memory has passed its expiry time
+func (m *Memory) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// clone copies the memory so that callers can change it without touching the stored one
+func (m *Memory) clone() *Memory {
+	copied := *m
+	copied.Tags = append([]string(nil), m.Tags...)
+	return &copied
+}
+
+// lastActivity returns the latest of the update and access times
+func (m *Memory) lastActivity() time.Time {
+	if m.LastAccessedAt.After(m.UpdatedAt) {
+		return m.LastAccessedAt
+	}
+	return m.UpdatedAt
+}
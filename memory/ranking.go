@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+)
+
+// rankByRecencyAndImportance blends the relevance score of each result with
+// the memory's recency and importance, weighted by the memory configuration:
+//
+//	score = (1 - wr - wi) * relevance + wr * recency + wi * importance
+//
+// Recency halves every RecencyHalfLife since the memory was last updated. Accesses
+// do not count, since every search records one for its hits and would otherwise
+// reorder the next search.
+func rankByRecencyAndImportance(results []ScoredMemory, memoryConfig *config.MemoryConfig, now time.Time) []ScoredMemory {
+	recencyWeight := max(memoryConfig.RecencyWeight, 0)
+	importanceWeight := max(memoryConfig.ImportanceWeight, 0)
+	if recencyWeight+importanceWeight == 0 {
+		return results
+	}
+	if total := recencyWeight + importanceWeight; total > 1 {
+		recencyWeight, importanceWeight = recencyWeight/total, importanceWeight/total
+	}
+
+	for i := range results {
+		memory := results[i].Memory
+		results[i].Score = (1-recencyWeight-importanceWeight)*results[i].Score +
+			recencyWeight*recency(memory, memoryConfig.RecencyHalfLife, now) +
+			importanceWeight*memory.Importance
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
+
+// recency returns 1.0 for a memory updated just now, decaying by half every halfLife
+func recency(memory *Memory, halfLife time.Duration, now time.Time) float64 {
+	if memory.UpdatedAt.IsZero() || halfLife <= 0 {
+		return 0
+	}
+
+	idle := now.Sub(memory.UpdatedAt)
+	if idle <= 0 {
+		return 1
+	}
+
+	return math.Pow(0.5, float64(idle)/float64(halfLife))
+}
+
+// prunable reports whether the memory is expired or of low value per the memory configuration
+func prunable(memory *Memory, memoryConfig *config.MemoryConfig, now time.Time) bool {
+	if memory.Expired(now) {
+		return true
+	}
+
+	if memoryConfig.PruneMinImportance <= 0 || memoryConfig.PruneMaxIdle <= 0 {
+		return false
+	}
+
+	lastActivity := memory.lastActivity()
+	if lastActivity.IsZero() {
+		lastActivity = memory.CreatedAt
+	}
+
+	return memory.Importance < memoryConfig.PruneMinImportance && now.Sub(lastActivity) >= memoryConfig.PruneMaxIdle
+}
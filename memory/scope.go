@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"strings"
+)
+
+type (
+	// Scope identifies who a memory belongs to. It is carried through the
+	// context so that memory tools operate on the caller's namespace.
+	Scope struct {
+		UserID    string `json:"user_id,omitempty"`
+		AgentName string `json:"agent_name,omitempty"`
+		ThreadID  string `json:"thread_id,omitempty"`
+	}
+
+	scopeContextKeyType string
+)
+
+const (
+	// DefaultNamespace is the namespace used when no scope is set in the context
+	DefaultNamespace = ""
+)
+
+var (
+	scopeContextKey = scopeContextKeyType("ctx.memoryScope")
+)
+
+// WithScope returns a copy of ctx that carries the given memory scope
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey, scope)
+}
+
+// ScopeFromContext returns the memory scope stored in ctx, or an empty scope
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, ok := ctx.Value(scopeContextKey).(Scope)
+	if !ok {
+		return Scope{}
+	}
+	return scope
+}
+
+// Namespace converts the scope into a namespace string
+// e.g. "user:alice/agent:assistant" or "user:alice/agent:assistant/thread:42"
+func (s Scope) Namespace(includeThread bool) string {
+	parts := make([]string, 0, 3)
+	if s.UserID != "" {
+		parts = append(parts, "user:"+s.UserID)
+	}
+	if s.AgentName != "" {
+		parts = append(parts, "agent:"+s.AgentName)
+	}
+	if includeThread && s.ThreadID != "" {
+		parts = append(parts, "thread:"+s.ThreadID)
+	}
+	return strings.Join(parts, "/")
+}
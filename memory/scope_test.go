@@ -0,0 +1,27 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope_Namespace(t *testing.T) {
+	scope := memory.Scope{UserID: "alice", AgentName: "assistant", ThreadID: "42"}
+
+	assert.Equal(t, "user:alice/agent:assistant", scope.Namespace(false))
+	assert.Equal(t, "user:alice/agent:assistant/thread:42", scope.Namespace(true))
+	assert.Equal(t, "agent:assistant", memory.Scope{AgentName: "assistant"}.Namespace(true))
+	assert.Equal(t, memory.DefaultNamespace, memory.Scope{}.Namespace(true))
+}
+
+func TestScope_Context(t *testing.T) {
+	ctx := t.Context()
+
+	assert.Equal(t, memory.Scope{}, memory.ScopeFromContext(ctx))
+
+	scope := memory.Scope{UserID: "alice", AgentName: "assistant"}
+	ctx = memory.WithScope(ctx, scope)
+	assert.Equal(t, scope, memory.ScopeFromContext(ctx))
+}
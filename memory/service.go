@@ -2,12 +2,15 @@ package memory
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"sync"
+	"time"
 
-	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/habiliai/agentruntime/config"
 	internalgenkit "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/mokiat/gog"
 	"github.com/pkg/errors"
 )
 
@@ -17,30 +20,80 @@ type (
 		Value  string   `json:"value"`
 		Source string   `json:"source"`
 		Tags   []string `json:"tags,omitempty"`
+
+		// Importance is in 0.0~1.0; DefaultImportance is used when nil
+		Importance *float64 `json:"importance,omitempty"`
+		// TTL is the lifetime of the memory; MemoryConfig.DefaultTTL is used when 0
+		TTL time.Duration `json:"ttl,omitempty"`
 	}
 
 	UpdateMemoryInput struct {
 		Value *string  `json:"value"`
 		Tags  []string `json:"tags,omitempty"`
+
+		Importance *float64 `json:"importance,omitempty"`
+		// TTL restarts the lifetime of the memory from now; 0 removes the expiry
+		TTL *time.Duration `json:"ttl,omitempty"`
 	}
 
 	Service interface {
 		RememberMemory(ctx context.Context, input RememberInput) (*Memory, error)
-		SearchMemory(ctx context.Context, query string, limit int) ([]ScoredMemory, error)
+		SearchMemory(ctx context.Context, query string, limit int, opts SearchOptions) ([]ScoredMemory, error)
 		UpdateMemory(ctx context.Context, key string, input UpdateMemoryInput) (*Memory, error)
 		GetMemory(ctx context.Context, key string) (*Memory, error)
 		DeleteMemory(ctx context.Context, key string) error
-		ListMemories(ctx context.Context) ([]*Memory, error)
+		// ListMemories lists the memories that have not expired or been superseded
+		ListMemories(ctx context.Context, opts ListOptions) (*MemoryList, error)
 		GenerateKey(ctx context.Context, input string, tags []string, prompt string, existingKeys []string) (string, error)
 		GenerateTags(ctx context.Context, input string, prompt string, existingTags []string) ([]string, error)
+
+		// ListNamespaces returns all namespaces that hold memories
+		ListNamespaces(ctx context.Context) ([]string, error)
+		// DeleteNamespace removes every memory in the given namespace
+		DeleteNamespace(ctx context.Context, namespace string) error
+
+		// Consolidate merges near-duplicate memories of the current namespace or
+		// marks outdated ones superseded, and returns the audit records
+		Consolidate(ctx context.Context, opts ConsolidateOptions) ([]*Consolidation, error)
+		// ListConsolidations returns the consolidation audit records of the current namespace
+		ListConsolidations(ctx context.Context) ([]*Consolidation, error)
+
+		// ListHistory returns the recorded changes of the memory with the given key, oldest first
+		ListHistory(ctx context.Context, key string) ([]*MemoryMutation, error)
+		// Rollback restores the memory with the given key to the value it had after the given version
+		Rollback(ctx context.Context, key string, version int) (*Memory, error)
+
+		// ExportMemories writes every memory of the current namespace to w
+		ExportMemories(ctx context.Context, w io.Writer, opts ExportOptions) error
+		// ImportMemories loads memories from r into the current namespace, recomputing missing embeddings
+		ImportMemories(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportResult, error)
+
+		// RecordEpisode stores the summary of a conversation thread as an episode
+		// of the current user and agent, replacing the previous one of the thread
+		RecordEpisode(ctx context.Context, input RecordEpisodeInput) (*Episode, error)
+		// RecallEpisodes searches the episodes of the current user and agent across threads
+		RecallEpisodes(ctx context.Context, query string, limit int, opts EpisodeSearchOptions) ([]ScoredEpisode, error)
+		// ListEpisodes returns the episodes of the current user and agent, oldest first
+		ListEpisodes(ctx context.Context) ([]*Episode, error)
+
+		// Prune removes expired and low-value memories from every namespace
+		// and returns the number of removed memories
+		Prune(ctx context.Context) (int, error)
+
+		// Close stops the background jobs and releases the resources held by the underlying store
+		Close() error
 	}
 
 	service struct {
 		store        Store
-		embedder     ai.Embedder
+		embedder     Embedder
 		genkit       *genkit.Genkit
 		memoryConfig *config.MemoryConfig
 		logger       *slog.Logger
+
+		// cancel stops the background jobs, wg waits for them to finish
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
 	}
 )
 
@@ -48,27 +101,89 @@ var (
 	_ Service = (*service)(nil)
 )
 
+// NewServiceWithStore creates a memory service with a custom store and the embedder selected by memoryConfig
 func NewServiceWithStore(ctx context.Context, store Store, modelConfig *config.ModelConfig, memoryConfig *config.MemoryConfig, logger *slog.Logger) (Service, error) {
 	g, err := internalgenkit.NewGenkit(ctx, modelConfig, logger, modelConfig.TraceVerbose)
 	if err != nil {
 		return nil, err
 	}
 
-	embedder := genkit.LookupEmbedder(g, "openai", "text-embedding-3-small")
+	embedder, err := NewEmbedder(g, memoryConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	return &service{store: store, embedder: embedder, genkit: g, memoryConfig: memoryConfig, logger: logger}, nil
+	return newService(g, store, embedder, memoryConfig, logger)
 }
 
+// NewServiceWithEmbedder creates a memory service with a custom store and embedder
+func NewServiceWithEmbedder(ctx context.Context, store Store, embedder Embedder, modelConfig *config.ModelConfig, memoryConfig *config.MemoryConfig, logger *slog.Logger) (Service, error) {
+	g, err := internalgenkit.NewGenkit(ctx, modelConfig, logger, modelConfig.TraceVerbose)
+	if err != nil {
+		return nil, err
+	}
+
+	return newService(g, store, embedder, memoryConfig, logger)
+}
+
+// NewService creates a memory service with the store and embedder selected by memoryConfig
 func NewService(ctx context.Context, modelConfig *config.ModelConfig, memoryConfig *config.MemoryConfig, logger *slog.Logger) (Service, error) {
-	return NewServiceWithStore(ctx, NewInMemoryStore(), modelConfig, memoryConfig, logger)
+	g, err := internalgenkit.NewGenkit(ctx, modelConfig, logger, modelConfig.TraceVerbose)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder, err := NewEmbedder(g, memoryConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewStore(memoryConfig, embedder.Dimension())
+	if err != nil {
+		return nil, err
+	}
+
+	return newService(g, store, embedder, memoryConfig, logger)
+}
+
+func newService(g *genkit.Genkit, store Store, embedder Embedder, memoryConfig *config.MemoryConfig, logger *slog.Logger) (*service, error) {
+	if embedder == nil {
+		return nil, errors.New("memory embedder is required")
+	}
+
+	// Stores with a fixed vector size must match the embedder
+	if sized, ok := store.(interface{ Dimension() int }); ok && sized.Dimension() != embedder.Dimension() {
+		return nil, errors.Errorf("memory store dimension %d does not match the embedder dimension %d", sized.Dimension(), embedder.Dimension())
+	}
+
+	if memoryConfig == nil {
+		memoryConfig = config.NewMemoryConfig()
+	}
+
+	s := &service{store: store, embedder: embedder, genkit: g, memoryConfig: memoryConfig, logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	if memoryConfig.PruneInterval > 0 {
+		s.runPeriodically(ctx, "prune", memoryConfig.PruneInterval, func(ctx context.Context) error {
+			pruned, err := s.Prune(ctx)
+			if err == nil && pruned > 0 {
+				s.logger.Info("pruned memories", "count", pruned)
+			}
+			return err
+		})
+	}
+	if memoryConfig.ConsolidationInterval > 0 {
+		s.runPeriodically(ctx, "consolidate", memoryConfig.ConsolidationInterval, s.consolidateAll)
+	}
+
+	return s, nil
 }
 
 // RememberMemories creates and stores memories from the given inputs
 func (s *service) RememberMemory(ctx context.Context, input RememberInput) (*Memory, error) {
 	// Generate embedding for the input
-	embedding, err := s.embedder.Embed(ctx, &ai.EmbedRequest{
-		Input: []*ai.Document{{Content: []*ai.Part{ai.NewTextPart(input.Value)}}},
-	})
+	embeddings, err := s.embedder.EmbedDocuments(ctx, input.Value)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to generate embedding for input '%s'", input.Value)
 	}
@@ -79,45 +194,81 @@ func (s *service) RememberMemory(ctx context.Context, input RememberInput) (*Mem
 		source = MemorySourceUser
 	}
 
+	importance := DefaultImportance
+	if input.Importance != nil {
+		importance = *input.Importance
+	}
+	if importance < 0 || importance > 1 {
+		return nil, errors.Errorf("importance must be between 0 and 1, got %v", importance)
+	}
+
 	// Create memory with ULID
+	now := time.Now()
 	memory := &Memory{
-		Key:       input.Key,
-		Value:     input.Value,
-		Source:    MemorySource(source),
-		Tags:      input.Tags,
-		Embedding: embedding.Embeddings[0].Embedding,
+		Key:            input.Key,
+		Value:          input.Value,
+		Source:         MemorySource(source),
+		Tags:           input.Tags,
+		Namespace:      s.namespace(ctx),
+		Importance:     importance,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		LastAccessedAt: now,
+		Embedding:      embeddings[0],
+	}
+
+	ttl := input.TTL
+	if ttl == 0 {
+		ttl = s.memoryConfig.DefaultTTL
+	}
+	if ttl > 0 {
+		memory.ExpiresAt = gog.PtrOf(now.Add(ttl))
 	}
 
 	// Store memory
 	if err := s.store.Set(ctx, memory); err != nil {
 		return nil, errors.Wrapf(err, "failed to store memory")
 	}
+	s.recordMutation(ctx, memory.Namespace, MutationCreate, nil, memory)
 
 	return memory, nil
 }
 
-// SearchMemory searches for memories similar to the given query
-func (s *service) SearchMemory(ctx context.Context, query string, limit int) ([]ScoredMemory, error) {
+// SearchMemory searches for memories relevant to the given query by meaning and keywords.
+// opts filters the memories by tags and source and drops results below opts.MinScore.
+func (s *service) SearchMemory(ctx context.Context, query string, limit int, opts SearchOptions) ([]ScoredMemory, error) {
 	if query == "" {
 		return nil, errors.Errorf("query cannot be empty")
 	}
 
 	// Generate embedding for the query
-	embedding, err := s.embedder.Embed(ctx, &ai.EmbedRequest{
-		Input: []*ai.Document{{Content: []*ai.Part{ai.NewTextPart(query)}}},
-	})
+	queryEmbedding, err := s.embedder.EmbedQuery(ctx, query)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to generate embedding for query")
 	}
 
-	queryEmbedding := embedding.Embeddings[0].Embedding
-
-	// Search in store
-	results, err := s.store.Search(ctx, query, queryEmbedding, uint(limit))
+	// Search in store; every match is ranked so that recency and importance can reorder them
+	namespace := s.namespace(ctx)
+	results, err := s.store.Search(ctx, namespace, query, queryEmbedding, 0, SearchOptions{Tags: opts.Tags, Source: opts.Source})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to search memories")
 	}
 
+	now := time.Now()
+	results = rankByRecencyAndImportance(results, s.memoryConfig, now)
+	results = finalizeResults(results, opts, uint(max(limit, 0)))
+
+	keys := make([]string, 0, len(results))
+	for _, result := range results {
+		keys = append(keys, result.Memory.Key)
+	}
+	if err := s.store.Touch(ctx, namespace, keys, now); err != nil {
+		s.logger.Warn("failed to record memory access", "error", err)
+	}
+	for _, result := range results {
+		result.Memory.LastAccessedAt = now
+	}
+
 	return results, nil
 }
 
@@ -127,11 +278,22 @@ func (s *service) GetMemory(ctx context.Context, key string) (*Memory, error) {
 		return nil, errors.Errorf("memory ID cannot be empty")
 	}
 
-	memory, err := s.store.Get(ctx, key)
+	namespace := s.namespace(ctx)
+	memory, err := s.store.Get(ctx, namespace, key)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get memory")
 	}
 
+	now := time.Now()
+	if memory.Expired(now) {
+		return nil, errors.Wrapf(ErrMemoryNotFound, "key '%s'", key)
+	}
+
+	if err := s.store.Touch(ctx, namespace, []string{key}, now); err != nil {
+		s.logger.Warn("failed to record memory access", "error", err)
+	}
+	memory.LastAccessedAt = now
+
 	return memory, nil
 }
 
@@ -141,21 +303,32 @@ func (s *service) DeleteMemory(ctx context.Context, key string) error {
 		return errors.Errorf("memory key cannot be empty")
 	}
 
-	if err := s.store.Delete(ctx, key); err != nil {
+	namespace := s.namespace(ctx)
+	memory, err := s.store.Get(ctx, namespace, key)
+	if errors.Is(err, ErrMemoryNotFound) {
+		// Deleting a missing memory is a no-op
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get memory")
+	}
+
+	if err := s.store.Delete(ctx, namespace, key); err != nil {
 		return errors.Wrapf(err, "failed to delete memory")
 	}
+	s.recordMutation(ctx, namespace, MutationDelete, memory, nil)
 
 	return nil
 }
 
-// ListMemories returns all stored memories
-func (s *service) ListMemories(ctx context.Context) ([]*Memory, error) {
-	memories, err := s.store.List(ctx)
+// ListMemories returns a page of the stored memories that have not expired or been superseded
+func (s *service) ListMemories(ctx context.Context, opts ListOptions) (*MemoryList, error) {
+	opts.ActiveOnly = true
+	list, err := s.store.List(ctx, s.namespace(ctx), opts)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to list memories")
 	}
 
-	return memories, nil
+	return list, nil
 }
 
 func (s *service) UpdateMemory(ctx context.Context, key string, input UpdateMemoryInput) (*Memory, error) {
@@ -163,26 +336,141 @@ func (s *service) UpdateMemory(ctx context.Context, key string, input UpdateMemo
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get memory")
 	}
+	old := snapshot(memory)
 
 	if input.Value != nil {
 		memory.Value = *input.Value
 		// Generate embedding for the input
-		embedding, err := s.embedder.Embed(ctx, &ai.EmbedRequest{
-			Input: []*ai.Document{{Content: []*ai.Part{ai.NewTextPart(memory.Value)}}},
-		})
+		embeddings, err := s.embedder.EmbedDocuments(ctx, memory.Value)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to generate embedding for input '%s'", memory.Value)
 		}
-		memory.Embedding = embedding.Embeddings[0].Embedding
+		memory.Embedding = embeddings[0]
 	}
 
 	if len(input.Tags) > 0 {
 		memory.Tags = input.Tags
 	}
 
+	if input.Importance != nil {
+		if *input.Importance < 0 || *input.Importance > 1 {
+			return nil, errors.Errorf("importance must be between 0 and 1, got %v", *input.Importance)
+		}
+		memory.Importance = *input.Importance
+	}
+
+	memory.UpdatedAt = time.Now()
+	if input.TTL != nil {
+		memory.ExpiresAt = nil
+		if *input.TTL > 0 {
+			memory.ExpiresAt = gog.PtrOf(memory.UpdatedAt.Add(*input.TTL))
+		}
+	}
+
 	if err := s.store.Replace(ctx, memory); err != nil {
 		return nil, errors.Wrapf(err, "failed to update memory")
 	}
+	s.recordMutation(ctx, memory.Namespace, MutationUpdate, old, memory)
 
 	return memory, nil
 }
+
+// ListNamespaces returns all namespaces that hold memories
+func (s *service) ListNamespaces(ctx context.Context) ([]string, error) {
+	namespaces, err := s.store.ListNamespaces(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list namespaces")
+	}
+
+	return namespaces, nil
+}
+
+// DeleteNamespace removes every memory in the given namespace together with its
+// history. The deletion of each memory is recorded in the emptied history by key
+// only, so the audit trail does not keep the removed values.
+func (s *service) DeleteNamespace(ctx context.Context, namespace string) error {
+	list, err := s.store.List(ctx, namespace, ListOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list memories in namespace '%s'", namespace)
+	}
+
+	if err := s.store.DeleteNamespace(ctx, namespace); err != nil {
+		return errors.Wrapf(err, "failed to delete namespace '%s'", namespace)
+	}
+
+	for _, memory := range list.Memories {
+		s.recordMutation(ctx, namespace, MutationDelete, &Memory{Namespace: namespace, Key: memory.Key}, nil)
+	}
+
+	return nil
+}
+
+// Prune removes expired and low-value memories from every namespace
+func (s *service) Prune(ctx context.Context) (int, error) {
+	namespaces, err := s.store.ListNamespaces(ctx)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to list namespaces")
+	}
+
+	now := time.Now()
+	pruned := 0
+	for _, namespace := range namespaces {
+		list, err := s.store.List(ctx, namespace, ListOptions{})
+		if err != nil {
+			return pruned, errors.Wrapf(err, "failed to list memories in namespace '%s'", namespace)
+		}
+
+		for _, memory := range list.Memories {
+			if !prunable(memory, s.memoryConfig, now) {
+				continue
+			}
+			if err := s.store.Delete(ctx, namespace, memory.Key); err != nil {
+				return pruned, errors.Wrapf(err, "failed to delete memory '%s'", memory.Key)
+			}
+			s.recordMutation(ctx, namespace, MutationPrune, memory, nil)
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// Close stops the background jobs and closes the underlying store if it holds resources
+func (s *service) Close() error {
+	s.cancel()
+	s.wg.Wait()
+
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// runPeriodically runs job every interval in the background until ctx is done
+func (s *service) runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ctx = WithActor(ctx, Actor{Type: ActorSystem, Name: name})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := job(ctx); err != nil && ctx.Err() == nil {
+					s.logger.Warn("memory background job failed", "job", name, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// namespace resolves the namespace of the memory scope carried by ctx
+func (s *service) namespace(ctx context.Context) string {
+	return ScopeFromContext(ctx).Namespace(s.memoryConfig.ThreadScoped)
+}
@@ -0,0 +1,283 @@
+package memory_test
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/mokiat/gog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEmbedder is a deterministic bag-of-words embedder for tests
+type fakeEmbedder struct {
+	dimension int
+}
+
+func (e *fakeEmbedder) EmbedDocuments(ctx context.Context, texts ...string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		embedding := make([]float32, e.dimension)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(word))
+			embedding[h.Sum32()%uint32(e.dimension)] += 1
+		}
+
+		var norm float64
+		for _, v := range embedding {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			for i := range embedding {
+				embedding[i] = float32(float64(embedding[i]) / math.Sqrt(norm))
+			}
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
+
+func (e *fakeEmbedder) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	embeddings, err := e.EmbedDocuments(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (e *fakeEmbedder) Dimension() int {
+	return e.dimension
+}
+
+func newTestService(t *testing.T, store memory.Store, memoryConfig *config.MemoryConfig) memory.Service {
+	service, err := memory.NewServiceWithEmbedder(t.Context(), store, &fakeEmbedder{dimension: 16}, &config.ModelConfig{}, memoryConfig, slog.Default())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = service.Close()
+	})
+	return service
+}
+
+func TestService_Namespaces(t *testing.T) {
+	service := newTestService(t, memory.NewInMemoryStore(), config.NewMemoryConfig())
+
+	aliceCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice", AgentName: "assistant", ThreadID: "1"})
+	bobCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "bob", AgentName: "assistant", ThreadID: "2"})
+
+	_, err := service.RememberMemory(aliceCtx, memory.RememberInput{Key: "user_name_full", Value: "Alice"})
+	require.NoError(t, err)
+	_, err = service.RememberMemory(bobCtx, memory.RememberInput{Key: "user_name_full", Value: "Bob"})
+	require.NoError(t, err)
+
+	// Memories are shared across threads of the same user and agent by default
+	otherThreadCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice", AgentName: "assistant", ThreadID: "3"})
+	mem, err := service.GetMemory(otherThreadCtx, "user_name_full")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", mem.Value)
+	assert.Equal(t, "user:alice/agent:assistant", mem.Namespace)
+
+	results, err := service.SearchMemory(bobCtx, "name", 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Bob", results[0].Memory.Value)
+
+	namespaces, err := service.ListNamespaces(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:alice/agent:assistant", "user:bob/agent:assistant"}, namespaces)
+
+	require.NoError(t, service.DeleteNamespace(t.Context(), "user:alice/agent:assistant"))
+	list, err := service.ListMemories(aliceCtx, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	assert.Empty(t, memories)
+
+	// The deletion is recorded without the deleted value
+	history, err := service.ListHistory(aliceCtx, "user_name_full")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, memory.MutationDelete, history[0].Operation)
+	assert.Equal(t, "user_name_full", history[0].OldValue.Key)
+	assert.Empty(t, history[0].OldValue.Value)
+}
+
+func TestService_ThreadScoped(t *testing.T) {
+	conf := config.NewMemoryConfig()
+	conf.ThreadScoped = true
+	service := newTestService(t, memory.NewInMemoryStore(), conf)
+
+	threadCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice", ThreadID: "1"})
+	_, err := service.RememberMemory(threadCtx, memory.RememberInput{Key: "conversation_topic", Value: "launch plan"})
+	require.NoError(t, err)
+
+	otherThreadCtx := memory.WithScope(t.Context(), memory.Scope{UserID: "alice", ThreadID: "2"})
+	_, err = service.GetMemory(otherThreadCtx, "conversation_topic")
+	require.Error(t, err)
+}
+
+func TestService_TimestampsAndTTL(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewInMemoryStore()
+	service := newTestService(t, store, config.NewMemoryConfig())
+
+	before := time.Now()
+	mem, err := service.RememberMemory(ctx, memory.RememberInput{Key: "user_name_full", Value: "Dennis Park"})
+	require.NoError(t, err)
+	assert.False(t, mem.CreatedAt.Before(before))
+	assert.Equal(t, mem.CreatedAt, mem.UpdatedAt)
+	assert.Equal(t, memory.DefaultImportance, mem.Importance)
+	assert.Nil(t, mem.ExpiresAt)
+
+	_, err = service.RememberMemory(ctx, memory.RememberInput{Key: "too_important", Value: "x", Importance: gog.PtrOf(1.5)})
+	require.Error(t, err)
+
+	temporary, err := service.RememberMemory(ctx, memory.RememberInput{Key: "user_trip_current", Value: "In Tokyo this week", TTL: time.Hour})
+	require.NoError(t, err)
+	require.NotNil(t, temporary.ExpiresAt)
+	assert.WithinDuration(t, temporary.CreatedAt.Add(time.Hour), *temporary.ExpiresAt, time.Second)
+
+	// Expired memories are hidden from get, list and search
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:       "user_trip_past",
+		Value:     "In Tokyo last month",
+		ExpiresAt: gog.PtrOf(time.Now().Add(-time.Minute)),
+		Embedding: mustEmbed(t, "In Tokyo last month"),
+	}))
+
+	_, err = service.GetMemory(ctx, "user_trip_past")
+	require.Error(t, err)
+
+	list, err := service.ListMemories(ctx, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	assert.Len(t, memories, 2)
+
+	results, err := service.SearchMemory(ctx, "Tokyo", 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.NotEqual(t, "user_trip_past", result.Memory.Key)
+	}
+
+	// Recalling a memory records the access time
+	time.Sleep(time.Millisecond)
+	recalled, err := service.GetMemory(ctx, "user_name_full")
+	require.NoError(t, err)
+	assert.True(t, recalled.LastAccessedAt.After(recalled.UpdatedAt))
+
+	// Updating refreshes UpdatedAt and can clear the expiry
+	updated, err := service.UpdateMemory(ctx, "user_trip_current", memory.UpdateMemoryInput{TTL: gog.PtrOf(time.Duration(0)), Importance: gog.PtrOf(0.8)})
+	require.NoError(t, err)
+	assert.Nil(t, updated.ExpiresAt)
+	assert.Equal(t, 0.8, updated.Importance)
+	assert.True(t, updated.UpdatedAt.After(updated.CreatedAt))
+}
+
+func TestService_SearchRecencyAndImportance(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewInMemoryStore()
+
+	conf := config.NewMemoryConfig()
+	conf.RecencyWeight = 0.3
+	conf.ImportanceWeight = 0.3
+	service := newTestService(t, store, conf)
+
+	// Same relevance, different importance and age
+	now := time.Now()
+	for _, mem := range []*memory.Memory{
+		{Key: "stale", Value: "coffee preference", Importance: 0.2, UpdatedAt: now.Add(-365 * 24 * time.Hour)},
+		{Key: "fresh", Value: "coffee preference", Importance: 0.9, UpdatedAt: now},
+	} {
+		mem.Embedding = mustEmbed(t, mem.Value)
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	results, err := service.SearchMemory(ctx, "coffee preference", 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "fresh", results[0].Memory.Key)
+	assert.Greater(t, results[0].Score, results[1].Score)
+	for _, result := range results {
+		assert.LessOrEqual(t, result.Score, 1.0)
+		assert.False(t, result.Memory.LastAccessedAt.Before(now), "search hits record their access time")
+	}
+
+	// The access recorded by the search does not change the next ranking
+	again, err := service.SearchMemory(ctx, "coffee preference", 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, again, 2)
+	for i := range results {
+		assert.Equal(t, results[i].Memory.Key, again[i].Memory.Key)
+		assert.InDelta(t, results[i].Score, again[i].Score, 1e-6)
+	}
+
+	// The minimum score applies to the final score, which the recency of the
+	// fresh memory lowers by far less than 1e-6 until the next search
+	results, err = service.SearchMemory(ctx, "coffee preference", 10, memory.SearchOptions{MinScore: again[0].Score - 1e-6})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "fresh", results[0].Memory.Key)
+}
+
+func TestService_Prune(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewInMemoryStore()
+
+	conf := config.NewMemoryConfig()
+	conf.PruneMinImportance = 0.3
+	conf.PruneMaxIdle = 24 * time.Hour
+	service := newTestService(t, store, conf)
+
+	now := time.Now()
+	for _, mem := range []*memory.Memory{
+		{Key: "expired", Value: "a", Importance: 0.9, UpdatedAt: now, ExpiresAt: gog.PtrOf(now.Add(-time.Second))},
+		{Key: "idle_low_value", Value: "b", Importance: 0.1, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Key: "recent_low_value", Value: "c", Importance: 0.1, UpdatedAt: now},
+		{Key: "idle_important", Value: "d", Importance: 0.9, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Key: "other_namespace_expired", Value: "e", Namespace: "user:bob", ExpiresAt: gog.PtrOf(now.Add(-time.Second))},
+	} {
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	pruned, err := service.Prune(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+
+	list, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	keys := make([]string, 0, len(memories))
+	for _, mem := range memories {
+		keys = append(keys, mem.Key)
+	}
+	assert.ElementsMatch(t, []string{"recent_low_value", "idle_important"}, keys)
+}
+
+func TestService_BackgroundPrune(t *testing.T) {
+	store := memory.NewInMemoryStore()
+
+	conf := config.NewMemoryConfig()
+	conf.PruneInterval = 10 * time.Millisecond
+	service := newTestService(t, store, conf)
+
+	require.NoError(t, store.Set(t.Context(), &memory.Memory{Key: "expired", Value: "a", ExpiresAt: gog.PtrOf(time.Now())}))
+
+	assert.Eventually(t, func() bool {
+		namespaces, err := store.ListNamespaces(t.Context())
+		return err == nil && len(namespaces) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, service.Close())
+}
+
+func mustEmbed(t *testing.T, text string) []float32 {
+	embeddings, err := (&fakeEmbedder{dimension: 16}).EmbedDocuments(t.Context(), text)
+	require.NoError(t, err)
+	return embeddings[0]
+}
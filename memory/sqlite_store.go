@@ -0,0 +1,866 @@
+//go:build !without_sqlite
+
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SqliteStore implements Store using SQLite with sqlite-vec extension
+type SqliteStore struct {
+	db     *gorm.DB
+	vecDim int
+}
+
+// SqliteMemoryRecord represents the database structure for memories
+type SqliteMemoryRecord struct {
+	ID string `gorm:"primaryKey"`
+
+	// Timestamps are managed by the memory service, not by GORM
+	CreatedAt      time.Time `gorm:"autoCreateTime:false"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime:false"`
+	LastAccessedAt time.Time
+	ExpiresAt      *time.Time `gorm:"index"`
+
+	Namespace  string `gorm:"uniqueIndex:idx_memories_namespace_key"`
+	Key        string `gorm:"uniqueIndex:idx_memories_namespace_key"`
+	Value      string
+	Source     string
+	Tags       datatypes.JSONSlice[string]
+	Importance float64
+
+	SupersededBy string
+}
+
+// TableName specifies the table name for GORM
+func (SqliteMemoryRecord) TableName() string {
+	return "memories"
+}
+
+// SqliteConsolidationRecord is the audit record of a consolidation
+type SqliteConsolidationRecord struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Namespace string `gorm:"index"`
+	Action    string
+	Reason    string
+	Before    datatypes.JSONSlice[*Memory]
+	After     datatypes.JSONSlice[*Memory]
+}
+
+func (SqliteConsolidationRecord) TableName() string {
+	return "memory_consolidations"
+}
+
+// SqliteMutationRecord is one recorded change of a memory
+type SqliteMutationRecord struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Namespace string `gorm:"uniqueIndex:idx_memory_mutations_version"`
+	Key       string `gorm:"uniqueIndex:idx_memory_mutations_version"`
+	Version   int    `gorm:"uniqueIndex:idx_memory_mutations_version"`
+	Operation string
+	ActorType string
+	ActorName string
+	RunID     string `gorm:"index"`
+	ThreadID  string
+	OldValue  datatypes.JSONType[*Memory]
+	NewValue  datatypes.JSONType[*Memory]
+}
+
+func (SqliteMutationRecord) TableName() string {
+	return "memory_mutations"
+}
+
+// SqliteEpisodeRecord is the summary of a past conversation thread
+type SqliteEpisodeRecord struct {
+	ID        string    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"autoCreateTime:false"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+	Namespace string    `gorm:"index"`
+	ThreadID  string
+
+	Summary      string
+	Participants datatypes.JSONSlice[string]
+	Outcomes     datatypes.JSONSlice[string]
+	StartedAt    time.Time
+	EndedAt      time.Time
+
+	// Embedding is the serialized embedding of the episode. Episodes are few
+	// compared to memories, so they are ranked in Go instead of in a vec0 table.
+	Embedding []byte
+}
+
+func (SqliteEpisodeRecord) TableName() string {
+	return "memory_episodes"
+}
+
+// SqliteMemoryMetadataRecord keeps store-level settings such as the embedding dimension
+type SqliteMemoryMetadataRecord struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+func (SqliteMemoryMetadataRecord) TableName() string {
+	return "memory_metadata"
+}
+
+const (
+	sqliteMetadataKeyEmbeddingDimension = "embedding_dimension"
+
+	// sqliteVecKMax is the largest k sqlite-vec accepts in a KNN query
+	// (SQLITE_VEC_VEC0_K_MAX)
+	sqliteVecKMax = 4096
+)
+
+var (
+	_ Store = (*SqliteStore)(nil)
+)
+
+// NewSqliteStore creates a new SQLite-based memory store and migrates its schema
+func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
+	if dimension <= 0 {
+		return nil, errors.Errorf("invalid embedding dimension: %d", dimension)
+	}
+
+	// Initialize sqlite-vec extension
+	sqlite_vec.Auto()
+
+	dsn := fmt.Sprintf("file:%s?cache=shared&mode=rwc&_journal_mode=WAL&_foreign_keys=on", dbPath)
+	if dbPath == ":memory:" {
+		// A shared cache would share ":memory:" with every store of the process, so
+		// name a database that only the connections of this store share
+		dsn = fmt.Sprintf("file:memory-%s?mode=memory&cache=shared&_foreign_keys=on", uuid.NewString())
+	}
+
+	// Open database connection
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open sqlite database")
+	}
+
+	store := &SqliteStore{
+		db:     db,
+		vecDim: dimension,
+	}
+
+	if err := store.migrate(); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// OpenSqliteStoreReadOnly opens an existing SQLite memory store without
+// migrating it, with the embedding dimension it was created with. Writes to
+// the store fail.
+func OpenSqliteStoreReadOnly(dbPath string) (*SqliteStore, error) {
+	sqlite_vec.Auto()
+
+	dsn := fmt.Sprintf("file:%s?mode=ro&_foreign_keys=on", dbPath)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open sqlite database")
+	}
+
+	store := &SqliteStore{db: db}
+
+	var metadata SqliteMemoryMetadataRecord
+	if err := db.First(&metadata, "key = ?", sqliteMetadataKeyEmbeddingDimension).Error; err != nil {
+		_ = store.Close()
+		return nil, errors.Wrapf(err, "failed to read embedding dimension")
+	}
+	if store.vecDim, err = strconv.Atoi(metadata.Value); err != nil {
+		_ = store.Close()
+		return nil, errors.Wrapf(err, "invalid stored embedding dimension '%s'", metadata.Value)
+	}
+
+	return store, nil
+}
+
+// migrate creates or updates the tables used by the store
+func (s *SqliteStore) migrate() error {
+	if err := s.db.AutoMigrate(&SqliteMemoryRecord{}, &SqliteConsolidationRecord{}, &SqliteMutationRecord{}, &SqliteEpisodeRecord{}, &SqliteMemoryMetadataRecord{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate memory tables")
+	}
+
+	// Verify the embedding dimension the store was created with
+	var metadata SqliteMemoryMetadataRecord
+	err := s.db.First(&metadata, "key = ?", sqliteMetadataKeyEmbeddingDimension).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := s.db.Create(&SqliteMemoryMetadataRecord{
+			Key:   sqliteMetadataKeyEmbeddingDimension,
+			Value: strconv.Itoa(s.vecDim),
+		}).Error; err != nil {
+			return errors.Wrapf(err, "failed to save embedding dimension")
+		}
+	case err != nil:
+		return errors.Wrapf(err, "failed to read embedding dimension")
+	default:
+		storedDim, err := strconv.Atoi(metadata.Value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid stored embedding dimension '%s'", metadata.Value)
+		}
+		if storedDim != s.vecDim {
+			return errors.Errorf("memory store was created with embedding dimension %d, but %d was requested", storedDim, s.vecDim)
+		}
+	}
+
+	return s.createVectorTable()
+}
+
+// createVectorTable creates the sqlite-vec virtual table
+func (s *SqliteStore) createVectorTable() error {
+	// Verify sqlite-vec is loaded
+	var sqliteVersion, vecVersion string
+	err := s.db.Raw("SELECT sqlite_version(), vec_version()").Row().Scan(&sqliteVersion, &vecVersion)
+	if err != nil {
+		return errors.Wrapf(err, "sqlite-vec extension not properly loaded")
+	}
+
+	// Namespace is a partition key so that KNN queries only scan one namespace
+	createTableSQL := fmt.Sprintf(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS memory_vectors USING vec0(
+			memory_id TEXT PRIMARY KEY,
+			namespace TEXT partition key,
+			embedding float[%d] distance_metric=cosine
+		);
+	`, s.vecDim)
+
+	if err := s.db.Exec(createTableSQL).Error; err != nil {
+		return errors.Wrapf(err, "failed to create memory_vectors table")
+	}
+
+	return nil
+}
+
+// Set implements Store.Set
+func (s *SqliteStore) Set(ctx context.Context, memory *Memory) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&SqliteMemoryRecord{}).
+			Where("namespace = ? AND key = ?", memory.Namespace, memory.Key).
+			Count(&count).Error; err != nil {
+			return errors.Wrapf(err, "failed to check existing memory")
+		}
+		if count > 0 {
+			return errors.Errorf("memory with key '%s' already exists", memory.Key)
+		}
+
+		return s.save(tx, memory)
+	})
+}
+
+// Replace implements Store.Replace
+func (s *SqliteStore) Replace(ctx context.Context, memory *Memory) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.save(tx, memory)
+	})
+}
+
+// save upserts the memory record and its embedding. An empty embedding keeps
+// the stored vector untouched.
+func (s *SqliteStore) save(tx *gorm.DB, memory *Memory) error {
+	var record SqliteMemoryRecord
+	err := tx.First(&record, "namespace = ? AND key = ?", memory.Namespace, memory.Key).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.Wrapf(err, "failed to get memory record")
+	}
+	if record.ID == "" {
+		record.ID = uuid.NewString()
+	}
+
+	record.Namespace = memory.Namespace
+	record.Key = memory.Key
+	record.Value = memory.Value
+	record.Source = memory.Source
+	record.Tags = memory.Tags
+	record.Importance = memory.Importance
+	if !memory.CreatedAt.IsZero() {
+		record.CreatedAt = memory.CreatedAt
+	}
+	record.UpdatedAt = memory.UpdatedAt
+	record.LastAccessedAt = memory.LastAccessedAt
+	record.ExpiresAt = memory.ExpiresAt
+	record.SupersededBy = memory.SupersededBy
+
+	if err := tx.Save(&record).Error; err != nil {
+		return errors.Wrapf(err, "failed to save memory record")
+	}
+
+	if len(memory.Embedding) == 0 {
+		return nil
+	}
+	if len(memory.Embedding) != s.vecDim {
+		return errors.Errorf("embedding dimension mismatch: got %d, expected %d", len(memory.Embedding), s.vecDim)
+	}
+
+	serializedEmbedding, err := sqlite_vec.SerializeFloat32(memory.Embedding)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize embedding")
+	}
+
+	if err := tx.Exec("DELETE FROM memory_vectors WHERE memory_id = ?", record.ID).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete existing vector")
+	}
+
+	insertSQL := "INSERT INTO memory_vectors (memory_id, namespace, embedding) VALUES (?, ?, ?)"
+	if err := tx.Exec(insertSQL, record.ID, record.Namespace, serializedEmbedding).Error; err != nil {
+		return errors.Wrapf(err, "failed to insert memory vector")
+	}
+
+	return nil
+}
+
+// Get implements Store.Get
+func (s *SqliteStore) Get(ctx context.Context, namespace string, key string) (*Memory, error) {
+	var record SqliteMemoryRecord
+	if err := s.db.WithContext(ctx).First(&record, "namespace = ? AND key = ?", namespace, key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Wrapf(ErrMemoryNotFound, "key '%s'", key)
+		}
+		return nil, errors.Wrapf(err, "failed to get memory record")
+	}
+
+	embeddings, err := s.loadEmbeddings(ctx, []string{record.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return record.toMemory(embeddings[record.ID]), nil
+}
+
+// Search implements Store.Search
+func (s *SqliteStore) Search(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts SearchOptions) ([]ScoredMemory, error) {
+	if len(queryEmbedding) == 0 {
+		return nil, errors.New("query embedding is empty")
+	}
+
+	tx := s.db.WithContext(ctx).Where("namespace = ?", namespace)
+	if opts.Source != "" {
+		tx = tx.Where("source = ?", opts.Source)
+	}
+	var records []SqliteMemoryRecord
+	if err := tx.Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch memory records")
+	}
+
+	// Tag filters are applied on the loaded memories; embeddings are only
+	// loaded for the returned results
+	candidates := make(map[string]*Memory, len(records))
+	memories := make([]*Memory, 0, len(records))
+	ids := make(map[*Memory]string, len(records))
+	for _, record := range records {
+		memory := record.toMemory(nil)
+		if !opts.Matches(memory) {
+			continue
+		}
+		candidates[record.ID] = memory
+		memories = append(memories, memory)
+		ids[memory] = record.ID
+	}
+
+	if len(candidates) == 0 {
+		return nil, errors.New("no memories found")
+	}
+
+	var (
+		vectorResults []ScoredMemory
+		err           error
+	)
+	if len(queryEmbedding) == s.vecDim {
+		vectorResults, err = s.vectorSearch(ctx, namespace, queryEmbedding, candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keywordResults := keywordSearch(query, memories)
+
+	if len(vectorResults) == 0 && len(keywordResults) == 0 {
+		return nil, errors.New("no memories found")
+	}
+
+	results := finalizeResults(fuseResults(query, vectorResults, keywordResults), opts, limit)
+
+	resultIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		resultIDs = append(resultIDs, ids[result.Memory])
+	}
+	embeddings, err := s.loadEmbeddings(ctx, resultIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		result.Memory.Embedding = embeddings[ids[result.Memory]]
+	}
+
+	return results, nil
+}
+
+// vectorSearch ranks the candidate memories of the namespace by cosine similarity.
+// The KNN query ranks the nearest k memories of the namespace, at most
+// sqliteVecKMax, and keeps the candidates among them.
+func (s *SqliteStore) vectorSearch(ctx context.Context, namespace string, queryEmbedding []float32, candidates map[string]*Memory) ([]ScoredMemory, error) {
+	serializedQuery, err := sqlite_vec.SerializeFloat32(queryEmbedding)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize query embedding")
+	}
+
+	var k int64
+	if err := s.db.WithContext(ctx).Model(&SqliteMemoryRecord{}).Where("namespace = ?", namespace).Count(&k).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to count memories")
+	}
+	k = min(k, sqliteVecKMax)
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT memory_id, distance
+		FROM memory_vectors
+		WHERE embedding MATCH ? AND k = ? AND namespace = ?
+		ORDER BY distance
+	`, serializedQuery, k, namespace).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to execute search query")
+	}
+	defer rows.Close()
+
+	var results []ScoredMemory
+	for rows.Next() {
+		var (
+			id       string
+			distance float64
+		)
+		if err := rows.Scan(&id, &distance); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan result row")
+		}
+		memory, ok := candidates[id]
+		if !ok {
+			continue
+		}
+
+		// Cosine distance is in [0, 2]; transform to the [0, 1] similarity used by InMemoryStore
+		score := 1.0 - distance*0.5
+		results = append(results, ScoredMemory{
+			Memory:      memory,
+			Score:       score,
+			VectorScore: score,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read search results")
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Memory.Key < results[j].Memory.Key
+	})
+
+	return results, nil
+}
+
+// List implements Store.List
+func (s *SqliteStore) List(ctx context.Context, namespace string, opts ListOptions) (*MemoryList, error) {
+	query := s.db.WithContext(ctx).Where("namespace = ?", namespace)
+	if opts.Source != "" {
+		query = query.Where("source = ?", opts.Source)
+	}
+	if opts.KeyPrefix != "" {
+		query = query.Where("key LIKE ? ESCAPE '\\'", escapeLike(opts.KeyPrefix)+"%")
+	}
+
+	var records []SqliteMemoryRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list memory records")
+	}
+
+	memories := make([]*Memory, 0, len(records))
+	ids := make(map[*Memory]string, len(records))
+	for _, record := range records {
+		memory := record.toMemory(nil)
+		memories = append(memories, memory)
+		ids[memory] = record.ID
+	}
+
+	// Tags, sorting and the cursor are applied in Go; embeddings are only
+	// loaded for the returned page
+	list, err := paginate(memories, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pageIDs := make([]string, 0, len(list.Memories))
+	for _, memory := range list.Memories {
+		pageIDs = append(pageIDs, ids[memory])
+	}
+	embeddings, err := s.loadEmbeddings(ctx, pageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, memory := range list.Memories {
+		memory.Embedding = embeddings[ids[memory]]
+	}
+
+	return list, nil
+}
+
+// Delete implements Store.Delete
+func (s *SqliteStore) Delete(ctx context.Context, namespace string, key string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&SqliteMemoryRecord{}).
+			Where("namespace = ? AND key = ?", namespace, key).
+			Pluck("id", &ids).Error; err != nil {
+			return errors.Wrapf(err, "failed to get memory record")
+		}
+
+		return deleteSqliteMemories(tx, ids)
+	})
+}
+
+// Touch implements Store.Touch
+func (s *SqliteStore) Touch(ctx context.Context, namespace string, keys []string, accessedAt time.Time) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := s.db.WithContext(ctx).
+		Model(&SqliteMemoryRecord{}).
+		Where("namespace = ? AND key IN ?", namespace, keys).
+		Update("last_accessed_at", accessedAt).Error; err != nil {
+		return errors.Wrapf(err, "failed to update last access time")
+	}
+
+	return nil
+}
+
+// ListNamespaces implements Store.ListNamespaces
+func (s *SqliteStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	if err := s.db.WithContext(ctx).
+		Model(&SqliteMemoryRecord{}).
+		Distinct("namespace").
+		Order("namespace").
+		Pluck("namespace", &namespaces).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list namespaces")
+	}
+
+	return namespaces, nil
+}
+
+// DeleteNamespace implements Store.DeleteNamespace
+func (s *SqliteStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&SqliteMemoryRecord{}).
+			Where("namespace = ?", namespace).
+			Pluck("id", &ids).Error; err != nil {
+			return errors.Wrapf(err, "failed to get memory records")
+		}
+
+		if err := tx.Delete(&SqliteConsolidationRecord{}, "namespace = ?", namespace).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete consolidation records")
+		}
+		if err := tx.Delete(&SqliteMutationRecord{}, "namespace = ?", namespace).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete mutation records")
+		}
+		if err := tx.Delete(&SqliteEpisodeRecord{}, "namespace = ?", namespace).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete episode records")
+		}
+
+		return deleteSqliteMemories(tx, ids)
+	})
+}
+
+// SaveConsolidation implements Store.SaveConsolidation
+func (s *SqliteStore) SaveConsolidation(ctx context.Context, consolidation *Consolidation) error {
+	if err := s.db.WithContext(ctx).Create(&SqliteConsolidationRecord{
+		ID:        consolidation.ID,
+		CreatedAt: consolidation.CreatedAt,
+		Namespace: consolidation.Namespace,
+		Action:    consolidation.Action,
+		Reason:    consolidation.Reason,
+		Before:    consolidation.Before,
+		After:     consolidation.After,
+	}).Error; err != nil {
+		return errors.Wrapf(err, "failed to save consolidation record")
+	}
+
+	return nil
+}
+
+// ListConsolidations implements Store.ListConsolidations
+func (s *SqliteStore) ListConsolidations(ctx context.Context, namespace string) ([]*Consolidation, error) {
+	var records []SqliteConsolidationRecord
+	if err := s.db.WithContext(ctx).Where("namespace = ?", namespace).Order("created_at").Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list consolidation records")
+	}
+
+	consolidations := make([]*Consolidation, 0, len(records))
+	for _, record := range records {
+		consolidations = append(consolidations, &Consolidation{
+			ID:        record.ID,
+			Namespace: record.Namespace,
+			Action:    record.Action,
+			Reason:    record.Reason,
+			Before:    record.Before,
+			After:     record.After,
+			CreatedAt: record.CreatedAt,
+		})
+	}
+
+	return consolidations, nil
+}
+
+// AppendMutation implements Store.AppendMutation
+func (s *SqliteStore) AppendMutation(ctx context.Context, mutation *MemoryMutation) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var version int
+		if err := tx.Model(&SqliteMutationRecord{}).
+			Where("namespace = ? AND key = ?", mutation.Namespace, mutation.Key).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&version).Error; err != nil {
+			return errors.Wrapf(err, "failed to get latest version")
+		}
+		mutation.Version = version + 1
+
+		if err := tx.Create(&SqliteMutationRecord{
+			ID:        mutation.ID,
+			CreatedAt: mutation.CreatedAt,
+			Namespace: mutation.Namespace,
+			Key:       mutation.Key,
+			Version:   mutation.Version,
+			Operation: mutation.Operation,
+			ActorType: mutation.Actor.Type,
+			ActorName: mutation.Actor.Name,
+			RunID:     mutation.Actor.RunID,
+			ThreadID:  mutation.ThreadID,
+			OldValue:  datatypes.NewJSONType(mutation.OldValue),
+			NewValue:  datatypes.NewJSONType(mutation.NewValue),
+		}).Error; err != nil {
+			return errors.Wrapf(err, "failed to save mutation record")
+		}
+
+		return nil
+	})
+}
+
+// ListMutations implements Store.ListMutations
+func (s *SqliteStore) ListMutations(ctx context.Context, namespace string, key string) ([]*MemoryMutation, error) {
+	var records []SqliteMutationRecord
+	if err := s.db.WithContext(ctx).
+		Where("namespace = ? AND key = ?", namespace, key).
+		Order("version").
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list mutation records")
+	}
+
+	mutations := make([]*MemoryMutation, 0, len(records))
+	for _, record := range records {
+		mutations = append(mutations, &MemoryMutation{
+			ID:        record.ID,
+			Namespace: record.Namespace,
+			Key:       record.Key,
+			Version:   record.Version,
+			Operation: record.Operation,
+			Actor: Actor{
+				Type:  record.ActorType,
+				Name:  record.ActorName,
+				RunID: record.RunID,
+			},
+			ThreadID:  record.ThreadID,
+			OldValue:  record.OldValue.Data(),
+			NewValue:  record.NewValue.Data(),
+			CreatedAt: record.CreatedAt,
+		})
+	}
+
+	return mutations, nil
+}
+
+// SaveEpisode implements Store.SaveEpisode
+func (s *SqliteStore) SaveEpisode(ctx context.Context, episode *Episode) error {
+	serializedEmbedding, err := sqlite_vec.SerializeFloat32(episode.Embedding)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize embedding")
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing SqliteEpisodeRecord
+		err := tx.Where("id = ?", episode.ID).Limit(1).Find(&existing).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to get episode record")
+		}
+		if existing.ID != "" {
+			episode.CreatedAt = existing.CreatedAt
+			if episode.StartedAt.IsZero() {
+				episode.StartedAt = existing.StartedAt
+			}
+		}
+		if episode.StartedAt.IsZero() {
+			episode.StartedAt = episode.CreatedAt
+		}
+
+		if err := tx.Save(&SqliteEpisodeRecord{
+			ID:           episode.ID,
+			CreatedAt:    episode.CreatedAt,
+			UpdatedAt:    episode.UpdatedAt,
+			Namespace:    episode.Namespace,
+			ThreadID:     episode.ThreadID,
+			Summary:      episode.Summary,
+			Participants: episode.Participants,
+			Outcomes:     episode.Outcomes,
+			StartedAt:    episode.StartedAt,
+			EndedAt:      episode.EndedAt,
+			Embedding:    serializedEmbedding,
+		}).Error; err != nil {
+			return errors.Wrapf(err, "failed to save episode record")
+		}
+
+		return nil
+	})
+}
+
+// SearchEpisodes implements Store.SearchEpisodes
+func (s *SqliteStore) SearchEpisodes(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts EpisodeSearchOptions) ([]ScoredEpisode, error) {
+	episodes, err := s.ListEpisodes(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return searchEpisodes(query, queryEmbedding, episodes, limit, opts), nil
+}
+
+// ListEpisodes implements Store.ListEpisodes
+func (s *SqliteStore) ListEpisodes(ctx context.Context, namespace string) ([]*Episode, error) {
+	var records []SqliteEpisodeRecord
+	if err := s.db.WithContext(ctx).
+		Where("namespace = ?", namespace).
+		Order("started_at, id").
+		Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to list episode records")
+	}
+
+	episodes := make([]*Episode, 0, len(records))
+	for _, record := range records {
+		episodes = append(episodes, &Episode{
+			ID:           record.ID,
+			Namespace:    record.Namespace,
+			ThreadID:     record.ThreadID,
+			Summary:      record.Summary,
+			Participants: record.Participants,
+			Outcomes:     record.Outcomes,
+			StartedAt:    record.StartedAt,
+			EndedAt:      record.EndedAt,
+			CreatedAt:    record.CreatedAt,
+			UpdatedAt:    record.UpdatedAt,
+			Embedding:    deserializeFloat32(record.Embedding),
+		})
+	}
+
+	return episodes, nil
+}
+
+// Dimension returns the embedding dimension of the vector table
+func (s *SqliteStore) Dimension() int {
+	return s.vecDim
+}
+
+// Close closes the underlying database connection
+func (s *SqliteStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// loadEmbeddings reads the stored vectors of the given memory IDs
+func (s *SqliteStore) loadEmbeddings(ctx context.Context, ids []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32, len(ids))
+	if len(ids) == 0 {
+		return embeddings, nil
+	}
+
+	rows, err := s.db.WithContext(ctx).Raw("SELECT memory_id, embedding FROM memory_vectors WHERE memory_id IN ?", ids).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load embeddings")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   string
+			blob []byte
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan embedding row")
+		}
+		embeddings[id] = deserializeFloat32(blob)
+	}
+
+	return embeddings, rows.Err()
+}
+
+func deleteSqliteMemories(tx *gorm.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := tx.Exec("DELETE FROM memory_vectors WHERE memory_id IN ?", ids).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete vectors")
+	}
+
+	if err := tx.Delete(&SqliteMemoryRecord{}, "id IN ?", ids).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete memory records")
+	}
+
+	return nil
+}
+
+func (r *SqliteMemoryRecord) toMemory(embedding []float32) *Memory {
+	return &Memory{
+		Key:       r.Key,
+		Value:     r.Value,
+		Source:    r.Source,
+		Tags:      r.Tags,
+		Namespace: r.Namespace,
+
+		Importance:     r.Importance,
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+		LastAccessedAt: r.LastAccessedAt,
+		ExpiresAt:      r.ExpiresAt,
+		SupersededBy:   r.SupersededBy,
+
+		Embedding: embedding,
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with a backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// deserializeFloat32 is the inverse of sqlite_vec.SerializeFloat32
+func deserializeFloat32(blob []byte) []float32 {
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[i*4:]))
+	}
+	return vector
+}
@@ -0,0 +1,24 @@
+//go:build without_sqlite
+
+package memory
+
+import "github.com/pkg/errors"
+
+// SqliteStore is unavailable when built with the without_sqlite tag
+type SqliteStore struct {
+	Store
+}
+
+// NewSqliteStore always fails when built with the without_sqlite tag
+func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
+	return nil, errors.New("sqlite memory store is not available: built with without_sqlite tag")
+}
+
+// OpenSqliteStoreReadOnly always fails when built with the without_sqlite tag
+func OpenSqliteStoreReadOnly(dbPath string) (*SqliteStore, error) {
+	return nil, errors.New("sqlite memory store is not available: built with without_sqlite tag")
+}
+
+func (s *SqliteStore) Close() error {
+	return nil
+}
@@ -0,0 +1,487 @@
+//go:build !without_sqlite
+
+package memory_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSqliteStore(t *testing.T, path string) *memory.SqliteStore {
+	store, err := memory.NewSqliteStore(path, 3)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	return store
+}
+
+func TestSqliteStore_SetGetReplace(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	mem := &memory.Memory{
+		Key:       "user_name_full",
+		Value:     "Dennis",
+		Source:    memory.MemorySourceUser,
+		Tags:      []string{"personal"},
+		Embedding: []float32{1.0, 0.0, 0.0},
+	}
+	require.NoError(t, store.Set(ctx, mem))
+
+	// Duplicate keys are rejected by Set
+	err := store.Set(ctx, mem)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+
+	stored, err := store.Get(ctx, memory.DefaultNamespace, "user_name_full")
+	require.NoError(t, err)
+	assert.Equal(t, mem.Value, stored.Value)
+	assert.Equal(t, mem.Source, stored.Source)
+	assert.Equal(t, mem.Tags, stored.Tags)
+	assert.Equal(t, mem.Embedding, stored.Embedding)
+
+	// Replace without an embedding keeps the stored vector
+	require.NoError(t, store.Replace(ctx, &memory.Memory{
+		Key:    "user_name_full",
+		Value:  "Dennis Park",
+		Source: memory.MemorySourceUser,
+	}))
+
+	stored, err = store.Get(ctx, memory.DefaultNamespace, "user_name_full")
+	require.NoError(t, err)
+	assert.Equal(t, "Dennis Park", stored.Value)
+	assert.Equal(t, mem.Embedding, stored.Embedding)
+
+	_, err = store.Get(ctx, memory.DefaultNamespace, "non-existent")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestSqliteStore_TimestampsAndTouch(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	expiresAt := now.Add(time.Hour)
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:        "user_trip_current",
+		Value:      "In Tokyo this week",
+		Importance: 0.7,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  &expiresAt,
+		Embedding:  []float32{1.0, 0.0, 0.0},
+	}))
+
+	stored, err := store.Get(ctx, memory.DefaultNamespace, "user_trip_current")
+	require.NoError(t, err)
+	assert.Equal(t, 0.7, stored.Importance)
+	assert.True(t, now.Equal(stored.CreatedAt))
+	assert.True(t, now.Equal(stored.UpdatedAt))
+	require.NotNil(t, stored.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*stored.ExpiresAt))
+
+	accessedAt := now.Add(time.Minute)
+	require.NoError(t, store.Touch(ctx, memory.DefaultNamespace, []string{"user_trip_current", "missing"}, accessedAt))
+
+	stored, err = store.Get(ctx, memory.DefaultNamespace, "user_trip_current")
+	require.NoError(t, err)
+	assert.True(t, accessedAt.Equal(stored.LastAccessedAt))
+	assert.True(t, now.Equal(stored.UpdatedAt), "touch must not change UpdatedAt")
+}
+
+func TestSqliteStore_Search(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	_, err := store.Search(ctx, memory.DefaultNamespace, "query", []float32{1.0, 0.0, 0.0}, 10, memory.SearchOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no memories found")
+
+	_, err = store.Search(ctx, memory.DefaultNamespace, "query", []float32{}, 10, memory.SearchOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "query embedding is empty")
+
+	for _, mem := range []*memory.Memory{
+		{Key: "mem1", Value: "first", Embedding: []float32{1.0, 0.0, 0.0}},
+		{Key: "mem2", Value: "second", Embedding: []float32{0.0, 1.0, 0.0}},
+		{Key: "mem3", Value: "third", Embedding: []float32{-1.0, 0.0, 0.0}},
+		{Key: "mem4", Value: "other namespace", Namespace: "user:bob", Embedding: []float32{1.0, 0.0, 0.0}},
+	} {
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	results, err := store.Search(ctx, memory.DefaultNamespace, "query", []float32{0.9, 0.1, 0.1}, 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "mem1", results[0].Memory.Key)
+	assert.Equal(t, "mem3", results[2].Memory.Key)
+	for i := 1; i < len(results); i++ {
+		assert.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+	}
+	for _, result := range results {
+		assert.GreaterOrEqual(t, result.Score, 0.0)
+		assert.LessOrEqual(t, result.Score, 1.0)
+	}
+
+	limited, err := store.Search(ctx, memory.DefaultNamespace, "query", []float32{0.9, 0.1, 0.1}, 2, memory.SearchOptions{})
+	require.NoError(t, err)
+	assert.Len(t, limited, 2)
+}
+
+func TestSqliteStore_SearchManyMemories(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	// sqlite-vec rejects KNN queries with k above 4096
+	for i := range 4200 {
+		angle := float64(i) / 4200 * math.Pi
+		require.NoError(t, store.Set(ctx, &memory.Memory{
+			Key:       fmt.Sprintf("mem%d", i),
+			Value:     "filler",
+			Embedding: []float32{float32(math.Cos(angle)), float32(math.Sin(angle)), 0},
+		}))
+	}
+
+	results, err := store.Search(ctx, memory.DefaultNamespace, "query", []float32{1, 0, 0}, 3, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "mem0", results[0].Memory.Key)
+	assert.Len(t, results[0].Memory.Embedding, 3)
+}
+
+func TestSqliteStore_SearchHybrid(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	for _, mem := range []*memory.Memory{
+		{Key: "user_preference_coffee", Value: "Dark roast with oat milk", Source: memory.MemorySourceUser, Tags: []string{"preferences"}, Embedding: []float32{1.0, 0.0, 0.0}},
+		{Key: "user_location_city", Value: "Lives in Seoul", Source: memory.MemorySourceUser, Tags: []string{"personal"}, Embedding: []float32{0.0, 1.0, 0.0}},
+		{Key: "project_status_current", Value: "Migration to Seoul region finished", Source: memory.MemorySourceAgent, Tags: []string{"work"}, Embedding: []float32{0.7, 0.7, 0.0}},
+	} {
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	results, err := store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0, 0.0}, 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "user_preference_coffee", results[2].Memory.Key)
+
+	results, err = store.Search(ctx, memory.DefaultNamespace, "user_location_city", []float32{1.0, 0.0, 0.0}, 1, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "user_location_city", results[0].Memory.Key)
+	assert.Equal(t, 1.0, results[0].Score)
+
+	results, err = store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0, 0.0}, 10, memory.SearchOptions{
+		Tags:   []string{"personal", "work"},
+		Source: memory.MemorySourceUser,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "user_location_city", results[0].Memory.Key)
+
+	results, err = store.Search(ctx, memory.DefaultNamespace, "coffee", []float32{0.0, 1.0, 0.0}, 10, memory.SearchOptions{MinScore: 0.75})
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.GreaterOrEqual(t, result.Score, 0.75)
+	}
+}
+
+func TestSqliteStore_ListAndDelete(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	for _, mem := range []*memory.Memory{
+		{Key: "a", Value: "alice a", Namespace: "user:alice", Embedding: []float32{1.0, 0.0, 0.0}},
+		{Key: "b", Value: "alice b", Namespace: "user:alice", Embedding: []float32{0.0, 1.0, 0.0}},
+		{Key: "a", Value: "bob a", Namespace: "user:bob", Embedding: []float32{0.0, 0.0, 1.0}},
+	} {
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	list, err := store.List(ctx, "user:alice", memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	require.Len(t, memories, 2)
+	assert.Equal(t, "a", memories[0].Key)
+	assert.Equal(t, "b", memories[1].Key)
+
+	namespaces, err := store.ListNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:alice", "user:bob"}, namespaces)
+
+	require.NoError(t, store.Delete(ctx, "user:alice", "a"))
+	_, err = store.Get(ctx, "user:alice", "a")
+	require.Error(t, err)
+
+	// Deleting a non-existent memory is not an error
+	require.NoError(t, store.Delete(ctx, "user:alice", "a"))
+
+	require.NoError(t, store.DeleteNamespace(ctx, "user:alice"))
+	list, err = store.List(ctx, "user:alice", memory.ListOptions{})
+	require.NoError(t, err)
+	memories = list.Memories
+	assert.Empty(t, memories)
+
+	bob, err := store.Get(ctx, "user:bob", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "bob a", bob.Value)
+}
+
+func TestSqliteStore_ListOptions(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	for _, mem := range []*memory.Memory{
+		{Key: "user_a", Value: "a", Source: memory.MemorySourceUser, Tags: []string{"x"}, Embedding: []float32{1.0, 0.0, 0.0}},
+		{Key: "user_b", Value: "b", Source: memory.MemorySourceAgent, Tags: []string{"y"}, Embedding: []float32{0.0, 1.0, 0.0}},
+		{Key: "userXc", Value: "c", Source: memory.MemorySourceUser, Tags: []string{"x"}, Embedding: []float32{0.0, 0.0, 1.0}},
+		{Key: "user_d", Value: "d", Source: memory.MemorySourceUser, Tags: []string{"x"}, Embedding: []float32{1.0, 1.0, 0.0}},
+	} {
+		mem.Namespace = "user:alice"
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	// "_" in the prefix is matched literally rather than as a LIKE wildcard
+	list, err := store.List(ctx, "user:alice", memory.ListOptions{KeyPrefix: "user_", Source: memory.MemorySourceUser, Tags: []string{"x"}, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, list.Memories, 1)
+	assert.Equal(t, "user_a", list.Memories[0].Key)
+	assert.Equal(t, []float32{1.0, 0.0, 0.0}, list.Memories[0].Embedding)
+	require.NotEmpty(t, list.NextCursor)
+
+	list, err = store.List(ctx, "user:alice", memory.ListOptions{KeyPrefix: "user_", Source: memory.MemorySourceUser, Tags: []string{"x"}, Limit: 1, Cursor: list.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, list.Memories, 1)
+	assert.Equal(t, "user_d", list.Memories[0].Key)
+	assert.Empty(t, list.NextCursor)
+}
+
+func TestSqliteStore_Consolidations(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	require.NoError(t, store.Set(ctx, &memory.Memory{Key: "old", Value: "dark roast", Namespace: "user:alice", Embedding: []float32{1.0, 0.0, 0.0}}))
+	require.NoError(t, store.Replace(ctx, &memory.Memory{Key: "old", Value: "dark roast", Namespace: "user:alice", SupersededBy: "new"}))
+
+	stored, err := store.Get(ctx, "user:alice", "old")
+	require.NoError(t, err)
+	assert.Equal(t, "new", stored.SupersededBy)
+
+	require.NoError(t, store.SaveConsolidation(ctx, &memory.Consolidation{
+		ID:        "c1",
+		Namespace: "user:alice",
+		Action:    memory.ConsolidationActionSupersede,
+		Reason:    "preference changed",
+		Before:    []*memory.Memory{{Key: "old", Value: "dark roast"}},
+		After:     []*memory.Memory{{Key: "old", Value: "dark roast", SupersededBy: "new"}},
+		CreatedAt: time.Now(),
+	}))
+
+	consolidations, err := store.ListConsolidations(ctx, "user:alice")
+	require.NoError(t, err)
+	require.Len(t, consolidations, 1)
+	assert.Equal(t, "preference changed", consolidations[0].Reason)
+	assert.Equal(t, "dark roast", consolidations[0].Before[0].Value)
+	assert.Equal(t, "new", consolidations[0].After[0].SupersededBy)
+
+	require.NoError(t, store.DeleteNamespace(ctx, "user:alice"))
+	consolidations, err = store.ListConsolidations(ctx, "user:alice")
+	require.NoError(t, err)
+	assert.Empty(t, consolidations)
+}
+
+func TestSqliteStore_Mutations(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	actor := memory.Actor{Type: memory.ActorTool, Name: "update_memory", RunID: "run-1"}
+	for _, mutation := range []*memory.MemoryMutation{
+		{ID: "m1", Namespace: "user:alice", Key: "coffee", Operation: memory.MutationCreate, Actor: actor, NewValue: &memory.Memory{Key: "coffee", Value: "dark"}},
+		{ID: "m2", Namespace: "user:alice", Key: "coffee", Operation: memory.MutationUpdate, Actor: actor, ThreadID: "t1", OldValue: &memory.Memory{Key: "coffee", Value: "dark"}, NewValue: &memory.Memory{Key: "coffee", Value: "light"}},
+		{ID: "m3", Namespace: "user:alice", Key: "tea", Operation: memory.MutationCreate, Actor: actor, NewValue: &memory.Memory{Key: "tea", Value: "green"}},
+	} {
+		mutation.CreatedAt = time.Now()
+		require.NoError(t, store.AppendMutation(ctx, mutation))
+	}
+
+	mutations, err := store.ListMutations(ctx, "user:alice", "coffee")
+	require.NoError(t, err)
+	require.Len(t, mutations, 2)
+	assert.Equal(t, 1, mutations[0].Version)
+	assert.Nil(t, mutations[0].OldValue)
+	assert.Equal(t, 2, mutations[1].Version)
+	assert.Equal(t, actor, mutations[1].Actor)
+	assert.Equal(t, "t1", mutations[1].ThreadID)
+	assert.Equal(t, "dark", mutations[1].OldValue.Value)
+	assert.Equal(t, "light", mutations[1].NewValue.Value)
+
+	mutations, err = store.ListMutations(ctx, "user:alice", "tea")
+	require.NoError(t, err)
+	require.Len(t, mutations, 1)
+	assert.Equal(t, 1, mutations[0].Version)
+}
+
+func TestSqliteStore_Episodes(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "memory.db"))
+
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	episode := &memory.Episode{
+		ID:           "launch",
+		Namespace:    "user:alice",
+		ThreadID:     "launch",
+		Summary:      "Discussed the launch",
+		Participants: []string{"assistant", "Alice"},
+		EndedAt:      createdAt,
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+		Embedding:    []float32{1.0, 0.0, 0.0},
+	}
+	require.NoError(t, store.SaveEpisode(ctx, episode))
+	assert.Equal(t, createdAt, episode.StartedAt)
+
+	now := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, store.SaveEpisode(ctx, &memory.Episode{
+		ID:        "launch",
+		Namespace: "user:alice",
+		ThreadID:  "launch",
+		Summary:   "Decided the launch date",
+		Outcomes:  []string{"Launch on June 3"},
+		EndedAt:   now,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Embedding: []float32{0.0, 1.0, 0.0},
+	}))
+
+	episodes, err := store.ListEpisodes(ctx, "user:alice")
+	require.NoError(t, err)
+	require.Len(t, episodes, 1)
+	assert.Equal(t, "Decided the launch date", episodes[0].Summary)
+	assert.Equal(t, []string{"Launch on June 3"}, episodes[0].Outcomes)
+	assert.True(t, createdAt.Equal(episodes[0].CreatedAt))
+	assert.True(t, createdAt.Equal(episodes[0].StartedAt))
+	assert.Equal(t, []float32{0.0, 1.0, 0.0}, episodes[0].Embedding)
+
+	results, err := store.SearchEpisodes(ctx, "user:alice", "launch date", []float32{0.0, 1.0, 0.0}, 10, memory.EpisodeSearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "launch", results[0].ID)
+
+	require.NoError(t, store.DeleteNamespace(ctx, "user:alice"))
+	episodes, err = store.ListEpisodes(ctx, "user:alice")
+	require.NoError(t, err)
+	assert.Empty(t, episodes)
+}
+
+func TestSqliteStore_Persistence(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "memory.db")
+
+	store, err := memory.NewSqliteStore(path, 3)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:       "user_location_city",
+		Value:     "Seoul",
+		Embedding: []float32{0.0, 1.0, 0.0},
+	}))
+	require.NoError(t, store.Close())
+
+	// A different dimension is rejected for an existing database
+	_, err = memory.NewSqliteStore(path, 4)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "embedding dimension")
+
+	reopened := newTestSqliteStore(t, path)
+	stored, err := reopened.Get(ctx, memory.DefaultNamespace, "user_location_city")
+	require.NoError(t, err)
+	assert.Equal(t, "Seoul", stored.Value)
+	assert.Equal(t, []float32{0.0, 1.0, 0.0}, stored.Embedding)
+}
+
+func TestSqliteStore_InMemoryDatabasesAreSeparate(t *testing.T) {
+	ctx := t.Context()
+	first := newTestSqliteStore(t, ":memory:")
+	second := newTestSqliteStore(t, ":memory:")
+
+	require.NoError(t, first.Set(ctx, &memory.Memory{Key: "user_location_city", Value: "Seoul", Embedding: []float32{0.0, 1.0, 0.0}}))
+
+	_, err := second.Get(ctx, memory.DefaultNamespace, "user_location_city")
+	require.ErrorIs(t, err, memory.ErrMemoryNotFound)
+	stored, err := first.Get(ctx, memory.DefaultNamespace, "user_location_city")
+	require.NoError(t, err)
+	assert.Equal(t, "Seoul", stored.Value)
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := memory.NewStore(config.NewMemoryConfig(), 3)
+	require.NoError(t, err)
+	assert.IsType(t, &memory.InMemoryStore{}, store)
+
+	conf := config.NewMemoryConfig()
+	conf.SqliteEnabled = true
+	conf.SqlitePath = filepath.Join(t.TempDir(), "nested", "memory.db")
+
+	store, err = memory.NewStore(conf, 3)
+	require.NoError(t, err)
+	require.IsType(t, &memory.SqliteStore{}, store)
+	require.NoError(t, store.(*memory.SqliteStore).Close())
+}
+
+func TestOpenReadOnlyStore(t *testing.T) {
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "memory.db")
+
+	// A missing database is not created
+	_, err := memory.OpenReadOnlyStore(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+	assert.NoFileExists(t, path)
+
+	store, err := memory.NewSqliteStore(path, 3)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:       "user_location_city",
+		Value:     "Seoul",
+		Embedding: []float32{0.0, 1.0, 0.0},
+	}))
+	require.NoError(t, store.Close())
+
+	readOnly, err := memory.OpenReadOnlyStore(path)
+	require.NoError(t, err)
+	defer readOnly.Close()
+	assert.Equal(t, 3, readOnly.Dimension())
+
+	var buf bytes.Buffer
+	require.NoError(t, memory.ExportMemories(ctx, readOnly, memory.DefaultNamespace, &buf, memory.ExportOptions{
+		Format:            memory.ExportFormatJSONL,
+		IncludeEmbeddings: true,
+	}))
+	assert.Contains(t, buf.String(), `"value":"Seoul"`)
+	assert.Contains(t, buf.String(), `"embedding":[0,1,0]`)
+
+	// Writes are rejected
+	require.Error(t, readOnly.Set(ctx, &memory.Memory{Key: "user_name", Value: "Dennis", Embedding: []float32{1.0, 0.0, 0.0}}))
+}
+
+func TestService_DimensionMismatch(t *testing.T) {
+	store, err := memory.NewSqliteStore(filepath.Join(t.TempDir(), "memory.db"), 8)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = memory.NewServiceWithEmbedder(t.Context(), store, &fakeEmbedder{dimension: 16}, &config.ModelConfig{}, config.NewMemoryConfig(), slog.Default())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match")
+}
@@ -2,9 +2,15 @@ package memory
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/habiliai/agentruntime/config"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/mat"
 )
@@ -12,29 +18,132 @@ import (
 type (
 	// Store interface for memory storage
 	Store interface {
+		// Set stores a new memory in memory.Namespace and fails if the key already exists
 		Set(ctx context.Context, memory *Memory) error
+		// Replace stores the memory in memory.Namespace, overwriting any existing one
 		Replace(ctx context.Context, memory *Memory) error
-		Get(ctx context.Context, key string) (*Memory, error)
-		Search(ctx context.Context, query string, queryEmbedding []float32, limit uint) ([]ScoredMemory, error)
-		List(ctx context.Context) ([]*Memory, error)
-		Delete(ctx context.Context, key string) error
+		// Get returns the memory with the key, or an error wrapping ErrMemoryNotFound
+		// when the namespace has none
+		Get(ctx context.Context, namespace string, key string) (*Memory, error)
+		// Search ranks the memories of the namespace passing opts by fusing vector
+		// similarity and BM25 keyword relevance with reciprocal rank fusion
+		Search(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts SearchOptions) ([]ScoredMemory, error)
+		// List returns the memories of the namespace passing opts, sorted and paged per opts
+		List(ctx context.Context, namespace string, opts ListOptions) (*MemoryList, error)
+		Delete(ctx context.Context, namespace string, key string) error
+		// Touch records that the memories with the given keys were accessed at accessedAt
+		Touch(ctx context.Context, namespace string, keys []string, accessedAt time.Time) error
+
+		// ListNamespaces returns every namespace that holds at least one memory
+		ListNamespaces(ctx context.Context) ([]string, error)
+		// DeleteNamespace removes all memories, audit records and history in the given namespace
+		DeleteNamespace(ctx context.Context, namespace string) error
+
+		// SaveConsolidation records a consolidation for audit
+		SaveConsolidation(ctx context.Context, consolidation *Consolidation) error
+		// ListConsolidations returns the consolidations of the namespace, oldest first
+		ListConsolidations(ctx context.Context, namespace string) ([]*Consolidation, error)
+
+		// AppendMutation records a change of a memory and assigns its version
+		AppendMutation(ctx context.Context, mutation *MemoryMutation) error
+		// ListMutations returns the changes of a memory, oldest first
+		ListMutations(ctx context.Context, namespace string, key string) ([]*MemoryMutation, error)
+
+		// SaveEpisode stores the episode in episode.Namespace, replacing the one with
+		// the same ID. A replaced episode keeps its CreatedAt, and its StartedAt unless
+		// episode.StartedAt is set; a new episode without StartedAt starts at CreatedAt.
+		SaveEpisode(ctx context.Context, episode *Episode) error
+		// SearchEpisodes ranks the episodes of the namespace passing opts like Search ranks memories
+		SearchEpisodes(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts EpisodeSearchOptions) ([]ScoredEpisode, error)
+		// ListEpisodes returns the episodes of the namespace, oldest first
+		ListEpisodes(ctx context.Context, namespace string) ([]*Episode, error)
 	}
 
 	// InMemoryStore is a simple in-memory implementation
 	InMemoryStore struct {
-		mu       sync.RWMutex
-		memories map[string]*Memory
+		mu             sync.RWMutex
+		memories       map[string]map[string]*Memory  // namespace -> key -> memory
+		consolidations map[string][]*Consolidation    // namespace -> consolidations
+		mutations      map[string][]*MemoryMutation   // namespace -> mutations
+		episodes       map[string]map[string]*Episode // namespace -> id -> episode
 	}
 )
 
 // Memory tool functions
 var (
 	_ Store = (*InMemoryStore)(nil)
+
+	// ErrMemoryNotFound is returned by Store.Get when the memory does not exist
+	ErrMemoryNotFound = errors.New("memory not found")
 )
 
+// NewStore creates the memory store selected by the memory configuration.
+// dimension is the embedding size of the configured embedder.
+func NewStore(memoryConfig *config.MemoryConfig, dimension int) (Store, error) {
+	if memoryConfig == nil || !memoryConfig.SqliteEnabled {
+		return NewInMemoryStore(), nil
+	}
+
+	path, err := expandHome(memoryConfig.SqlitePath)
+	if err != nil {
+		return nil, err
+	}
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, errors.Wrapf(err, "failed to create memory database directory")
+		}
+	}
+
+	store, err := NewSqliteStore(path, dimension)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create sqlite memory store")
+	}
+
+	return store, nil
+}
+
+// OpenReadOnlyStore opens an existing SQLite memory database for reading. It
+// needs no embedder since the embedding dimension is read from the database,
+// and fails instead of creating the database when path does not exist.
+func OpenReadOnlyStore(path string) (*SqliteStore, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("memory database %s does not exist", path)
+		}
+		return nil, errors.Wrapf(err, "failed to open memory database")
+	}
+
+	store, err := OpenSqliteStoreReadOnly(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open sqlite memory store")
+	}
+
+	return store, nil
+}
+
+// expandHome replaces a leading ~ of path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve home directory")
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		memories: make(map[string]*Memory),
+		memories:       make(map[string]map[string]*Memory),
+		consolidations: make(map[string][]*Consolidation),
+		mutations:      make(map[string][]*MemoryMutation),
+		episodes:       make(map[string]map[string]*Episode),
 	}
 }
 
@@ -42,32 +151,33 @@ func (s *InMemoryStore) Set(ctx context.Context, memory *Memory) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.memories[memory.Key]; exists {
+	memories := s.namespaceLocked(memory.Namespace)
+	if _, exists := memories[memory.Key]; exists {
 		return errors.Errorf("memory with key '%s' already exists", memory.Key)
 	}
 
-	s.memories[memory.Key] = memory
+	memories[memory.Key] = memory.clone()
 	return nil
 }
 
 func (s *InMemoryStore) Replace(ctx context.Context, memory *Memory) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.memories[memory.Key] = memory
+	s.namespaceLocked(memory.Namespace)[memory.Key] = memory.clone()
 	return nil
 }
 
-func (s *InMemoryStore) Get(ctx context.Context, key string) (*Memory, error) {
+func (s *InMemoryStore) Get(ctx context.Context, namespace string, key string) (*Memory, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	memory, exists := s.memories[key]
+	memory, exists := s.memories[namespace][key]
 	if !exists {
-		return nil, errors.Errorf("memory with key '%s' not found", key)
+		return nil, errors.Wrapf(ErrMemoryNotFound, "key '%s'", key)
 	}
-	return memory, nil
+	return memory.clone(), nil
 }
 
-func (s *InMemoryStore) Search(ctx context.Context, query string, queryEmbedding []float32, limit uint) ([]ScoredMemory, error) {
+func (s *InMemoryStore) Search(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts SearchOptions) ([]ScoredMemory, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -75,24 +185,53 @@ func (s *InMemoryStore) Search(ctx context.Context, query string, queryEmbedding
 		return nil, errors.New("query embedding is empty")
 	}
 
-	// Collect all memories
-	var validMemories []*Memory
-	for _, memory := range s.memories {
+	// Collect all memories passing the filters
+	var (
+		candidates    []*Memory
+		validMemories []*Memory
+	)
+	for _, memory := range s.memories[namespace] {
+		if !opts.Matches(memory) {
+			continue
+		}
+		candidates = append(candidates, memory)
 		// Only include memories with matching embedding dimensions for matrix calculation
-		if len(queryEmbedding) > 0 && len(memory.Embedding) == len(queryEmbedding) {
+		if len(memory.Embedding) == len(queryEmbedding) {
 			validMemories = append(validMemories, memory)
 		}
 	}
 
-	if len(validMemories) == 0 {
+	// Keep the keyword ranking stable across calls
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Key < candidates[j].Key
+	})
+
+	vectorResults := vectorSearch(queryEmbedding, validMemories)
+	keywordResults := keywordSearch(query, candidates)
+
+	if len(vectorResults) == 0 && len(keywordResults) == 0 {
 		return nil, errors.New("no memories found")
 	}
 
+	results := finalizeResults(fuseResults(query, vectorResults, keywordResults), opts, limit)
+	for i := range results {
+		results[i].Memory = results[i].Memory.clone()
+	}
+
+	return results, nil
+}
+
+// vectorSearch ranks the memories by the inner product of their embeddings with the query
+func vectorSearch(queryEmbedding []float32, memories []*Memory) []ScoredMemory {
+	if len(memories) == 0 {
+		return nil
+	}
+
 	// Create scored results for all memories
-	scoredResults := make([]ScoredMemory, 0, len(validMemories))
+	scoredResults := make([]ScoredMemory, 0, len(memories))
 
 	// Calculate scores for valid memories using matrix multiplication
-	numMemories := len(validMemories)
+	numMemories := len(memories)
 	embeddingDim := len(queryEmbedding)
 
 	// Convert queryEmbedding to float64 vector
@@ -103,7 +242,7 @@ func (s *InMemoryStore) Search(ctx context.Context, query string, queryEmbedding
 
 	// Create memory embeddings matrix (N x d)
 	memoryData := make([]float64, numMemories*embeddingDim)
-	for i, memory := range validMemories {
+	for i, memory := range memories {
 		for j, v := range memory.Embedding {
 			memoryData[i*embeddingDim+j] = float64(v)
 		}
@@ -120,43 +259,191 @@ func (s *InMemoryStore) Search(ctx context.Context, query string, queryEmbedding
 	// Create scored results with OpenAI embedding optimized transformation
 	// OpenAI embeddings are normalized, so inner product is always in [-1, 1]
 	// Transform to [0, 1] range: (score + 1) * 0.5
-	for i, memory := range validMemories {
+	for i, memory := range memories {
 		score := (resultVec.AtVec(i) + 1.0) * 0.5 // [-1,1] → [0,1]
 
 		scoredResults = append(scoredResults, ScoredMemory{
-			Memory: memory,
-			Score:  score,
+			Memory:      memory,
+			Score:       score,
+			VectorScore: score,
 		})
 	}
 
-	// Sort by similarity score (descending)
+	// Sort by similarity score (descending), ties by key so that rankings are stable
 	sort.Slice(scoredResults, func(i, j int) bool {
-		return scoredResults[i].Score > scoredResults[j].Score
+		if scoredResults[i].Score != scoredResults[j].Score {
+			return scoredResults[i].Score > scoredResults[j].Score
+		}
+		return scoredResults[i].Memory.Key < scoredResults[j].Memory.Key
 	})
 
-	// Apply limit
-	if limit > 0 && uint(len(scoredResults)) > limit {
-		scoredResults = scoredResults[:limit]
+	return scoredResults
+}
+
+func (s *InMemoryStore) List(ctx context.Context, namespace string, opts ListOptions) (*MemoryList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	memories := s.memories[namespace]
+	results := make([]*Memory, 0, len(memories))
+	for _, memory := range memories {
+		results = append(results, memory)
+	}
+
+	list, err := paginate(results, opts)
+	if err != nil {
+		return nil, err
 	}
+	for i, memory := range list.Memories {
+		list.Memories[i] = memory.clone()
+	}
+
+	return list, nil
+}
 
-	return scoredResults, nil
+func (s *InMemoryStore) Delete(ctx context.Context, namespace string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	memories, ok := s.memories[namespace]
+	if !ok {
+		return nil
+	}
+	delete(memories, key)
+	if len(memories) == 0 {
+		delete(s.memories, namespace)
+	}
+	return nil
 }
 
-func (s *InMemoryStore) List(ctx context.Context) ([]*Memory, error) {
+func (s *InMemoryStore) Touch(ctx context.Context, namespace string, keys []string, accessedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if memory, ok := s.memories[namespace][key]; ok {
+			memory.LastAccessedAt = accessedAt
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) ListNamespaces(ctx context.Context) ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	results := make([]*Memory, 0, len(s.memories))
-	for _, memory := range s.memories {
-		results = append(results, memory)
+	namespaces := make([]string, 0, len(s.memories))
+	for namespace, memories := range s.memories {
+		if len(memories) == 0 {
+			continue
+		}
+		namespaces = append(namespaces, namespace)
 	}
+	sort.Strings(namespaces)
 
-	return results, nil
+	return namespaces, nil
+}
+
+func (s *InMemoryStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.memories, namespace)
+	delete(s.consolidations, namespace)
+	delete(s.mutations, namespace)
+	delete(s.episodes, namespace)
+	return nil
 }
 
-func (s *InMemoryStore) Delete(ctx context.Context, key string) error {
+func (s *InMemoryStore) SaveConsolidation(ctx context.Context, consolidation *Consolidation) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.memories, key)
+	s.consolidations[consolidation.Namespace] = append(s.consolidations[consolidation.Namespace], consolidation)
 	return nil
 }
+
+func (s *InMemoryStore) ListConsolidations(ctx context.Context, namespace string) ([]*Consolidation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.consolidations[namespace]), nil
+}
+
+func (s *InMemoryStore) AppendMutation(ctx context.Context, mutation *MemoryMutation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mutation.Version = 1
+	for _, m := range s.mutations[mutation.Namespace] {
+		if m.Key == mutation.Key {
+			mutation.Version = m.Version + 1
+		}
+	}
+	s.mutations[mutation.Namespace] = append(s.mutations[mutation.Namespace], mutation)
+	return nil
+}
+
+func (s *InMemoryStore) ListMutations(ctx context.Context, namespace string, key string) ([]*MemoryMutation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mutations []*MemoryMutation
+	for _, mutation := range s.mutations[namespace] {
+		if mutation.Key == key {
+			mutations = append(mutations, mutation)
+		}
+	}
+	return mutations, nil
+}
+
+func (s *InMemoryStore) SaveEpisode(ctx context.Context, episode *Episode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	episodes, ok := s.episodes[episode.Namespace]
+	if !ok {
+		episodes = make(map[string]*Episode)
+		s.episodes[episode.Namespace] = episodes
+	}
+
+	if existing, ok := episodes[episode.ID]; ok {
+		episode.CreatedAt = existing.CreatedAt
+		if episode.StartedAt.IsZero() {
+			episode.StartedAt = existing.StartedAt
+		}
+	}
+	if episode.StartedAt.IsZero() {
+		episode.StartedAt = episode.CreatedAt
+	}
+	episodes[episode.ID] = episode
+	return nil
+}
+
+func (s *InMemoryStore) SearchEpisodes(ctx context.Context, namespace string, query string, queryEmbedding []float32, limit uint, opts EpisodeSearchOptions) ([]ScoredEpisode, error) {
+	episodes, err := s.ListEpisodes(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return searchEpisodes(query, queryEmbedding, episodes, limit, opts), nil
+}
+
+func (s *InMemoryStore) ListEpisodes(ctx context.Context, namespace string) ([]*Episode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	episodes := make([]*Episode, 0, len(s.episodes[namespace]))
+	for _, episode := range s.episodes[namespace] {
+		episodes = append(episodes, episode)
+	}
+	sortEpisodes(episodes)
+	return episodes, nil
+}
+
+// namespaceLocked returns the memories of a namespace, creating it if needed.
+// The caller must hold the write lock.
+func (s *InMemoryStore) namespaceLocked(namespace string) map[string]*Memory {
+	memories, ok := s.memories[namespace]
+	if !ok {
+		memories = make(map[string]*Memory)
+		s.memories[namespace] = memories
+	}
+	return memories
+}
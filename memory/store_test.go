@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
@@ -32,7 +33,7 @@ func TestInMemoryStore_Set(t *testing.T) {
 	require.NoError(t, err, "Set should not return an error")
 
 	// Verify the memory was stored
-	stored, err := store.Get(ctx, "test-key")
+	stored, err := store.Get(ctx, memory.DefaultNamespace, "test-key")
 	require.NoError(t, err)
 	assert.Equal(t, mem.Key, stored.Key)
 	assert.Equal(t, mem.Value, stored.Value)
@@ -46,7 +47,7 @@ func TestInMemoryStore_Get(t *testing.T) {
 	ctx := t.Context()
 
 	// Test getting non-existent memory
-	_, err := store.Get(ctx, "non-existent")
+	_, err := store.Get(ctx, memory.DefaultNamespace, "non-existent")
 	assert.Error(t, err, "Get should return error for non-existent key")
 	assert.Contains(t, err.Error(), "not found")
 
@@ -62,11 +63,28 @@ func TestInMemoryStore_Get(t *testing.T) {
 	require.NoError(t, err)
 
 	// Test getting existing memory
-	retrieved, err := store.Get(ctx, "existing-key")
+	retrieved, err := store.Get(ctx, memory.DefaultNamespace, "existing-key")
 	require.NoError(t, err, "Get should not return error for existing key")
 	assert.Equal(t, mem.Key, retrieved.Key)
 	assert.Equal(t, mem.Value, retrieved.Value)
 	assert.Equal(t, mem.Source, retrieved.Source)
+
+	// Returned memories are copies, so changing them leaves the store untouched
+	retrieved.Value = "changed"
+	retrieved.LastAccessedAt = time.Now()
+	mem.Value = "changed too"
+	stored, err := store.Get(ctx, memory.DefaultNamespace, "existing-key")
+	require.NoError(t, err)
+	assert.Equal(t, "existing value", stored.Value)
+	assert.True(t, stored.LastAccessedAt.IsZero())
+
+	results, err := store.Search(ctx, memory.DefaultNamespace, "existing", []float32{0.4, 0.5, 0.6}, 1, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	results[0].Memory.Tags = append(results[0].Memory.Tags, "changed")
+	stored, err = store.Get(ctx, memory.DefaultNamespace, "existing-key")
+	require.NoError(t, err)
+	assert.Empty(t, stored.Tags)
 }
 
 func TestInMemoryStore_Search(t *testing.T) {
@@ -74,12 +92,12 @@ func TestInMemoryStore_Search(t *testing.T) {
 	ctx := t.Context()
 
 	// Test search with empty store
-	_, err := store.Search(ctx, "test query", []float32{0.1, 0.2, 0.3}, 10)
+	_, err := store.Search(ctx, memory.DefaultNamespace, "test query", []float32{0.1, 0.2, 0.3}, 10, memory.SearchOptions{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no memories found")
 
 	// Test search with empty embedding
-	_, err = store.Search(ctx, "test query", []float32{}, 10)
+	_, err = store.Search(ctx, memory.DefaultNamespace, "test query", []float32{}, 10, memory.SearchOptions{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "query embedding is empty")
 
@@ -119,7 +137,7 @@ func TestInMemoryStore_Search(t *testing.T) {
 
 	// Test search with matching dimensions
 	queryEmbedding := []float32{0.9, 0.1, 0.1}
-	results, err := store.Search(ctx, "test query", queryEmbedding, 10)
+	results, err := store.Search(ctx, memory.DefaultNamespace, "test query", queryEmbedding, 10, memory.SearchOptions{})
 	require.NoError(t, err, "Search should not return error")
 
 	// Should only return memories with matching embedding dimensions (3)
@@ -133,12 +151,12 @@ func TestInMemoryStore_Search(t *testing.T) {
 	assert.Equal(t, "mem1", results[0].Memory.Key)
 
 	// Test limit parameter
-	limitedResults, err := store.Search(ctx, "test query", queryEmbedding, 2)
+	limitedResults, err := store.Search(ctx, memory.DefaultNamespace, "test query", queryEmbedding, 2, memory.SearchOptions{})
 	require.NoError(t, err)
 	assert.Len(t, limitedResults, 2, "Should respect limit parameter")
 
 	// Test limit of 0 (should return all)
-	allResults, err := store.Search(ctx, "test query", queryEmbedding, 0)
+	allResults, err := store.Search(ctx, memory.DefaultNamespace, "test query", queryEmbedding, 0, memory.SearchOptions{})
 	require.NoError(t, err)
 	assert.Len(t, allResults, 3, "Limit of 0 should return all results")
 }
@@ -148,8 +166,9 @@ func TestInMemoryStore_List(t *testing.T) {
 	ctx := t.Context()
 
 	// Test empty store
-	memories, err := store.List(ctx)
+	list, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{})
 	require.NoError(t, err, "List should not return error")
+	memories := list.Memories
 	assert.Empty(t, memories, "Empty store should return empty list")
 
 	// Add some memories
@@ -174,8 +193,9 @@ func TestInMemoryStore_List(t *testing.T) {
 	}
 
 	// Test list with memories
-	memories, err = store.List(ctx)
+	list, err = store.List(ctx, memory.DefaultNamespace, memory.ListOptions{})
 	require.NoError(t, err, "List should not return error")
+	memories = list.Memories
 	assert.Len(t, memories, 2, "Should return all stored memories")
 
 	// Verify all memories are returned (order not guaranteed)
@@ -187,12 +207,84 @@ func TestInMemoryStore_List(t *testing.T) {
 	assert.True(t, keys["key2"], "Should contain key2")
 }
 
+func TestInMemoryStore_ListOptions(t *testing.T) {
+	store := memory.NewInMemoryStore()
+	ctx := t.Context()
+
+	for i, mem := range []*memory.Memory{
+		{Key: "user_preference_coffee", Source: memory.MemorySourceUser, Tags: []string{"preferences"}, Importance: 0.5},
+		{Key: "user_preference_tea", Source: memory.MemorySourceUser, Tags: []string{"Preferences"}, Importance: 0.9},
+		{Key: "user_name_full", Source: memory.MemorySourceUser, Tags: []string{"personal"}, Importance: 1.0},
+		{Key: "project_deadline", Source: memory.MemorySourceAgent, Tags: []string{"work"}, Importance: 0.2},
+		{Key: "user_preference_music", Source: memory.MemorySourceAgent, Tags: []string{"preferences"}, Importance: 0.3},
+	} {
+		mem.Value = mem.Key
+		mem.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	keysOf := func(list *memory.MemoryList) []string {
+		keys := make([]string, 0, len(list.Memories))
+		for _, mem := range list.Memories {
+			keys = append(keys, mem.Key)
+		}
+		return keys
+	}
+
+	t.Run("filters", func(t *testing.T) {
+		list, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{KeyPrefix: "user_preference_"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_preference_coffee", "user_preference_music", "user_preference_tea"}, keysOf(list))
+		assert.Empty(t, list.NextCursor)
+
+		list, err = store.List(ctx, memory.DefaultNamespace, memory.ListOptions{Tags: []string{"preferences"}, Source: memory.MemorySourceUser})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_preference_coffee", "user_preference_tea"}, keysOf(list))
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		list, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{SortBy: memory.ListSortByImportance, Descending: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_name_full", "user_preference_tea", "user_preference_coffee", "user_preference_music", "project_deadline"}, keysOf(list))
+
+		list, err = store.List(ctx, memory.DefaultNamespace, memory.ListOptions{SortBy: memory.ListSortByCreatedAt})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_preference_coffee", "user_preference_tea", "user_name_full", "project_deadline", "user_preference_music"}, keysOf(list))
+
+		_, err = store.List(ctx, memory.DefaultNamespace, memory.ListOptions{SortBy: "value"})
+		require.Error(t, err)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		opts := memory.ListOptions{SortBy: memory.ListSortByImportance, Limit: 2}
+
+		var keys []string
+		pages := 0
+		for {
+			list, err := store.List(ctx, memory.DefaultNamespace, opts)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(list.Memories), 2)
+			keys = append(keys, keysOf(list)...)
+			pages++
+			if list.NextCursor == "" {
+				break
+			}
+			opts.Cursor = list.NextCursor
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, []string{"project_deadline", "user_preference_music", "user_preference_coffee", "user_preference_tea", "user_name_full"}, keys)
+
+		_, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{Cursor: "not a cursor"})
+		require.Error(t, err)
+	})
+}
+
 func TestInMemoryStore_Delete(t *testing.T) {
 	store := memory.NewInMemoryStore()
 	ctx := t.Context()
 
 	// Test deleting non-existent key (should not error)
-	err := store.Delete(ctx, "non-existent")
+	err := store.Delete(ctx, memory.DefaultNamespace, "non-existent")
 	assert.NoError(t, err, "Delete should not error on non-existent key")
 
 	// Add a memory
@@ -206,15 +298,15 @@ func TestInMemoryStore_Delete(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify it exists
-	_, err = store.Get(ctx, "delete-me")
+	_, err = store.Get(ctx, memory.DefaultNamespace, "delete-me")
 	require.NoError(t, err, "Memory should exist before deletion")
 
 	// Delete it
-	err = store.Delete(ctx, "delete-me")
+	err = store.Delete(ctx, memory.DefaultNamespace, "delete-me")
 	require.NoError(t, err, "Delete should not return error")
 
 	// Verify it's gone
-	_, err = store.Get(ctx, "delete-me")
+	_, err = store.Get(ctx, memory.DefaultNamespace, "delete-me")
 	assert.Error(t, err, "Memory should not exist after deletion")
 	assert.Contains(t, err.Error(), "not found")
 }
@@ -244,7 +336,7 @@ func TestInMemoryStore_ConcurrentAccess(t *testing.T) {
 	go func() {
 		defer func() { done <- true }()
 		for i := 0; i < 50; i++ {
-			_, err := store.List(ctx)
+			_, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{})
 			assert.NoError(t, err)
 		}
 	}()
@@ -254,11 +346,72 @@ func TestInMemoryStore_ConcurrentAccess(t *testing.T) {
 	<-done
 
 	// Verify final state
-	memories, err := store.List(ctx)
+	list, err := store.List(ctx, memory.DefaultNamespace, memory.ListOptions{})
 	require.NoError(t, err)
+	memories := list.Memories
 	assert.Len(t, memories, 100, "All memories should be stored")
 }
 
+func TestInMemoryStore_Namespaces(t *testing.T) {
+	store := memory.NewInMemoryStore()
+	ctx := t.Context()
+
+	alice := memory.Scope{UserID: "alice", AgentName: "assistant"}.Namespace(false)
+	bob := memory.Scope{UserID: "bob", AgentName: "assistant"}.Namespace(false)
+
+	// The same key can exist independently in different namespaces
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:       "user_name_full",
+		Value:     "Alice",
+		Namespace: alice,
+		Embedding: []float32{1.0, 0.0},
+	}))
+	require.NoError(t, store.Set(ctx, &memory.Memory{
+		Key:       "user_name_full",
+		Value:     "Bob",
+		Namespace: bob,
+		Embedding: []float32{0.0, 1.0},
+	}))
+
+	stored, err := store.Get(ctx, alice, "user_name_full")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", stored.Value)
+
+	stored, err = store.Get(ctx, bob, "user_name_full")
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", stored.Value)
+
+	// Memories are not visible outside their namespace
+	_, err = store.Get(ctx, memory.DefaultNamespace, "user_name_full")
+	assert.Error(t, err)
+
+	results, err := store.Search(ctx, alice, "name", []float32{0.0, 1.0}, 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Alice", results[0].Memory.Value)
+
+	namespaces, err := store.ListNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{alice, bob}, namespaces)
+
+	// Deleting a namespace leaves the others untouched
+	require.NoError(t, store.DeleteNamespace(ctx, alice))
+
+	list, err := store.List(ctx, alice, memory.ListOptions{})
+	require.NoError(t, err)
+	memories := list.Memories
+	assert.Empty(t, memories)
+
+	list, err = store.List(ctx, bob, memory.ListOptions{})
+	require.NoError(t, err)
+	memories = list.Memories
+	assert.Len(t, memories, 1)
+
+	namespaces, err = store.ListNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob}, namespaces)
+}
+
 func TestInMemoryStore_SearchScoring(t *testing.T) {
 	store := memory.NewInMemoryStore()
 	ctx := t.Context()
@@ -291,7 +444,7 @@ func TestInMemoryStore_SearchScoring(t *testing.T) {
 	}
 
 	queryEmbedding := []float32{1.0, 0.0}
-	results, err := store.Search(ctx, "test", queryEmbedding, 10)
+	results, err := store.Search(ctx, memory.DefaultNamespace, "test", queryEmbedding, 10, memory.SearchOptions{})
 	require.NoError(t, err)
 	require.Len(t, results, 3)
 
@@ -306,11 +459,73 @@ func TestInMemoryStore_SearchScoring(t *testing.T) {
 		assert.LessOrEqual(t, result.Score, 1.0, "Score should be <= 1")
 	}
 
-	// Identical vector should have highest score (close to 1.0)
-	assert.Greater(t, results[0].Score, 0.9, "Identical vector should have high score")
+	// Identical vector should have highest similarity (close to 1.0)
+	assert.Greater(t, results[0].VectorScore, 0.9, "Identical vector should have high similarity")
+
+	// Opposite vector should have lowest similarity (close to 0.0)
+	assert.Less(t, results[2].VectorScore, 0.1, "Opposite vector should have low similarity")
+
+	// Without keyword matches, the first of the vector ranking scores 0.5 like
+	// in any other search where only one ranking found it
+	assert.InDelta(t, 0.5, results[0].Score, 1e-9)
+}
+
+func TestInMemoryStore_SearchHybrid(t *testing.T) {
+	store := memory.NewInMemoryStore()
+	ctx := t.Context()
+
+	for _, mem := range []*memory.Memory{
+		{Key: "user_preference_coffee", Value: "Dark roast with oat milk", Source: memory.MemorySourceUser, Tags: []string{"preferences"}, Embedding: []float32{1.0, 0.0}},
+		{Key: "user_location_city", Value: "Lives in Seoul", Source: memory.MemorySourceUser, Tags: []string{"personal"}, Embedding: []float32{0.0, 1.0}},
+		{Key: "project_status_current", Value: "Migration to Seoul region finished", Source: memory.MemorySourceAgent, Tags: []string{"work"}, Embedding: []float32{0.7, 0.7}},
+	} {
+		require.NoError(t, store.Set(ctx, mem))
+	}
+
+	// The embedding favors the coffee memory, but only the others mention Seoul
+	results, err := store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0}, 10, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "user_preference_coffee", results[2].Memory.Key)
+	assert.Greater(t, results[0].KeywordScore, 0.0)
+	assert.Greater(t, results[0].VectorScore, 0.0)
+	assert.Zero(t, results[2].KeywordScore)
+	for _, result := range results {
+		assert.GreaterOrEqual(t, result.Score, 0.0)
+		assert.LessOrEqual(t, result.Score, 1.0)
+	}
+
+	// An exact key match is pinned to the top
+	results, err = store.Search(ctx, memory.DefaultNamespace, "user_location_city", []float32{1.0, 0.0}, 1, memory.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "user_location_city", results[0].Memory.Key)
+	assert.Equal(t, 1.0, results[0].Score)
+
+	// Tag and source filters
+	results, err = store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0}, 10, memory.SearchOptions{Tags: []string{"personal", "preferences"}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.NotEqual(t, "project_status_current", result.Memory.Key)
+	}
+
+	results, err = store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0}, 10, memory.SearchOptions{Source: memory.MemorySourceAgent})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "project_status_current", results[0].Memory.Key)
 
-	// Opposite vector should have lowest score (close to 0.0)
-	assert.Less(t, results[2].Score, 0.1, "Opposite vector should have low score")
+	_, err = store.Search(ctx, memory.DefaultNamespace, "Seoul", []float32{1.0, 0.0}, 10, memory.SearchOptions{Tags: []string{"unknown"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no memories found")
+
+	// Minimum score cutoff
+	results, err = store.Search(ctx, memory.DefaultNamespace, "coffee", []float32{0.0, 1.0}, 10, memory.SearchOptions{MinScore: 0.75})
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.GreaterOrEqual(t, result.Score, 0.75)
+	}
+	assert.Less(t, len(results), 3)
 }
 
 func TestInMemoryStore_SearchWithGenkitEmbeddings_Live(t *testing.T) {
@@ -375,7 +590,7 @@ func TestInMemoryStore_SearchWithGenkitEmbeddings_Live(t *testing.T) {
 	require.Len(t, queryEmbedding.Embeddings, 1, "Should have one query embedding")
 
 	// Perform search
-	results, err := store.Search(ctx, queryText, queryEmbedding.Embeddings[0].Embedding, 3)
+	results, err := store.Search(ctx, memory.DefaultNamespace, queryText, queryEmbedding.Embeddings[0].Embedding, 3, memory.SearchOptions{})
 	require.NoError(t, err, "Search should not fail")
 	require.Len(t, results, 3, "Should return top 3 results")
 
@@ -404,7 +619,7 @@ func TestInMemoryStore_SearchWithGenkitEmbeddings_Live(t *testing.T) {
 	dogQueryEmbedding, err := ai.Embed(ctx, embedder, ai.WithTextDocs(dogQueryText))
 	require.NoError(t, err, "Failed to generate dog query embedding")
 
-	dogResults, err := store.Search(ctx, dogQueryText, dogQueryEmbedding.Embeddings[0].Embedding, 3)
+	dogResults, err := store.Search(ctx, memory.DefaultNamespace, dogQueryText, dogQueryEmbedding.Embeddings[0].Embedding, 3, memory.SearchOptions{})
 	require.NoError(t, err, "Dog search should not fail")
 
 	// The top result should be about dogs
@@ -13,6 +13,7 @@ type (
 	}
 	CallDataStore struct {
 		callData []CallData
+		sources  []Source
 	}
 	callDataStoreContextKeyType string
 )
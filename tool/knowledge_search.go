@@ -2,63 +2,80 @@ package tool
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
 )
 
-type Knowledge struct {
-	ai.Media `json:",inline"`
-	Score    float64 `json:"score,omitempty" jsonschema:"description=Score of the search result"`
-	Context  string  `json:"context,omitempty" jsonschema:"description=Text of the search result"`
-}
-
-func (m *manager) registerKnowledgeSearchTool(skill *entity.NativeAgentSkill) error {
-	allowedKnowledgeIds, ok := skill.Env["knowledge_ids"].([]string)
-	if !ok {
-		allowedKnowledgeIds = nil
+type (
+	Knowledge struct {
+		ai.Media `json:",inline"`
+		Ref      string  `json:"ref,omitempty" jsonschema:"description=Reference number to cite the result with, e.g. [1]"`
+		Score    float64 `json:"score,omitempty" jsonschema:"description=Score of the search result"`
+		Context  string  `json:"context,omitempty" jsonschema:"description=Text of the search result, or of the page an image result shows"`
 	}
 
-	return registerNativeTool(
-		m,
-		"knowledge_search",
-		`Search through the external knowledge base to find relevant information, documents, and context.
-
-This tool provides semantic search capabilities across stored knowledge including:
-- Previously saved documents, notes, and information
-- Context from past conversations and interactions
-- Domain-specific knowledge and reference materials
-- User preferences, patterns, and historical data
+	// KnowledgeFilter is a condition of knowledge_search on a metadata field
+	KnowledgeFilter struct {
+		Field  string `json:"field" jsonschema:"description=The metadata field to filter on"`
+		Eq     any    `json:"eq,omitempty" jsonschema:"description=Keep results whose field equals this string, number or boolean"`
+		In     []any  `json:"in,omitempty" jsonschema:"description=Keep results whose field equals one of these values"`
+		Gt     any    `json:"gt,omitempty" jsonschema:"description=Keep results whose field is greater than this number or string"`
+		Gte    any    `json:"gte,omitempty" jsonschema:"description=Keep results whose field is greater than or equal to this number or string"`
+		Lt     any    `json:"lt,omitempty" jsonschema:"description=Keep results whose field is less than this number or string"`
+		Lte    any    `json:"lte,omitempty" jsonschema:"description=Keep results whose field is less than or equal to this number or string"`
+		Exists *bool  `json:"exists,omitempty" jsonschema:"description=Keep results where the field is set (true) or not set (false)"`
+	}
 
-When to use this tool:
-- When asked about information that might be stored in the knowledge base
-- To retrieve context from previous conversations or saved documents
-- When you need background information before answering a question
-- To verify facts or find supporting evidence from stored knowledge
-- When the user references something from the past ("as we discussed", "like last time", etc.)
+	// knowledgeSearchEnv is the configuration of the knowledge_search skill
+	knowledgeSearchEnv struct {
+		// KnowledgeIds limits the search to these knowledge IDs
+		KnowledgeIds []string `mapstructure:"knowledge_ids"`
+		// FilterFields are the metadata fields the agent may filter on. Without them
+		// the agent cannot filter.
+		FilterFields []string `mapstructure:"filter_fields"`
+		// Filter is applied to every search in addition to the agent's filters
+		Filter *knowledge.Filter `mapstructure:"filter"`
+	}
+)
 
-How to use:
-- Provide a clear, specific search query as input
-- Use keywords and phrases that describe what you're looking for
-- Consider multiple search attempts with different phrasings if initial results are insufficient
-- The tool returns relevant excerpts with metadata about the source
+func (m *manager) registerKnowledgeSearchTool(skill *entity.NativeAgentSkill) error {
+	var env knowledgeSearchEnv
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           &env,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := decoder.Decode(skill.Env); err != nil {
+		return errors.Wrapf(err, "invalid knowledge_search configuration")
+	}
+	if err := env.Filter.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid knowledge_search filter")
+	}
 
-Response structure:
-- Results: Array of matching knowledge items with content and metadata
-- Count: Number of results returned (may be less than limit if fewer matches found)
-- Error: Error message if the search fails (e.g., connection issues, invalid query)
+	description := knowledgeSearchDescription
+	if len(env.FilterFields) > 0 {
+		description += fmt.Sprintf(`
 
-Error handling:
-- If an error occurs, the Error field will contain the error message
-- Common errors: database connection issues, invalid query format, service unavailable
-- When an error occurs, try rephrasing the query or waiting before retry
-- The tool will still return a response (not throw an error) to allow graceful handling
+Results can be narrowed with filters on these metadata fields: %s. All filters must hold.`, strings.Join(env.FilterFields, ", "))
+	}
 
-The search uses semantic similarity, so exact keyword matches are not required. Results are ranked by relevance and include context about when and where the information was stored.`,
+	if err := registerNativeTool(
+		m,
+		"knowledge_search",
+		description,
 		skill,
 		func(ctx *Context, input struct {
-			Query string `json:"query" jsonschema:"description=The search query to find relevant information"`
-			Limit *int   `json:"limit,omitempty" jsonschema:"description=The maximum number of results to return,default=5"`
+			Query   string            `json:"query" jsonschema:"description=The search query to find relevant information"`
+			Limit   *int              `json:"limit,omitempty" jsonschema:"description=The maximum number of results to return,default=5"`
+			Filters []KnowledgeFilter `json:"filters,omitempty" jsonschema:"description=Optional conditions on metadata fields that every result must meet"`
 		}) (reply struct {
 			Output []Knowledge `json:"output,omitempty" jsonschema:"description=List of search results with relevant knowledge"`
 			Error  string      `json:"error,omitempty" jsonschema:"description=Error message if the search fails"`
@@ -69,8 +86,14 @@ The search uses semantic similarity, so exact keyword matches are not required.
 				limit = *input.Limit
 			}
 
+			filter, err := env.filter(input.Filters)
+			if err != nil {
+				reply.Error = err.Error()
+				return reply, nil
+			}
+
 			// Retrieve relevant knowledge
-			results, err := m.knowledgeService.RetrieveRelevantKnowledge(ctx, input.Query, limit, allowedKnowledgeIds)
+			results, err := m.knowledgeService.RetrieveRelevantKnowledge(ctx, input.Query, limit, env.KnowledgeIds, knowledge.WithFilter(filter))
 			if err != nil {
 				reply.Error = err.Error()
 				return reply, nil
@@ -79,15 +102,19 @@ The search uses semantic similarity, so exact keyword matches are not required.
 			// Clean up embedding data to reduce response size
 			for _, res := range results {
 				k := Knowledge{
+					Ref:   AddSource(ctx, res.Document).Ref,
 					Score: float64(res.Score),
 				}
-				switch res.Content.MIMEType {
-				case "image/jpeg", "image/png", "image/jpg", "image/webp":
+				switch res.Content.Type() {
+				case knowledge.ContentTypeImage:
+					// Images are returned as data URLs, which model plugins pass
+					// to the model as media parts, with the text of PDF pages
 					k.Media = ai.Media{
 						ContentType: res.Content.MIMEType,
-						Url:         res.Content.Image,
+						Url:         res.Content.DataURL(),
 					}
-				case "text/plain", "plain/text":
+					k.Context = res.EmbeddingText
+				case knowledge.ContentTypeText:
 					k.Context = res.Content.Text
 				default:
 					return reply, fmt.Errorf("unknown content type: %s", res.Content.MIMEType)
@@ -97,5 +124,86 @@ The search uses semantic similarity, so exact keyword matches are not required.
 
 			return
 		},
-	)
+	); err != nil {
+		return err
+	}
+
+	m.usagePrompts[skill.Name] = knowledgeSearchUsagePrompt
+	return nil
 }
+
+// filter combines the configured filter with the agent's filters, which may only
+// use the configured filter fields
+func (e *knowledgeSearchEnv) filter(filters []KnowledgeFilter) (*knowledge.Filter, error) {
+	combined := &knowledge.Filter{}
+	if e.Filter != nil {
+		combined.And = append(combined.And, e.Filter)
+	}
+
+	for _, f := range filters {
+		if !slices.Contains(e.FilterFields, f.Field) {
+			if len(e.FilterFields) == 0 {
+				return nil, errors.New("filters are not enabled for knowledge_search")
+			}
+			return nil, errors.Errorf("cannot filter on field %q, allowed fields: %s", f.Field, strings.Join(e.FilterFields, ", "))
+		}
+		combined.And = append(combined.And, &knowledge.Filter{
+			Field:  f.Field,
+			Eq:     f.Eq,
+			In:     f.In,
+			Gt:     f.Gt,
+			Gte:    f.Gte,
+			Lt:     f.Lt,
+			Lte:    f.Lte,
+			Exists: f.Exists,
+		})
+	}
+
+	if err := combined.Validate(); err != nil {
+		return nil, err
+	}
+	return combined, nil
+}
+
+const knowledgeSearchDescription = `Search through the external knowledge base to find relevant information, documents, and context.
+
+This tool provides semantic search capabilities across stored knowledge including:
+- Previously saved documents, notes, and information
+- Context from past conversations and interactions
+- Domain-specific knowledge and reference materials
+- User preferences, patterns, and historical data
+
+When to use this tool:
+- When asked about information that might be stored in the knowledge base
+- To retrieve context from previous conversations or saved documents
+- When you need background information before answering a question
+- To verify facts or find supporting evidence from stored knowledge
+- When the user references something from the past ("as we discussed", "like last time", etc.)
+
+How to use:
+- Provide a clear, specific search query as input
+- Use keywords and phrases that describe what you're looking for
+- Consider multiple search attempts with different phrasings if initial results are insufficient
+- The tool returns relevant excerpts with metadata about the source
+
+Response structure:
+- Output: Array of matching knowledge items with a reference number, score and context
+- Error: Error message if the search fails (e.g., connection issues, invalid query)
+
+Error handling:
+- If an error occurs, the Error field will contain the error message
+- Common errors: database connection issues, invalid query format, service unavailable
+- When an error occurs, try rephrasing the query or waiting before retry
+- The tool will still return a response (not throw an error) to allow graceful handling
+
+The search uses semantic similarity, so exact keyword matches are not required. Results are ranked by relevance and include context about when and where the information was stored.`
+
+const knowledgeSearchUsagePrompt = `<tool:knowledge_search_instructions>
+# Citing Knowledge
+
+Every knowledge_search result has a reference number in its 'ref' field. When a sentence of your answer uses information from search results, put their reference numbers in square brackets right after the claim, before the period:
+- One source: "The shop opens at 9am [1]."
+- Several sources: "Repairs take two days [1][3]."
+
+Only cite reference numbers returned by knowledge_search, never invent them, and do not cite claims that do not come from the results. Information from anywhere else, such as the instructions or the conversation, has no reference number and is not cited. Do not add a list of references at the end of your answer.
+</tool:knowledge_search_instructions>`
@@ -0,0 +1,84 @@
+package tool_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnowledgeSearch_Sources(t *testing.T) {
+	ctx := t.Context()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hours.md"), []byte("# Hours\n\nThe shop opens at 9am."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repairs.md"), []byte("# Repairs\n\nBicycle repairs take two days."), 0o644))
+	paths, err := knowledge.ResolvePaths(dir)
+	require.NoError(t, err)
+
+	conf := config.NewKnowledgeConfig()
+	conf.EmbeddingProvider = knowledge.EmbeddingProviderFake
+	conf.RerankEnabled = false
+	conf.SqliteEnabled = false
+	knowledgeService, err := knowledge.NewService(ctx, &config.ModelConfig{}, conf, logger)
+	require.NoError(t, err)
+	defer knowledgeService.Close()
+	_, err = knowledgeService.IndexKnowledgeFromFiles(ctx, "shop", paths, knowledge.LoaderOptions{})
+	require.NoError(t, err)
+
+	g, err := genkit.NewGenkit(ctx, nil, logger, false)
+	require.NoError(t, err)
+	skill := entity.AgentSkillUnion{
+		Type:     "nativeTool",
+		OfNative: &entity.NativeAgentSkill{Name: "knowledge_search"},
+	}
+	toolManager, err := tool.NewToolManager(ctx, []entity.AgentSkillUnion{skill}, logger, g, knowledgeService, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	assert.Contains(t, toolManager.GetUsagePrompt(skill), "<tool:knowledge_search_instructions>")
+
+	search := func(query string, limit int) []tool.Knowledge {
+		out, err := toolManager.GetTool("knowledge_search").RunRaw(ctx, map[string]any{"query": query, "limit": limit})
+		require.NoError(t, err)
+		data, err := json.Marshal(out)
+		require.NoError(t, err)
+		var reply struct {
+			Output []tool.Knowledge `json:"output"`
+		}
+		require.NoError(t, json.Unmarshal(data, &reply))
+		return reply.Output
+	}
+
+	ctx = tool.WithEmptyCallDataStore(ctx)
+	results := search("shop opens 9am", 1)
+	require.Len(t, results, 1)
+	assert.Equal(t, "1", results[0].Ref)
+
+	// Documents found again keep their refs
+	results = search("bicycle repairs take two days", 2)
+	require.Len(t, results, 2)
+	refs := map[string]string{}
+	for _, result := range results {
+		refs[result.Context] = result.Ref
+	}
+	assert.ElementsMatch(t, []string{"1", "2"}, []string{results[0].Ref, results[1].Ref})
+
+	sources := tool.GetSources(ctx)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "1", sources[0].Ref)
+	assert.Equal(t, "hours.md", sources[0].Filename)
+	assert.Equal(t, "2", sources[1].Ref)
+	assert.Equal(t, "repairs.md", sources[1].Filename)
+	assert.Equal(t, sources[1].Ref, refs[sources[1].Text])
+}
@@ -1,14 +1,21 @@
 package tool
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/memory"
 	"github.com/mokiat/gog"
+	"github.com/pkg/errors"
 )
 
 func (m *manager) registerMemorySKill(skill *entity.NativeAgentSkill) error {
+	if m.memoryService == nil {
+		return errors.New("memory service is not available")
+	}
+
 	// Remember tool
 	if err := registerNativeTool(
 		m,
@@ -24,24 +31,38 @@ func (m *manager) registerMemorySKill(skill *entity.NativeAgentSkill) error {
 **Key format**: category_subcategory_detail  
 Examples: user_name_full, user_preference_coffee, project_requirements_2024
 
+**Importance**: 0.9+ for core identity facts, 0.5 for ordinary facts, 0.2 for passing details  
+**TTL**: set for temporary facts (*"I'm in Tokyo this week"* → 168h)
+
 **IMPORTANT**: Always inform user when storing their information`,
 		skill,
 		func(ctx *Context, req struct {
-			Key    string   `json:"key" jsonschema:"required,description=Unique identifier using format: category_subcategory_detail (e.g. user_name_full, user_preference_coffee, project_requirements_2024)"`
-			Memory string   `json:"memory" jsonschema:"required,description=The information to store - be specific and descriptive (e.g. 'Prefers dark roast coffee with oat milk, no sugar')"`
-			Tags   []string `json:"tags,omitempty" jsonschema:"description=Optional categorization tags (e.g. ['personal', 'preferences'], ['work', 'decisions'], ['goals'])"`
+			Key        string   `json:"key" jsonschema:"required,description=Unique identifier using format: category_subcategory_detail (e.g. user_name_full, user_preference_coffee, project_requirements_2024)"`
+			Memory     string   `json:"memory" jsonschema:"required,description=The information to store - be specific and descriptive (e.g. 'Prefers dark roast coffee with oat milk, no sugar')"`
+			Tags       []string `json:"tags,omitempty" jsonschema:"description=Optional categorization tags (e.g. ['personal', 'preferences'], ['work', 'decisions'], ['goals'])"`
+			Importance *float64 `json:"importance,omitempty" jsonschema:"description=Optional importance from 0 to 1 (default: 0.5). Important memories rank higher in search and are kept longer."`
+			TTL        *string  `json:"ttl,omitempty" jsonschema:"description=Optional lifetime for temporary information as a duration (e.g. '24h', '168h'). The memory expires afterwards."`
 		}) (resp struct {
-			Memory *memory.Memory `json:"memory,omitempty" jsonschema:"description=Successfully stored memory object with key, value, source, tags, and timestamp"`
+			Memory *memory.Memory `json:"memory,omitempty" jsonschema:"description=Successfully stored memory object with key, value, source, tags, importance and timestamps"`
 			Error  *string        `json:"error,omitempty" jsonschema:"description=Error message if storage failed (e.g. invalid key format, duplicate key, storage error)"`
 		}, globalErr error) {
 			input := memory.RememberInput{
-				Key:    req.Key,
-				Value:  req.Memory,
-				Source: memory.MemorySourceAgent,
-				Tags:   req.Tags,
+				Key:        req.Key,
+				Value:      req.Memory,
+				Source:     memory.MemorySourceAgent,
+				Tags:       req.Tags,
+				Importance: req.Importance,
+			}
+			if req.TTL != nil {
+				ttl, err := time.ParseDuration(*req.TTL)
+				if err != nil {
+					resp.Error = gog.PtrOf("invalid ttl: " + err.Error())
+					return resp, nil
+				}
+				input.TTL = ttl
 			}
 
-			memory, err := m.memoryService.RememberMemory(ctx, input)
+			memory, err := m.memoryService.RememberMemory(memoryToolContext(ctx, "remember_memory"), input)
 			if err != nil {
 				resp.Error = gog.PtrOf(err.Error())
 				return resp, nil
@@ -58,7 +79,7 @@ Examples: user_name_full, user_preference_coffee, project_requirements_2024
 	if err := registerNativeTool(
 		m,
 		"search_memory",
-		`Find relevant memories using **semantic search** with natural language queries.
+		`Find relevant memories using **hybrid search** (semantic + keyword) with natural language queries.
 
 **Perfect for** when you:
 - Start conversation → *find context about current topic*
@@ -66,15 +87,22 @@ Examples: user_name_full, user_preference_coffee, project_requirements_2024
 - Looking for patterns → *user preferences, past decisions*
 - Need discovery → *related information across memories*
 
-Uses **AI embeddings** to find conceptually related memories, not just keyword matches
+Combines **AI embeddings** (conceptually related memories) with **keyword matching** (exact names, keys and terms)
+
+**Narrow results** with tags, source (user or agent) and a minimum score
+
+**Scores** (0-1) fuse both rankings the same way for every query: about 1.0 for a memory ranked first by meaning and keywords, about 0.5 or less for one found by only one of them. Recency and importance shift them slightly.
 
 **Good queries**: "coffee preferences", "fitness goals", "work projects", "user background"`,
 		skill,
 		func(ctx *Context, req struct {
-			Query string `json:"query" jsonschema:"required,description=Natural language search query to find related memories (e.g. 'coffee preferences', 'fitness goals', 'work projects', 'user background')"`
-			Limit *int   `json:"limit,omitempty" jsonschema:"description=Maximum number of memories to return (optional parameter, 1-100 range, default: 20, recommended: 10-20 for most conversations)"`
+			Query    string   `json:"query" jsonschema:"required,description=Natural language search query to find related memories (e.g. 'coffee preferences', 'fitness goals', 'work projects', 'user background')"`
+			Limit    *int     `json:"limit,omitempty" jsonschema:"description=Maximum number of memories to return (optional parameter, 1-100 range, default: 20, recommended: 10-20 for most conversations)"`
+			Tags     []string `json:"tags,omitempty" jsonschema:"description=Only return memories having at least one of these tags (e.g. ['personal'], ['work', 'decisions'])"`
+			Source   *string  `json:"source,omitempty" jsonschema:"enum=user,enum=agent,description=Only return memories from this source"`
+			MinScore *float64 `json:"min_score,omitempty" jsonschema:"description=Drop memories scoring below this score (0-1, see Scores above), e.g. 0.6 to keep only memories matching in both meaning and keywords"`
 		}) (resp struct {
-			Memories []memory.ScoredMemory `json:"memories,omitempty" jsonschema:"description=Array of relevant memories ranked by similarity score (0-1, higher = more relevant)"`
+			Memories []memory.ScoredMemory `json:"memories,omitempty" jsonschema:"description=Array of relevant memories ranked by relevance score (0-1, higher = more relevant, 1.0 = ranked first by meaning and keywords)"`
 			Error    *string               `json:"error,omitempty" jsonschema:"description=Error message if search failed (e.g. no memories found, query too vague, search service error)"`
 		}, err error) {
 			limit := 20
@@ -82,7 +110,17 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 				limit = *req.Limit
 			}
 
-			memories, err := m.memoryService.SearchMemory(ctx, req.Query, limit)
+			opts := memory.SearchOptions{
+				Tags: req.Tags,
+			}
+			if req.Source != nil {
+				opts.Source = *req.Source
+			}
+			if req.MinScore != nil {
+				opts.MinScore = *req.MinScore
+			}
+
+			memories, err := m.memoryService.SearchMemory(ctx, req.Query, limit, opts)
 			if err != nil {
 				resp.Memories = make([]memory.ScoredMemory, 0, 1)
 				resp.Error = gog.PtrOf(err.Error())
@@ -100,7 +138,7 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 	if err := registerNativeTool(
 		m,
 		"list_memories",
-		`Get **complete overview** of all stored memories in the system.
+		`Browse stored memories **page by page**, optionally filtered.
 
 **Use this when**:
 - **First conversation** with user → *check what you know about them*
@@ -108,25 +146,61 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 - **Memory audit** → *what information has been stored*
 - **Search failed** → *no relevant results found*
 
-**Returns**: All memories with keys, values, sources, tags, and timestamps
+**Filter** by tags, source (user or agent) or key prefix (e.g. *user_preference_*)  
+**Sort** by key, created_at, updated_at or importance  
+**Paginate**: pass the returned next_cursor as cursor to get the next page; no next_cursor means the last page
 
-**CAUTION**: Returns ALL memories - use carefully if many memories exist`,
+**Returns**: Up to limit memories with keys, values, sources, tags, importance and timestamps`,
 		skill,
-		func(ctx *Context, req struct{}) (resp struct {
-			Memories []*memory.Memory `json:"memories,omitempty" jsonschema:"description=Complete list of all stored memories with full details (keys, values, sources, tags, timestamps)"`
-			Error    *string          `json:"error,omitempty" jsonschema:"description=Error message if listing failed (e.g. no memories exist, storage access error)"`
+		func(ctx *Context, req struct {
+			Tags      []string `json:"tags,omitempty" jsonschema:"description=Only return memories having at least one of these tags"`
+			Source    *string  `json:"source,omitempty" jsonschema:"enum=user,enum=agent,description=Only return memories from this source"`
+			KeyPrefix *string  `json:"key_prefix,omitempty" jsonschema:"description=Only return memories whose key starts with this prefix (e.g. user_preference_)"`
+			SortBy    *string  `json:"sort_by,omitempty" jsonschema:"enum=key,enum=created_at,enum=updated_at,enum=importance,description=Sort field (default: key)"`
+			Order     *string  `json:"order,omitempty" jsonschema:"enum=asc,enum=desc,description=Sort order (default: asc)"`
+			Cursor    *string  `json:"cursor,omitempty" jsonschema:"description=The next_cursor of the previous page to continue listing"`
+			Limit     *int     `json:"limit,omitempty" jsonschema:"description=Maximum number of memories to return (1-100 range, default: 20)"`
+		}) (resp struct {
+			Memories   []*memory.Memory `json:"memories,omitempty" jsonschema:"description=A page of stored memories with full details (keys, values, sources, tags, importance, timestamps)"`
+			NextCursor *string          `json:"next_cursor,omitempty" jsonschema:"description=Cursor for the next page. Absent on the last page"`
+			Error      *string          `json:"error,omitempty" jsonschema:"description=Error message if listing failed (e.g. invalid cursor, storage access error)"`
 		}, err error) {
-			memories, err := m.memoryService.ListMemories(ctx)
+			opts := memory.ListOptions{
+				Tags:  req.Tags,
+				Limit: 20,
+			}
+			if req.Source != nil {
+				opts.Source = *req.Source
+			}
+			if req.KeyPrefix != nil {
+				opts.KeyPrefix = *req.KeyPrefix
+			}
+			if req.SortBy != nil {
+				opts.SortBy = *req.SortBy
+			}
+			if req.Order != nil {
+				opts.Descending = strings.EqualFold(*req.Order, "desc")
+			}
+			if req.Cursor != nil {
+				opts.Cursor = *req.Cursor
+			}
+			if req.Limit != nil {
+				opts.Limit = min(max(*req.Limit, 1), 100)
+			}
+
+			list, err := m.memoryService.ListMemories(ctx, opts)
 			if err != nil {
 				resp.Error = gog.PtrOf(err.Error())
 				return resp, nil
 			}
 
-			if memories == nil {
-				memories = make([]*memory.Memory, 0, 1)
+			resp.Memories = list.Memories
+			if resp.Memories == nil {
+				resp.Memories = make([]*memory.Memory, 0, 1)
+			}
+			if list.NextCursor != "" {
+				resp.NextCursor = gog.PtrOf(list.NextCursor)
 			}
-
-			resp.Memories = memories
 			return resp, nil
 		},
 	); err != nil {
@@ -197,19 +271,30 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 - Project completed → update project_status_current`,
 		skill,
 		func(ctx *Context, req struct {
-			Key   string   `json:"key" jsonschema:"required,description=Exact memory key to update - must match existing stored key exactly (e.g. user_name_full, user_preference_coffee). Use search_memory if unsure of exact key."`
-			Value *string  `json:"value,omitempty" jsonschema:"description=New value to replace existing memory content. If not provided, only tags will be updated."`
-			Tags  []string `json:"tags,omitempty" jsonschema:"description=New tags to replace existing tags. If empty, tags will be cleared."`
+			Key        string   `json:"key" jsonschema:"required,description=Exact memory key to update - must match existing stored key exactly (e.g. user_name_full, user_preference_coffee). Use search_memory if unsure of exact key."`
+			Value      *string  `json:"value,omitempty" jsonschema:"description=New value to replace existing memory content. If not provided, only tags will be updated."`
+			Tags       []string `json:"tags,omitempty" jsonschema:"description=New tags to replace existing tags. If empty, tags will be cleared."`
+			Importance *float64 `json:"importance,omitempty" jsonschema:"description=New importance from 0 to 1. If not provided, importance is unchanged."`
+			TTL        *string  `json:"ttl,omitempty" jsonschema:"description=New lifetime from now as a duration (e.g. '24h'). Use '0s' to make the memory permanent. If not provided, expiry is unchanged."`
 		}) (resp struct {
 			Memory *memory.Memory `json:"memory,omitempty" jsonschema:"description=Updated memory object with new values (includes updated value, tags, source, timestamp)"`
 			Error  *string        `json:"error,omitempty" jsonschema:"description=Error message if update failed (e.g. key not found, invalid key format, update error)"`
 		}, err error) {
 			input := memory.UpdateMemoryInput{
-				Value: req.Value,
-				Tags:  req.Tags,
+				Value:      req.Value,
+				Tags:       req.Tags,
+				Importance: req.Importance,
+			}
+			if req.TTL != nil {
+				ttl, err := time.ParseDuration(*req.TTL)
+				if err != nil {
+					resp.Error = gog.PtrOf("invalid ttl: " + err.Error())
+					return resp, nil
+				}
+				input.TTL = &ttl
 			}
 
-			updatedMemory, err := m.memoryService.UpdateMemory(ctx, req.Key, input)
+			updatedMemory, err := m.memoryService.UpdateMemory(memoryToolContext(ctx, "update_memory"), req.Key, input)
 			if err != nil {
 				resp.Error = gog.PtrOf(err.Error())
 				return resp, nil
@@ -243,7 +328,7 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 			Success bool    `json:"success" jsonschema:"description=True if memory was successfully deleted, false otherwise"`
 			Error   *string `json:"error,omitempty" jsonschema:"description=Error message if deletion failed (e.g. key not found, invalid key format, access error)"`
 		}, err error) {
-			err = m.memoryService.DeleteMemory(ctx, req.Key)
+			err = m.memoryService.DeleteMemory(memoryToolContext(ctx, "delete_memory"), req.Key)
 			if err != nil {
 				resp.Error = gog.PtrOf(err.Error())
 				resp.Success = false
@@ -256,6 +341,79 @@ Uses **AI embeddings** to find conceptually related memories, not just keyword m
 		return err
 	}
 
+	// Recall episodes tool
+	if err := registerNativeTool(
+		m,
+		"recall_episodes",
+		`Search **past conversations** (episodes) across all threads with this user.
+
+Each episode summarizes a past thread with its time, participants and outcomes (decisions, agreements, action items).
+
+**Use this when**:
+- **User refers to a past conversation** → *"what did we decide last week about the launch?"*
+- **Continuing earlier work** → *"let's pick up where we left off"*
+- **Facts are not enough** → *you need what was discussed, not just what was stored*
+
+**Narrow results** with a participant or a time range (since/until)
+
+**If you need a specific fact** → use search_memory instead`,
+		skill,
+		func(ctx *Context, req struct {
+			Query       string   `json:"query" jsonschema:"required,description=What the past conversation was about (e.g. 'launch date decision', 'database migration plan')"`
+			Limit       *int     `json:"limit,omitempty" jsonschema:"description=Maximum number of episodes to return (1-20 range, default: 5)"`
+			Participant *string  `json:"participant,omitempty" jsonschema:"description=Only return episodes with this participant"`
+			Since       *string  `json:"since,omitempty" jsonschema:"description=Only return episodes that ended after this time (RFC 3339 like '2024-05-01T09:00:00Z' or a date like '2024-05-01')"`
+			Until       *string  `json:"until,omitempty" jsonschema:"description=Only return episodes that started before this time (RFC 3339 like '2024-05-08T18:00:00Z' or a date like '2024-05-08')"`
+			MinScore    *float64 `json:"min_score,omitempty" jsonschema:"description=Only return episodes with a relevance score of at least this value (0 to 1)"`
+		}) (resp struct {
+			Episodes []memory.ScoredEpisode `json:"episodes" jsonschema:"description=Past conversations ordered by relevance, with summary, participants, outcomes, time range and relevance score"`
+			Error    *string                `json:"error,omitempty" jsonschema:"description=Error message if the search failed (e.g. invalid time, search service error)"`
+		}, err error) {
+			resp.Episodes = make([]memory.ScoredEpisode, 0, 1)
+
+			limit := 5
+			if req.Limit != nil {
+				limit = min(max(*req.Limit, 1), 20)
+			}
+
+			var opts memory.EpisodeSearchOptions
+			if req.Participant != nil {
+				opts.Participant = *req.Participant
+			}
+			if req.MinScore != nil {
+				opts.MinScore = *req.MinScore
+			}
+			if req.Since != nil {
+				since, err := parseEpisodeTime(*req.Since)
+				if err != nil {
+					resp.Error = gog.PtrOf("invalid since: " + err.Error())
+					return resp, nil
+				}
+				opts.Since = &since
+			}
+			if req.Until != nil {
+				until, err := parseEpisodeTime(*req.Until)
+				if err != nil {
+					resp.Error = gog.PtrOf("invalid until: " + err.Error())
+					return resp, nil
+				}
+				opts.Until = &until
+			}
+
+			episodes, err := m.memoryService.RecallEpisodes(ctx, req.Query, limit, opts)
+			if err != nil {
+				resp.Error = gog.PtrOf(err.Error())
+				return resp, nil
+			}
+			if len(episodes) > 0 {
+				resp.Episodes = episodes
+			}
+			return resp, nil
+		},
+	); err != nil {
+		return err
+	}
+
 	m.usagePrompts[skill.Name] = strings.TrimSpace(`<tool:memory_instructions>
 # AI Agent Memory System - Complete Usage Guide
 
@@ -315,6 +473,9 @@ Use 'update_memory' RIGHT AWAY when user mentions changes:
 - YES → use 'recall_memory' with exact key
 - NO → use 'search_memory' with descriptive terms
 
+**Is it about a past conversation rather than a fact?**
+- YES → use 'recall_episodes' (e.g. "what did we decide last week about the launch?")
+
 **Information Status?**
 - NEW info → use 'remember_memory' to create
 - CHANGED info → use 'update_memory' to modify existing
@@ -408,3 +569,19 @@ When user changes subject → search_memory with new topic keywords → Surface
 
 	return nil
 }
+
+// parseEpisodeTime parses an RFC 3339 time or a date
+func parseEpisodeTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// memoryToolContext marks memory changes as made by the given tool, keeping the run of the caller
+func memoryToolContext(ctx context.Context, toolName string) context.Context {
+	actor := memory.ActorFromContext(ctx)
+	actor.Type = memory.ActorTool
+	actor.Name = toolName
+	return memory.WithActor(ctx, actor)
+}
@@ -0,0 +1,99 @@
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/habiliai/agentruntime/knowledge"
+)
+
+type (
+	// Source is a knowledge document retrieved during a run. The model cites it
+	// by putting its Ref in brackets after a claim, e.g. [1].
+	Source struct {
+		Ref        string `json:"ref"`
+		DocumentID string `json:"document_id"`
+		Title      string `json:"title,omitempty"`
+		URL        string `json:"url,omitempty"`
+		Filename   string `json:"filename,omitempty"`
+		PageNumber int    `json:"page_number,omitempty"`
+		// Text is the retrieved text of the document
+		Text string `json:"text,omitempty"`
+	}
+)
+
+// AddSource records a retrieved knowledge document as a source of the run in
+// the call data store of ctx and returns it with its ref. A document retrieved
+// again keeps its ref; documents without an ID are told apart by their source
+// and text. Without a call data store, the source gets no ref.
+func AddSource(ctx context.Context, doc *knowledge.Document) Source {
+	source := Source{
+		DocumentID: doc.ID,
+		Title:      metadataString(doc.Metadata, knowledge.MetadataKeySourceTitle),
+		URL:        metadataString(doc.Metadata, knowledge.MetadataKeySourceURL),
+		Filename:   metadataString(doc.Metadata, knowledge.MetadataKeySourceFilename),
+		Text:       doc.Content.Text,
+	}
+	if source.Text == "" {
+		source.Text = doc.EmbeddingText
+	}
+	switch page := doc.Metadata[knowledge.MetadataKeyPageNumber].(type) {
+	case int:
+		source.PageNumber = page
+	case float64:
+		source.PageNumber = int(page)
+	}
+
+	lockCallDataStoreContext.Lock()
+	defer lockCallDataStoreContext.Unlock()
+
+	store, ok := ctx.Value(callDataStoreContextKey).(*CallDataStore)
+	if !ok {
+		return source
+	}
+	identity := source.identity()
+	for _, existing := range store.sources {
+		if existing.identity() == identity {
+			return existing
+		}
+	}
+
+	source.Ref = strconv.Itoa(len(store.sources) + 1)
+	store.sources = append(store.sources, source)
+	return source
+}
+
+// GetSources returns the sources recorded in the call data store of ctx, in the
+// order of their refs
+func GetSources(ctx context.Context) []Source {
+	store, ok := ctx.Value(callDataStoreContextKey).(*CallDataStore)
+	if !ok {
+		return nil
+	}
+
+	lockCallDataStoreContext.Lock()
+	defer lockCallDataStoreContext.Unlock()
+
+	return append([]Source(nil), store.sources...)
+}
+
+// identity identifies the document of the source, by its ID or, without one,
+// by a hash of its source and text
+func (s Source) identity() string {
+	if s.DocumentID != "" {
+		return s.DocumentID
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		s.Title, s.URL, s.Filename, strconv.Itoa(s.PageNumber), s.Text,
+	}, "\x00")))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func metadataString(metadata map[string]any, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
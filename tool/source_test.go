@@ -0,0 +1,32 @@
+package tool_test
+
+import (
+	"testing"
+
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSource_WithoutID(t *testing.T) {
+	ctx := tool.WithEmptyCallDataStore(t.Context())
+
+	hours := &knowledge.Document{
+		Content:  knowledge.Content{Text: "The shop opens at 9am."},
+		Metadata: map[string]any{knowledge.MetadataKeySourceFilename: "hours.md"},
+	}
+	repairs := &knowledge.Document{
+		Content:  knowledge.Content{Text: "Bicycle repairs take two days."},
+		Metadata: map[string]any{knowledge.MetadataKeySourceFilename: "repairs.md"},
+	}
+
+	assert.Equal(t, "1", tool.AddSource(ctx, hours).Ref)
+	assert.Equal(t, "2", tool.AddSource(ctx, repairs).Ref)
+	assert.Equal(t, "1", tool.AddSource(ctx, hours).Ref)
+
+	sources := tool.GetSources(ctx)
+	if assert.Len(t, sources, 2) {
+		assert.Equal(t, "hours.md", sources[0].Filename)
+		assert.Equal(t, "repairs.md", sources[1].Filename)
+	}
+}